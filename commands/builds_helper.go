@@ -3,6 +3,7 @@ package commands
 import (
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 
@@ -69,6 +70,11 @@ type buildsHelper struct {
 	jobsTotal                 *prometheus.CounterVec
 	jobDurationHistogram      *prometheus.HistogramVec
 	jobQueueDurationHistogram *prometheus.HistogramVec
+
+	jobPeakMemoryHistogram *prometheus.HistogramVec
+	jobCPUSecondsHistogram *prometheus.HistogramVec
+	jobDiskIOHistogram     *prometheus.HistogramVec
+	jobNetworkIOHistogram  *prometheus.HistogramVec
 }
 
 func (b *buildsHelper) getRunnerCounter(runner *common.RunnerConfig) *runnerCounter {
@@ -208,6 +214,8 @@ func (b *buildsHelper) removeBuild(deleteBuild *common.Build) bool {
 		WithLabelValues(deleteBuild.Runner.ShortDescription(), deleteBuild.Runner.SystemIDState.GetSystemID()).
 		Observe(deleteBuild.Duration().Seconds())
 
+	b.observeResourceUsage(deleteBuild, deleteBuild.ResourceUsage())
+
 	for idx, build := range b.builds {
 		if build == deleteBuild {
 			b.builds = append(b.builds[0:idx], b.builds[idx+1:]...)
@@ -219,6 +227,31 @@ func (b *buildsHelper) removeBuild(deleteBuild *common.Build) bool {
 	return false
 }
 
+func (b *buildsHelper) observeResourceUsage(build *common.Build, usage *common.ResourceUsage) {
+	if usage == nil {
+		return
+	}
+
+	labels := []string{
+		build.Runner.ShortDescription(),
+		build.Runner.SystemIDState.GetSystemID(),
+		strconv.FormatInt(build.JobInfo.ProjectID, 10),
+	}
+
+	b.jobPeakMemoryHistogram.WithLabelValues(labels...).Observe(float64(usage.PeakMemoryBytes))
+	b.jobCPUSecondsHistogram.WithLabelValues(labels...).Observe(usage.CPUSeconds)
+
+	if usage.Disk != nil {
+		b.jobDiskIOHistogram.WithLabelValues(append(labels, "read")...).Observe(float64(usage.Disk.InBytes))
+		b.jobDiskIOHistogram.WithLabelValues(append(labels, "write")...).Observe(float64(usage.Disk.OutBytes))
+	}
+
+	if usage.Network != nil {
+		b.jobNetworkIOHistogram.WithLabelValues(append(labels, "receive")...).Observe(float64(usage.Network.InBytes))
+		b.jobNetworkIOHistogram.WithLabelValues(append(labels, "transmit")...).Observe(float64(usage.Network.OutBytes))
+	}
+}
+
 func (b *buildsHelper) buildsCount() int {
 	b.lock.Lock()
 	defer b.lock.Unlock()
@@ -274,6 +307,10 @@ func (b *buildsHelper) Describe(ch chan<- *prometheus.Desc) {
 	b.jobsTotal.Describe(ch)
 	b.jobDurationHistogram.Describe(ch)
 	b.jobQueueDurationHistogram.Describe(ch)
+	b.jobPeakMemoryHistogram.Describe(ch)
+	b.jobCPUSecondsHistogram.Describe(ch)
+	b.jobDiskIOHistogram.Describe(ch)
+	b.jobNetworkIOHistogram.Describe(ch)
 }
 
 // Collect implements prometheus.Collector.
@@ -314,6 +351,10 @@ func (b *buildsHelper) Collect(ch chan<- prometheus.Metric) {
 	b.jobsTotal.Collect(ch)
 	b.jobDurationHistogram.Collect(ch)
 	b.jobQueueDurationHistogram.Collect(ch)
+	b.jobPeakMemoryHistogram.Collect(ch)
+	b.jobCPUSecondsHistogram.Collect(ch)
+	b.jobDiskIOHistogram.Collect(ch)
+	b.jobNetworkIOHistogram.Collect(ch)
 }
 
 func (b *buildsHelper) ListJobsHandler(w http.ResponseWriter, r *http.Request) {
@@ -362,5 +403,37 @@ func newBuildsHelper() buildsHelper {
 			},
 			[]string{"runner", "system_id", "project_jobs_running"},
 		),
+		jobPeakMemoryHistogram: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "gitlab_runner_job_peak_memory_bytes",
+				Help:    "Histogram of the peak memory usage of jobs",
+				Buckets: prometheus.ExponentialBuckets(16*1024*1024, 2, 10),
+			},
+			[]string{"runner", "system_id", "project"},
+		),
+		jobCPUSecondsHistogram: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "gitlab_runner_job_cpu_seconds",
+				Help:    "Histogram of the CPU time consumed by jobs",
+				Buckets: []float64{1, 5, 15, 30, 60, 300, 600, 1800, 3600, 7200},
+			},
+			[]string{"runner", "system_id", "project"},
+		),
+		jobDiskIOHistogram: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "gitlab_runner_job_disk_io_bytes",
+				Help:    "Histogram of the number of bytes read from and written to disk by jobs",
+				Buckets: prometheus.ExponentialBuckets(1024*1024, 4, 10),
+			},
+			[]string{"runner", "system_id", "project", "direction"},
+		),
+		jobNetworkIOHistogram: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "gitlab_runner_job_network_io_bytes",
+				Help:    "Histogram of the number of bytes received and transmitted over the network by jobs",
+				Buckets: prometheus.ExponentialBuckets(1024*1024, 4, 10),
+			},
+			[]string{"runner", "system_id", "project", "direction"},
+		),
 	}
 }
@@ -6,8 +6,10 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -205,6 +207,52 @@ func TestBuildsHelper_ListJobsHandler(t *testing.T) {
 	}
 }
 
+func TestBuildsHelper_observeResourceUsage(t *testing.T) {
+	build := &common.Build{
+		JobResponse: common.JobResponse{
+			JobInfo: common.JobInfo{ProjectID: 42},
+		},
+		Runner: &common.RunnerConfig{
+			RunnerCredentials: common.RunnerCredentials{Token: "a1b2c3d4e5"},
+			SystemIDState:     common.NewSystemIDState(),
+		},
+	}
+
+	b := newBuildsHelper()
+	b.observeResourceUsage(build, nil)
+	assert.Zero(t, testutil.CollectAndCount(b.jobPeakMemoryHistogram))
+
+	b.observeResourceUsage(build, &common.ResourceUsage{
+		PeakMemoryBytes: 100 * 1024 * 1024,
+		CPUSeconds:      10,
+		Network:         &common.ResourceUsageIO{InBytes: 1024, OutBytes: 2048},
+	})
+
+	assert.Equal(t, 1, testutil.CollectAndCount(b.jobPeakMemoryHistogram))
+	assert.Equal(t, 1, testutil.CollectAndCount(b.jobCPUSecondsHistogram))
+	assert.Equal(t, 0, testutil.CollectAndCount(b.jobDiskIOHistogram))
+	assert.Equal(t, 2, testutil.CollectAndCount(b.jobNetworkIOHistogram))
+
+	expected := `
+# HELP gitlab_runner_job_cpu_seconds Histogram of the CPU time consumed by jobs
+# TYPE gitlab_runner_job_cpu_seconds histogram
+gitlab_runner_job_cpu_seconds_bucket{project="42",runner="a1b2c3d4",system_id="",le="1"} 0
+gitlab_runner_job_cpu_seconds_bucket{project="42",runner="a1b2c3d4",system_id="",le="5"} 0
+gitlab_runner_job_cpu_seconds_bucket{project="42",runner="a1b2c3d4",system_id="",le="15"} 1
+gitlab_runner_job_cpu_seconds_bucket{project="42",runner="a1b2c3d4",system_id="",le="30"} 1
+gitlab_runner_job_cpu_seconds_bucket{project="42",runner="a1b2c3d4",system_id="",le="60"} 1
+gitlab_runner_job_cpu_seconds_bucket{project="42",runner="a1b2c3d4",system_id="",le="300"} 1
+gitlab_runner_job_cpu_seconds_bucket{project="42",runner="a1b2c3d4",system_id="",le="600"} 1
+gitlab_runner_job_cpu_seconds_bucket{project="42",runner="a1b2c3d4",system_id="",le="1800"} 1
+gitlab_runner_job_cpu_seconds_bucket{project="42",runner="a1b2c3d4",system_id="",le="3600"} 1
+gitlab_runner_job_cpu_seconds_bucket{project="42",runner="a1b2c3d4",system_id="",le="7200"} 1
+gitlab_runner_job_cpu_seconds_bucket{project="42",runner="a1b2c3d4",system_id="",le="+Inf"} 1
+gitlab_runner_job_cpu_seconds_sum{project="42",runner="a1b2c3d4",system_id=""} 10
+gitlab_runner_job_cpu_seconds_count{project="42",runner="a1b2c3d4",system_id=""} 1
+`
+	assert.NoError(t, testutil.CollectAndCompare(b.jobCPUSecondsHistogram, strings.NewReader(expected)))
+}
+
 func TestRestrictHTTPMethods(t *testing.T) {
 	tests := map[string]int{
 		http.MethodGet:  http.StatusOK,
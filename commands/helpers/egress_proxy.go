@@ -0,0 +1,45 @@
+package helpers
+
+import (
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/egress"
+)
+
+type EgressProxyCommand struct {
+	Listen       string   `long:"listen" description:"The address the proxy listens on"`
+	AllowedCIDRs []string `long:"allowed-cidr" description:"CIDR the jobs are allowed to connect to"`
+	AllowedHosts []string `long:"allowed-host" description:"Host pattern the jobs are allowed to connect to"`
+}
+
+func (c *EgressProxyCommand) Execute(_ *cli.Context) {
+	policy, err := egress.NewPolicy(c.AllowedCIDRs, c.AllowedHosts)
+	if err != nil {
+		logrus.Fatalln(err)
+	}
+
+	server := &http.Server{
+		Addr:              c.Listen,
+		Handler:           egress.NewProxy(policy, os.Stdout),
+		ReadHeaderTimeout: time.Minute,
+	}
+
+	logrus.Println("Egress proxy listening on", c.Listen)
+	logrus.Fatalln(server.ListenAndServe())
+}
+
+func init() {
+	common.RegisterCommand2(
+		"egress-proxy",
+		"proxy restricting the destinations the jobs can connect to",
+		&EgressProxyCommand{
+			Listen: ":8080",
+		},
+	)
+}
@@ -4,9 +4,12 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/sirupsen/logrus"
@@ -19,6 +22,45 @@ type HealthCheckCommand struct {
 	ctx context.Context
 }
 
+// healthCheckProbe holds the readiness probe settings passed by the executor
+// in the READINESS_PROBE_* variables. Without them, the ports are dialed
+// until one of them accepts a connection.
+type healthCheckProbe struct {
+	httpPath string
+	port     string
+	timeout  time.Duration
+	period   time.Duration
+	retries  int
+}
+
+func newHealthCheckProbe() healthCheckProbe {
+	return healthCheckProbe{
+		httpPath: os.Getenv("READINESS_PROBE_HTTP_PATH"),
+		port:     os.Getenv("READINESS_PROBE_PORT"),
+		timeout:  getEnvSeconds("READINESS_PROBE_TIMEOUT", 5*time.Minute),
+		period:   getEnvSeconds("READINESS_PROBE_PERIOD", time.Second),
+		retries:  getEnvInt("READINESS_PROBE_RETRIES"),
+	}
+}
+
+func getEnvInt(name string) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil {
+		return 0
+	}
+
+	return value
+}
+
+func getEnvSeconds(name string, defaultValue time.Duration) time.Duration {
+	value := getEnvInt(name)
+	if value <= 0 {
+		return defaultValue
+	}
+
+	return time.Duration(value) * time.Second
+}
+
 func (c *HealthCheckCommand) Execute(_ *cli.Context) {
 	var ports []string
 	var addr string
@@ -40,50 +82,108 @@ func (c *HealthCheckCommand) Execute(_ *cli.Context) {
 		}
 	}
 
+	probe := newHealthCheckProbe()
+	if probe.port != "" {
+		ports = []string{probe.port}
+	}
+
 	if addr == "" || len(ports) == 0 {
 		logrus.Fatalln("No HOST or PORT found")
 	}
 
-	fmt.Printf("waiting for TCP connection to %s on %v...\n", addr, ports)
+	if probe.httpPath != "" {
+		fmt.Printf("waiting for HTTP GET %s to succeed on %s on %v...\n", probe.httpPath, addr, ports)
+	} else {
+		fmt.Printf("waiting for TCP connection to %s on %v...\n", addr, ports)
+	}
+
 	wg := sync.WaitGroup{}
 	wg.Add(len(ports))
 	ctx, cancel := context.WithCancel(c.ctx)
 	defer cancel()
 
+	var ready atomic.Bool
 	for _, port := range ports {
-		go checkPort(ctx, addr, port, cancel, wg.Done)
+		go func(port string) {
+			defer wg.Done()
+
+			if checkPort(ctx, addr, port, probe) {
+				ready.Store(true)
+				cancel()
+			}
+		}(port)
 	}
 
 	wg.Wait()
+
+	if !ready.Load() && c.ctx.Err() == nil {
+		logrus.Fatalln("Readiness probe failed after", probe.retries, "attempts")
+	}
 }
 
-// checkPort will attempt to Dial the specified addr:port until successful. This function is intended to be run as a
+// checkPort will attempt to probe the specified addr:port until successful. This function is intended to be run as a
 // go-routine and has the following exit criteria:
-//  1. A call to net.Dial is successful (i.e. does not return an error). A successful dial will also result in the
-//     the passed context being cancelled.
+//  1. A probe is successful. It returns true.
 //  2. The passed context is cancelled.
-func checkPort(parentCtx context.Context, addr, port string, cancel func(), done func()) {
-	defer done()
-	defer cancel()
+//  3. The probe failed as many times as the probe's retries, when set.
+func checkPort(parentCtx context.Context, addr, port string, probe healthCheckProbe) bool {
+	for attempt := 1; ; attempt++ {
+		err := probe.check(parentCtx, addr, port)
+		if err == nil {
+			fmt.Printf("probe succeeded on %s:%s. Exiting...\n", addr, port)
+			return true
+		}
+
+		if parentCtx.Err() != nil {
+			return false
+		}
+
+		if probe.retries > 0 && attempt >= probe.retries {
+			fmt.Printf("probe failed on %s:%s after %d attempts: %v\n", addr, port, attempt, err)
+			return false
+		}
 
-	for {
-		ctx, cancel := context.WithTimeout(parentCtx, 5*time.Minute)
-		defer cancel()
+		select {
+		case <-parentCtx.Done():
+			return false
+		case <-time.After(probe.period):
+		}
+	}
+}
+
+func (p healthCheckProbe) check(parentCtx context.Context, addr, port string) error {
+	ctx, cancel := context.WithTimeout(parentCtx, p.timeout)
+	defer cancel()
 
+	if p.httpPath == "" {
 		fmt.Printf("dialing %s:%s...\n", addr, port)
 		conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", net.JoinHostPort(addr, port))
 		if err != nil {
-			if parentCtx.Err() != nil {
-				return
-			}
-			time.Sleep(time.Second)
-			continue
+			return err
 		}
 
-		_ = conn.Close()
-		fmt.Printf("dial succeeded on %s:%s. Exiting...\n", addr, port)
-		return
+		return conn.Close()
+	}
+
+	url := "http://" + net.JoinHostPort(addr, port) + "/" + strings.TrimPrefix(p.httpPath, "/")
+	fmt.Printf("requesting %s...\n", url)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
 	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	return nil
 }
 
 func init() {
@@ -0,0 +1,73 @@
+package helpers
+
+import (
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/process"
+)
+
+// SandboxInitCommand is the init process of the sandbox of the shell executor.
+// It sets up the mounts of the sandbox and executes the shell of the job.
+type SandboxInitCommand struct {
+	TmpDir    string `long:"tmp-dir" description:"Directory mounted on /tmp"`
+	BuildsDir string `long:"builds-dir" description:"Builds directory hidden from the job"`
+	BindDir   string `long:"bind-dir" description:"Directory of the builds directory that the job can access"`
+	JobDir    string `long:"job-dir" description:"Directory mounted on the bind directory, the bind directory itself by default"`
+
+	CacheDir        string `long:"cache-dir" description:"Cache directory hidden from the job"`
+	ProjectCacheDir string `long:"project-cache-dir" description:"Directory of the cache directory that the job can access"`
+
+	HiddenDirs []string `long:"hide-dir" description:"Directory hidden from the job"`
+}
+
+func (c *SandboxInitCommand) Execute(ctx *cli.Context) {
+	if ctx.NArg() == 0 {
+		logrus.Fatalln("No command passed")
+	}
+
+	err := process.SetupSandboxMounts(process.SandboxMounts{
+		TmpDir:          c.TmpDir,
+		BuildsDir:       c.BuildsDir,
+		BindDir:         c.BindDir,
+		JobDir:          c.JobDir,
+		CacheDir:        c.CacheDir,
+		ProjectCacheDir: c.ProjectCacheDir,
+		HiddenDirs:      c.HiddenDirs,
+	})
+	if err != nil {
+		logrus.Fatalln("Setting up the sandbox:", err)
+	}
+
+	// the thread that drops the capabilities executes the shell
+	runtime.LockOSThread()
+
+	err = process.DropCapabilities()
+	if err != nil {
+		logrus.Fatalln("Setting up the sandbox:", err)
+	}
+
+	args := ctx.Args()
+
+	executable, err := exec.LookPath(args[0])
+	if err != nil {
+		logrus.Fatalln(err)
+	}
+
+	err = syscall.Exec(executable, args, os.Environ())
+	logrus.Fatalln("Executing", executable+":", err)
+}
+
+func init() {
+	common.RegisterCommand2(
+		"sandbox-init",
+		"sets up the sandbox of a shell executor job and runs its shell (internal)",
+		&SandboxInitCommand{},
+	)
+}
@@ -0,0 +1,188 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers"
+)
+
+const jobStateFileName = ".runner_jobs_state"
+
+const orphanedJobTraceMessage = "\n" + helpers.ANSI_BOLD_RED +
+	"ERROR: Job was orphaned by a restart of the runner process. Its resources have been cleaned up." +
+	helpers.ANSI_RESET + "\n"
+
+// setupJobStateStore creates the store persisting in-flight jobs, when the job state recovery
+// is enabled in the configuration.
+func (mr *RunCommand) setupJobStateStore() error {
+	config := mr.getConfig()
+	if !config.JobStateRecovery {
+		mr.jobStateStore = nil
+		return nil
+	}
+
+	store := common.NewJobStateStore(filepath.Join(filepath.Dir(mr.ConfigFile), jobStateFileName))
+	err := store.LoadFromFile()
+	if err != nil {
+		return fmt.Errorf("loading job state file: %w", err)
+	}
+
+	mr.jobStateStore = store
+
+	return nil
+}
+
+// trackJobState adds the build to the job state store and hooks the store into the
+// build, so that resources created by the executor are persisted as well. The returned
+// function removes the build from the store and must be called when the build finishes.
+func (mr *RunCommand) trackJobState(build *common.Build) func() {
+	store := mr.jobStateStore
+	if store == nil {
+		return func() {}
+	}
+
+	logger := mr.log().WithField("job", build.ID)
+
+	err := store.Track(build)
+	if err != nil {
+		logger.WithError(err).Warningln("Failed to persist job state")
+	}
+
+	build.ResourceRecorder = func(resource common.ExecutorResource) {
+		err := store.AddResource(build, resource)
+		if err != nil {
+			logger.WithError(err).Warningln("Failed to persist job resource")
+		}
+	}
+
+	return func() {
+		err := store.Remove(build.Runner.URL, build.ID)
+		if err != nil {
+			logger.WithError(err).Warningln("Failed to remove job from the job state file")
+		}
+	}
+}
+
+// recoverOrphanedJobs handles jobs that were still running when the previous runner
+// process terminated. Resources of such jobs are removed by the executor provider
+// and the jobs are reported to GitLab as failed. It's run in the background, as the
+// cleanup of each job can take up to common.OrphanedJobCleanupTimeout.
+func (mr *RunCommand) recoverOrphanedJobs() {
+	store := mr.jobStateStore
+	if store == nil {
+		return
+	}
+
+	config := mr.getConfig()
+	for _, job := range store.Jobs() {
+		logger := mr.log().WithFields(logrus.Fields{
+			"job":    job.ID,
+			"runner": job.Runner,
+		})
+
+		runner := findRunnerForJobState(config, job)
+		if runner == nil {
+			logger.Warningln("Runner of the orphaned job is no longer configured; dropping job state")
+			mr.removeJobState(logger, job)
+			continue
+		}
+
+		mr.cleanupOrphanedJob(logger, runner, job)
+
+		if mr.failOrphanedJob(logger, runner, job) {
+			mr.removeJobState(logger, job)
+		}
+	}
+}
+
+// findRunnerForJobState returns the runner of the job. The runner ID survives the
+// rotation of the runner token, the short description of the token is only used for
+// the jobs of runners without an ID.
+func findRunnerForJobState(config *common.Config, job common.JobStateEntry) *common.RunnerConfig {
+	for _, runner := range config.Runners {
+		if runner.URL != job.URL {
+			continue
+		}
+
+		if job.RunnerID != 0 && runner.ID == job.RunnerID {
+			return runner
+		}
+
+		if job.RunnerID == 0 && runner.ShortDescription() == job.Runner {
+			return runner
+		}
+	}
+
+	return nil
+}
+
+func (mr *RunCommand) cleanupOrphanedJob(
+	logger logrus.FieldLogger,
+	runner *common.RunnerConfig,
+	job common.JobStateEntry,
+) {
+	cleaner, ok := common.GetExecutorProvider(job.Executor).(common.OrphanedJobCleaner)
+	if !ok {
+		logger.WithField("executor", job.Executor).
+			Warningln("Executor doesn't support cleaning up orphaned jobs; resources may be left behind")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), common.OrphanedJobCleanupTimeout)
+	defer cancel()
+
+	logger.Infoln("Cleaning up resources of orphaned job")
+
+	err := cleaner.CleanupOrphanedJob(ctx, runner, job)
+	if err != nil {
+		logger.WithError(err).Warningln("Failed to clean up resources of orphaned job")
+	}
+}
+
+// failOrphanedJob appends an explanation to the job log and marks the job as failed.
+// It returns false when GitLab couldn't be reached, so the job is retried on the next start.
+func (mr *RunCommand) failOrphanedJob(
+	logger logrus.FieldLogger,
+	runner *common.RunnerConfig,
+	job common.JobStateEntry,
+) bool {
+	credentials := job.Credentials()
+	message := []byte(orphanedJobTraceMessage)
+
+	// The offset of the existing job log is unknown. GitLab responds to a range
+	// mismatch with the current offset, which is then used to append the message.
+	result := mr.network.PatchTrace(*runner, credentials, message, 0, false)
+	if result.State == common.PatchRangeMismatch {
+		result = mr.network.PatchTrace(*runner, credentials, message, result.SentOffset, false)
+	}
+	if result.State != common.PatchSucceeded {
+		logger.WithField("state", result.State).Debugln("Failed to append the orphaned job message to the job log")
+	}
+
+	update := mr.network.UpdateJob(*runner, credentials, common.UpdateJobInfo{
+		ID:            job.ID,
+		State:         common.Failed,
+		FailureReason: common.RunnerSystemFailure,
+	})
+
+	switch update.State {
+	case common.UpdateSucceeded, common.UpdateAcceptedButNotCompleted, common.UpdateNotFound, common.UpdateAbort:
+		logger.Infoln("Orphaned job reported as failed")
+		return true
+	default:
+		logger.WithField("state", update.State).Warningln("Failed to report orphaned job as failed")
+		return false
+	}
+}
+
+func (mr *RunCommand) removeJobState(logger logrus.FieldLogger, job common.JobStateEntry) {
+	err := mr.jobStateStore.Remove(job.URL, job.ID)
+	if err != nil {
+		logger.WithError(err).Warningln("Failed to remove job from the job state file")
+	}
+}
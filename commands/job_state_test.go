@@ -0,0 +1,243 @@
+//go:build !integration
+
+package commands
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+const orphanedJobsTestExecutor = "orphaned-jobs-test"
+
+type orphanedJobsTestProvider struct {
+	*common.MockExecutorProvider
+
+	cleaned []common.JobStateEntry
+}
+
+func (p *orphanedJobsTestProvider) CleanupOrphanedJob(
+	_ context.Context,
+	_ *common.RunnerConfig,
+	job common.JobStateEntry,
+) error {
+	p.cleaned = append(p.cleaned, job)
+	return nil
+}
+
+func registerOrphanedJobsTestProvider(t *testing.T) *orphanedJobsTestProvider {
+	if provider, ok := common.GetExecutorProvider(orphanedJobsTestExecutor).(*orphanedJobsTestProvider); ok {
+		provider.cleaned = nil
+		return provider
+	}
+
+	mockProvider := common.NewMockExecutorProvider(t)
+	mockProvider.On("GetDefaultShell").Return("bash").Maybe()
+	mockProvider.On("CanCreate").Return(true).Maybe()
+	mockProvider.On("GetFeatures", mock.Anything).Return(nil).Maybe()
+
+	provider := &orphanedJobsTestProvider{MockExecutorProvider: mockProvider}
+	common.RegisterExecutorProvider(orphanedJobsTestExecutor, provider)
+
+	return provider
+}
+
+func TestRunCommand_recoverOrphanedJobs(t *testing.T) {
+	runner := &common.RunnerConfig{
+		RunnerCredentials: common.RunnerCredentials{
+			URL:   "https://gitlab.example.com",
+			ID:    1,
+			Token: "glrt-runner-token",
+		},
+		RunnerSettings: common.RunnerSettings{
+			Executor: orphanedJobsTestExecutor,
+		},
+	}
+
+	// the token of the runner was rotated after the job started
+	rotatedRunner := *runner
+	rotatedRunner.Token = "glrt-rotated-runner-token"
+
+	removedRunner := &common.RunnerConfig{
+		RunnerCredentials: common.RunnerCredentials{
+			URL:   "https://gitlab.example.com",
+			ID:    2,
+			Token: "glrt-removed-runner-token",
+		},
+		RunnerSettings: common.RunnerSettings{
+			Executor: orphanedJobsTestExecutor,
+		},
+	}
+
+	newBuild := func(id int64, runner *common.RunnerConfig) *common.Build {
+		return &common.Build{
+			JobResponse: common.JobResponse{ID: id, Token: "job-token"},
+			Runner:      runner,
+		}
+	}
+
+	tests := map[string]struct {
+		updateState       common.UpdateState
+		expectedRemaining []int64
+	}{
+		"job reported as failed": {
+			updateState:       common.UpdateSucceeded,
+			expectedRemaining: []int64{},
+		},
+		"job no longer exists": {
+			updateState:       common.UpdateNotFound,
+			expectedRemaining: []int64{},
+		},
+		"GitLab not reachable": {
+			updateState:       common.UpdateFailed,
+			expectedRemaining: []int64{1},
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			provider := registerOrphanedJobsTestProvider(t)
+
+			configFile := filepath.Join(t.TempDir(), "config.toml")
+
+			store := common.NewJobStateStore(filepath.Join(filepath.Dir(configFile), jobStateFileName))
+			require.NoError(t, store.Track(newBuild(1, &rotatedRunner)))
+			require.NoError(t, store.AddResource(newBuild(1, &rotatedRunner), common.ExecutorResource{
+				Type: common.ExecutorResourceContainer,
+				ID:   "container-id",
+			}))
+			require.NoError(t, store.Track(newBuild(2, removedRunner)))
+
+			network := common.NewMockNetwork(t)
+			network.On("PatchTrace", *runner, mock.Anything, mock.Anything, 0, false).
+				Return(common.PatchTraceResult{State: common.PatchRangeMismatch, SentOffset: 10}).
+				Once()
+			network.On("PatchTrace", *runner, mock.Anything, mock.Anything, 10, false).
+				Return(common.PatchTraceResult{State: common.PatchSucceeded}).
+				Once()
+			network.On("UpdateJob", *runner, mock.Anything, common.UpdateJobInfo{
+				ID:            1,
+				State:         common.Failed,
+				FailureReason: common.RunnerSystemFailure,
+			}).
+				Run(func(args mock.Arguments) {
+					credentials := args.Get(1).(*common.JobCredentials)
+					assert.Equal(t, "job-token", credentials.Token)
+				}).
+				Return(common.UpdateJobResult{State: tt.updateState}).
+				Once()
+
+			config := common.NewConfig()
+			config.JobStateRecovery = true
+			config.Runners = []*common.RunnerConfig{runner}
+
+			mr := &RunCommand{network: network}
+			mr.config = config
+			mr.ConfigFile = configFile
+
+			require.NoError(t, mr.setupJobStateStore())
+			mr.recoverOrphanedJobs()
+
+			require.Len(t, provider.cleaned, 1)
+			assert.Equal(t, int64(1), provider.cleaned[0].ID)
+			assert.Len(t, provider.cleaned[0].Resources, 1)
+
+			remaining := []int64{}
+			for _, job := range mr.jobStateStore.Jobs() {
+				remaining = append(remaining, job.ID)
+			}
+			assert.Equal(t, tt.expectedRemaining, remaining)
+		})
+	}
+}
+
+func TestRunCommand_trackJobState(t *testing.T) {
+	runner := &common.RunnerConfig{
+		RunnerCredentials: common.RunnerCredentials{
+			URL:   "https://gitlab.example.com",
+			Token: "glrt-runner-token",
+		},
+	}
+	build := &common.Build{
+		JobResponse: common.JobResponse{ID: 1, Token: "job-token"},
+		Runner:      runner,
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		mr := &RunCommand{}
+		mr.config = common.NewConfig()
+
+		require.NoError(t, mr.setupJobStateStore())
+		assert.Nil(t, mr.jobStateStore)
+
+		mr.trackJobState(build)()
+		assert.Nil(t, build.ResourceRecorder)
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		mr := &RunCommand{}
+		mr.config = common.NewConfig()
+		mr.config.JobStateRecovery = true
+		mr.ConfigFile = filepath.Join(t.TempDir(), "config.toml")
+
+		require.NoError(t, mr.setupJobStateStore())
+		require.NotNil(t, mr.jobStateStore)
+
+		untrack := mr.trackJobState(build)
+		build.RecordExecutorResource(common.ExecutorResource{Type: common.ExecutorResourcePod, ID: "pod"})
+
+		jobs := mr.jobStateStore.Jobs()
+		require.Len(t, jobs, 1)
+		assert.Equal(t, []common.ExecutorResource{{Type: common.ExecutorResourcePod, ID: "pod"}}, jobs[0].Resources)
+
+		untrack()
+		assert.Empty(t, mr.jobStateStore.Jobs())
+	})
+}
+
+func TestFindRunnerForJobState(t *testing.T) {
+	withID := &common.RunnerConfig{RunnerCredentials: common.RunnerCredentials{
+		URL:   "https://gitlab.example.com",
+		ID:    1,
+		Token: "glrt-rotated-token",
+	}}
+	withoutID := &common.RunnerConfig{RunnerCredentials: common.RunnerCredentials{
+		URL:   "https://gitlab.example.com",
+		Token: "legacy-runner-token",
+	}}
+
+	config := common.NewConfig()
+	config.Runners = []*common.RunnerConfig{withoutID, withID}
+
+	tests := map[string]struct {
+		job      common.JobStateEntry
+		expected *common.RunnerConfig
+	}{
+		"runner ID": {
+			job:      common.JobStateEntry{URL: "https://gitlab.example.com", RunnerID: 1, Runner: "glrt-old"},
+			expected: withID,
+		},
+		"unknown runner ID": {
+			job: common.JobStateEntry{URL: "https://gitlab.example.com", RunnerID: 3, Runner: withoutID.ShortDescription()},
+		},
+		"other URL": {
+			job: common.JobStateEntry{URL: "https://other.example.com", RunnerID: 1},
+		},
+		"token of a runner without ID": {
+			job:      common.JobStateEntry{URL: "https://gitlab.example.com", Runner: withoutID.ShortDescription()},
+			expected: withoutID,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			assert.Equal(t, tt.expected, findRunnerForJobState(config, tt.job))
+		})
+	}
+}
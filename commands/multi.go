@@ -100,6 +100,9 @@ type RunCommand struct {
 
 	sessionServer *session.Server
 
+	// jobStateStore persists in-flight jobs when the job state recovery is enabled
+	jobStateStore *common.JobStateStore
+
 	// abortBuilds is used to abort running builds
 	abortBuilds chan os.Signal
 
@@ -178,6 +181,11 @@ func (mr *RunCommand) Start(_ service.Service) error {
 		return err
 	}
 
+	err = mr.setupJobStateStore()
+	if err != nil {
+		return err
+	}
+
 	config := mr.getConfig()
 	for _, runner := range config.Runners {
 		mr.runnerWorkersFeeds.WithLabelValues(runner.ShortDescription(), runner.Name, runner.GetSystemID()).Add(0)
@@ -351,6 +359,8 @@ func (mr *RunCommand) reloadConfig() error {
 		mr.sentryLogHook = sentry.LogHook{}
 	}
 
+	mr.configureExecutorProviders(config)
+
 	mr.configReloaded <- 1
 
 	return nil
@@ -398,6 +408,8 @@ func (mr *RunCommand) run() {
 
 	go mr.resetRunnerTokens()
 
+	go mr.recoverOrphanedJobs()
+
 	runners := make(chan *common.RunnerConfig)
 	go mr.feedRunners(runners)
 
@@ -449,6 +461,15 @@ func (mr *RunCommand) initUsedExecutorProviders() {
 	}
 }
 
+func (mr *RunCommand) configureExecutorProviders(config *common.Config) {
+	for _, provider := range common.GetExecutorProviders() {
+		configurableProvider, ok := provider.(common.ConfigurableExecutorProvider)
+		if ok {
+			configurableProvider.Configure(config.Runners)
+		}
+	}
+}
+
 func (mr *RunCommand) shutdownUsedExecutorProviders() {
 	shutdownTimeout := mr.config.GetShutdownTimeout()
 
@@ -798,6 +819,9 @@ func (mr *RunCommand) processBuildOnRunner(
 	// Add build to list of builds to assign numbers
 	mr.buildsHelper.addBuild(build)
 
+	// Persist the build, so it can be recovered if the process dies
+	defer mr.trackJobState(build)()
+
 	fields := logrus.Fields{
 		"job":      build.ID,
 		"project":  build.JobInfo.ProjectID,
@@ -158,6 +158,11 @@ func (r *RunSingleCommand) Execute(c *cli.Context) {
 		logrus.WithError(err).Fatal("Failed to generate random system ID")
 	}
 
+	configurableProvider, ok := executorProvider.(common.ConfigurableExecutorProvider)
+	if ok {
+		configurableProvider.Configure([]*common.RunnerConfig{&r.RunnerConfig})
+	}
+
 	logrus.Println("Starting runner for", r.URL, "with token", r.ShortDescription(), "...")
 
 	r.finished = abool.New()
@@ -149,6 +149,7 @@ type Build struct {
 	currentStage          BuildStage
 	currentState          BuildRuntimeState
 	executorStageResolver func() ExecutorStage
+	resourceUsage         *ResourceUsage
 
 	secretsResolver func(l logger, registry SecretResolverRegistry, featureFlagOn func(string) bool) (SecretsResolver, error)
 
@@ -163,6 +164,10 @@ type Build struct {
 
 	Referees         []referees.Referee
 	ArtifactUploader func(config JobCredentials, reader io.ReadCloser, options ArtifactsOptions) (UploadState, string)
+
+	// ResourceRecorder, when set, is notified about every resource the executor
+	// creates for the job, so it can be cleaned up after a runner restart.
+	ResourceRecorder func(resource ExecutorResource) `json:"-" yaml:"-"`
 }
 
 func (b *Build) setCurrentStage(stage BuildStage) {
@@ -193,6 +198,16 @@ func (b *Build) CurrentState() BuildRuntimeState {
 	return b.currentState
 }
 
+// RecordExecutorResource notifies the ResourceRecorder, if any, about a resource
+// created by the executor for this build.
+func (b *Build) RecordExecutorResource(resource ExecutorResource) {
+	if b.ResourceRecorder == nil {
+		return
+	}
+
+	b.ResourceRecorder(resource)
+}
+
 func (b *Build) Log() *logrus.Entry {
 	return b.Runner.Log().WithField("job", b.ID).WithField("project", b.JobInfo.ProjectID)
 }
@@ -256,11 +271,18 @@ func (b *Build) TmpProjectDir() string {
 	return helpers.ToSlash(b.BuildDir) + ".tmp"
 }
 
+// StaticBuildStages returns the BuildStages which are executed on every build
+func StaticBuildStages() []BuildStage {
+	stages := make([]BuildStage, len(staticBuildStages))
+	copy(stages, staticBuildStages)
+
+	return stages
+}
+
 // BuildStages returns a list of all BuildStages which will be executed.
 // Not in the order of execution.
 func (b *Build) BuildStages() []BuildStage {
-	stages := make([]BuildStage, len(staticBuildStages))
-	copy(stages, staticBuildStages)
+	stages := StaticBuildStages()
 
 	for _, s := range b.Steps {
 		if s.Name == StepNameAfterScript {
@@ -690,6 +712,7 @@ func (b *Build) run(ctx context.Context, executor Executor) (err error) {
 		err = b.handleError(ctx.Err())
 
 	case signal := <-b.SystemInterrupt:
+		b.checkpoint(ctx, executor)
 		err = &BuildError{
 			Inner:         fmt.Errorf("aborted: %v", signal),
 			FailureReason: RunnerSystemFailure,
@@ -728,6 +751,20 @@ func (b *Build) run(ctx context.Context, executor Executor) (err error) {
 	return err
 }
 
+// checkpoint saves the state of a job aborted by the runner's shutdown, when
+// it's supported by the executor
+func (b *Build) checkpoint(ctx context.Context, executor Executor) {
+	checkpointer, ok := executor.(CheckpointableExecutor)
+	if !ok {
+		return
+	}
+
+	err := checkpointer.Checkpoint(ctx)
+	if err != nil {
+		b.logger.Warningln("Failed to checkpoint the job:", err)
+	}
+}
+
 // waitForBuildFinish will wait for the build to finish or timeout, whichever
 // comes first. This is to prevent issues where something in the build can't be
 // killed or processed and results into the Job running until the GitLab Runner
@@ -947,6 +984,9 @@ func (b *Build) Run(globalConfig *Config, trace JobTrace) (err error) {
 	if errWait := b.waitForTerminal(ctx, globalConfig.SessionServer.GetSessionTimeout()); errWait != nil {
 		b.Log().WithError(errWait).Debug("Stopped waiting for terminal")
 	}
+	if b.IsFeatureFlagOn(featureflags.ReportResourceUsage) {
+		b.reportResourceUsage(executor)
+	}
 	executor.Finish(err)
 
 	return err
@@ -1536,6 +1536,39 @@ func TestSkipBuildStageFeatureFlag(t *testing.T) {
 	}
 }
 
+type checkpointableMockExecutor struct {
+	*MockExecutor
+
+	checkpointed bool
+	err          error
+}
+
+func (e *checkpointableMockExecutor) Checkpoint(_ context.Context) error {
+	e.checkpointed = true
+	return e.err
+}
+
+func TestBuildCheckpoint(t *testing.T) {
+	tests := map[string]error{
+		"checkpoint created": nil,
+		"checkpoint failed":  errors.New("checkpoint failed"),
+	}
+
+	for tn, checkpointErr := range tests {
+		t.Run(tn, func(t *testing.T) {
+			build := &Build{Runner: &RunnerConfig{}}
+			build.logger = NewBuildLogger(&Trace{Writer: os.Stdout}, build.Log())
+
+			e := &checkpointableMockExecutor{MockExecutor: NewMockExecutor(t), err: checkpointErr}
+			build.checkpoint(context.Background(), e)
+			assert.True(t, e.checkpointed)
+
+			// executors not supporting checkpoints are skipped
+			build.checkpoint(context.Background(), NewMockExecutor(t))
+		})
+	}
+}
+
 func TestWaitForTerminal(t *testing.T) {
 	cases := []struct {
 		name                   string
@@ -170,60 +170,115 @@ func (p *StringOrArray) UnmarshalTOML(data interface{}) error {
 
 type DockerConfig struct {
 	docker.Credentials
-	Hostname                   string             `toml:"hostname,omitempty" json:"hostname" long:"hostname" env:"DOCKER_HOSTNAME" description:"Custom container hostname"`
-	Image                      string             `toml:"image" json:"image" long:"image" env:"DOCKER_IMAGE" description:"Docker image to be used"`
-	Runtime                    string             `toml:"runtime,omitempty" json:"runtime" long:"runtime" env:"DOCKER_RUNTIME" description:"Docker runtime to be used"`
-	Memory                     string             `toml:"memory,omitempty" json:"memory" long:"memory" env:"DOCKER_MEMORY" description:"Memory limit (format: <number>[<unit>]). Unit can be one of b, k, m, or g. Minimum is 4M."`
-	MemorySwap                 string             `toml:"memory_swap,omitempty" json:"memory_swap" long:"memory-swap" env:"DOCKER_MEMORY_SWAP" description:"Total memory limit (memory + swap, format: <number>[<unit>]). Unit can be one of b, k, m, or g."`
-	MemoryReservation          string             `toml:"memory_reservation,omitempty" json:"memory_reservation" long:"memory-reservation" env:"DOCKER_MEMORY_RESERVATION" description:"Memory soft limit (format: <number>[<unit>]). Unit can be one of b, k, m, or g."`
-	CPUSetCPUs                 string             `toml:"cpuset_cpus,omitempty" json:"cpuset_cpus" long:"cpuset-cpus" env:"DOCKER_CPUSET_CPUS" description:"String value containing the cgroups CpusetCpus to use"`
-	CPUS                       string             `toml:"cpus,omitempty" json:"cpus" long:"cpus" env:"DOCKER_CPUS" description:"Number of CPUs"`
-	CPUShares                  int64              `toml:"cpu_shares,omitzero" json:"cpu_shares" long:"cpu-shares" env:"DOCKER_CPU_SHARES" description:"Number of CPU shares"`
-	DNS                        []string           `toml:"dns,omitempty" json:"dns,omitempty" long:"dns" env:"DOCKER_DNS" description:"A list of DNS servers for the container to use"`
-	DNSSearch                  []string           `toml:"dns_search,omitempty" json:"dns_search,omitempty" long:"dns-search" env:"DOCKER_DNS_SEARCH" description:"A list of DNS search domains"`
-	Privileged                 bool               `toml:"privileged,omitzero" json:"privileged" long:"privileged" env:"DOCKER_PRIVILEGED" description:"Give extended privileges to container"`
-	ServicesPrivileged         *bool              `toml:"services_privileged,omitempty" json:"services_privileged,omitempty" long:"services_privileged" env:"DOCKER_SERVICES_PRIVILEGED" description:"When set this will give or remove extended privileges to container services"`
-	DisableEntrypointOverwrite bool               `toml:"disable_entrypoint_overwrite,omitzero" json:"disable_entrypoint_overwrite" long:"disable-entrypoint-overwrite" env:"DOCKER_DISABLE_ENTRYPOINT_OVERWRITE" description:"Disable the possibility for a container to overwrite the default image entrypoint"`
-	User                       string             `toml:"user,omitempty" json:"user" long:"user" env:"DOCKER_USER" description:"Run all commands in the container as the specified user."`
-	UsernsMode                 string             `toml:"userns_mode,omitempty" json:"userns_mode" long:"userns" env:"DOCKER_USERNS_MODE" description:"User namespace to use"`
-	CapAdd                     []string           `toml:"cap_add" json:"cap_add,omitempty" long:"cap-add" env:"DOCKER_CAP_ADD" description:"Add Linux capabilities"`
-	CapDrop                    []string           `toml:"cap_drop" json:"cap_drop,omitempty" long:"cap-drop" env:"DOCKER_CAP_DROP" description:"Drop Linux capabilities"`
-	OomKillDisable             bool               `toml:"oom_kill_disable,omitzero" json:"oom_kill_disable" long:"oom-kill-disable" env:"DOCKER_OOM_KILL_DISABLE" description:"Do not kill processes in a container if an out-of-memory (OOM) error occurs"`
-	OomScoreAdjust             int                `toml:"oom_score_adjust,omitzero" json:"oom_score_adjust" long:"oom-score-adjust" env:"DOCKER_OOM_SCORE_ADJUST" description:"Adjust OOM score"`
-	SecurityOpt                []string           `toml:"security_opt" json:"security_opt,omitempty" long:"security-opt" env:"DOCKER_SECURITY_OPT" description:"Security Options"`
-	ServicesSecurityOpt        []string           `toml:"services_security_opt" json:"services_security_opt,omitempty" long:"services-security-opt" env:"DOCKER_SERVICES_SECURITY_OPT" description:"Security Options for container services"`
-	Devices                    []string           `toml:"devices" json:"devices,omitempty" long:"devices" env:"DOCKER_DEVICES" description:"Add a host device to the container"`
-	DeviceCgroupRules          []string           `toml:"device_cgroup_rules,omitempty" json:"device_cgroup_rules,omitempty" long:"device-cgroup-rules" env:"DOCKER_DEVICE_CGROUP_RULES" description:"Add a device cgroup rule to the container"`
-	Gpus                       string             `toml:"gpus,omitempty" json:"gpus" long:"gpus" env:"DOCKER_GPUS" description:"Request GPUs to be used by Docker"`
-	DisableCache               bool               `toml:"disable_cache,omitzero" json:"disable_cache" long:"disable-cache" env:"DOCKER_DISABLE_CACHE" description:"Disable all container caching"`
-	Volumes                    []string           `toml:"volumes,omitempty" json:"volumes,omitempty" long:"volumes" env:"DOCKER_VOLUMES" description:"Bind-mount a volume and create it if it doesn't exist prior to mounting. Can be specified multiple times once per mountpoint, e.g. --docker-volumes 'test0:/test0' --docker-volumes 'test1:/test1'"`
-	VolumeDriver               string             `toml:"volume_driver,omitempty" json:"volume_driver" long:"volume-driver" env:"DOCKER_VOLUME_DRIVER" description:"Volume driver to be used"`
-	VolumeDriverOps            map[string]string  `toml:"volume_driver_ops,omitempty" json:"volume_driver_ops,omitempty" long:"volume-driver-ops" env:"DOCKER_VOLUME_DRIVER_OPS" description:"A toml table/json object with the format key=values. Volume driver ops to be specified"`
-	CacheDir                   string             `toml:"cache_dir,omitempty" json:"cache_dir" long:"cache-dir" env:"DOCKER_CACHE_DIR" description:"Directory where to store caches"`
-	ExtraHosts                 []string           `toml:"extra_hosts,omitempty" json:"extra_hosts,omitempty" long:"extra-hosts" env:"DOCKER_EXTRA_HOSTS" description:"Add a custom host-to-IP mapping"`
-	VolumesFrom                []string           `toml:"volumes_from,omitempty" json:"volumes_from,omitempty" long:"volumes-from" env:"DOCKER_VOLUMES_FROM" description:"A list of volumes to inherit from another container"`
-	NetworkMode                string             `toml:"network_mode,omitempty" json:"network_mode" long:"network-mode" env:"DOCKER_NETWORK_MODE" description:"Add container to a custom network"`
-	IpcMode                    string             `toml:"ipcmode,omitempty" json:"ipcmode" long:"ipcmode" env:"DOCKER_IPC_MODE" description:"Select IPC mode for container"`
-	MacAddress                 string             `toml:"mac_address,omitempty" json:"mac_address" long:"mac-address" env:"DOCKER_MAC_ADDRESS" description:"Container MAC address (e.g., 92:d0:c6:0a:29:33)"`
-	Links                      []string           `toml:"links,omitempty" json:"links,omitempty" long:"links" env:"DOCKER_LINKS" description:"Add link to another container"`
-	Services                   []Service          `toml:"services,omitempty" json:"services,omitempty" description:"Add service that is started with container"`
-	WaitForServicesTimeout     int                `toml:"wait_for_services_timeout,omitzero" json:"wait_for_services_timeout" long:"wait-for-services-timeout" env:"DOCKER_WAIT_FOR_SERVICES_TIMEOUT" description:"How long to wait for service startup"`
-	AllowedImages              []string           `toml:"allowed_images,omitempty" json:"allowed_images,omitempty" long:"allowed-images" env:"DOCKER_ALLOWED_IMAGES" description:"Image allowlist"`
-	AllowedPrivilegedImages    []string           `toml:"allowed_privileged_images,omitempty" json:"allowed_privileged_images,omitempty" long:"allowed-privileged-images" env:"DOCKER_ALLOWED_PRIVILEGED_IMAGES" description:"Privileged image allowlist"`
-	AllowedPrivilegedServices  []string           `toml:"allowed_privileged_services,omitempty" json:"allowed_privileged_services,omitempty" long:"allowed-privileged-services" env:"DOCKER_ALLOWED_PRIVILEGED_SERVICES" description:"Privileged Service allowlist"`
-	AllowedPullPolicies        []DockerPullPolicy `toml:"allowed_pull_policies,omitempty" json:"allowed_pull_policies,omitempty" long:"allowed-pull-policies" env:"DOCKER_ALLOWED_PULL_POLICIES" description:"Pull policy allowlist"`
-	AllowedServices            []string           `toml:"allowed_services,omitempty" json:"allowed_services,omitempty" long:"allowed-services" env:"DOCKER_ALLOWED_SERVICES" description:"Service allowlist"`
-	PullPolicy                 StringOrArray      `toml:"pull_policy,omitempty" json:"pull_policy,omitempty" long:"pull-policy" env:"DOCKER_PULL_POLICY" description:"Image pull policy: never, if-not-present, always"`
-	Isolation                  string             `toml:"isolation,omitempty" json:"isolation" long:"isolation" env:"DOCKER_ISOLATION" description:"Container isolation technology. Windows only"`
-	ShmSize                    int64              `toml:"shm_size,omitempty" json:"shm_size" long:"shm-size" env:"DOCKER_SHM_SIZE" description:"Shared memory size for docker images (in bytes)"`
-	Tmpfs                      map[string]string  `toml:"tmpfs,omitempty" json:"tmpfs,omitempty" long:"tmpfs" env:"DOCKER_TMPFS" description:"A toml table/json object with the format key=values. When set this will mount the specified path in the key as a tmpfs volume in the main container, using the options specified as key. For the supported options, see the documentation for the unix 'mount' command"`
-	ServicesTmpfs              map[string]string  `toml:"services_tmpfs,omitempty" json:"services_tmpfs,omitempty" long:"services-tmpfs" env:"DOCKER_SERVICES_TMPFS" description:"A toml table/json object with the format key=values. When set this will mount the specified path in the key as a tmpfs volume in all the service containers, using the options specified as key. For the supported options, see the documentation for the unix 'mount' command"`
-	SysCtls                    DockerSysCtls      `toml:"sysctls,omitempty" json:"sysctls,omitempty" long:"sysctls" env:"DOCKER_SYSCTLS" description:"Sysctl options, a toml table/json object of key=value. Value is expected to be a string."`
-	HelperImage                string             `toml:"helper_image,omitempty" json:"helper_image" long:"helper-image" env:"DOCKER_HELPER_IMAGE" description:"[ADVANCED] Override the default helper image used to clone repos and upload artifacts"`
-	HelperImageFlavor          string             `toml:"helper_image_flavor,omitempty" json:"helper_image_flavor" long:"helper-image-flavor" env:"DOCKER_HELPER_IMAGE_FLAVOR" description:"Set helper image flavor (alpine, ubuntu), defaults to alpine"`
-	ContainerLabels            map[string]string  `toml:"container_labels,omitempty" json:"container_labels,omitempty" long:"container-labels" description:"A toml table/json object of key-value. Value is expected to be a string. When set, this will create containers with the given container labels. Environment variables will be substituted for values here."`
-	EnableIPv6                 bool               `toml:"enable_ipv6,omitempty" json:"enable_ipv6" long:"enable-ipv6" description:"Enable IPv6 for automatically created networks. This is only takes affect when the feature flag FF_NETWORK_PER_BUILD is enabled."`
-	Ulimit                     map[string]string  `toml:"ulimit,omitempty" json:"ulimit,omitempty" long:"ulimit" env:"DOCKER_ULIMIT" description:"Ulimit options for container"`
+	Hostname                          string                         `toml:"hostname,omitempty" json:"hostname" long:"hostname" env:"DOCKER_HOSTNAME" description:"Custom container hostname"`
+	Image                             string                         `toml:"image" json:"image" long:"image" env:"DOCKER_IMAGE" description:"Docker image to be used"`
+	Runtime                           string                         `toml:"runtime,omitempty" json:"runtime" long:"runtime" env:"DOCKER_RUNTIME" description:"Docker runtime to be used"`
+	Memory                            string                         `toml:"memory,omitempty" json:"memory" long:"memory" env:"DOCKER_MEMORY" description:"Memory limit (format: <number>[<unit>]). Unit can be one of b, k, m, or g. Minimum is 4M."`
+	MemorySwap                        string                         `toml:"memory_swap,omitempty" json:"memory_swap" long:"memory-swap" env:"DOCKER_MEMORY_SWAP" description:"Total memory limit (memory + swap, format: <number>[<unit>]). Unit can be one of b, k, m, or g."`
+	MemoryReservation                 string                         `toml:"memory_reservation,omitempty" json:"memory_reservation" long:"memory-reservation" env:"DOCKER_MEMORY_RESERVATION" description:"Memory soft limit (format: <number>[<unit>]). Unit can be one of b, k, m, or g."`
+	CPUSetCPUs                        string                         `toml:"cpuset_cpus,omitempty" json:"cpuset_cpus" long:"cpuset-cpus" env:"DOCKER_CPUSET_CPUS" description:"String value containing the cgroups CpusetCpus to use"`
+	CPUS                              string                         `toml:"cpus,omitempty" json:"cpus" long:"cpus" env:"DOCKER_CPUS" description:"Number of CPUs"`
+	CPUShares                         int64                          `toml:"cpu_shares,omitzero" json:"cpu_shares" long:"cpu-shares" env:"DOCKER_CPU_SHARES" description:"Number of CPU shares"`
+	DNS                               []string                       `toml:"dns,omitempty" json:"dns,omitempty" long:"dns" env:"DOCKER_DNS" description:"A list of DNS servers for the container to use"`
+	DNSSearch                         []string                       `toml:"dns_search,omitempty" json:"dns_search,omitempty" long:"dns-search" env:"DOCKER_DNS_SEARCH" description:"A list of DNS search domains"`
+	Privileged                        bool                           `toml:"privileged,omitzero" json:"privileged" long:"privileged" env:"DOCKER_PRIVILEGED" description:"Give extended privileges to container"`
+	ServicesPrivileged                *bool                          `toml:"services_privileged,omitempty" json:"services_privileged,omitempty" long:"services_privileged" env:"DOCKER_SERVICES_PRIVILEGED" description:"When set this will give or remove extended privileges to container services"`
+	DisableEntrypointOverwrite        bool                           `toml:"disable_entrypoint_overwrite,omitzero" json:"disable_entrypoint_overwrite" long:"disable-entrypoint-overwrite" env:"DOCKER_DISABLE_ENTRYPOINT_OVERWRITE" description:"Disable the possibility for a container to overwrite the default image entrypoint"`
+	User                              string                         `toml:"user,omitempty" json:"user" long:"user" env:"DOCKER_USER" description:"Run all commands in the container as the specified user."`
+	UsernsMode                        string                         `toml:"userns_mode,omitempty" json:"userns_mode" long:"userns" env:"DOCKER_USERNS_MODE" description:"User namespace to use"`
+	CapAdd                            []string                       `toml:"cap_add" json:"cap_add,omitempty" long:"cap-add" env:"DOCKER_CAP_ADD" description:"Add Linux capabilities"`
+	CapDrop                           []string                       `toml:"cap_drop" json:"cap_drop,omitempty" long:"cap-drop" env:"DOCKER_CAP_DROP" description:"Drop Linux capabilities"`
+	OomKillDisable                    bool                           `toml:"oom_kill_disable,omitzero" json:"oom_kill_disable" long:"oom-kill-disable" env:"DOCKER_OOM_KILL_DISABLE" description:"Do not kill processes in a container if an out-of-memory (OOM) error occurs"`
+	OomScoreAdjust                    int                            `toml:"oom_score_adjust,omitzero" json:"oom_score_adjust" long:"oom-score-adjust" env:"DOCKER_OOM_SCORE_ADJUST" description:"Adjust OOM score"`
+	SecurityOpt                       []string                       `toml:"security_opt" json:"security_opt,omitempty" long:"security-opt" env:"DOCKER_SECURITY_OPT" description:"Security Options"`
+	ServicesSecurityOpt               []string                       `toml:"services_security_opt" json:"services_security_opt,omitempty" long:"services-security-opt" env:"DOCKER_SERVICES_SECURITY_OPT" description:"Security Options for container services"`
+	Devices                           []string                       `toml:"devices" json:"devices,omitempty" long:"devices" env:"DOCKER_DEVICES" description:"Add a host device to the container"`
+	DeviceCgroupRules                 []string                       `toml:"device_cgroup_rules,omitempty" json:"device_cgroup_rules,omitempty" long:"device-cgroup-rules" env:"DOCKER_DEVICE_CGROUP_RULES" description:"Add a device cgroup rule to the container"`
+	Gpus                              string                         `toml:"gpus,omitempty" json:"gpus" long:"gpus" env:"DOCKER_GPUS" description:"Request GPUs to be used by Docker"`
+	DisableCache                      bool                           `toml:"disable_cache,omitzero" json:"disable_cache" long:"disable-cache" env:"DOCKER_DISABLE_CACHE" description:"Disable all container caching"`
+	Volumes                           []string                       `toml:"volumes,omitempty" json:"volumes,omitempty" long:"volumes" env:"DOCKER_VOLUMES" description:"Bind-mount a volume and create it if it doesn't exist prior to mounting. Can be specified multiple times once per mountpoint, e.g. --docker-volumes 'test0:/test0' --docker-volumes 'test1:/test1'"`
+	VolumeDriver                      string                         `toml:"volume_driver,omitempty" json:"volume_driver" long:"volume-driver" env:"DOCKER_VOLUME_DRIVER" description:"Volume driver to be used"`
+	VolumeDriverOps                   map[string]string              `toml:"volume_driver_ops,omitempty" json:"volume_driver_ops,omitempty" long:"volume-driver-ops" env:"DOCKER_VOLUME_DRIVER_OPS" description:"A toml table/json object with the format key=values. Volume driver ops to be specified"`
+	CacheDir                          string                         `toml:"cache_dir,omitempty" json:"cache_dir" long:"cache-dir" env:"DOCKER_CACHE_DIR" description:"Directory where to store caches"`
+	ExtraHosts                        []string                       `toml:"extra_hosts,omitempty" json:"extra_hosts,omitempty" long:"extra-hosts" env:"DOCKER_EXTRA_HOSTS" description:"Add a custom host-to-IP mapping"`
+	VolumesFrom                       []string                       `toml:"volumes_from,omitempty" json:"volumes_from,omitempty" long:"volumes-from" env:"DOCKER_VOLUMES_FROM" description:"A list of volumes to inherit from another container"`
+	NetworkMode                       string                         `toml:"network_mode,omitempty" json:"network_mode" long:"network-mode" env:"DOCKER_NETWORK_MODE" description:"Add container to a custom network"`
+	IpcMode                           string                         `toml:"ipcmode,omitempty" json:"ipcmode" long:"ipcmode" env:"DOCKER_IPC_MODE" description:"Select IPC mode for container"`
+	MacAddress                        string                         `toml:"mac_address,omitempty" json:"mac_address" long:"mac-address" env:"DOCKER_MAC_ADDRESS" description:"Container MAC address (e.g., 92:d0:c6:0a:29:33)"`
+	Links                             []string                       `toml:"links,omitempty" json:"links,omitempty" long:"links" env:"DOCKER_LINKS" description:"Add link to another container"`
+	Services                          []Service                      `toml:"services,omitempty" json:"services,omitempty" description:"Add service that is started with container"`
+	WaitForServicesTimeout            int                            `toml:"wait_for_services_timeout,omitzero" json:"wait_for_services_timeout" long:"wait-for-services-timeout" env:"DOCKER_WAIT_FOR_SERVICES_TIMEOUT" description:"How long to wait for service startup"`
+	AllowedImages                     []string                       `toml:"allowed_images,omitempty" json:"allowed_images,omitempty" long:"allowed-images" env:"DOCKER_ALLOWED_IMAGES" description:"Image allowlist"`
+	AllowedPrivilegedImages           []string                       `toml:"allowed_privileged_images,omitempty" json:"allowed_privileged_images,omitempty" long:"allowed-privileged-images" env:"DOCKER_ALLOWED_PRIVILEGED_IMAGES" description:"Privileged image allowlist"`
+	AllowedPrivilegedServices         []string                       `toml:"allowed_privileged_services,omitempty" json:"allowed_privileged_services,omitempty" long:"allowed-privileged-services" env:"DOCKER_ALLOWED_PRIVILEGED_SERVICES" description:"Privileged Service allowlist"`
+	AllowedPullPolicies               []DockerPullPolicy             `toml:"allowed_pull_policies,omitempty" json:"allowed_pull_policies,omitempty" long:"allowed-pull-policies" env:"DOCKER_ALLOWED_PULL_POLICIES" description:"Pull policy allowlist"`
+	AllowedServices                   []string                       `toml:"allowed_services,omitempty" json:"allowed_services,omitempty" long:"allowed-services" env:"DOCKER_ALLOWED_SERVICES" description:"Service allowlist"`
+	PullPolicy                        StringOrArray                  `toml:"pull_policy,omitempty" json:"pull_policy,omitempty" long:"pull-policy" env:"DOCKER_PULL_POLICY" description:"Image pull policy: never, if-not-present, always"`
+	Isolation                         string                         `toml:"isolation,omitempty" json:"isolation" long:"isolation" env:"DOCKER_ISOLATION" description:"Container isolation technology. Windows only"`
+	ShmSize                           int64                          `toml:"shm_size,omitempty" json:"shm_size" long:"shm-size" env:"DOCKER_SHM_SIZE" description:"Shared memory size for docker images (in bytes)"`
+	Tmpfs                             map[string]string              `toml:"tmpfs,omitempty" json:"tmpfs,omitempty" long:"tmpfs" env:"DOCKER_TMPFS" description:"A toml table/json object with the format key=values. When set this will mount the specified path in the key as a tmpfs volume in the main container, using the options specified as key. For the supported options, see the documentation for the unix 'mount' command"`
+	ServicesTmpfs                     map[string]string              `toml:"services_tmpfs,omitempty" json:"services_tmpfs,omitempty" long:"services-tmpfs" env:"DOCKER_SERVICES_TMPFS" description:"A toml table/json object with the format key=values. When set this will mount the specified path in the key as a tmpfs volume in all the service containers, using the options specified as key. For the supported options, see the documentation for the unix 'mount' command"`
+	SysCtls                           DockerSysCtls                  `toml:"sysctls,omitempty" json:"sysctls,omitempty" long:"sysctls" env:"DOCKER_SYSCTLS" description:"Sysctl options, a toml table/json object of key=value. Value is expected to be a string."`
+	HelperImage                       string                         `toml:"helper_image,omitempty" json:"helper_image" long:"helper-image" env:"DOCKER_HELPER_IMAGE" description:"[ADVANCED] Override the default helper image used to clone repos and upload artifacts"`
+	HelperImageFlavor                 string                         `toml:"helper_image_flavor,omitempty" json:"helper_image_flavor" long:"helper-image-flavor" env:"DOCKER_HELPER_IMAGE_FLAVOR" description:"Set helper image flavor (alpine, ubuntu), defaults to alpine"`
+	ContainerLabels                   map[string]string              `toml:"container_labels,omitempty" json:"container_labels,omitempty" long:"container-labels" description:"A toml table/json object of key-value. Value is expected to be a string. When set, this will create containers with the given container labels. Environment variables will be substituted for values here."`
+	EnableIPv6                        bool                           `toml:"enable_ipv6,omitempty" json:"enable_ipv6" long:"enable-ipv6" description:"Enable IPv6 for automatically created networks. This is only takes affect when the feature flag FF_NETWORK_PER_BUILD is enabled."`
+	Ulimit                            map[string]string              `toml:"ulimit,omitempty" json:"ulimit,omitempty" long:"ulimit" env:"DOCKER_ULIMIT" description:"Ulimit options for container"`
+	CPUSOverwriteMaxAllowed           string                         `toml:"cpus_overwrite_max_allowed,omitempty" json:"cpus_overwrite_max_allowed" long:"cpus-overwrite-max-allowed" env:"DOCKER_CPUS_OVERWRITE_MAX_ALLOWED" description:"If set, the max number of CPUs the build container can be set to. Used with the DOCKER_CPU_LIMIT variable in the build."`
+	MemoryOverwriteMaxAllowed         string                         `toml:"memory_overwrite_max_allowed,omitempty" json:"memory_overwrite_max_allowed" long:"memory-overwrite-max-allowed" env:"DOCKER_MEMORY_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the memory limit of the build container can be set to. Used with the DOCKER_MEMORY_LIMIT variable in the build."`
+	ShmSizeOverwriteMaxAllowed        int64                          `toml:"shm_size_overwrite_max_allowed,omitzero" json:"shm_size_overwrite_max_allowed" long:"shm-size-overwrite-max-allowed" env:"DOCKER_SHM_SIZE_OVERWRITE_MAX_ALLOWED" description:"If set, the max shared memory size (in bytes) of the build container can be set to. Used with the DOCKER_SHM_SIZE_LIMIT variable in the build."`
+	ServiceCPUSOverwriteMaxAllowed    string                         `toml:"service_cpus_overwrite_max_allowed,omitempty" json:"service_cpus_overwrite_max_allowed" long:"service-cpus-overwrite-max-allowed" env:"DOCKER_SERVICE_CPUS_OVERWRITE_MAX_ALLOWED" description:"If set, the max number of CPUs the service containers can be set to. Used with the DOCKER_SERVICE_CPU_LIMIT variable in the build."`
+	ServiceMemoryOverwriteMaxAllowed  string                         `toml:"service_memory_overwrite_max_allowed,omitempty" json:"service_memory_overwrite_max_allowed" long:"service-memory-overwrite-max-allowed" env:"DOCKER_SERVICE_MEMORY_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the memory limit of the service containers can be set to. Used with the DOCKER_SERVICE_MEMORY_LIMIT variable in the build."`
+	ServiceShmSizeOverwriteMaxAllowed int64                          `toml:"service_shm_size_overwrite_max_allowed,omitzero" json:"service_shm_size_overwrite_max_allowed" long:"service-shm-size-overwrite-max-allowed" env:"DOCKER_SERVICE_SHM_SIZE_OVERWRITE_MAX_ALLOWED" description:"If set, the max shared memory size (in bytes) of the service containers can be set to. Used with the DOCKER_SERVICE_SHM_SIZE_LIMIT variable in the build."`
+	BuildKit                          *DockerBuildKitConfig          `toml:"buildkit,omitempty" json:"buildkit,omitempty" namespace:"buildkit" description:"Rootless BuildKit daemon provisioned for every job"`
+	ImageVerification                 *DockerImageVerificationConfig `toml:"image_verification,omitempty" json:"image_verification,omitempty" namespace:"image_verification" description:"Verify the signatures of the images before running them"`
+	CacheVolumesQuota                 string                         `toml:"cache_volumes_quota,omitempty" json:"cache_volumes_quota" long:"cache-volumes-quota" env:"DOCKER_CACHE_VOLUMES_QUOTA" description:"The maximum size of the cache volumes on the Docker host (format: <number>[<unit>]). The least recently used cache volumes are removed when it's exceeded"`
+	SharedServices                    *DockerSharedServicesConfig    `toml:"shared_services,omitempty" json:"shared_services,omitempty" namespace:"shared_services" description:"Services started once and shared between the jobs of a project"`
+	ImageWarmer                       *DockerImageWarmerConfig       `toml:"image_warmer,omitempty" json:"image_warmer,omitempty" namespace:"image_warmer" description:"Pull images on the Docker host in the background, before the jobs need them"`
+	EgressPolicy                      *DockerEgressPolicyConfig      `toml:"egress_policy,omitempty" json:"egress_policy,omitempty" namespace:"egress_policy" description:"Restrict the destinations the build and service containers can connect to"`
+	Checkpoint                        *DockerCheckpointConfig        `toml:"checkpoint,omitempty" json:"checkpoint,omitempty" namespace:"checkpoint" description:"(Experimental) Checkpoint the jobs aborted by the runner's shutdown, for their retries to resume from"`
+}
+
+type DockerBuildKitConfig struct {
+	Enabled bool   `toml:"enabled,omitempty" json:"enabled" long:"enabled" env:"DOCKER_BUILDKIT_ENABLED" description:"Start a rootless BuildKit daemon next to every job and expose its address to the job with BUILDKIT_HOST"`
+	Image   string `toml:"image,omitempty" json:"image" long:"image" env:"DOCKER_BUILDKIT_IMAGE" description:"The rootless BuildKit image to use. Defaults to moby/buildkit:rootless"`
+}
+
+const (
+	DockerImageVerificationProviderCosign   = "cosign"
+	DockerImageVerificationProviderNotation = "notation"
+)
+
+type DockerImageVerificationConfig struct {
+	Provider  string `toml:"provider,omitempty" json:"provider" long:"provider" env:"DOCKER_IMAGE_VERIFICATION_PROVIDER" description:"The tool used to verify the image signatures: cosign or notation. Defaults to cosign"`
+	PublicKey string `toml:"public_key,omitempty" json:"public_key" long:"public-key" env:"DOCKER_IMAGE_VERIFICATION_PUBLIC_KEY" description:"Path to the public key the cosign signatures are verified against"`
+}
+
+type DockerSharedServicesConfig struct {
+	TTL      string                `toml:"ttl,omitempty" json:"ttl" long:"ttl" env:"DOCKER_SHARED_SERVICES_TTL" description:"How long a shared service is kept after the last job using it finished, for example 10m. Defaults to 10m"`
+	Services []DockerSharedService `toml:"service,omitempty" json:"service,omitempty" description:"The services that are shared between jobs"`
+}
+
+type DockerSharedService struct {
+	Image        string   `toml:"image" json:"image" description:"Wildcard pattern of the service images to share"`
+	ResetCommand []string `toml:"reset_command,omitempty" json:"reset_command,omitempty" description:"Command executed in the shared service container before each job, to reset its state"`
+}
+
+type DockerImageWarmerConfig struct {
+	Images       []string `toml:"images,omitempty" json:"images,omitempty" long:"images" env:"DOCKER_IMAGE_WARMER_IMAGES" description:"The images pulled on the Docker host in the background"`
+	Interval     string   `toml:"interval,omitempty" json:"interval" long:"interval" env:"DOCKER_IMAGE_WARMER_INTERVAL" description:"How often the images are pulled again to keep them up to date, for example 1h. Defaults to 1h"`
+	RecentImages int      `toml:"recent_images,omitzero" json:"recent_images" long:"recent-images" env:"DOCKER_IMAGE_WARMER_RECENT_IMAGES" description:"The number of images most recently used by the jobs that are also kept up to date"`
+}
+
+type DockerEgressPolicyConfig struct {
+	AllowedCIDRs []string `toml:"allowed_cidrs,omitempty" json:"allowed_cidrs,omitempty" long:"allowed-cidrs" env:"DOCKER_EGRESS_POLICY_ALLOWED_CIDRS" description:"The CIDRs the build and service containers can connect to"`
+	AllowedHosts []string `toml:"allowed_hosts,omitempty" json:"allowed_hosts,omitempty" long:"allowed-hosts" env:"DOCKER_EGRESS_POLICY_ALLOWED_HOSTS" description:"The host patterns the build and service containers can connect to, for example *.example.com"`
+}
+
+type DockerCheckpointConfig struct {
+	Dir    string `toml:"dir,omitempty" json:"dir" long:"dir" env:"DOCKER_CHECKPOINT_DIR" description:"The directory on the Docker host the checkpoints are stored in. It must be shared between the Docker hosts, for example with NFS"`
+	CRIU   bool   `toml:"criu,omitzero" json:"criu" long:"criu" env:"DOCKER_CHECKPOINT_CRIU" description:"Checkpoint the process of the build container with CRIU, which requires the Docker daemon's experimental features"`
+	MaxAge string `toml:"max_age,omitempty" json:"max_age" long:"max-age" env:"DOCKER_CHECKPOINT_MAX_AGE" description:"How long the checkpoints of jobs that aren't retried are kept, for example 72h. Defaults to 168h"`
 }
 
 type InstanceConfig struct {
@@ -385,10 +440,69 @@ type CustomConfig struct {
 	CleanupArgs        []string `toml:"cleanup_args,omitempty" json:"cleanup_args,omitempty" long:"cleanup-args" description:"Arguments for the cleanup executable"`
 	CleanupExecTimeout *int     `toml:"cleanup_exec_timeout,omitempty" json:"cleanup_exec_timeout,omitempty" long:"cleanup-exec-timeout" env:"CUSTOM_CLEANUP_EXEC_TIMEOUT" description:"Timeout for the cleanup executable (in seconds)"`
 
+	DriverExec   string   `toml:"driver_exec,omitempty" json:"driver_exec" long:"driver-exec" env:"CUSTOM_DRIVER_EXEC" description:"Executable of a driver that runs all the stages of a job through the driver protocol on its standard input and output, instead of the config, prepare, run and cleanup executables"`
+	DriverArgs   []string `toml:"driver_args,omitempty" json:"driver_args,omitempty" long:"driver-args" description:"Arguments for the driver executable"`
+	DriverSocket string   `toml:"driver_socket,omitempty" json:"driver_socket" long:"driver-socket" env:"CUSTOM_DRIVER_SOCKET" description:"Unix socket of a driver that runs all the stages of a job through the driver protocol, instead of the config, prepare, run and cleanup executables"`
+
 	GracefulKillTimeout *int `toml:"graceful_kill_timeout,omitempty" json:"graceful_kill_timeout,omitempty" long:"graceful-kill-timeout" env:"CUSTOM_GRACEFUL_KILL_TIMEOUT" description:"Graceful timeout for scripts execution after SIGTERM is sent to the process (in seconds). This limits the time given for scripts to perform the cleanup before exiting"`
 	ForceKillTimeout    *int `toml:"force_kill_timeout,omitempty" json:"force_kill_timeout,omitempty" long:"force-kill-timeout" env:"CUSTOM_FORCE_KILL_TIMEOUT" description:"Force timeout for scripts execution (in seconds). Counted from the force kill call; if process will be not terminated, Runner will abandon process termination and log an error"`
 }
 
+// ShellSandboxConfig configures the Linux namespaces and the cgroup in which the
+// shell executor runs the scripts of the jobs
+type ShellSandboxConfig struct {
+	Enabled        bool   `toml:"enabled,omitempty" json:"enabled" long:"enabled" env:"SHELL_SANDBOX_ENABLED" description:"Run the scripts of the jobs in new user, mount and PID namespaces, with a private /tmp and only the builds directory of the job"`
+	IsolateNetwork bool   `toml:"isolate_network,omitempty" json:"isolate_network" long:"isolate-network" env:"SHELL_SANDBOX_ISOLATE_NETWORK" description:"Run the user scripts of the jobs in a new network namespace, without network access"`
+	CgroupParent   string `toml:"cgroup_parent,omitempty" json:"cgroup_parent" long:"cgroup-parent" env:"SHELL_SANDBOX_CGROUP_PARENT" description:"cgroup v2 directory, delegated to the runner user, in which the cgroups of the jobs are created"`
+	CPUs           string `toml:"cpus,omitempty" json:"cpus" long:"cpus" env:"SHELL_SANDBOX_CPUS" description:"Number of CPUs the job can use, for example 1.5"`
+	Memory         string `toml:"memory,omitempty" json:"memory" long:"memory" env:"SHELL_SANDBOX_MEMORY" description:"Memory limit of the job, for example 512m"`
+	PidsLimit      int64  `toml:"pids_limit,omitzero" json:"pids_limit" long:"pids-limit" env:"SHELL_SANDBOX_PIDS_LIMIT" description:"Maximum number of processes of the job"`
+
+	HiddenDirs []string `toml:"hidden_dirs,omitempty" json:"hidden_dirs" long:"hidden-dirs" env:"SHELL_SANDBOX_HIDDEN_DIRS" description:"Directories hidden from the jobs, in addition to the directory of the configuration file and the cache directory"`
+
+	// ConfigDir is the directory of the configuration file, which holds the
+	// tokens of the runners and the state of the jobs
+	ConfigDir string `toml:"-" json:"-"`
+}
+
+// GetHiddenDirs returns the directories hidden from all the stages of the jobs
+func (c *ShellSandboxConfig) GetHiddenDirs() []string {
+	var dirs []string
+	for _, dir := range append([]string{c.ConfigDir}, c.HiddenDirs...) {
+		if dir != "" {
+			dirs = append(dirs, filepath.Clean(dir))
+		}
+	}
+
+	return dirs
+}
+
+// GetCgroupLimits returns the limits of the cgroup of the job
+func (c *ShellSandboxConfig) GetCgroupLimits() (process.CgroupLimits, error) {
+	var limits process.CgroupLimits
+
+	nanoCPUs, err := ParseNanoCPUs(c.CPUs)
+	if err != nil {
+		return limits, fmt.Errorf("parsing cpus: %w", err)
+	}
+	limits.NanoCPUs = nanoCPUs
+
+	if c.Memory != "" {
+		limits.MemoryBytes, err = units.RAMInBytes(c.Memory)
+		if err != nil {
+			return limits, fmt.Errorf("parsing memory: %w", err)
+		}
+	}
+
+	limits.PidsLimit = c.PidsLimit
+
+	if !limits.IsEmpty() && c.CgroupParent == "" {
+		return limits, errors.New("cgroup_parent is required to limit the resources of the jobs")
+	}
+
+	return limits, nil
+}
+
 // GetPullPolicies returns a validated list of pull policies, falling back to a predefined value if empty,
 // or returns an error if the list is not valid
 func (c KubernetesConfig) GetPullPolicies() ([]api.PullPolicy, error) {
@@ -488,94 +602,104 @@ func (p KubernetesDNSPolicy) Get() (api.DNSPolicy, error) {
 }
 
 type KubernetesConfig struct {
-	Host                                              string                             `toml:"host" json:"host" long:"host" env:"KUBERNETES_HOST" description:"Optional Kubernetes master host URL (auto-discovery attempted if not specified)"`
-	CertFile                                          string                             `toml:"cert_file,omitempty" json:"cert_file" long:"cert-file" env:"KUBERNETES_CERT_FILE" description:"Optional Kubernetes master auth certificate"`
-	KeyFile                                           string                             `toml:"key_file,omitempty" json:"key_file" long:"key-file" env:"KUBERNETES_KEY_FILE" description:"Optional Kubernetes master auth private key"`
-	CAFile                                            string                             `toml:"ca_file,omitempty" json:"ca_file" long:"ca-file" env:"KUBERNETES_CA_FILE" description:"Optional Kubernetes master auth ca certificate"`
-	BearerTokenOverwriteAllowed                       bool                               `toml:"bearer_token_overwrite_allowed" json:"bearer_token_overwrite_allowed" long:"bearer_token_overwrite_allowed" env:"KUBERNETES_BEARER_TOKEN_OVERWRITE_ALLOWED" description:"Bool to authorize builds to specify their own bearer token for creation."`
-	BearerToken                                       string                             `toml:"bearer_token,omitempty" json:"bearer_token" long:"bearer_token" env:"KUBERNETES_BEARER_TOKEN" description:"Optional Kubernetes service account token used to start build pods."`
-	Image                                             string                             `toml:"image" json:"image" long:"image" env:"KUBERNETES_IMAGE" description:"Default docker image to use for builds when none is specified"`
-	Namespace                                         string                             `toml:"namespace" json:"namespace" long:"namespace" env:"KUBERNETES_NAMESPACE" description:"Namespace to run Kubernetes jobs in"`
-	NamespaceOverwriteAllowed                         string                             `toml:"namespace_overwrite_allowed" json:"namespace_overwrite_allowed" long:"namespace_overwrite_allowed" env:"KUBERNETES_NAMESPACE_OVERWRITE_ALLOWED" description:"Regex to validate 'KUBERNETES_NAMESPACE_OVERWRITE' value"`
-	Privileged                                        *bool                              `toml:"privileged,omitzero" json:"privileged,omitempty" long:"privileged" env:"KUBERNETES_PRIVILEGED" description:"Run all containers with the privileged flag enabled"`
-	RuntimeClassName                                  *string                            `toml:"runtime_class_name,omitempty" json:"runtime_class_name,omitempty" long:"runtime-class-name" env:"KUBERNETES_RUNTIME_CLASS_NAME" description:"A Runtime Class to use for all created pods, errors if the feature is unsupported by the cluster"`
-	AllowPrivilegeEscalation                          *bool                              `toml:"allow_privilege_escalation,omitzero" json:"allow_privilege_escalation,omitempty" long:"allow-privilege-escalation" env:"KUBERNETES_ALLOW_PRIVILEGE_ESCALATION" description:"Run all containers with the security context allowPrivilegeEscalation flag enabled. When empty, it does not define the allowPrivilegeEscalation flag in the container SecurityContext and allows Kubernetes to use the default privilege escalation behavior."`
-	CPULimit                                          string                             `toml:"cpu_limit,omitempty" json:"cpu_limit" long:"cpu-limit" env:"KUBERNETES_CPU_LIMIT" description:"The CPU allocation given to build containers"`
-	CPULimitOverwriteMaxAllowed                       string                             `toml:"cpu_limit_overwrite_max_allowed,omitempty" json:"cpu_limit_overwrite_max_allowed" long:"cpu-limit-overwrite-max-allowed" env:"KUBERNETES_CPU_LIMIT_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the cpu limit can be set to. Used with the KUBERNETES_CPU_LIMIT variable in the build."`
-	CPURequest                                        string                             `toml:"cpu_request,omitempty" json:"cpu_request" long:"cpu-request" env:"KUBERNETES_CPU_REQUEST" description:"The CPU allocation requested for build containers"`
-	CPURequestOverwriteMaxAllowed                     string                             `toml:"cpu_request_overwrite_max_allowed,omitempty" json:"cpu_request_overwrite_max_allowed" long:"cpu-request-overwrite-max-allowed" env:"KUBERNETES_CPU_REQUEST_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the cpu request can be set to. Used with the KUBERNETES_CPU_REQUEST variable in the build."`
-	MemoryLimit                                       string                             `toml:"memory_limit,omitempty" json:"memory_limit" long:"memory-limit" env:"KUBERNETES_MEMORY_LIMIT" description:"The amount of memory allocated to build containers"`
-	MemoryLimitOverwriteMaxAllowed                    string                             `toml:"memory_limit_overwrite_max_allowed,omitempty" json:"memory_limit_overwrite_max_allowed" long:"memory-limit-overwrite-max-allowed" env:"KUBERNETES_MEMORY_LIMIT_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the memory limit can be set to. Used with the KUBERNETES_MEMORY_LIMIT variable in the build."`
-	MemoryRequest                                     string                             `toml:"memory_request,omitempty" json:"memory_request" long:"memory-request" env:"KUBERNETES_MEMORY_REQUEST" description:"The amount of memory requested from build containers"`
-	MemoryRequestOverwriteMaxAllowed                  string                             `toml:"memory_request_overwrite_max_allowed,omitempty" json:"memory_request_overwrite_max_allowed" long:"memory-request-overwrite-max-allowed" env:"KUBERNETES_MEMORY_REQUEST_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the memory request can be set to. Used with the KUBERNETES_MEMORY_REQUEST variable in the build."`
-	EphemeralStorageLimit                             string                             `toml:"ephemeral_storage_limit,omitempty" json:"ephemeral_storage_limit" long:"ephemeral-storage-limit" env:"KUBERNETES_EPHEMERAL_STORAGE_LIMIT" description:"The amount of ephemeral storage allocated to build containers"`
-	EphemeralStorageLimitOverwriteMaxAllowed          string                             `toml:"ephemeral_storage_limit_overwrite_max_allowed,omitempty" json:"ephemeral_storage_limit_overwrite_max_allowed" long:"ephemeral-storage-limit-overwrite-max-allowed" env:"KUBERNETES_EPHEMERAL_STORAGE_LIMIT_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the ephemeral limit can be set to. Used with the KUBERNETES_EPHEMERAL_STORAGE_LIMIT variable in the build."`
-	EphemeralStorageRequest                           string                             `toml:"ephemeral_storage_request,omitempty" json:"ephemeral_storage_request" long:"ephemeral-storage-request" env:"KUBERNETES_EPHEMERAL_STORAGE_REQUEST" description:"The amount of ephemeral storage requested from build containers"`
-	EphemeralStorageRequestOverwriteMaxAllowed        string                             `toml:"ephemeral_storage_request_overwrite_max_allowed,omitempty" json:"ephemeral_storage_request_overwrite_max_allowed" long:"ephemeral-storage-request-overwrite-max-allowed" env:"KUBERNETES_EPHEMERAL_STORAGE_REQUEST_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the ephemeral storage request can be set to. Used with the KUBERNETES_EPHEMERAL_STORAGE_REQUEST variable in the build."`
-	ServiceCPULimit                                   string                             `toml:"service_cpu_limit,omitempty" json:"service_cpu_limit" long:"service-cpu-limit" env:"KUBERNETES_SERVICE_CPU_LIMIT" description:"The CPU allocation given to build service containers"`
-	ServiceCPULimitOverwriteMaxAllowed                string                             `toml:"service_cpu_limit_overwrite_max_allowed,omitempty" json:"service_cpu_limit_overwrite_max_allowed" long:"service-cpu-limit-overwrite-max-allowed" env:"KUBERNETES_SERVICE_CPU_LIMIT_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the service cpu limit can be set to. Used with the KUBERNETES_SERVICE_CPU_LIMIT variable in the build."`
-	ServiceCPURequest                                 string                             `toml:"service_cpu_request,omitempty" json:"service_cpu_request" long:"service-cpu-request" env:"KUBERNETES_SERVICE_CPU_REQUEST" description:"The CPU allocation requested for build service containers"`
-	ServiceCPURequestOverwriteMaxAllowed              string                             `toml:"service_cpu_request_overwrite_max_allowed,omitempty" json:"service_cpu_request_overwrite_max_allowed" long:"service-cpu-request-overwrite-max-allowed" env:"KUBERNETES_SERVICE_CPU_REQUEST_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the service cpu request can be set to. Used with the KUBERNETES_SERVICE_CPU_REQUEST variable in the build."`
-	ServiceMemoryLimit                                string                             `toml:"service_memory_limit,omitempty" json:"service_memory_limit" long:"service-memory-limit" env:"KUBERNETES_SERVICE_MEMORY_LIMIT" description:"The amount of memory allocated to build service containers"`
-	ServiceMemoryLimitOverwriteMaxAllowed             string                             `toml:"service_memory_limit_overwrite_max_allowed,omitempty" json:"service_memory_limit_overwrite_max_allowed" long:"service-memory-limit-overwrite-max-allowed" env:"KUBERNETES_SERVICE_MEMORY_LIMIT_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the service memory limit can be set to. Used with the KUBERNETES_SERVICE_MEMORY_LIMIT variable in the build."`
-	ServiceMemoryRequest                              string                             `toml:"service_memory_request,omitempty" json:"service_memory_request" long:"service-memory-request" env:"KUBERNETES_SERVICE_MEMORY_REQUEST" description:"The amount of memory requested for build service containers"`
-	ServiceMemoryRequestOverwriteMaxAllowed           string                             `toml:"service_memory_request_overwrite_max_allowed,omitempty" json:"service_memory_request_overwrite_max_allowed" long:"service-memory-request-overwrite-max-allowed" env:"KUBERNETES_SERVICE_MEMORY_REQUEST_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the service memory request can be set to. Used with the KUBERNETES_SERVICE_MEMORY_REQUEST variable in the build."`
-	ServiceEphemeralStorageLimit                      string                             `toml:"service_ephemeral_storage_limit,omitempty" json:"service_ephemeral_storage_limit" long:"service-ephemeral_storage-limit" env:"KUBERNETES_SERVICE_EPHEMERAL_STORAGE_LIMIT" description:"The amount of ephemeral storage allocated to build service containers"`
-	ServiceEphemeralStorageLimitOverwriteMaxAllowed   string                             `toml:"service_ephemeral_storage_limit_overwrite_max_allowed,omitempty" json:"service_ephemeral_storage_limit_overwrite_max_allowed" long:"service-ephemeral_storage-limit-overwrite-max-allowed" env:"KUBERNETES_SERVICE_EPHEMERAL_STORAGE_LIMIT_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the service ephemeral storage limit can be set to. Used with the KUBERNETES_SERVICE_EPHEMERAL_STORAGE_LIMIT variable in the build."`
-	ServiceEphemeralStorageRequest                    string                             `toml:"service_ephemeral_storage_request,omitempty" json:"service_ephemeral_storage_request" long:"service-ephemeral_storage-request" env:"KUBERNETES_SERVICE_EPHEMERAL_STORAGE_REQUEST" description:"The amount of ephemeral storage requested for build service containers"`
-	ServiceEphemeralStorageRequestOverwriteMaxAllowed string                             `toml:"service_ephemeral_storage_request_overwrite_max_allowed,omitempty" json:"service_ephemeral_storage_request_overwrite_max_allowed" long:"service-ephemeral_storage-request-overwrite-max-allowed" env:"KUBERNETES_SERVICE_EPHEMERAL_STORAGE_REQUEST_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the service ephemeral storage request can be set to. Used with the KUBERNETES_SERVICE_EPHEMERAL_STORAGE_REQUEST variable in the build."`
-	HelperCPULimit                                    string                             `toml:"helper_cpu_limit,omitempty" json:"helper_cpu_limit" long:"helper-cpu-limit" env:"KUBERNETES_HELPER_CPU_LIMIT" description:"The CPU allocation given to build helper containers"`
-	HelperCPULimitOverwriteMaxAllowed                 string                             `toml:"helper_cpu_limit_overwrite_max_allowed,omitempty" json:"helper_cpu_limit_overwrite_max_allowed" long:"helper-cpu-limit-overwrite-max-allowed" env:"KUBERNETES_HELPER_CPU_LIMIT_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the helper cpu limit can be set to. Used with the KUBERNETES_HELPER_CPU_LIMIT variable in the build."`
-	HelperCPURequest                                  string                             `toml:"helper_cpu_request,omitempty" json:"helper_cpu_request" long:"helper-cpu-request" env:"KUBERNETES_HELPER_CPU_REQUEST" description:"The CPU allocation requested for build helper containers"`
-	HelperCPURequestOverwriteMaxAllowed               string                             `toml:"helper_cpu_request_overwrite_max_allowed,omitempty" json:"helper_cpu_request_overwrite_max_allowed" long:"helper-cpu-request-overwrite-max-allowed" env:"KUBERNETES_HELPER_CPU_REQUEST_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the helper cpu request can be set to. Used with the KUBERNETES_HELPER_CPU_REQUEST variable in the build."`
-	HelperMemoryLimit                                 string                             `toml:"helper_memory_limit,omitempty" json:"helper_memory_limit" long:"helper-memory-limit" env:"KUBERNETES_HELPER_MEMORY_LIMIT" description:"The amount of memory allocated to build helper containers"`
-	HelperMemoryLimitOverwriteMaxAllowed              string                             `toml:"helper_memory_limit_overwrite_max_allowed,omitempty" json:"helper_memory_limit_overwrite_max_allowed" long:"helper-memory-limit-overwrite-max-allowed" env:"KUBERNETES_HELPER_MEMORY_LIMIT_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the helper memory limit can be set to. Used with the KUBERNETES_HELPER_MEMORY_LIMIT variable in the build."`
-	HelperMemoryRequest                               string                             `toml:"helper_memory_request,omitempty" json:"helper_memory_request" long:"helper-memory-request" env:"KUBERNETES_HELPER_MEMORY_REQUEST" description:"The amount of memory requested for build helper containers"`
-	HelperMemoryRequestOverwriteMaxAllowed            string                             `toml:"helper_memory_request_overwrite_max_allowed,omitempty" json:"helper_memory_request_overwrite_max_allowed" long:"helper-memory-request-overwrite-max-allowed" env:"KUBERNETES_HELPER_MEMORY_REQUEST_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the helper memory request can be set to. Used with the KUBERNETES_HELPER_MEMORY_REQUEST variable in the build."`
-	HelperEphemeralStorageLimit                       string                             `toml:"helper_ephemeral_storage_limit,omitempty" json:"helper_ephemeral_storage_limit" long:"helper-ephemeral_storage-limit" env:"KUBERNETES_HELPER_EPHEMERAL_STORAGE_LIMIT" description:"The amount of ephemeral storage allocated to build helper containers"`
-	HelperEphemeralStorageLimitOverwriteMaxAllowed    string                             `toml:"helper_ephemeral_storage_limit_overwrite_max_allowed,omitempty" json:"helper_ephemeral_storage_limit_overwrite_max_allowed" long:"helper-ephemeral_storage-limit-overwrite-max-allowed" env:"KUBERNETES_HELPER_EPHEMERAL_STORAGE_LIMIT_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the helper ephemeral storage limit can be set to. Used with the KUBERNETES_HELPER_EPHEMERAL_STORAGE_LIMIT variable in the build."`
-	HelperEphemeralStorageRequest                     string                             `toml:"helper_ephemeral_storage_request,omitempty" json:"helper_ephemeral_storage_request" long:"helper-ephemeral_storage-request" env:"KUBERNETES_HELPER_EPHEMERAL_STORAGE_REQUEST" description:"The amount of ephemeral storage requested for build helper containers"`
-	HelperEphemeralStorageRequestOverwriteMaxAllowed  string                             `toml:"helper_ephemeral_storage_request_overwrite_max_allowed,omitempty" json:"helper_ephemeral_storage_request_overwrite_max_allowed" long:"helper-ephemeral_storage-request-overwrite-max-allowed" env:"KUBERNETES_HELPER_EPHEMERAL_STORAGE_REQUEST_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the helper ephemeral storage request can be set to. Used with the KUBERNETES_HELPER_EPHEMERAL_STORAGE_REQUEST variable in the build."`
-	AllowedImages                                     []string                           `toml:"allowed_images,omitempty" json:"allowed_images,omitempty" long:"allowed-images" env:"KUBERNETES_ALLOWED_IMAGES" description:"Image allowlist"`
-	AllowedPullPolicies                               []DockerPullPolicy                 `toml:"allowed_pull_policies,omitempty" json:"allowed_pull_policies,omitempty" long:"allowed-pull-policies" env:"KUBERNETES_ALLOWED_PULL_POLICIES" description:"Pull policy allowlist"`
-	AllowedServices                                   []string                           `toml:"allowed_services,omitempty" json:"allowed_services,omitempty" long:"allowed-services" env:"KUBERNETES_ALLOWED_SERVICES" description:"Service allowlist"`
-	PullPolicy                                        StringOrArray                      `toml:"pull_policy,omitempty" json:"pull_policy" long:"pull-policy" env:"KUBERNETES_PULL_POLICY" description:"Policy for if/when to pull a container image (never, if-not-present, always). The cluster default will be used if not set"`
-	NodeSelector                                      map[string]string                  `toml:"node_selector,omitempty" json:"node_selector,omitempty" long:"node-selector" env:"KUBERNETES_NODE_SELECTOR" description:"A toml table/json object of key:value. Value is expected to be a string. When set this will create pods on k8s nodes that match all the key:value pairs. Only one selector is supported through environment variable configuration."`
-	NodeSelectorOverwriteAllowed                      string                             `toml:"node_selector_overwrite_allowed" json:"node_selector_overwrite_allowed" long:"node_selector_overwrite_allowed" env:"KUBERNETES_NODE_SELECTOR_OVERWRITE_ALLOWED" description:"Regex to validate 'KUBERNETES_NODE_SELECTOR_*' values"`
-	NodeTolerations                                   map[string]string                  `toml:"node_tolerations,omitempty" json:"node_tolerations,omitempty" long:"node-tolerations" env:"KUBERNETES_NODE_TOLERATIONS" description:"A toml table/json object of key=value:effect. Value and effect are expected to be strings. When set, pods will tolerate the given taints. Only one toleration is supported through environment variable configuration."`
-	Affinity                                          KubernetesAffinity                 `toml:"affinity,omitempty" json:"affinity" long:"affinity" description:"Kubernetes Affinity setting that is used to select the node that spawns a pod"`
-	ImagePullSecrets                                  []string                           `toml:"image_pull_secrets,omitempty" json:"image_pull_secrets,omitempty" long:"image-pull-secrets" env:"KUBERNETES_IMAGE_PULL_SECRETS" description:"A list of image pull secrets that are used for pulling docker image"`
-	HelperImage                                       string                             `toml:"helper_image,omitempty" json:"helper_image" long:"helper-image" env:"KUBERNETES_HELPER_IMAGE" description:"[ADVANCED] Override the default helper image used to clone repos and upload artifacts"`
-	HelperImageFlavor                                 string                             `toml:"helper_image_flavor,omitempty" json:"helper_image_flavor" long:"helper-image-flavor" env:"KUBERNETES_HELPER_IMAGE_FLAVOR" description:"Set helper image flavor (alpine, ubuntu), defaults to alpine"`
-	TerminationGracePeriodSeconds                     *int64                             `toml:"terminationGracePeriodSeconds,omitzero" json:"terminationGracePeriodSeconds,omitempty" long:"terminationGracePeriodSeconds" env:"KUBERNETES_TERMINATIONGRACEPERIODSECONDS" description:"Duration after the processes running in the pod are sent a termination signal and the time when the processes are forcibly halted with a kill signal.DEPRECATED: use KUBERNETES_POD_TERMINATION_GRACE_PERIOD_SECONDS and KUBERNETES_CLEANUP_GRACE_PERIOD_SECONDS instead."`
-	PodTerminationGracePeriodSeconds                  *int64                             `toml:"pod_termination_grace_period_seconds,omitzero" json:"pod_termination_grace_period_seconds,omitempty" long:"pod_termination_grace_period_seconds" env:"KUBERNETES_POD_TERMINATION_GRACE_PERIOD_SECONDS" description:"Pod-level setting which determines the duration in seconds which the pod has to terminate gracefully. After this, the processes are forcibly halted with a kill signal. Ignored if KUBERNETES_TERMINATIONGRACEPERIODSECONDS is specified."`
-	CleanupGracePeriodSeconds                         *int64                             `toml:"cleanup_grace_period_seconds,omitzero" json:"cleanup_grace_period_seconds,omitempty" long:"cleanup_grace_period_seconds" env:"KUBERNETES_CLEANUP_GRACE_PERIOD_SECONDS" description:"When cleaning up a pod on completion of a job, the duration in seconds which the pod has to terminate gracefully. After this, the processes are forcibly halted with a kill signal. Ignored if KUBERNETES_TERMINATIONGRACEPERIODSECONDS is specified."`
-	CleanupResourcesTimeout                           *time.Duration                     `toml:"cleanup_resources_timeout,omitzero" json:"cleanup_resources_timeout,omitempty" long:"cleanup_resources_timeout" env:"KUBERNETES_CLEANUP_RESOURCES_TIMEOUT" description:"The total amount of time for Kubernetes resources to be cleaned up after the job completes. Supported syntax: '1h30m', '300s', '10m'. Default is 5 minutes ('5m')."`
-	PollInterval                                      int                                `toml:"poll_interval,omitzero" json:"poll_interval" long:"poll-interval" env:"KUBERNETES_POLL_INTERVAL" description:"How frequently, in seconds, the runner will poll the Kubernetes pod it has just created to check its status"`
-	PollTimeout                                       int                                `toml:"poll_timeout,omitzero" json:"poll_timeout" long:"poll-timeout" env:"KUBERNETES_POLL_TIMEOUT" description:"The total amount of time, in seconds, that needs to pass before the runner will timeout attempting to connect to the pod it has just created (useful for queueing more builds that the cluster can handle at a time)"`
-	ResourceAvailabilityCheckMaxAttempts              int                                `toml:"resource_availability_check_max_attempts,omitzero" json:"resource_availability_check_max_attempts" long:"resource-availability-check-max-attempts" env:"KUBERNETES_RESOURCE_AVAILABILITY_CHECK_MAX_ATTEMPTS" default:"5" description:"The maximum number of attempts to check if a resource (service account and/or pull secret) set is available before giving up. There is 5 seconds interval between each attempt"`
-	PodLabels                                         map[string]string                  `toml:"pod_labels,omitempty" json:"pod_labels,omitempty" long:"pod-labels" description:"A toml table/json object of key-value. Value is expected to be a string. When set, this will create pods with the given pod labels. Environment variables will be substituted for values here."`
-	PodLabelsOverwriteAllowed                         string                             `toml:"pod_labels_overwrite_allowed" json:"pod_labels_overwrite_allowed" long:"pod_labels_overwrite_allowed" env:"KUBERNETES_POD_LABELS_OVERWRITE_ALLOWED" description:"Regex to validate 'KUBERNETES_POD_LABELS_*' values"`
-	SchedulerName                                     string                             `toml:"scheduler_name,omitempty" json:"scheduler_name" long:"scheduler-name" env:"KUBERNETES_SCHEDULER_NAME" description:"Pods will be scheduled using this scheduler, if it exists"`
-	ServiceAccount                                    string                             `toml:"service_account,omitempty" json:"service_account" long:"service-account" env:"KUBERNETES_SERVICE_ACCOUNT" description:"Executor pods will use this Service Account to talk to kubernetes API"`
-	ServiceAccountOverwriteAllowed                    string                             `toml:"service_account_overwrite_allowed" json:"service_account_overwrite_allowed" long:"service_account_overwrite_allowed" env:"KUBERNETES_SERVICE_ACCOUNT_OVERWRITE_ALLOWED" description:"Regex to validate 'KUBERNETES_SERVICE_ACCOUNT' value"`
-	PodAnnotations                                    map[string]string                  `toml:"pod_annotations,omitempty" json:"pod_annotations,omitempty" long:"pod-annotations" description:"A toml table/json object of key-value. Value is expected to be a string. When set, this will create pods with the given annotations. Can be overwritten in build with KUBERNETES_POD_ANNOTATION_* variables"`
-	PodAnnotationsOverwriteAllowed                    string                             `toml:"pod_annotations_overwrite_allowed" json:"pod_annotations_overwrite_allowed" long:"pod_annotations_overwrite_allowed" env:"KUBERNETES_POD_ANNOTATIONS_OVERWRITE_ALLOWED" description:"Regex to validate 'KUBERNETES_POD_ANNOTATIONS_*' values"`
-	PodSecurityContext                                KubernetesPodSecurityContext       `toml:"pod_security_context,omitempty" namespace:"pod-security-context" description:"A security context attached to each build pod"`
-	InitPermissionsContainerSecurityContext           KubernetesContainerSecurityContext `toml:"init_permissions_container_security_context,omitempty" namespace:"init_permissions_container_security_context" description:"A security context attached to the init-permissions container inside the build pod"`
-	BuildContainerSecurityContext                     KubernetesContainerSecurityContext `toml:"build_container_security_context,omitempty" namespace:"build_container_security_context" description:"A security context attached to the build container inside the build pod"`
-	HelperContainerSecurityContext                    KubernetesContainerSecurityContext `toml:"helper_container_security_context,omitempty" namespace:"helper_container_security_context" description:"A security context attached to the helper container inside the build pod"`
-	ServiceContainerSecurityContext                   KubernetesContainerSecurityContext `toml:"service_container_security_context,omitempty" namespace:"service_container_security_context" description:"A security context attached to the service containers inside the build pod"`
-	Volumes                                           KubernetesVolumes                  `toml:"volumes"`
-	HostAliases                                       []KubernetesHostAliases            `toml:"host_aliases,omitempty" json:"host_aliases,omitempty" long:"host_aliases" description:"Add a custom host-to-IP mapping"`
-	Services                                          []Service                          `toml:"services,omitempty" json:"services,omitempty" description:"Add service that is started with container"`
-	CapAdd                                            []string                           `toml:"cap_add" json:"cap_add,omitempty" long:"cap-add" env:"KUBERNETES_CAP_ADD" description:"Add Linux capabilities"`
-	CapDrop                                           []string                           `toml:"cap_drop" json:"cap_drop,omitempty" long:"cap-drop" env:"KUBERNETES_CAP_DROP" description:"Drop Linux capabilities"`
-	DNSPolicy                                         KubernetesDNSPolicy                `toml:"dns_policy,omitempty" json:"dns_policy" long:"dns-policy" env:"KUBERNETES_DNS_POLICY" description:"How Kubernetes should try to resolve DNS from the created pods. If unset, Kubernetes will use the default 'ClusterFirst'. Valid values are: none, default, cluster-first, cluster-first-with-host-net"`
-	DNSConfig                                         KubernetesDNSConfig                `toml:"dns_config" json:"dns_config" description:"Pod DNS config"`
-	ContainerLifecycle                                KubernetesContainerLifecyle        `toml:"container_lifecycle,omitempty" json:"container_lifecycle,omitempty" description:"Actions that the management system should take in response to container lifecycle events"`
-	PriorityClassName                                 string                             `toml:"priority_class_name,omitempty" json:"priority_class_name" long:"priority_class_name" env:"KUBERNETES_PRIORITY_CLASS_NAME" description:"If set, the Kubernetes Priority Class to be set to the Pods"`
-	PodSpec                                           []KubernetesPodSpec                `toml:"pod_spec" json:",omitempty"`
+	Host                                              string                              `toml:"host" json:"host" long:"host" env:"KUBERNETES_HOST" description:"Optional Kubernetes master host URL (auto-discovery attempted if not specified)"`
+	CertFile                                          string                              `toml:"cert_file,omitempty" json:"cert_file" long:"cert-file" env:"KUBERNETES_CERT_FILE" description:"Optional Kubernetes master auth certificate"`
+	KeyFile                                           string                              `toml:"key_file,omitempty" json:"key_file" long:"key-file" env:"KUBERNETES_KEY_FILE" description:"Optional Kubernetes master auth private key"`
+	CAFile                                            string                              `toml:"ca_file,omitempty" json:"ca_file" long:"ca-file" env:"KUBERNETES_CA_FILE" description:"Optional Kubernetes master auth ca certificate"`
+	BearerTokenOverwriteAllowed                       bool                                `toml:"bearer_token_overwrite_allowed" json:"bearer_token_overwrite_allowed" long:"bearer_token_overwrite_allowed" env:"KUBERNETES_BEARER_TOKEN_OVERWRITE_ALLOWED" description:"Bool to authorize builds to specify their own bearer token for creation."`
+	BearerToken                                       string                              `toml:"bearer_token,omitempty" json:"bearer_token" long:"bearer_token" env:"KUBERNETES_BEARER_TOKEN" description:"Optional Kubernetes service account token used to start build pods."`
+	Image                                             string                              `toml:"image" json:"image" long:"image" env:"KUBERNETES_IMAGE" description:"Default docker image to use for builds when none is specified"`
+	Namespace                                         string                              `toml:"namespace" json:"namespace" long:"namespace" env:"KUBERNETES_NAMESPACE" description:"Namespace to run Kubernetes jobs in"`
+	NamespaceOverwriteAllowed                         string                              `toml:"namespace_overwrite_allowed" json:"namespace_overwrite_allowed" long:"namespace_overwrite_allowed" env:"KUBERNETES_NAMESPACE_OVERWRITE_ALLOWED" description:"Regex to validate 'KUBERNETES_NAMESPACE_OVERWRITE' value"`
+	Privileged                                        *bool                               `toml:"privileged,omitzero" json:"privileged,omitempty" long:"privileged" env:"KUBERNETES_PRIVILEGED" description:"Run all containers with the privileged flag enabled"`
+	RuntimeClassName                                  *string                             `toml:"runtime_class_name,omitempty" json:"runtime_class_name,omitempty" long:"runtime-class-name" env:"KUBERNETES_RUNTIME_CLASS_NAME" description:"A Runtime Class to use for all created pods, errors if the feature is unsupported by the cluster"`
+	AllowPrivilegeEscalation                          *bool                               `toml:"allow_privilege_escalation,omitzero" json:"allow_privilege_escalation,omitempty" long:"allow-privilege-escalation" env:"KUBERNETES_ALLOW_PRIVILEGE_ESCALATION" description:"Run all containers with the security context allowPrivilegeEscalation flag enabled. When empty, it does not define the allowPrivilegeEscalation flag in the container SecurityContext and allows Kubernetes to use the default privilege escalation behavior."`
+	CPULimit                                          string                              `toml:"cpu_limit,omitempty" json:"cpu_limit" long:"cpu-limit" env:"KUBERNETES_CPU_LIMIT" description:"The CPU allocation given to build containers"`
+	CPULimitOverwriteMaxAllowed                       string                              `toml:"cpu_limit_overwrite_max_allowed,omitempty" json:"cpu_limit_overwrite_max_allowed" long:"cpu-limit-overwrite-max-allowed" env:"KUBERNETES_CPU_LIMIT_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the cpu limit can be set to. Used with the KUBERNETES_CPU_LIMIT variable in the build."`
+	CPURequest                                        string                              `toml:"cpu_request,omitempty" json:"cpu_request" long:"cpu-request" env:"KUBERNETES_CPU_REQUEST" description:"The CPU allocation requested for build containers"`
+	CPURequestOverwriteMaxAllowed                     string                              `toml:"cpu_request_overwrite_max_allowed,omitempty" json:"cpu_request_overwrite_max_allowed" long:"cpu-request-overwrite-max-allowed" env:"KUBERNETES_CPU_REQUEST_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the cpu request can be set to. Used with the KUBERNETES_CPU_REQUEST variable in the build."`
+	MemoryLimit                                       string                              `toml:"memory_limit,omitempty" json:"memory_limit" long:"memory-limit" env:"KUBERNETES_MEMORY_LIMIT" description:"The amount of memory allocated to build containers"`
+	MemoryLimitOverwriteMaxAllowed                    string                              `toml:"memory_limit_overwrite_max_allowed,omitempty" json:"memory_limit_overwrite_max_allowed" long:"memory-limit-overwrite-max-allowed" env:"KUBERNETES_MEMORY_LIMIT_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the memory limit can be set to. Used with the KUBERNETES_MEMORY_LIMIT variable in the build."`
+	MemoryRequest                                     string                              `toml:"memory_request,omitempty" json:"memory_request" long:"memory-request" env:"KUBERNETES_MEMORY_REQUEST" description:"The amount of memory requested from build containers"`
+	MemoryRequestOverwriteMaxAllowed                  string                              `toml:"memory_request_overwrite_max_allowed,omitempty" json:"memory_request_overwrite_max_allowed" long:"memory-request-overwrite-max-allowed" env:"KUBERNETES_MEMORY_REQUEST_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the memory request can be set to. Used with the KUBERNETES_MEMORY_REQUEST variable in the build."`
+	EphemeralStorageLimit                             string                              `toml:"ephemeral_storage_limit,omitempty" json:"ephemeral_storage_limit" long:"ephemeral-storage-limit" env:"KUBERNETES_EPHEMERAL_STORAGE_LIMIT" description:"The amount of ephemeral storage allocated to build containers"`
+	EphemeralStorageLimitOverwriteMaxAllowed          string                              `toml:"ephemeral_storage_limit_overwrite_max_allowed,omitempty" json:"ephemeral_storage_limit_overwrite_max_allowed" long:"ephemeral-storage-limit-overwrite-max-allowed" env:"KUBERNETES_EPHEMERAL_STORAGE_LIMIT_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the ephemeral limit can be set to. Used with the KUBERNETES_EPHEMERAL_STORAGE_LIMIT variable in the build."`
+	EphemeralStorageRequest                           string                              `toml:"ephemeral_storage_request,omitempty" json:"ephemeral_storage_request" long:"ephemeral-storage-request" env:"KUBERNETES_EPHEMERAL_STORAGE_REQUEST" description:"The amount of ephemeral storage requested from build containers"`
+	EphemeralStorageRequestOverwriteMaxAllowed        string                              `toml:"ephemeral_storage_request_overwrite_max_allowed,omitempty" json:"ephemeral_storage_request_overwrite_max_allowed" long:"ephemeral-storage-request-overwrite-max-allowed" env:"KUBERNETES_EPHEMERAL_STORAGE_REQUEST_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the ephemeral storage request can be set to. Used with the KUBERNETES_EPHEMERAL_STORAGE_REQUEST variable in the build."`
+	ServiceCPULimit                                   string                              `toml:"service_cpu_limit,omitempty" json:"service_cpu_limit" long:"service-cpu-limit" env:"KUBERNETES_SERVICE_CPU_LIMIT" description:"The CPU allocation given to build service containers"`
+	ServiceCPULimitOverwriteMaxAllowed                string                              `toml:"service_cpu_limit_overwrite_max_allowed,omitempty" json:"service_cpu_limit_overwrite_max_allowed" long:"service-cpu-limit-overwrite-max-allowed" env:"KUBERNETES_SERVICE_CPU_LIMIT_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the service cpu limit can be set to. Used with the KUBERNETES_SERVICE_CPU_LIMIT variable in the build."`
+	ServiceCPURequest                                 string                              `toml:"service_cpu_request,omitempty" json:"service_cpu_request" long:"service-cpu-request" env:"KUBERNETES_SERVICE_CPU_REQUEST" description:"The CPU allocation requested for build service containers"`
+	ServiceCPURequestOverwriteMaxAllowed              string                              `toml:"service_cpu_request_overwrite_max_allowed,omitempty" json:"service_cpu_request_overwrite_max_allowed" long:"service-cpu-request-overwrite-max-allowed" env:"KUBERNETES_SERVICE_CPU_REQUEST_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the service cpu request can be set to. Used with the KUBERNETES_SERVICE_CPU_REQUEST variable in the build."`
+	ServiceMemoryLimit                                string                              `toml:"service_memory_limit,omitempty" json:"service_memory_limit" long:"service-memory-limit" env:"KUBERNETES_SERVICE_MEMORY_LIMIT" description:"The amount of memory allocated to build service containers"`
+	ServiceMemoryLimitOverwriteMaxAllowed             string                              `toml:"service_memory_limit_overwrite_max_allowed,omitempty" json:"service_memory_limit_overwrite_max_allowed" long:"service-memory-limit-overwrite-max-allowed" env:"KUBERNETES_SERVICE_MEMORY_LIMIT_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the service memory limit can be set to. Used with the KUBERNETES_SERVICE_MEMORY_LIMIT variable in the build."`
+	ServiceMemoryRequest                              string                              `toml:"service_memory_request,omitempty" json:"service_memory_request" long:"service-memory-request" env:"KUBERNETES_SERVICE_MEMORY_REQUEST" description:"The amount of memory requested for build service containers"`
+	ServiceMemoryRequestOverwriteMaxAllowed           string                              `toml:"service_memory_request_overwrite_max_allowed,omitempty" json:"service_memory_request_overwrite_max_allowed" long:"service-memory-request-overwrite-max-allowed" env:"KUBERNETES_SERVICE_MEMORY_REQUEST_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the service memory request can be set to. Used with the KUBERNETES_SERVICE_MEMORY_REQUEST variable in the build."`
+	ServiceEphemeralStorageLimit                      string                              `toml:"service_ephemeral_storage_limit,omitempty" json:"service_ephemeral_storage_limit" long:"service-ephemeral_storage-limit" env:"KUBERNETES_SERVICE_EPHEMERAL_STORAGE_LIMIT" description:"The amount of ephemeral storage allocated to build service containers"`
+	ServiceEphemeralStorageLimitOverwriteMaxAllowed   string                              `toml:"service_ephemeral_storage_limit_overwrite_max_allowed,omitempty" json:"service_ephemeral_storage_limit_overwrite_max_allowed" long:"service-ephemeral_storage-limit-overwrite-max-allowed" env:"KUBERNETES_SERVICE_EPHEMERAL_STORAGE_LIMIT_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the service ephemeral storage limit can be set to. Used with the KUBERNETES_SERVICE_EPHEMERAL_STORAGE_LIMIT variable in the build."`
+	ServiceEphemeralStorageRequest                    string                              `toml:"service_ephemeral_storage_request,omitempty" json:"service_ephemeral_storage_request" long:"service-ephemeral_storage-request" env:"KUBERNETES_SERVICE_EPHEMERAL_STORAGE_REQUEST" description:"The amount of ephemeral storage requested for build service containers"`
+	ServiceEphemeralStorageRequestOverwriteMaxAllowed string                              `toml:"service_ephemeral_storage_request_overwrite_max_allowed,omitempty" json:"service_ephemeral_storage_request_overwrite_max_allowed" long:"service-ephemeral_storage-request-overwrite-max-allowed" env:"KUBERNETES_SERVICE_EPHEMERAL_STORAGE_REQUEST_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the service ephemeral storage request can be set to. Used with the KUBERNETES_SERVICE_EPHEMERAL_STORAGE_REQUEST variable in the build."`
+	HelperCPULimit                                    string                              `toml:"helper_cpu_limit,omitempty" json:"helper_cpu_limit" long:"helper-cpu-limit" env:"KUBERNETES_HELPER_CPU_LIMIT" description:"The CPU allocation given to build helper containers"`
+	HelperCPULimitOverwriteMaxAllowed                 string                              `toml:"helper_cpu_limit_overwrite_max_allowed,omitempty" json:"helper_cpu_limit_overwrite_max_allowed" long:"helper-cpu-limit-overwrite-max-allowed" env:"KUBERNETES_HELPER_CPU_LIMIT_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the helper cpu limit can be set to. Used with the KUBERNETES_HELPER_CPU_LIMIT variable in the build."`
+	HelperCPURequest                                  string                              `toml:"helper_cpu_request,omitempty" json:"helper_cpu_request" long:"helper-cpu-request" env:"KUBERNETES_HELPER_CPU_REQUEST" description:"The CPU allocation requested for build helper containers"`
+	HelperCPURequestOverwriteMaxAllowed               string                              `toml:"helper_cpu_request_overwrite_max_allowed,omitempty" json:"helper_cpu_request_overwrite_max_allowed" long:"helper-cpu-request-overwrite-max-allowed" env:"KUBERNETES_HELPER_CPU_REQUEST_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the helper cpu request can be set to. Used with the KUBERNETES_HELPER_CPU_REQUEST variable in the build."`
+	HelperMemoryLimit                                 string                              `toml:"helper_memory_limit,omitempty" json:"helper_memory_limit" long:"helper-memory-limit" env:"KUBERNETES_HELPER_MEMORY_LIMIT" description:"The amount of memory allocated to build helper containers"`
+	HelperMemoryLimitOverwriteMaxAllowed              string                              `toml:"helper_memory_limit_overwrite_max_allowed,omitempty" json:"helper_memory_limit_overwrite_max_allowed" long:"helper-memory-limit-overwrite-max-allowed" env:"KUBERNETES_HELPER_MEMORY_LIMIT_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the helper memory limit can be set to. Used with the KUBERNETES_HELPER_MEMORY_LIMIT variable in the build."`
+	HelperMemoryRequest                               string                              `toml:"helper_memory_request,omitempty" json:"helper_memory_request" long:"helper-memory-request" env:"KUBERNETES_HELPER_MEMORY_REQUEST" description:"The amount of memory requested for build helper containers"`
+	HelperMemoryRequestOverwriteMaxAllowed            string                              `toml:"helper_memory_request_overwrite_max_allowed,omitempty" json:"helper_memory_request_overwrite_max_allowed" long:"helper-memory-request-overwrite-max-allowed" env:"KUBERNETES_HELPER_MEMORY_REQUEST_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the helper memory request can be set to. Used with the KUBERNETES_HELPER_MEMORY_REQUEST variable in the build."`
+	HelperEphemeralStorageLimit                       string                              `toml:"helper_ephemeral_storage_limit,omitempty" json:"helper_ephemeral_storage_limit" long:"helper-ephemeral_storage-limit" env:"KUBERNETES_HELPER_EPHEMERAL_STORAGE_LIMIT" description:"The amount of ephemeral storage allocated to build helper containers"`
+	HelperEphemeralStorageLimitOverwriteMaxAllowed    string                              `toml:"helper_ephemeral_storage_limit_overwrite_max_allowed,omitempty" json:"helper_ephemeral_storage_limit_overwrite_max_allowed" long:"helper-ephemeral_storage-limit-overwrite-max-allowed" env:"KUBERNETES_HELPER_EPHEMERAL_STORAGE_LIMIT_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the helper ephemeral storage limit can be set to. Used with the KUBERNETES_HELPER_EPHEMERAL_STORAGE_LIMIT variable in the build."`
+	HelperEphemeralStorageRequest                     string                              `toml:"helper_ephemeral_storage_request,omitempty" json:"helper_ephemeral_storage_request" long:"helper-ephemeral_storage-request" env:"KUBERNETES_HELPER_EPHEMERAL_STORAGE_REQUEST" description:"The amount of ephemeral storage requested for build helper containers"`
+	HelperEphemeralStorageRequestOverwriteMaxAllowed  string                              `toml:"helper_ephemeral_storage_request_overwrite_max_allowed,omitempty" json:"helper_ephemeral_storage_request_overwrite_max_allowed" long:"helper-ephemeral_storage-request-overwrite-max-allowed" env:"KUBERNETES_HELPER_EPHEMERAL_STORAGE_REQUEST_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the helper ephemeral storage request can be set to. Used with the KUBERNETES_HELPER_EPHEMERAL_STORAGE_REQUEST variable in the build."`
+	AllowedImages                                     []string                            `toml:"allowed_images,omitempty" json:"allowed_images,omitempty" long:"allowed-images" env:"KUBERNETES_ALLOWED_IMAGES" description:"Image allowlist"`
+	AllowedPullPolicies                               []DockerPullPolicy                  `toml:"allowed_pull_policies,omitempty" json:"allowed_pull_policies,omitempty" long:"allowed-pull-policies" env:"KUBERNETES_ALLOWED_PULL_POLICIES" description:"Pull policy allowlist"`
+	AllowedServices                                   []string                            `toml:"allowed_services,omitempty" json:"allowed_services,omitempty" long:"allowed-services" env:"KUBERNETES_ALLOWED_SERVICES" description:"Service allowlist"`
+	PullPolicy                                        StringOrArray                       `toml:"pull_policy,omitempty" json:"pull_policy" long:"pull-policy" env:"KUBERNETES_PULL_POLICY" description:"Policy for if/when to pull a container image (never, if-not-present, always). The cluster default will be used if not set"`
+	NodeSelector                                      map[string]string                   `toml:"node_selector,omitempty" json:"node_selector,omitempty" long:"node-selector" env:"KUBERNETES_NODE_SELECTOR" description:"A toml table/json object of key:value. Value is expected to be a string. When set this will create pods on k8s nodes that match all the key:value pairs. Only one selector is supported through environment variable configuration."`
+	NodeSelectorOverwriteAllowed                      string                              `toml:"node_selector_overwrite_allowed" json:"node_selector_overwrite_allowed" long:"node_selector_overwrite_allowed" env:"KUBERNETES_NODE_SELECTOR_OVERWRITE_ALLOWED" description:"Regex to validate 'KUBERNETES_NODE_SELECTOR_*' values"`
+	NodeTolerations                                   map[string]string                   `toml:"node_tolerations,omitempty" json:"node_tolerations,omitempty" long:"node-tolerations" env:"KUBERNETES_NODE_TOLERATIONS" description:"A toml table/json object of key=value:effect. Value and effect are expected to be strings. When set, pods will tolerate the given taints. Only one toleration is supported through environment variable configuration."`
+	Affinity                                          KubernetesAffinity                  `toml:"affinity,omitempty" json:"affinity" long:"affinity" description:"Kubernetes Affinity setting that is used to select the node that spawns a pod"`
+	ImagePullSecrets                                  []string                            `toml:"image_pull_secrets,omitempty" json:"image_pull_secrets,omitempty" long:"image-pull-secrets" env:"KUBERNETES_IMAGE_PULL_SECRETS" description:"A list of image pull secrets that are used for pulling docker image"`
+	HelperImage                                       string                              `toml:"helper_image,omitempty" json:"helper_image" long:"helper-image" env:"KUBERNETES_HELPER_IMAGE" description:"[ADVANCED] Override the default helper image used to clone repos and upload artifacts"`
+	HelperImageFlavor                                 string                              `toml:"helper_image_flavor,omitempty" json:"helper_image_flavor" long:"helper-image-flavor" env:"KUBERNETES_HELPER_IMAGE_FLAVOR" description:"Set helper image flavor (alpine, ubuntu), defaults to alpine"`
+	TerminationGracePeriodSeconds                     *int64                              `toml:"terminationGracePeriodSeconds,omitzero" json:"terminationGracePeriodSeconds,omitempty" long:"terminationGracePeriodSeconds" env:"KUBERNETES_TERMINATIONGRACEPERIODSECONDS" description:"Duration after the processes running in the pod are sent a termination signal and the time when the processes are forcibly halted with a kill signal.DEPRECATED: use KUBERNETES_POD_TERMINATION_GRACE_PERIOD_SECONDS and KUBERNETES_CLEANUP_GRACE_PERIOD_SECONDS instead."`
+	PodTerminationGracePeriodSeconds                  *int64                              `toml:"pod_termination_grace_period_seconds,omitzero" json:"pod_termination_grace_period_seconds,omitempty" long:"pod_termination_grace_period_seconds" env:"KUBERNETES_POD_TERMINATION_GRACE_PERIOD_SECONDS" description:"Pod-level setting which determines the duration in seconds which the pod has to terminate gracefully. After this, the processes are forcibly halted with a kill signal. Ignored if KUBERNETES_TERMINATIONGRACEPERIODSECONDS is specified."`
+	CleanupGracePeriodSeconds                         *int64                              `toml:"cleanup_grace_period_seconds,omitzero" json:"cleanup_grace_period_seconds,omitempty" long:"cleanup_grace_period_seconds" env:"KUBERNETES_CLEANUP_GRACE_PERIOD_SECONDS" description:"When cleaning up a pod on completion of a job, the duration in seconds which the pod has to terminate gracefully. After this, the processes are forcibly halted with a kill signal. Ignored if KUBERNETES_TERMINATIONGRACEPERIODSECONDS is specified."`
+	CleanupResourcesTimeout                           *time.Duration                      `toml:"cleanup_resources_timeout,omitzero" json:"cleanup_resources_timeout,omitempty" long:"cleanup_resources_timeout" env:"KUBERNETES_CLEANUP_RESOURCES_TIMEOUT" description:"The total amount of time for Kubernetes resources to be cleaned up after the job completes. Supported syntax: '1h30m', '300s', '10m'. Default is 5 minutes ('5m')."`
+	PollInterval                                      int                                 `toml:"poll_interval,omitzero" json:"poll_interval" long:"poll-interval" env:"KUBERNETES_POLL_INTERVAL" description:"How frequently, in seconds, the runner will poll the Kubernetes pod it has just created to check its status"`
+	PollTimeout                                       int                                 `toml:"poll_timeout,omitzero" json:"poll_timeout" long:"poll-timeout" env:"KUBERNETES_POLL_TIMEOUT" description:"The total amount of time, in seconds, that needs to pass before the runner will timeout attempting to connect to the pod it has just created (useful for queueing more builds that the cluster can handle at a time)"`
+	ResourceAvailabilityCheckMaxAttempts              int                                 `toml:"resource_availability_check_max_attempts,omitzero" json:"resource_availability_check_max_attempts" long:"resource-availability-check-max-attempts" env:"KUBERNETES_RESOURCE_AVAILABILITY_CHECK_MAX_ATTEMPTS" default:"5" description:"The maximum number of attempts to check if a resource (service account and/or pull secret) set is available before giving up. There is 5 seconds interval between each attempt"`
+	PodLabels                                         map[string]string                   `toml:"pod_labels,omitempty" json:"pod_labels,omitempty" long:"pod-labels" description:"A toml table/json object of key-value. Value is expected to be a string. When set, this will create pods with the given pod labels. Environment variables will be substituted for values here."`
+	PodLabelsOverwriteAllowed                         string                              `toml:"pod_labels_overwrite_allowed" json:"pod_labels_overwrite_allowed" long:"pod_labels_overwrite_allowed" env:"KUBERNETES_POD_LABELS_OVERWRITE_ALLOWED" description:"Regex to validate 'KUBERNETES_POD_LABELS_*' values"`
+	SchedulerName                                     string                              `toml:"scheduler_name,omitempty" json:"scheduler_name" long:"scheduler-name" env:"KUBERNETES_SCHEDULER_NAME" description:"Pods will be scheduled using this scheduler, if it exists"`
+	ServiceAccount                                    string                              `toml:"service_account,omitempty" json:"service_account" long:"service-account" env:"KUBERNETES_SERVICE_ACCOUNT" description:"Executor pods will use this Service Account to talk to kubernetes API"`
+	ServiceAccountOverwriteAllowed                    string                              `toml:"service_account_overwrite_allowed" json:"service_account_overwrite_allowed" long:"service_account_overwrite_allowed" env:"KUBERNETES_SERVICE_ACCOUNT_OVERWRITE_ALLOWED" description:"Regex to validate 'KUBERNETES_SERVICE_ACCOUNT' value"`
+	PodAnnotations                                    map[string]string                   `toml:"pod_annotations,omitempty" json:"pod_annotations,omitempty" long:"pod-annotations" description:"A toml table/json object of key-value. Value is expected to be a string. When set, this will create pods with the given annotations. Can be overwritten in build with KUBERNETES_POD_ANNOTATION_* variables"`
+	PodAnnotationsOverwriteAllowed                    string                              `toml:"pod_annotations_overwrite_allowed" json:"pod_annotations_overwrite_allowed" long:"pod_annotations_overwrite_allowed" env:"KUBERNETES_POD_ANNOTATIONS_OVERWRITE_ALLOWED" description:"Regex to validate 'KUBERNETES_POD_ANNOTATIONS_*' values"`
+	PodSecurityContext                                KubernetesPodSecurityContext        `toml:"pod_security_context,omitempty" namespace:"pod-security-context" description:"A security context attached to each build pod"`
+	InitPermissionsContainerSecurityContext           KubernetesContainerSecurityContext  `toml:"init_permissions_container_security_context,omitempty" namespace:"init_permissions_container_security_context" description:"A security context attached to the init-permissions container inside the build pod"`
+	BuildContainerSecurityContext                     KubernetesContainerSecurityContext  `toml:"build_container_security_context,omitempty" namespace:"build_container_security_context" description:"A security context attached to the build container inside the build pod"`
+	HelperContainerSecurityContext                    KubernetesContainerSecurityContext  `toml:"helper_container_security_context,omitempty" namespace:"helper_container_security_context" description:"A security context attached to the helper container inside the build pod"`
+	ServiceContainerSecurityContext                   KubernetesContainerSecurityContext  `toml:"service_container_security_context,omitempty" namespace:"service_container_security_context" description:"A security context attached to the service containers inside the build pod"`
+	Volumes                                           KubernetesVolumes                   `toml:"volumes"`
+	HostAliases                                       []KubernetesHostAliases             `toml:"host_aliases,omitempty" json:"host_aliases,omitempty" long:"host_aliases" description:"Add a custom host-to-IP mapping"`
+	Services                                          []Service                           `toml:"services,omitempty" json:"services,omitempty" description:"Add service that is started with container"`
+	NativeSidecars                                    bool                                `toml:"native_sidecars,omitzero" json:"native_sidecars" long:"native-sidecars" env:"KUBERNETES_NATIVE_SIDECARS" description:"Run the services as native sidecar containers, which requires Kubernetes 1.28 or later with the SidecarContainers feature gate enabled"`
+	CapAdd                                            []string                            `toml:"cap_add" json:"cap_add,omitempty" long:"cap-add" env:"KUBERNETES_CAP_ADD" description:"Add Linux capabilities"`
+	CapDrop                                           []string                            `toml:"cap_drop" json:"cap_drop,omitempty" long:"cap-drop" env:"KUBERNETES_CAP_DROP" description:"Drop Linux capabilities"`
+	DNSPolicy                                         KubernetesDNSPolicy                 `toml:"dns_policy,omitempty" json:"dns_policy" long:"dns-policy" env:"KUBERNETES_DNS_POLICY" description:"How Kubernetes should try to resolve DNS from the created pods. If unset, Kubernetes will use the default 'ClusterFirst'. Valid values are: none, default, cluster-first, cluster-first-with-host-net"`
+	DNSConfig                                         KubernetesDNSConfig                 `toml:"dns_config" json:"dns_config" description:"Pod DNS config"`
+	ContainerLifecycle                                KubernetesContainerLifecyle         `toml:"container_lifecycle,omitempty" json:"container_lifecycle,omitempty" description:"Actions that the management system should take in response to container lifecycle events"`
+	PriorityClassName                                 string                              `toml:"priority_class_name,omitempty" json:"priority_class_name" long:"priority_class_name" env:"KUBERNETES_PRIORITY_CLASS_NAME" description:"If set, the Kubernetes Priority Class to be set to the Pods"`
+	PodSpec                                           []KubernetesPodSpec                 `toml:"pod_spec" json:",omitempty"`
+	WarmPool                                          *KubernetesWarmPoolConfig           `toml:"warm_pool,omitempty" json:"warm_pool,omitempty" namespace:"warm_pool" description:"Keep build pods scheduled and running before the jobs need them"`
+	WorkspaceSnapshots                                *KubernetesWorkspaceSnapshotsConfig `toml:"workspace_snapshots,omitempty" json:"workspace_snapshots,omitempty" namespace:"workspace_snapshots" description:"Provision the build workspaces from volume snapshots of the previous jobs of the project"`
+	NamespaceLimits                                   *KubernetesNamespaceLimitsConfig    `toml:"namespace_limits,omitempty" json:"namespace_limits,omitempty" namespace:"namespace_limits" description:"Adjust the resources of the build pod to the limit ranges of the namespace, and wait for its resource quotas to allow the pod"`
+	NamespacePerJob                                   *KubernetesNamespacePerJobConfig    `toml:"namespace_per_job,omitempty" json:"namespace_per_job,omitempty" namespace:"namespace_per_job" description:"Run each job in a namespace created for it, and deleted with its resources when the job ends"`
+	OrphanedResourcesGC                               *KubernetesOrphanedGCConfig         `toml:"orphaned_resources_gc,omitempty" json:"orphaned_resources_gc,omitempty" namespace:"orphaned_resources_gc" description:"Periodically delete the pods, secrets, services and config maps left behind by the jobs of the runner"`
+	DebugContainer                                    *KubernetesDebugContainerConfig     `toml:"debug_container,omitempty" json:"debug_container,omitempty" namespace:"debug_container" description:"Open the interactive web terminal in an ephemeral debug container that shares the process namespace of the build container"`
+	MachineClasses                                    []KubernetesMachineClass            `toml:"machine_classes,omitempty" json:",omitempty"`
+	DefaultMachineClass                               string                              `toml:"default_machine_class,omitempty" json:"default_machine_class" long:"default-machine-class" env:"KUBERNETES_DEFAULT_MACHINE_CLASS" description:"Name of the machine class of the jobs that don't select one with the KUBERNETES_MACHINE_CLASS variable"`
+	MachineClassOverwriteAllowed                      string                              `toml:"machine_class_overwrite_allowed,omitempty" json:"machine_class_overwrite_allowed" long:"machine-class-overwrite-allowed" env:"KUBERNETES_MACHINE_CLASS_OVERWRITE_ALLOWED" description:"Regex to validate 'KUBERNETES_MACHINE_CLASS' values"`
 }
 
 type KubernetesPodSpec struct {
@@ -585,6 +709,70 @@ type KubernetesPodSpec struct {
 	PatchType KubernetesPodSpecPatchType `toml:"patch_type"`
 }
 
+type KubernetesWarmPoolConfig struct {
+	Size        int    `toml:"size,omitzero" json:"size" long:"size" env:"KUBERNETES_WARM_POOL_SIZE" description:"The number of idle build pods kept for each pod configuration used by the jobs"`
+	MaxUseCount int    `toml:"max_use_count,omitzero" json:"max_use_count" long:"max-use-count" env:"KUBERNETES_WARM_POOL_MAX_USE_COUNT" description:"The number of jobs a warm pod runs before it's replaced. Defaults to 1"`
+	IdleTimeout string `toml:"idle_timeout,omitempty" json:"idle_timeout" long:"idle-timeout" env:"KUBERNETES_WARM_POOL_IDLE_TIMEOUT" description:"How long the warm pods of a pod configuration no job uses are kept, for example 30m. Defaults to 30m"`
+}
+
+type KubernetesWorkspaceSnapshotsConfig struct {
+	StorageClass  string `toml:"storage_class,omitempty" json:"storage_class" long:"storage-class" env:"KUBERNETES_WORKSPACE_SNAPSHOTS_STORAGE_CLASS" description:"Storage class of the workspace volumes, its CSI driver must support volume snapshots. The default storage class is used if not set"`
+	SnapshotClass string `toml:"snapshot_class,omitempty" json:"snapshot_class" long:"snapshot-class" env:"KUBERNETES_WORKSPACE_SNAPSHOTS_SNAPSHOT_CLASS" description:"Volume snapshot class of the workspace snapshots. The default volume snapshot class is used if not set"`
+	Size          string `toml:"size,omitempty" json:"size" long:"size" env:"KUBERNETES_WORKSPACE_SNAPSHOTS_SIZE" description:"Size of the workspace volumes, for example 20Gi. Defaults to 10Gi"`
+	Retention     int    `toml:"retention,omitzero" json:"retention" long:"retention" env:"KUBERNETES_WORKSPACE_SNAPSHOTS_RETENTION" description:"The number of snapshots kept for each project and ref. Defaults to 1"`
+	MaxAge        string `toml:"max_age,omitempty" json:"max_age" long:"max-age" env:"KUBERNETES_WORKSPACE_SNAPSHOTS_MAX_AGE" description:"How long the snapshots are kept, for example 72h. Defaults to 168h"`
+}
+
+type KubernetesNamespaceLimitsConfig struct {
+	QuotaWaitTimeout string `toml:"quota_wait_timeout,omitempty" json:"quota_wait_timeout" long:"quota-wait-timeout" env:"KUBERNETES_NAMESPACE_LIMITS_QUOTA_WAIT_TIMEOUT" description:"How long to wait for the resource quotas of the namespace to allow the build pod, for example 30m. Defaults to 10m"`
+}
+
+type KubernetesNamespacePerJobConfig struct {
+	Prefix         string            `toml:"prefix,omitempty" json:"prefix" long:"prefix" env:"KUBERNETES_NAMESPACE_PER_JOB_PREFIX" description:"Prefix of the names of the job namespaces. Defaults to ci-job"`
+	Labels         map[string]string `toml:"labels,omitempty" json:"labels,omitempty" long:"labels" description:"A toml table/json object of key-value. The labels set on the job namespaces, for example the Pod Security Admission labels"`
+	NetworkPolicy  string            `toml:"network_policy,omitempty" json:"network_policy" long:"network-policy" env:"KUBERNETES_NAMESPACE_PER_JOB_NETWORK_POLICY" description:"YAML manifest of the NetworkPolicy created in the job namespaces"`
+	ResourceQuota  string            `toml:"resource_quota,omitempty" json:"resource_quota" long:"resource-quota" env:"KUBERNETES_NAMESPACE_PER_JOB_RESOURCE_QUOTA" description:"YAML manifest of the ResourceQuota created in the job namespaces"`
+	ServiceAccount string            `toml:"service_account,omitempty" json:"service_account" long:"service-account" env:"KUBERNETES_NAMESPACE_PER_JOB_SERVICE_ACCOUNT" description:"YAML manifest of the ServiceAccount created in the job namespaces. The build pod runs with it"`
+	Role           string            `toml:"role,omitempty" json:"role" long:"role" env:"KUBERNETES_NAMESPACE_PER_JOB_ROLE" description:"YAML manifest of the Role created in the job namespaces"`
+	RoleBinding    string            `toml:"role_binding,omitempty" json:"role_binding" long:"role-binding" env:"KUBERNETES_NAMESPACE_PER_JOB_ROLE_BINDING" description:"YAML manifest of the RoleBinding created in the job namespaces. The namespace of its ServiceAccount subjects defaults to the job namespace"`
+}
+
+// KubernetesMachineClass is a named set of scheduling and resource settings of
+// the build pod, selected by the jobs with the KUBERNETES_MACHINE_CLASS variable
+type KubernetesMachineClass struct {
+	Name                      string                               `toml:"name" json:"name" description:"Name of the machine class"`
+	NodeSelector              map[string]string                    `toml:"node_selector,omitempty" json:"node_selector,omitempty" description:"A toml table/json object of key:value. Added to the node selector of the runner"`
+	NodeTolerations           map[string]string                    `toml:"node_tolerations,omitempty" json:"node_tolerations,omitempty" description:"A toml table/json object of key=value:effect. Added to the node tolerations of the runner"`
+	Affinity                  *KubernetesAffinity                  `toml:"affinity,omitempty" json:"affinity,omitempty" description:"Replaces the affinity of the runner"`
+	TopologySpreadConstraints []KubernetesTopologySpreadConstraint `toml:"topology_spread_constraints,omitempty" json:"topology_spread_constraints,omitempty" description:"How the build pods of the machine class are spread across the topology domains of the cluster"`
+	RuntimeClassName          string                               `toml:"runtime_class_name,omitempty" json:"runtime_class_name" description:"Replaces the runtime class of the runner"`
+	CPURequest                string                               `toml:"cpu_request,omitempty" json:"cpu_request" description:"Replaces the CPU request of the build container"`
+	CPULimit                  string                               `toml:"cpu_limit,omitempty" json:"cpu_limit" description:"Replaces the CPU limit of the build container"`
+	MemoryRequest             string                               `toml:"memory_request,omitempty" json:"memory_request" description:"Replaces the memory request of the build container"`
+	MemoryLimit               string                               `toml:"memory_limit,omitempty" json:"memory_limit" description:"Replaces the memory limit of the build container"`
+	EphemeralStorageRequest   string                               `toml:"ephemeral_storage_request,omitempty" json:"ephemeral_storage_request" description:"Replaces the ephemeral storage request of the build container"`
+	EphemeralStorageLimit     string                               `toml:"ephemeral_storage_limit,omitempty" json:"ephemeral_storage_limit" description:"Replaces the ephemeral storage limit of the build container"`
+}
+
+type KubernetesTopologySpreadConstraint struct {
+	MaxSkew           int32             `toml:"max_skew" json:"max_skew" description:"The maximum difference of the number of build pods between the topology domains"`
+	TopologyKey       string            `toml:"topology_key" json:"topology_key" description:"The node label of the topology domains, for example topology.kubernetes.io/zone"`
+	WhenUnsatisfiable string            `toml:"when_unsatisfiable,omitempty" json:"when_unsatisfiable" description:"DoNotSchedule or ScheduleAnyway. Defaults to ScheduleAnyway"`
+	MatchLabels       map[string]string `toml:"match_labels,omitempty" json:"match_labels,omitempty" description:"Labels of the pods that are counted. Defaults to the build pods of the machine class"`
+}
+
+type KubernetesDebugContainerConfig struct {
+	Image   string   `toml:"image" json:"image" long:"image" env:"KUBERNETES_DEBUG_CONTAINER_IMAGE" description:"Image of the debug container, for example busybox"`
+	Command []string `toml:"command,omitempty" json:"command,omitempty" long:"command" env:"KUBERNETES_DEBUG_CONTAINER_COMMAND" description:"Command of the debug container, run with a TTY. Defaults to sh"`
+}
+
+type KubernetesOrphanedGCConfig struct {
+	Interval      string `toml:"interval,omitempty" json:"interval" long:"interval" env:"KUBERNETES_ORPHANED_RESOURCES_GC_INTERVAL" description:"How often the orphaned resources are looked for, for example 30m. Defaults to 15m"`
+	GracePeriod   string `toml:"grace_period,omitempty" json:"grace_period" long:"grace-period" env:"KUBERNETES_ORPHANED_RESOURCES_GC_GRACE_PERIOD" description:"How old a resource must be to be deleted when its job isn't running, for example 2h. Defaults to 1h"`
+	DryRun        bool   `toml:"dry_run,omitempty" json:"dry_run" long:"dry-run" env:"KUBERNETES_ORPHANED_RESOURCES_GC_DRY_RUN" description:"Only log the orphaned resources instead of deleting them"`
+	AllNamespaces bool   `toml:"all_namespaces,omitempty" json:"all_namespaces" long:"all-namespaces" env:"KUBERNETES_ORPHANED_RESOURCES_GC_ALL_NAMESPACES" description:"Look for the orphaned resources in all the namespaces instead of the configured namespace only"`
+}
+
 // PodSpecPatch returns the patch data (JSON encoded) and type
 func (s *KubernetesPodSpec) PodSpecPatch() ([]byte, KubernetesPodSpecPatchType, error) {
 	patchBytes := []byte(s.Patch)
@@ -979,16 +1167,19 @@ type Service struct {
 	Command     []string `toml:"command" json:",omitempty" long:"command" description:"Command or script that should be used as the container’s command. Syntax is similar to https://docs.docker.com/engine/reference/builder/#cmd"`
 	Entrypoint  []string `toml:"entrypoint" json:",omitempty" long:"entrypoint" description:"Command or script that should be executed as the container’s entrypoint. syntax is similar to https://docs.docker.com/engine/reference/builder/#entrypoint"`
 	Environment []string `toml:"environment,omitempty" json:"environment,omitempty" long:"env" description:"Custom environment variables injected to service environment"`
+
+	ReadinessProbe *ReadinessProbe `toml:"readiness_probe,omitempty" json:"readiness_probe,omitempty" description:"Probe used to check that the service is ready"`
 }
 
 func (s *Service) Aliases() []string { return strings.Fields(strings.ReplaceAll(s.Alias, ",", " ")) }
 
 func (s *Service) ToImageDefinition() Image {
 	image := Image{
-		Name:       s.Name,
-		Alias:      s.Alias,
-		Command:    s.Command,
-		Entrypoint: s.Entrypoint,
+		Name:           s.Name,
+		Alias:          s.Alias,
+		Command:        s.Command,
+		Entrypoint:     s.Entrypoint,
+		ReadinessProbe: s.ReadinessProbe,
 	}
 
 	for _, environment := range s.Environment {
@@ -1106,6 +1297,8 @@ type RunnerSettings struct {
 	Kubernetes *KubernetesConfig `toml:"kubernetes,omitempty" json:"kubernetes,omitempty" group:"kubernetes executor" namespace:"kubernetes"`
 	Custom     *CustomConfig     `toml:"custom,omitempty" json:"custom,omitempty" group:"custom executor" namespace:"custom"`
 
+	ShellSandbox *ShellSandboxConfig `toml:"shell_sandbox,omitempty" json:"shell_sandbox,omitempty" group:"shell executor sandbox" namespace:"shell_sandbox"`
+
 	Autoscaler *AutoscalerConfig `toml:"autoscaler,omitempty" json:",omitempty"`
 }
 
@@ -1146,6 +1339,8 @@ type Config struct {
 
 	ShutdownTimeout int `toml:"shutdown_timeout,omitempty" json:"shutdown_timeout" description:"Number of seconds until the forceful shutdown operation times out and exits the process"`
 
+	JobStateRecovery bool `toml:"job_state_recovery,omitempty" json:"job_state_recovery" description:"Persist in-flight jobs to a state file, so that jobs orphaned by a runner restart are cleaned up and reported as failed"`
+
 	configSaver ConfigSaver
 }
 
@@ -1279,14 +1474,41 @@ func (c *SessionServer) GetSessionTimeout() time.Duration {
 	return DefaultSessionTimeout
 }
 
+// IsEnabled returns true if a BuildKit daemon should be provisioned for jobs.
+func (c *DockerBuildKitConfig) IsEnabled() bool {
+	return c != nil && c.Enabled
+}
+
+func (c *DockerBuildKitConfig) GetImage() string {
+	if c.Image == "" {
+		return DefaultDockerBuildKitImage
+	}
+
+	return c.Image
+}
+
+func (c *DockerImageVerificationConfig) GetProvider() string {
+	if c.Provider == "" {
+		return DockerImageVerificationProviderCosign
+	}
+
+	return c.Provider
+}
+
 func (c *DockerConfig) GetNanoCPUs() (int64, error) {
-	if c.CPUS == "" {
+	return ParseNanoCPUs(c.CPUS)
+}
+
+// ParseNanoCPUs converts a number of CPUs, as accepted by the --cpus flag of
+// docker run, to the nano CPUs used by the Docker API
+func ParseNanoCPUs(cpus string) (int64, error) {
+	if cpus == "" {
 		return 0, nil
 	}
 
-	cpu, ok := new(big.Rat).SetString(c.CPUS)
+	cpu, ok := new(big.Rat).SetString(cpus)
 	if !ok {
-		return 0, fmt.Errorf("failed to parse %v as a rational number", c.CPUS)
+		return 0, fmt.Errorf("failed to parse %v as a rational number", cpus)
 	}
 
 	nano, _ := cpu.Mul(cpu, big.NewRat(1e9, 1)).Float64()
@@ -1319,6 +1541,73 @@ func (c *DockerConfig) GetMemoryReservation() int64 {
 	return c.getMemoryBytes(c.MemoryReservation, "memory_reservation")
 }
 
+// GetCacheVolumesQuota returns the maximum size in bytes of the cache volumes
+// on the Docker host, or 0 when there's no quota
+func (c *DockerConfig) GetCacheVolumesQuota() (int64, error) {
+	if c.CacheVolumesQuota == "" {
+		return 0, nil
+	}
+
+	quota, err := units.RAMInBytes(c.CacheVolumesQuota)
+	if err != nil {
+		return 0, fmt.Errorf("parsing cache_volumes_quota: %w", err)
+	}
+
+	return quota, nil
+}
+
+// GetTTL returns how long a shared service is kept after the last job using
+// it finished
+func (c *DockerSharedServicesConfig) GetTTL() (time.Duration, error) {
+	if c.TTL == "" {
+		return DefaultDockerSharedServicesTTL, nil
+	}
+
+	ttl, err := time.ParseDuration(c.TTL)
+	if err != nil {
+		return 0, fmt.Errorf("parsing shared services ttl: %w", err)
+	}
+
+	return ttl, nil
+}
+
+// GetMaxAge returns how long the checkpoints of jobs that aren't retried are
+// kept
+func (c *DockerCheckpointConfig) GetMaxAge() (time.Duration, error) {
+	if c.MaxAge == "" {
+		return DefaultDockerCheckpointMaxAge, nil
+	}
+
+	maxAge, err := time.ParseDuration(c.MaxAge)
+	if err != nil {
+		return 0, fmt.Errorf("parsing checkpoint max age: %w", err)
+	}
+
+	if maxAge <= 0 {
+		return 0, fmt.Errorf("checkpoint max age must be positive: %s", c.MaxAge)
+	}
+
+	return maxAge, nil
+}
+
+// GetInterval returns how often the images are pulled by the image warmer
+func (c *DockerImageWarmerConfig) GetInterval() (time.Duration, error) {
+	if c.Interval == "" {
+		return DefaultDockerImageWarmerInterval, nil
+	}
+
+	interval, err := time.ParseDuration(c.Interval)
+	if err != nil {
+		return 0, fmt.Errorf("parsing image warmer interval: %w", err)
+	}
+
+	if interval <= 0 {
+		return 0, fmt.Errorf("image warmer interval must be positive: %s", c.Interval)
+	}
+
+	return interval, nil
+}
+
 func (c *DockerConfig) GetOomKillDisable() *bool {
 	return &c.OomKillDisable
 }
@@ -1356,6 +1645,145 @@ func (c *KubernetesConfig) GetCleanupResourcesTimeout() time.Duration {
 	return *c.CleanupResourcesTimeout
 }
 
+func (c *KubernetesWarmPoolConfig) GetMaxUseCount() int {
+	if c.MaxUseCount <= 0 {
+		return 1
+	}
+
+	return c.MaxUseCount
+}
+
+func (c *KubernetesWorkspaceSnapshotsConfig) GetSize() string {
+	if c.Size == "" {
+		return DefaultKubernetesWorkspaceSize
+	}
+
+	return c.Size
+}
+
+func (c *KubernetesWorkspaceSnapshotsConfig) GetRetention() int {
+	if c.Retention <= 0 {
+		return 1
+	}
+
+	return c.Retention
+}
+
+func (c *KubernetesWorkspaceSnapshotsConfig) GetMaxAge() (time.Duration, error) {
+	if c.MaxAge == "" {
+		return DefaultKubernetesWorkspaceSnapshotMaxAge, nil
+	}
+
+	maxAge, err := time.ParseDuration(c.MaxAge)
+	if err != nil {
+		return 0, fmt.Errorf("parsing workspace snapshots max age: %w", err)
+	}
+
+	if maxAge <= 0 {
+		return 0, fmt.Errorf("workspace snapshots max age must be positive: %s", c.MaxAge)
+	}
+
+	return maxAge, nil
+}
+
+func (c *KubernetesNamespacePerJobConfig) GetPrefix() string {
+	if c.Prefix == "" {
+		return DefaultKubernetesJobNamespacePrefix
+	}
+
+	return c.Prefix
+}
+
+// GetMachineClass returns the machine class with the name, or nil when it isn't
+// defined
+func (c *KubernetesConfig) GetMachineClass(name string) *KubernetesMachineClass {
+	for i := range c.MachineClasses {
+		if c.MachineClasses[i].Name == name {
+			return &c.MachineClasses[i]
+		}
+	}
+
+	return nil
+}
+
+func (c *KubernetesDebugContainerConfig) GetCommand() []string {
+	if len(c.Command) == 0 {
+		return []string{"sh"}
+	}
+
+	return c.Command
+}
+
+func (c *KubernetesOrphanedGCConfig) GetInterval() (time.Duration, error) {
+	if c.Interval == "" {
+		return DefaultKubernetesOrphanedResourcesGCInterval, nil
+	}
+
+	interval, err := time.ParseDuration(c.Interval)
+	if err != nil {
+		return 0, fmt.Errorf("parsing orphaned resources GC interval: %w", err)
+	}
+
+	if interval <= 0 {
+		return 0, fmt.Errorf("orphaned resources GC interval must be positive: %s", c.Interval)
+	}
+
+	return interval, nil
+}
+
+func (c *KubernetesOrphanedGCConfig) GetGracePeriod() (time.Duration, error) {
+	if c.GracePeriod == "" {
+		return DefaultKubernetesOrphanedResourcesGCGracePeriod, nil
+	}
+
+	gracePeriod, err := time.ParseDuration(c.GracePeriod)
+	if err != nil {
+		return 0, fmt.Errorf("parsing orphaned resources GC grace period: %w", err)
+	}
+
+	// the resources of the jobs started while the sweep lists them are only
+	// protected by the grace period
+	if gracePeriod <= 0 {
+		return 0, fmt.Errorf("orphaned resources GC grace period must be positive: %s", c.GracePeriod)
+	}
+
+	return gracePeriod, nil
+}
+
+func (c *KubernetesNamespaceLimitsConfig) GetQuotaWaitTimeout() (time.Duration, error) {
+	if c.QuotaWaitTimeout == "" {
+		return DefaultKubernetesQuotaWaitTimeout, nil
+	}
+
+	timeout, err := time.ParseDuration(c.QuotaWaitTimeout)
+	if err != nil {
+		return 0, fmt.Errorf("parsing namespace limits quota wait timeout: %w", err)
+	}
+
+	if timeout < 0 {
+		return 0, fmt.Errorf("namespace limits quota wait timeout must not be negative: %s", c.QuotaWaitTimeout)
+	}
+
+	return timeout, nil
+}
+
+func (c *KubernetesWarmPoolConfig) GetIdleTimeout() (time.Duration, error) {
+	if c.IdleTimeout == "" {
+		return DefaultKubernetesWarmPoolIdleTimeout, nil
+	}
+
+	timeout, err := time.ParseDuration(c.IdleTimeout)
+	if err != nil {
+		return 0, fmt.Errorf("parsing warm pool idle timeout: %w", err)
+	}
+
+	if timeout <= 0 {
+		return 0, fmt.Errorf("warm pool idle timeout must be positive: %s", c.IdleTimeout)
+	}
+
+	return timeout, nil
+}
+
 func (c *KubernetesConfig) GetPollInterval() int {
 	if c.PollInterval <= 0 {
 		c.PollInterval = KubernetesPollInterval
@@ -1938,9 +2366,18 @@ func (c *Config) LoadConfig(configFile string) error {
 		return err
 	}
 
+	configDir, err := filepath.Abs(filepath.Dir(configFile))
+	if err != nil {
+		return err
+	}
+
 	for _, runner := range c.Runners {
 		runner.rewriteGetSourcesHooks()
 
+		if runner.ShellSandbox != nil {
+			runner.ShellSandbox.ConfigDir = configDir
+		}
+
 		if runner.Machine == nil {
 			continue
 		}
@@ -4,6 +4,8 @@ package common
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -2213,3 +2215,143 @@ func TestConfig_GetCleanupResourcesTimeout(t *testing.T) {
 		})
 	}
 }
+
+func TestShellSandboxConfig_GetCgroupLimits(t *testing.T) {
+	tests := map[string]struct {
+		config         string
+		expectedLimits process.CgroupLimits
+		expectedError  string
+	}{
+		"no limits": {
+			config: `
+[[runners]]
+	name = "no limits"
+	executor = "shell"
+	[runners.shell_sandbox]
+		enabled = true`,
+		},
+		"limits": {
+			config: `
+[[runners]]
+	name = "limits"
+	executor = "shell"
+	[runners.shell_sandbox]
+		enabled = true
+		cgroup_parent = "/sys/fs/cgroup/gitlab-runner"
+		cpus = "1.5"
+		memory = "512m"
+		pids_limit = 100`,
+			expectedLimits: process.CgroupLimits{
+				NanoCPUs:    1500000000,
+				MemoryBytes: 512 * 1024 * 1024,
+				PidsLimit:   100,
+			},
+		},
+		"invalid memory": {
+			config: `
+[[runners]]
+	name = "invalid memory"
+	executor = "shell"
+	[runners.shell_sandbox]
+		cgroup_parent = "/sys/fs/cgroup/gitlab-runner"
+		memory = "a lot"`,
+			expectedError: "parsing memory:",
+		},
+		"limits without cgroup parent": {
+			config: `
+[[runners]]
+	name = "limits without cgroup parent"
+	executor = "shell"
+	[runners.shell_sandbox]
+		cpus = "2"`,
+			expectedError: "cgroup_parent is required to limit the resources of the jobs",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := NewConfig()
+			_, err := toml.Decode(tt.config, cfg)
+			require.NoError(t, err)
+
+			limits, err := cfg.Runners[0].ShellSandbox.GetCgroupLimits()
+			if tt.expectedError != "" {
+				assert.ErrorContains(t, err, tt.expectedError)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedLimits, limits)
+		})
+	}
+}
+
+func TestShellSandboxConfig_GetHiddenDirs(t *testing.T) {
+	dir := t.TempDir()
+	configFile := filepath.Join(dir, "config.toml")
+
+	require.NoError(t, os.WriteFile(configFile, []byte(`
+[[runners]]
+	name = "sandbox"
+	executor = "shell"
+	[runners.shell_sandbox]
+		enabled = true
+		hidden_dirs = ["/etc/ssl/private/", ""]
+
+[[runners]]
+	name = "no sandbox"
+	executor = "shell"`), 0o600))
+
+	cfg := NewConfig()
+	require.NoError(t, cfg.LoadConfig(configFile))
+
+	require.NotNil(t, cfg.Runners[0].ShellSandbox)
+	assert.Equal(t, dir, cfg.Runners[0].ShellSandbox.ConfigDir)
+	assert.Equal(t, []string{dir, "/etc/ssl/private"}, cfg.Runners[0].ShellSandbox.GetHiddenDirs())
+	assert.Nil(t, cfg.Runners[1].ShellSandbox)
+
+	assert.Empty(t, new(ShellSandboxConfig).GetHiddenDirs())
+}
+
+func TestKubernetesOrphanedGCConfig_GetGracePeriod(t *testing.T) {
+	tests := map[string]struct {
+		gracePeriod   string
+		expected      time.Duration
+		expectedError string
+	}{
+		"default": {
+			expected: DefaultKubernetesOrphanedResourcesGCGracePeriod,
+		},
+		"configured": {
+			gracePeriod: "30m",
+			expected:    30 * time.Minute,
+		},
+		"zero": {
+			gracePeriod:   "0s",
+			expectedError: "orphaned resources GC grace period must be positive: 0s",
+		},
+		"negative": {
+			gracePeriod:   "-1h",
+			expectedError: "orphaned resources GC grace period must be positive: -1h",
+		},
+		"invalid": {
+			gracePeriod:   "one hour",
+			expectedError: "parsing orphaned resources GC grace period",
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			config := &KubernetesOrphanedGCConfig{GracePeriod: tt.gracePeriod}
+
+			gracePeriod, err := config.GetGracePeriod()
+			if tt.expectedError != "" {
+				assert.ErrorContains(t, err, tt.expectedError)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, gracePeriod)
+		})
+	}
+}
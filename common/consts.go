@@ -14,6 +14,17 @@ const ReloadConfigInterval = 3 * time.Second
 const DefaultUnhealthyRequestsLimit = 3
 const DefaultUnhealthyInterval = 60 * time.Minute
 const DefaultWaitForServicesTimeout = 30
+const DefaultDockerBuildKitImage = "moby/buildkit:rootless"
+const DefaultDockerSharedServicesTTL = 10 * time.Minute
+const DefaultDockerImageWarmerInterval = time.Hour
+const DefaultDockerCheckpointMaxAge = 7 * 24 * time.Hour
+const DefaultKubernetesWarmPoolIdleTimeout = 30 * time.Minute
+const DefaultKubernetesWorkspaceSize = "10Gi"
+const DefaultKubernetesWorkspaceSnapshotMaxAge = 7 * 24 * time.Hour
+const DefaultKubernetesQuotaWaitTimeout = 10 * time.Minute
+const DefaultKubernetesJobNamespacePrefix = "ci-job"
+const DefaultKubernetesOrphanedResourcesGCInterval = 15 * time.Minute
+const DefaultKubernetesOrphanedResourcesGCGracePeriod = time.Hour
 const DefaultShutdownTimeout = 30 * time.Second
 const PreparationRetries = 3
 const DefaultGetSourcesAttempts = 1
@@ -32,6 +43,7 @@ const DefaultSessionTimeout = 30 * time.Minute
 const WaitForBuildFinishTimeout = 5 * time.Minute
 const SecretVariableDefaultsToFile = true
 const TokenResetIntervalFactor = 0.75
+const OrphanedJobCleanupTimeout = 5 * time.Minute
 
 const (
 	DefaultTraceOutputLimit = 4 * 1024 * 1024 // in bytes
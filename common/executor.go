@@ -77,6 +77,14 @@ type Executor interface {
 	SetCurrentStage(stage ExecutorStage)
 }
 
+// CheckpointableExecutor is implemented by executors that are able to save the state
+// of a job aborted by the runner's shutdown, for a retry of the job to resume from.
+type CheckpointableExecutor interface {
+	// Checkpoint saves the state of the job and stops it. It's called while the
+	// job is still running, before the job's context is cancelled.
+	Checkpoint(ctx context.Context) error
+}
+
 type ManagedExecutorProvider interface {
 	// Init initializes the executor provider.
 	//
@@ -103,6 +111,23 @@ type ManagedExecutorProvider interface {
 	Shutdown(ctx context.Context)
 }
 
+// OrphanedJobCleaner is implemented by executor providers that are able to remove the
+// resources of jobs that were still running when the previous runner process terminated.
+type OrphanedJobCleaner interface {
+	// CleanupOrphanedJob removes the resources recorded for the job. Resources that
+	// no longer exist must not be reported as an error.
+	CleanupOrphanedJob(ctx context.Context, config *RunnerConfig, job JobStateEntry) error
+}
+
+// ConfigurableExecutorProvider is implemented by executor providers that run background
+// tasks driven by the configuration of the runners.
+type ConfigurableExecutorProvider interface {
+	// Configure is called with the configuration of all the runners every time it's loaded.
+	//
+	// Configure MUST BE NON-BLOCKING!
+	Configure(runners []*RunnerConfig)
+}
+
 // ExecutorProvider is responsible for managing the lifetime of executors, acquiring resources,
 // retrieving executor metadata, etc.
 //
@@ -0,0 +1,197 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	ExecutorResourceContainer = "container"
+	ExecutorResourceNetwork   = "network"
+	ExecutorResourcePod       = "pod"
+	ExecutorResourceSecret    = "secret"
+)
+
+// ExecutorResource describes a resource created by an executor for a job,
+// e.g. a container or a pod, which may outlive the runner process.
+type ExecutorResource struct {
+	Type      string `json:"type"`
+	ID        string `json:"id"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// JobStateEntry is the persisted state of a single in-flight job. It holds
+// everything that is needed to clean up the job's resources and to report
+// the job's failure to GitLab after the runner process was restarted.
+type JobStateEntry struct {
+	ID        int64     `json:"id"`
+	Token     string    `json:"token"`
+	URL       string    `json:"url"`
+	Runner    string    `json:"runner"`
+	RunnerID  int64     `json:"runner_id,omitempty"`
+	Executor  string    `json:"executor"`
+	StartedAt time.Time `json:"started_at"`
+
+	Resources []ExecutorResource `json:"resources,omitempty"`
+}
+
+// Credentials returns the job credentials that can be used to update the job
+// in GitLab.
+func (e *JobStateEntry) Credentials() *JobCredentials {
+	return &JobCredentials{
+		ID:    e.ID,
+		Token: e.Token,
+		URL:   e.URL,
+	}
+}
+
+// JobStateStore persists in-flight jobs in a state file, so that a restarted
+// runner process is able to handle jobs orphaned by the previous one.
+type JobStateStore struct {
+	lock     sync.Mutex
+	filePath string
+	jobs     []*JobStateEntry
+}
+
+func NewJobStateStore(filePath string) *JobStateStore {
+	return &JobStateStore{
+		filePath: filePath,
+	}
+}
+
+func (s *JobStateStore) LoadFromFile() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	contents, err := os.ReadFile(s.filePath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("reading job state file: %w", err)
+	}
+
+	var jobs []*JobStateEntry
+	if err := json.Unmarshal(contents, &jobs); err != nil {
+		return fmt.Errorf("parsing job state file: %w", err)
+	}
+
+	s.jobs = jobs
+
+	return nil
+}
+
+// Jobs returns a copy of all jobs currently present in the store.
+func (s *JobStateStore) Jobs() []JobStateEntry {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	jobs := make([]JobStateEntry, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		entry := *job
+		entry.Resources = append([]ExecutorResource(nil), job.Resources...)
+		jobs = append(jobs, entry)
+	}
+
+	return jobs
+}
+
+// Track adds the build to the store and persists the state.
+func (s *JobStateStore) Track(build *Build) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.jobs = append(s.jobs, &JobStateEntry{
+		ID:        build.ID,
+		Token:     build.Token,
+		URL:       build.Runner.URL,
+		Runner:    build.Runner.ShortDescription(),
+		RunnerID:  build.Runner.ID,
+		Executor:  build.Runner.Executor,
+		StartedAt: time.Now().UTC(),
+	})
+
+	return s.save()
+}
+
+// AddResource records a resource created by the executor for the build and
+// persists the state.
+func (s *JobStateStore) AddResource(build *Build, resource ExecutorResource) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	job := s.find(build.Runner.URL, build.ID)
+	if job == nil {
+		return fmt.Errorf("job %d is not tracked", build.ID)
+	}
+
+	for _, r := range job.Resources {
+		if r == resource {
+			return nil
+		}
+	}
+
+	job.Resources = append(job.Resources, resource)
+
+	return s.save()
+}
+
+// Remove removes the job from the store and persists the state.
+func (s *JobStateStore) Remove(url string, id int64) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for i, job := range s.jobs {
+		if job.URL == url && job.ID == id {
+			s.jobs = append(s.jobs[:i], s.jobs[i+1:]...)
+			return s.save()
+		}
+	}
+
+	return nil
+}
+
+func (s *JobStateStore) find(url string, id int64) *JobStateEntry {
+	for _, job := range s.jobs {
+		if job.URL == url && job.ID == id {
+			return job
+		}
+	}
+
+	return nil
+}
+
+// save writes the state to a temporary file first and renames it afterwards,
+// so that a crash while writing never leaves a truncated state file behind.
+func (s *JobStateStore) save() error {
+	err := os.MkdirAll(filepath.Dir(s.filePath), 0700)
+	if err != nil {
+		return fmt.Errorf("creating directory: %w", err)
+	}
+
+	jobs := s.jobs
+	if jobs == nil {
+		jobs = []*JobStateEntry{}
+	}
+
+	contents, err := json.Marshal(jobs)
+	if err != nil {
+		return fmt.Errorf("encoding job state: %w", err)
+	}
+
+	tmpFile := s.filePath + ".tmp"
+	err = os.WriteFile(tmpFile, contents, 0o600)
+	if err != nil {
+		return fmt.Errorf("writing job state file: %w", err)
+	}
+
+	err = os.Rename(tmpFile, s.filePath)
+	if err != nil {
+		return fmt.Errorf("replacing job state file: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,103 @@
+//go:build !integration
+
+package common
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newJobStateTestBuild(id int64) *Build {
+	return &Build{
+		JobResponse: JobResponse{
+			ID:    id,
+			Token: "job-token",
+		},
+		Runner: &RunnerConfig{
+			RunnerCredentials: RunnerCredentials{
+				URL:   "https://gitlab.example.com",
+				Token: "glrt-runner-token",
+			},
+			RunnerSettings: RunnerSettings{
+				Executor: "docker",
+			},
+		},
+	}
+}
+
+func TestJobStateStore(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "state", ".runner_jobs_state")
+
+	store := NewJobStateStore(stateFile)
+	require.NoError(t, store.LoadFromFile())
+	assert.Empty(t, store.Jobs())
+
+	build1 := newJobStateTestBuild(1)
+	build2 := newJobStateTestBuild(2)
+
+	require.NoError(t, store.Track(build1))
+	require.NoError(t, store.Track(build2))
+
+	container := ExecutorResource{Type: ExecutorResourceContainer, ID: "container-id"}
+	require.NoError(t, store.AddResource(build1, container))
+	require.NoError(t, store.AddResource(build1, container))
+	assert.Error(t, store.AddResource(newJobStateTestBuild(3), container))
+
+	info, err := os.Stat(stateFile)
+	require.NoError(t, err)
+	if os.PathSeparator == '/' {
+		assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	}
+
+	loaded := NewJobStateStore(stateFile)
+	require.NoError(t, loaded.LoadFromFile())
+
+	jobs := loaded.Jobs()
+	require.Len(t, jobs, 2)
+	assert.Equal(t, int64(1), jobs[0].ID)
+	assert.Equal(t, "job-token", jobs[0].Token)
+	assert.Equal(t, "https://gitlab.example.com", jobs[0].URL)
+	assert.Equal(t, build1.Runner.ShortDescription(), jobs[0].Runner)
+	assert.Equal(t, "docker", jobs[0].Executor)
+	assert.Equal(t, []ExecutorResource{container}, jobs[0].Resources)
+	assert.Empty(t, jobs[1].Resources)
+
+	require.NoError(t, loaded.Remove("https://gitlab.example.com", 1))
+	require.NoError(t, loaded.Remove("https://gitlab.example.com", 1))
+
+	reloaded := NewJobStateStore(stateFile)
+	require.NoError(t, reloaded.LoadFromFile())
+
+	jobs = reloaded.Jobs()
+	require.Len(t, jobs, 1)
+	assert.Equal(t, int64(2), jobs[0].ID)
+}
+
+func TestJobStateStoreLoadInvalidFile(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), ".runner_jobs_state")
+	require.NoError(t, os.WriteFile(stateFile, []byte("invalid"), 0o600))
+
+	err := NewJobStateStore(stateFile).LoadFromFile()
+	assert.Error(t, err)
+}
+
+func TestBuildRecordExecutorResource(t *testing.T) {
+	build := newJobStateTestBuild(1)
+	resource := ExecutorResource{Type: ExecutorResourcePod, ID: "pod", Namespace: "default"}
+
+	assert.NotPanics(t, func() {
+		build.RecordExecutorResource(resource)
+	})
+
+	var recorded []ExecutorResource
+	build.ResourceRecorder = func(r ExecutorResource) {
+		recorded = append(recorded, r)
+	}
+	build.RecordExecutorResource(resource)
+
+	assert.Equal(t, []ExecutorResource{resource}, recorded)
+}
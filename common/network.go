@@ -32,6 +32,11 @@ const (
 	ImagePullFailure    JobFailureReason = "image_pull_failure"
 	UnknownFailure      JobFailureReason = "unknown_failure"
 
+	PodSchedulingFailure         JobFailureReason = "pod_scheduling_failure"
+	InsufficientResourcesFailure JobFailureReason = "insufficient_resources_failure"
+	VolumeBindingFailure         JobFailureReason = "volume_binding_failure"
+	ResourceQuotaFailure         JobFailureReason = "resource_quota_failure"
+
 	// When defining new job failure reasons, consider if its meaning is
 	// extracted from the scope of already existing one. If yes - update
 	// the failureReasonsCompatibilityMap variable below.
@@ -50,6 +55,10 @@ var (
 		JobExecutionTimeout,
 		ImagePullFailure,
 		UnknownFailure,
+		PodSchedulingFailure,
+		InsufficientResourcesFailure,
+		VolumeBindingFailure,
+		ResourceQuotaFailure,
 	}
 
 	// failureReasonsCompatibilityMap contains a mapping of new failure reasons
@@ -60,7 +69,11 @@ var (
 	// category for them (yet we still need to pass the that value through
 	// supported list check).
 	failureReasonsCompatibilityMap = map[JobFailureReason]JobFailureReason{
-		ImagePullFailure: RunnerSystemFailure,
+		ImagePullFailure:             RunnerSystemFailure,
+		PodSchedulingFailure:         RunnerSystemFailure,
+		InsufficientResourcesFailure: PodSchedulingFailure,
+		VolumeBindingFailure:         PodSchedulingFailure,
+		ResourceQuotaFailure:         RunnerSystemFailure,
 	}
 
 	// A small list of failure reasons that are supported by all
@@ -72,6 +85,18 @@ var (
 	}
 )
 
+// IsKnownFailureReason checks whether the failure reason is one of the failure
+// reasons known to runner
+func IsKnownFailureReason(reason JobFailureReason) bool {
+	for _, known := range allFailureReasons {
+		if reason == known {
+			return true
+		}
+	}
+
+	return false
+}
+
 const (
 	UpdateSucceeded UpdateState = iota
 	UpdateAcceptedButNotCompleted
@@ -292,6 +317,8 @@ type Image struct {
 	Ports        []Port             `json:"ports,omitempty"`
 	Variables    JobVariables       `json:"variables,omitempty"`
 	PullPolicies []DockerPullPolicy `json:"pull_policy,omitempty"`
+
+	ReadinessProbe *ReadinessProbe `json:"readiness_probe,omitempty"`
 }
 
 func (i *Image) Aliases() []string { return strings.Fields(strings.ReplaceAll(i.Alias, ",", " ")) }
@@ -302,6 +329,39 @@ type Port struct {
 	Name     string `json:"name,omitempty"`
 }
 
+const (
+	DefaultReadinessProbeTimeout = 1 * time.Second
+	DefaultReadinessProbePeriod  = 1 * time.Second
+)
+
+// ReadinessProbe defines how to check that a service is ready. The service is
+// probed with the Exec command when set, with an HTTP GET request to HTTPPath
+// when set, or with a TCP connection otherwise.
+type ReadinessProbe struct {
+	Exec           []string `toml:"exec,omitempty" json:"exec,omitempty" description:"Command executed in the service container, the service is ready when it exits with 0"`
+	HTTPPath       string   `toml:"http_path,omitempty" json:"http_path,omitempty" description:"Path requested with HTTP GET, the service is ready when it responds with a 2xx or 3xx status"`
+	Port           int      `toml:"port,omitempty" json:"port,omitempty" description:"Port of the HTTP or TCP probe. Defaults to the exposed ports of the service"`
+	TimeoutSeconds int      `toml:"timeout_seconds,omitempty" json:"timeout_seconds,omitempty" description:"Timeout of each probe attempt, in seconds. Defaults to 1"`
+	PeriodSeconds  int      `toml:"period_seconds,omitempty" json:"period_seconds,omitempty" description:"Delay between probe attempts, in seconds. Defaults to 1"`
+	Retries        int      `toml:"retries,omitempty" json:"retries,omitempty" description:"Number of probe attempts before the service is reported as not ready. When 0, the service is probed until the services wait timeout"`
+}
+
+func (p *ReadinessProbe) GetTimeout() time.Duration {
+	if p.TimeoutSeconds <= 0 {
+		return DefaultReadinessProbeTimeout
+	}
+
+	return time.Duration(p.TimeoutSeconds) * time.Second
+}
+
+func (p *ReadinessProbe) GetPeriod() time.Duration {
+	if p.PeriodSeconds <= 0 {
+		return DefaultReadinessProbePeriod
+	}
+
+	return time.Duration(p.PeriodSeconds) * time.Second
+}
+
 type Services []Image
 
 type ArtifactPaths []string
@@ -0,0 +1,108 @@
+package common
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/docker/go-units"
+
+	"gitlab.com/gitlab-org/gitlab-runner/helpers"
+)
+
+const resourceUsageSectionName = "resource_usage"
+
+// ResourceUsageIO holds the number of bytes transferred in both directions of
+// a disk or network interface.
+type ResourceUsageIO struct {
+	// InBytes is the number of bytes read from disk or received from network.
+	InBytes uint64
+	// OutBytes is the number of bytes written to disk or sent to network.
+	OutBytes uint64
+}
+
+func (io *ResourceUsageIO) Add(other ResourceUsageIO) {
+	io.InBytes += other.InBytes
+	io.OutBytes += other.OutBytes
+}
+
+// ResourceUsage describes the resources consumed by a job's container, pod or
+// process group. Disk and network usage are nil when the executor is not able
+// to measure them.
+type ResourceUsage struct {
+	PeakMemoryBytes uint64
+	CPUSeconds      float64
+	Disk            *ResourceUsageIO
+	Network         *ResourceUsageIO
+}
+
+// ResourceUsageReporter is implemented by executors that are able to measure
+// the resources consumed by the job they've executed.
+type ResourceUsageReporter interface {
+	// ResourceUsage returns the usage accumulated across all the commands run
+	// by the executor so far.
+	ResourceUsage() (*ResourceUsage, error)
+}
+
+func (u *ResourceUsage) lines() []string {
+	return []string{
+		fmt.Sprintf("Peak memory: %s", units.BytesSize(float64(u.PeakMemoryBytes))),
+		fmt.Sprintf("CPU time:    %s", time.Duration(u.CPUSeconds*float64(time.Second)).Round(time.Millisecond)),
+		fmt.Sprintf("Disk I/O:    %s", u.Disk.format("read", "written")),
+		fmt.Sprintf("Network:     %s", u.Network.format("received", "sent")),
+	}
+}
+
+func (io *ResourceUsageIO) format(in string, out string) string {
+	if io == nil {
+		return "not available"
+	}
+
+	return fmt.Sprintf(
+		"%s %s, %s %s",
+		units.BytesSize(float64(io.InBytes)), in,
+		units.BytesSize(float64(io.OutBytes)), out,
+	)
+}
+
+// ResourceUsage returns the resource usage reported by the executor once the
+// job has finished, or nil if it wasn't measured.
+func (b *Build) ResourceUsage() *ResourceUsage {
+	b.statusLock.Lock()
+	defer b.statusLock.Unlock()
+
+	return b.resourceUsage
+}
+
+func (b *Build) reportResourceUsage(executor Executor) {
+	reporter, ok := executor.(ResourceUsageReporter)
+	if !ok {
+		return
+	}
+
+	usage, err := reporter.ResourceUsage()
+	if err != nil {
+		b.Log().WithError(err).Warningln("Failed to measure job resource usage")
+		return
+	}
+	if usage == nil {
+		return
+	}
+
+	b.statusLock.Lock()
+	b.resourceUsage = usage
+	b.statusLock.Unlock()
+
+	section := helpers.BuildSection{
+		Name:        resourceUsageSectionName,
+		SkipMetrics: !b.JobResponse.Features.TraceSections,
+		Run: func() error {
+			b.logger.Println(fmt.Sprintf("%sResource usage%s", helpers.ANSI_BOLD_CYAN, helpers.ANSI_RESET))
+			for _, line := range usage.lines() {
+				b.logger.Println(line)
+			}
+
+			return nil
+		},
+	}
+	_ = section.Execute(&b.logger)
+}
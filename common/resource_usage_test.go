@@ -0,0 +1,88 @@
+//go:build !integration
+
+package common
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type resourceUsageReportingExecutor struct {
+	*MockExecutor
+
+	usage *ResourceUsage
+	err   error
+}
+
+func (e *resourceUsageReportingExecutor) ResourceUsage() (*ResourceUsage, error) {
+	return e.usage, e.err
+}
+
+func TestBuildReportResourceUsage(t *testing.T) {
+	tests := map[string]struct {
+		executor         Executor
+		expectedUsage    *ResourceUsage
+		expectedInTrace  []string
+		expectedNoOutput bool
+	}{
+		"executor not reporting usage": {
+			executor:         NewMockExecutor(t),
+			expectedNoOutput: true,
+		},
+		"usage not measured": {
+			executor:         &resourceUsageReportingExecutor{},
+			expectedNoOutput: true,
+		},
+		"usage measurement failed": {
+			executor:         &resourceUsageReportingExecutor{err: errors.New("metrics not available")},
+			expectedNoOutput: true,
+		},
+		"usage measured": {
+			executor: &resourceUsageReportingExecutor{
+				usage: &ResourceUsage{
+					PeakMemoryBytes: 512 * 1024 * 1024,
+					CPUSeconds:      12.3456,
+					Disk:            &ResourceUsageIO{InBytes: 1024, OutBytes: 2048},
+				},
+			},
+			expectedUsage: &ResourceUsage{
+				PeakMemoryBytes: 512 * 1024 * 1024,
+				CPUSeconds:      12.3456,
+				Disk:            &ResourceUsageIO{InBytes: 1024, OutBytes: 2048},
+			},
+			expectedInTrace: []string{
+				"section_start:",
+				"Resource usage",
+				"Peak memory: 512MiB",
+				"CPU time:    12.346s",
+				"Disk I/O:    1KiB read, 2KiB written",
+				"Network:     not available",
+				"section_end:",
+			},
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			trace := newFakeJobTrace()
+
+			build := &Build{Runner: &RunnerConfig{}}
+			build.JobResponse.Features.TraceSections = true
+			build.logger = newBuildLogger(tn, trace)
+
+			build.reportResourceUsage(tt.executor)
+
+			assert.Equal(t, tt.expectedUsage, build.ResourceUsage())
+
+			output := trace.Read()
+			if tt.expectedNoOutput {
+				assert.Empty(t, output)
+			}
+			for _, expected := range tt.expectedInTrace {
+				assert.Contains(t, output, expected)
+			}
+		})
+	}
+}
@@ -16,6 +16,24 @@ type ConfigExecOutput struct {
 	JobEnv *map[string]string `json:"job_env,omitempty"`
 
 	Shell *string `json:"shell,omitempty"`
+
+	Terminal *TerminalInfo     `json:"terminal,omitempty"`
+	Services []ServiceEndpoint `json:"services,omitempty"`
+
+	Features *FeaturesInfo `json:"features,omitempty"`
+
+	FailureReasons map[int]string `json:"failure_reasons,omitempty"`
+	StageTimeouts  map[string]int `json:"stage_timeouts,omitempty"`
+}
+
+// FeaturesInfo defines the features of the jobs that are supported by the
+// Custom Executor driver. A feature that isn't defined is considered as
+// supported.
+type FeaturesInfo struct {
+	Services        *bool `json:"services,omitempty"`
+	Artifacts       *bool `json:"artifacts,omitempty"`
+	Cache           *bool `json:"cache,omitempty"`
+	SharedBuildsDir *bool `json:"shared_builds_dir,omitempty"`
 }
 
 // DriverInfo wraps the information about Custom Executor driver details
@@ -24,3 +42,26 @@ type DriverInfo struct {
 	Name    *string `json:"name,omitempty"`
 	Version *string `json:"version,omitempty"`
 }
+
+// TerminalInfo defines the command that the Runner starts, with a TTY, for
+// the interactive web terminal sessions, for example a command that opens a
+// shell in the job's environment
+type TerminalInfo struct {
+	Command []string `json:"command"`
+}
+
+// ServiceEndpoint defines a service of the job's environment that the Runner
+// exposes through the session server, like the services of the Kubernetes
+// executor
+type ServiceEndpoint struct {
+	Name  string        `json:"name"`
+	Host  string        `json:"host"`
+	Ports []ServicePort `json:"ports"`
+}
+
+// ServicePort defines a port of a service, its protocol is http or https
+type ServicePort struct {
+	Number   int    `json:"number"`
+	Protocol string `json:"protocol,omitempty"`
+	Name     string `json:"name,omitempty"`
+}
@@ -0,0 +1,132 @@
+package api
+
+import "encoding/json"
+
+// DriverProtocolVersion is the version of the protocol spoken with the
+// drivers configured with driver_exec or driver_socket. The runner refuses
+// to run jobs with a driver that answers the initialize request with another
+// version.
+const DriverProtocolVersion = 1
+
+// Methods of the driver protocol, a JSON-RPC 2.0 protocol with one message
+// per line. The runner sends the initialize, prepare, run, cleanup and
+// terminal/open requests, and the cancel, terminal/input and terminal/close
+// notifications. The driver sends the output, terminal/output and
+// terminal/close notifications.
+const (
+	DriverMethodInitialize     = "initialize"
+	DriverMethodPrepare        = "prepare"
+	DriverMethodRun            = "run"
+	DriverMethodCleanup        = "cleanup"
+	DriverMethodCancel         = "cancel"
+	DriverMethodOutput         = "output"
+	DriverMethodTerminalOpen   = "terminal/open"
+	DriverMethodTerminalInput  = "terminal/input"
+	DriverMethodTerminalOutput = "terminal/output"
+	DriverMethodTerminalClose  = "terminal/close"
+)
+
+// The error codes of the driver responses that fail the job, like the
+// BUILD_FAILURE_EXIT_CODE and SYSTEM_FAILURE_EXIT_CODE exit codes of the
+// executables. Any other error code is handled as a system failure.
+const (
+	DriverBuildFailureErrorCode  = 1
+	DriverSystemFailureErrorCode = 2
+)
+
+// The streams of the output notifications
+const (
+	DriverOutputStdout = "stdout"
+	DriverOutputStderr = "stderr"
+)
+
+// DriverInitializeParams are the parameters of the initialize request, the
+// first request of a job's connection
+type DriverInitializeParams struct {
+	ProtocolVersion int    `json:"protocol_version"`
+	RunnerVersion   string `json:"runner_version"`
+
+	// Job is the job response received from GitLab's API, the content of
+	// the JOB_RESPONSE_FILE of the executables
+	Job json.RawMessage `json:"job"`
+
+	// Env holds the variables of the job, prefixed with CUSTOM_ENV_, like
+	// the environment of the executables
+	Env []string `json:"env"`
+}
+
+// DriverInitializeResult is the result of the initialize request. It holds
+// the same configuration values as the output of config_exec.
+type DriverInitializeResult struct {
+	ProtocolVersion int `json:"protocol_version"`
+
+	ConfigExecOutput
+}
+
+// DriverPrepareParams are the parameters of the prepare request
+type DriverPrepareParams struct {
+	Env []string `json:"env"`
+}
+
+// DriverRunParams are the parameters of the run request. The driver sends the
+// output of the script with output notifications for the request, and fails
+// the request with DriverBuildFailureErrorCode when the script fails. The stage
+// is the real name of the stage, the script step is step_script and not
+// build_script like for run_exec.
+type DriverRunParams struct {
+	Env    []string `json:"env"`
+	Stage  string   `json:"stage"`
+	Shell  string   `json:"shell"`
+	Script string   `json:"script"`
+}
+
+// DriverCleanupParams are the parameters of the cleanup request, the last
+// request of a job's connection
+type DriverCleanupParams struct {
+	Env []string `json:"env"`
+}
+
+// DriverCancelParams are the parameters of the cancel notification. The driver
+// should stop the request and answer it, the runner closes the connection when
+// it doesn't answer within graceful_kill_timeout.
+type DriverCancelParams struct {
+	ID int64 `json:"id"`
+}
+
+// DriverOutputParams are the parameters of the output notifications of the
+// prepare and run requests
+type DriverOutputParams struct {
+	RequestID int64  `json:"request_id"`
+	Stream    string `json:"stream"`
+	Data      []byte `json:"data"`
+}
+
+// DriverErrorData is the data of the errors of the driver responses
+type DriverErrorData struct {
+	// ExitCode is the exit code of the job script
+	ExitCode int `json:"exit_code,omitempty"`
+}
+
+// DriverTerminalOpenParams are the parameters of the terminal/open request,
+// for an interactive web terminal session in the job's environment
+type DriverTerminalOpenParams struct {
+	Env []string `json:"env"`
+}
+
+type DriverTerminalOpenResult struct {
+	TerminalID string `json:"terminal_id"`
+}
+
+// DriverTerminalDataParams are the parameters of the terminal/input and
+// terminal/output notifications
+type DriverTerminalDataParams struct {
+	TerminalID string `json:"terminal_id"`
+	Data       []byte `json:"data"`
+}
+
+// DriverTerminalCloseParams are the parameters of the terminal/close
+// notifications, sent by the runner when the user disconnects and by the
+// driver when the terminal's shell exits
+type DriverTerminalCloseParams struct {
+	TerminalID string `json:"terminal_id"`
+}
@@ -28,6 +28,10 @@ var newCommander = process.NewOSCmd
 
 type Options struct {
 	JobResponseFile string
+
+	// FailureReasons maps the exit codes of the executable, other than
+	// BuildFailureExitCode and SystemFailureExitCode, to job failure reasons
+	FailureReasons map[int]common.JobFailureReason
 }
 
 type command struct {
@@ -36,6 +40,8 @@ type command struct {
 
 	waitCh chan error
 
+	failureReasons map[int]common.JobFailureReason
+
 	logger process.Logger
 
 	gracefulKillTimeout time.Duration
@@ -66,6 +72,7 @@ func New(
 		context:             ctx,
 		cmd:                 newCommander(executable, args, cmdOpts),
 		waitCh:              make(chan error),
+		failureReasons:      options.FailureReasons,
 		logger:              cmdOpts.Logger,
 		gracefulKillTimeout: cmdOpts.GracefulKillTimeout,
 		forceKillTimeout:    cmdOpts.ForceKillTimeout,
@@ -100,9 +107,12 @@ func (c *command) waitForCommand() {
 	eerr, ok := err.(*exec.ExitError)
 	if ok {
 		exitCode := getExitCode(eerr)
+		reason, mapped := c.failureReasons[exitCode]
 		switch {
 		case exitCode == BuildFailureExitCode:
 			err = &common.BuildError{Inner: eerr, ExitCode: exitCode}
+		case mapped:
+			err = &common.BuildError{Inner: eerr, ExitCode: exitCode, FailureReason: reason}
 		case exitCode != SystemFailureExitCode:
 			err = &ErrUnknownFailure{Inner: eerr, ExitCode: exitCode}
 		}
@@ -63,6 +63,7 @@ func TestCommand_Run(t *testing.T) {
 		expectedError     string
 		expectedErrorType interface{}
 		expectedExitCode  int
+		expectedReason    common.JobFailureReason
 	}{
 		"error on cmd start()": {
 			cmdStartErr:   errors.New("test-error"),
@@ -88,6 +89,14 @@ func TestCommand_Run(t *testing.T) {
 				"executable execution terminated with: exit status 0",
 			expectedErrorType: &ErrUnknownFailure{},
 		},
+		"command ends with a mapped failure": {
+			cmdWaitErr:        &exec.ExitError{ProcessState: &os.ProcessState{}},
+			getExitCode:       func(err *exec.ExitError) int { return 3 },
+			expectedError:     "exit status 0",
+			expectedErrorType: &common.BuildError{},
+			expectedExitCode:  3,
+			expectedReason:    common.ImagePullFailure,
+		},
 		"command times out": {
 			contextClosed: true,
 			process:       &os.Process{Pid: 1234},
@@ -107,7 +116,9 @@ func TestCommand_Run(t *testing.T) {
 				ForceKillTimeout:    100 * time.Millisecond,
 			}
 
-			commanderMock, processKillWaiterMock, c, cleanup := newCommand(ctx, t, "exec", cmdOpts, Options{})
+			commanderMock, processKillWaiterMock, c, cleanup := newCommand(ctx, t, "exec", cmdOpts, Options{
+				FailureReasons: map[int]common.JobFailureReason{3: common.ImagePullFailure},
+			})
 			defer cleanup()
 
 			commanderMock.On("Start").
@@ -152,6 +163,7 @@ func TestCommand_Run(t *testing.T) {
 				var buildError *common.BuildError
 				if errors.As(err, &buildError) {
 					assert.Equal(t, tt.expectedExitCode, buildError.ExitCode)
+					assert.Equal(t, tt.expectedReason, buildError.FailureReason)
 				}
 			}
 		})
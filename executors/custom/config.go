@@ -11,6 +11,12 @@ type config struct {
 	*common.CustomConfig
 }
 
+// isDriverMode tells whether the stages of the jobs are run by a driver
+// through the driver protocol, instead of the executables
+func (c *config) isDriverMode() bool {
+	return c.DriverExec != "" || c.DriverSocket != ""
+}
+
 func (c *config) GetConfigExecTimeout() time.Duration {
 	return getDuration(c.ConfigExecTimeout, defaultConfigExecTimeout)
 }
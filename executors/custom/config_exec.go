@@ -0,0 +1,205 @@
+package custom
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/command"
+)
+
+// validate checks the configuration returned by the driver before it's
+// injected into the executor. An invalid configuration is a system failure,
+// while a job using a feature that the driver doesn't support is a build
+// failure.
+func (c *ConfigExecOutput) validate(executor *executor) error {
+	if c.Features != nil && c.Features.SharedBuildsDir != nil &&
+		c.BuildsDirIsShared != nil && *c.Features.SharedBuildsDir != *c.BuildsDirIsShared {
+		return errors.New("driver configuration: features.shared_builds_dir conflicts with builds_dir_is_shared")
+	}
+
+	for exitCode, reason := range c.FailureReasons {
+		switch exitCode {
+		case 0, command.BuildFailureExitCode, command.SystemFailureExitCode:
+			return fmt.Errorf("driver configuration: exit code %d can't be mapped to a failure reason", exitCode)
+		}
+
+		if !common.IsKnownFailureReason(common.JobFailureReason(reason)) {
+			return fmt.Errorf("driver configuration: unknown failure reason %q for exit code %d", reason, exitCode)
+		}
+	}
+
+	for stage, timeout := range c.StageTimeouts {
+		if !isKnownRunStage(stage, executor.config.isDriverMode()) {
+			return fmt.Errorf("driver configuration: unknown stage %q in stage_timeouts", stage)
+		}
+
+		if timeout <= 0 {
+			return fmt.Errorf("driver configuration: timeout of stage %q must be positive", stage)
+		}
+	}
+
+	return c.validateJobFeatures(executor.Build)
+}
+
+func (c *ConfigExecOutput) validateJobFeatures(build *common.Build) error {
+	if c.Features == nil {
+		return nil
+	}
+
+	unsupported := func(supported *bool) bool {
+		return supported != nil && !*supported
+	}
+
+	switch {
+	case unsupported(c.Features.Services) && len(build.Services) > 0:
+		return common.MakeBuildError("the job uses services, which aren't supported by the Custom executor driver")
+	case unsupported(c.Features.Artifacts) && len(build.Artifacts) > 0:
+		return common.MakeBuildError("the job uses artifacts, which aren't supported by the Custom executor driver")
+	case unsupported(c.Features.Cache) && len(build.Cache) > 0:
+		return common.MakeBuildError("the job uses cache, which isn't supported by the Custom executor driver")
+	}
+
+	return nil
+}
+
+// isKnownRunStage checks if the stage is a name passed to run_exec, or to the
+// run requests of the driver in driver mode. The steps of a job are only known
+// when it runs, so any step stage is accepted, and a timeout of a stage that
+// the job doesn't run is ignored.
+func isKnownRunStage(stage string, driverMode bool) bool {
+	for _, s := range common.StaticBuildStages() {
+		if stage == runStageName(s, driverMode) {
+			return true
+		}
+	}
+
+	// the script step is passed as build_script to run_exec
+	script := common.StepToBuildStage(common.Step{Name: common.StepNameScript})
+	if stage == runStageName(script, driverMode) {
+		return true
+	}
+
+	return strings.HasPrefix(stage, "step_") && (driverMode || stage != string(script))
+}
+
+// runStageName returns the name of the stage that is passed to the driver.
+// The version 1 of the driver protocol passes the real name of the stages,
+// only run_exec still gets build_script instead of step_script.
+func runStageName(stage common.BuildStage, driverMode bool) string {
+	// TODO: Remove this translation - https://gitlab.com/groups/gitlab-org/-/epics/6112
+	if stage == "step_script" && !driverMode {
+		return "build_script"
+	}
+
+	return string(stage)
+}
+
+// withStageTimeout applies the timeout that the driver defined for the stage,
+// if any, to the context of the stage
+func (e *executor) withStageTimeout(ctx context.Context, stage string) (context.Context, context.CancelFunc) {
+	timeout, ok := e.stageTimeouts[stage]
+	if !ok {
+		return context.WithCancel(ctx)
+	}
+
+	return context.WithTimeout(ctx, timeout)
+}
+
+// stageTimeoutError reports the stages that exceeded the timeout defined by
+// the driver as job execution timeouts
+func (e *executor) stageTimeoutError(ctx context.Context, parent context.Context, stage string, err error) error {
+	if err == nil || parent.Err() != nil || !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return err
+	}
+
+	return &common.BuildError{
+		Inner:         fmt.Errorf("stage %s exceeded the timeout of %v: %w", stage, e.stageTimeouts[stage], err),
+		FailureReason: common.JobExecutionTimeout,
+	}
+}
+
+// logDriverConfig prints the features, failure reasons and stage timeouts
+// defined by the driver in the job log
+func (e *executor) logDriverConfig() {
+	if e.features != nil {
+		var features []string
+		for _, feature := range []struct {
+			name      string
+			supported *bool
+		}{
+			{"services", e.features.Services},
+			{"artifacts", e.features.Artifacts},
+			{"cache", e.features.Cache},
+			{"shared_builds_dir", e.features.SharedBuildsDir},
+		} {
+			if feature.supported != nil {
+				features = append(features, fmt.Sprintf("%s=%t", feature.name, *feature.supported))
+			}
+		}
+
+		if len(features) > 0 {
+			e.Println("Driver features:", strings.Join(features, ", "))
+		}
+	}
+
+	if len(e.failureReasons) > 0 {
+		exitCodes := make([]int, 0, len(e.failureReasons))
+		for exitCode := range e.failureReasons {
+			exitCodes = append(exitCodes, exitCode)
+		}
+		sort.Ints(exitCodes)
+
+		reasons := make([]string, 0, len(exitCodes))
+		for _, exitCode := range exitCodes {
+			reasons = append(reasons, fmt.Sprintf("%d=%s", exitCode, e.failureReasons[exitCode]))
+		}
+
+		e.Println("Driver failure reasons:", strings.Join(reasons, ", "))
+	}
+
+	if len(e.stageTimeouts) > 0 {
+		stages := make([]string, 0, len(e.stageTimeouts))
+		for stage := range e.stageTimeouts {
+			stages = append(stages, stage)
+		}
+		sort.Strings(stages)
+
+		timeouts := make([]string, 0, len(stages))
+		for _, stage := range stages {
+			timeouts = append(timeouts, fmt.Sprintf("%s=%v", stage, e.stageTimeouts[stage]))
+		}
+
+		e.Println("Driver stage timeouts:", strings.Join(timeouts, ", "))
+	}
+}
+
+func failureReasons(reasons map[int]string) map[int]common.JobFailureReason {
+	if len(reasons) == 0 {
+		return nil
+	}
+
+	mapped := make(map[int]common.JobFailureReason, len(reasons))
+	for exitCode, reason := range reasons {
+		mapped[exitCode] = common.JobFailureReason(reason)
+	}
+
+	return mapped
+}
+
+func stageTimeouts(timeouts map[string]int) map[string]time.Duration {
+	if len(timeouts) == 0 {
+		return nil
+	}
+
+	durations := make(map[string]time.Duration, len(timeouts))
+	for stage, timeout := range timeouts {
+		durations[stage] = time.Duration(timeout) * time.Second
+	}
+
+	return durations
+}
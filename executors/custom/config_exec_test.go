@@ -0,0 +1,208 @@
+//go:build !integration
+
+package custom
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/api"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/driver"
+)
+
+func TestConfigExecOutput_Validate(t *testing.T) {
+	tests := map[string]struct {
+		output             string
+		build              common.JobResponse
+		driverMode         bool
+		expectedError      string
+		expectedBuildError bool
+	}{
+		"empty output": {
+			output: `{}`,
+		},
+		"valid output": {
+			output: `{
+				"features": {"services": true, "cache": false, "shared_builds_dir": true},
+				"builds_dir_is_shared": true,
+				"failure_reasons": {"3": "image_pull_failure", "4": "resource_quota_failure"},
+				"stage_timeouts": {"build_script": 3600, "get_sources": 60}
+			}`,
+			build: common.JobResponse{Services: common.Services{{Name: "redis"}}},
+		},
+		"conflicting shared builds dir": {
+			output:        `{"features": {"shared_builds_dir": false}, "builds_dir_is_shared": true}`,
+			expectedError: "driver configuration: features.shared_builds_dir conflicts with builds_dir_is_shared",
+		},
+		"build failure exit code mapped": {
+			output:        `{"failure_reasons": {"1": "image_pull_failure"}}`,
+			expectedError: "driver configuration: exit code 1 can't be mapped to a failure reason",
+		},
+		"unknown failure reason": {
+			output:        `{"failure_reasons": {"3": "driver_failure"}}`,
+			expectedError: `driver configuration: unknown failure reason "driver_failure" for exit code 3`,
+		},
+		"internal failure reason": {
+			output:        `{"failure_reasons": {"3": "job_canceled"}}`,
+			expectedError: `driver configuration: unknown failure reason "job_canceled" for exit code 3`,
+		},
+		"unknown stage": {
+			output:        `{"stage_timeouts": {"nonexistent_stage": 60}}`,
+			expectedError: `driver configuration: unknown stage "nonexistent_stage" in stage_timeouts`,
+		},
+		"script step stage passed as build_script": {
+			output:        `{"stage_timeouts": {"step_script": 60}}`,
+			expectedError: `driver configuration: unknown stage "step_script" in stage_timeouts`,
+		},
+		"script step stage in driver mode": {
+			output:     `{"stage_timeouts": {"step_script": 60}}`,
+			driverMode: true,
+		},
+		"build_script stage in driver mode": {
+			output:        `{"stage_timeouts": {"build_script": 60}}`,
+			driverMode:    true,
+			expectedError: `driver configuration: unknown stage "build_script" in stage_timeouts`,
+		},
+		"stages not run by the job": {
+			output: `{"stage_timeouts": {"step_release": 60, "archive_cache_on_failure": 60}}`,
+		},
+		"invalid stage timeout": {
+			output:        `{"stage_timeouts": {"build_script": 0}}`,
+			expectedError: `driver configuration: timeout of stage "build_script" must be positive`,
+		},
+		"job uses unsupported services": {
+			output:             `{"features": {"services": false}}`,
+			build:              common.JobResponse{Services: common.Services{{Name: "redis"}}},
+			expectedError:      "the job uses services, which aren't supported by the Custom executor driver",
+			expectedBuildError: true,
+		},
+		"job uses unsupported artifacts": {
+			output:             `{"features": {"artifacts": false}}`,
+			build:              common.JobResponse{Artifacts: common.Artifacts{{Paths: common.ArtifactPaths{"out"}}}},
+			expectedError:      "the job uses artifacts, which aren't supported by the Custom executor driver",
+			expectedBuildError: true,
+		},
+		"job uses unsupported cache": {
+			output:             `{"features": {"cache": false}}`,
+			build:              common.JobResponse{Cache: common.Caches{{Key: "key"}}},
+			expectedError:      "the job uses cache, which isn't supported by the Custom executor driver",
+			expectedBuildError: true,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			tt.build.Steps = common.Steps{{Name: common.StepNameScript}}
+
+			e := new(executor)
+			e.Build = &common.Build{JobResponse: tt.build}
+			e.config = &config{CustomConfig: &common.CustomConfig{}}
+			if tt.driverMode {
+				e.config.DriverSocket = "/run/driver.sock"
+			}
+
+			config := new(ConfigExecOutput)
+			require.NoError(t, json.Unmarshal([]byte(tt.output), config))
+
+			err := config.validate(e)
+			if tt.expectedError == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.EqualError(t, err, tt.expectedError)
+
+			var buildErr *common.BuildError
+			assert.Equal(t, tt.expectedBuildError, errors.As(err, &buildErr))
+		})
+	}
+}
+
+func TestExecutor_LogDriverConfig(t *testing.T) {
+	output := new(ConfigExecOutput)
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"features": {"services": true, "cache": false},
+		"failure_reasons": {"4": "resource_quota_failure", "3": "image_pull_failure"},
+		"stage_timeouts": {"get_sources": 60, "build_script": 3600}
+	}`), output))
+
+	out := new(bytes.Buffer)
+
+	config := getRunnerConfig(&common.CustomConfig{})
+
+	e := new(executor)
+	e.Build = &common.Build{Runner: &config}
+	e.BuildLogger = common.NewBuildLogger(&common.Trace{Writer: out}, e.Build.Log())
+
+	output.InjectInto(e)
+	e.logDriverConfig()
+
+	assert.Contains(t, out.String(), "Driver features: services=true, cache=false")
+	assert.Contains(t, out.String(), "Driver failure reasons: 3=image_pull_failure, 4=resource_quota_failure")
+	assert.Contains(t, out.String(), "Driver stage timeouts: build_script=1h0m0s, get_sources=1m0s")
+}
+
+func TestExecutor_StageTimeout(t *testing.T) {
+	e := new(executor)
+	e.stageTimeouts = map[string]time.Duration{"build_script": 10 * time.Millisecond}
+
+	t.Run("stage without timeout", func(t *testing.T) {
+		ctx, cancel := e.withStageTimeout(context.Background(), "get_sources")
+		defer cancel()
+
+		_, ok := ctx.Deadline()
+		assert.False(t, ok)
+	})
+
+	t.Run("stage exceeds the timeout", func(t *testing.T) {
+		ctx, cancel := e.withStageTimeout(context.Background(), "build_script")
+		defer cancel()
+
+		<-ctx.Done()
+
+		err := e.stageTimeoutError(ctx, context.Background(), "build_script", errors.New("killed"))
+
+		var buildErr *common.BuildError
+		require.ErrorAs(t, err, &buildErr)
+		assert.Equal(t, common.JobExecutionTimeout, buildErr.FailureReason)
+		assert.EqualError(t, err, "stage build_script exceeded the timeout of 10ms: killed")
+	})
+
+	t.Run("job is canceled", func(t *testing.T) {
+		parent, cancelParent := context.WithCancel(context.Background())
+		cancelParent()
+
+		ctx, cancel := e.withStageTimeout(parent, "build_script")
+		defer cancel()
+
+		err := errors.New("killed")
+		assert.Equal(t, err, e.stageTimeoutError(ctx, parent, "build_script", err))
+	})
+}
+
+func TestExecutor_DriverErrorFailureReason(t *testing.T) {
+	e := new(executor)
+	e.failureReasons = map[int]common.JobFailureReason{3: common.ImagePullFailure}
+
+	err := e.driverError(&driver.Error{
+		Code:    api.DriverSystemFailureErrorCode,
+		Message: "pulling image",
+		Data:    json.RawMessage(`{"exit_code":3}`),
+	})
+
+	var buildErr *common.BuildError
+	require.ErrorAs(t, err, &buildErr)
+	assert.Equal(t, 3, buildErr.ExitCode)
+	assert.Equal(t, common.ImagePullFailure, buildErr.FailureReason)
+
+	err = e.driverError(&driver.Error{Code: api.DriverSystemFailureErrorCode, Message: "failed"})
+	assert.False(t, errors.As(err, &buildErr))
+}
@@ -8,6 +8,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/sirupsen/logrus"
 
@@ -15,6 +16,7 @@ import (
 	"gitlab.com/gitlab-org/gitlab-runner/executors"
 	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/api"
 	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/command"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/driver"
 	"gitlab.com/gitlab-org/gitlab-runner/helpers/featureflags"
 	"gitlab.com/gitlab-org/gitlab-runner/helpers/process"
 )
@@ -67,6 +69,23 @@ func (c *ConfigExecOutput) InjectInto(executor *executor) {
 	if c.Shell != nil {
 		executor.Config.Shell = *c.Shell
 	}
+
+	if c.Terminal != nil {
+		executor.terminalCommand = c.Terminal.Command
+	}
+
+	executor.registerServiceProxies(c.Services)
+
+	if c.Features != nil {
+		executor.features = c.Features
+
+		if c.Features.SharedBuildsDir != nil {
+			executor.SharedBuildsDir = *c.Features.SharedBuildsDir
+		}
+	}
+
+	executor.failureReasons = failureReasons(c.FailureReasons)
+	executor.stageTimeouts = stageTimeouts(c.StageTimeouts)
 }
 
 type executor struct {
@@ -79,6 +98,15 @@ type executor struct {
 	driverInfo *api.DriverInfo
 
 	jobEnv map[string]string
+
+	terminalCommand []string
+
+	features       *api.FeaturesInfo
+	failureReasons map[int]common.JobFailureReason
+	stageTimeouts  map[string]time.Duration
+
+	driver       *driver.Conn
+	driverStderr *io.PipeWriter
 }
 
 func (e *executor) Prepare(options common.ExecutorPrepareOptions) error {
@@ -99,18 +127,27 @@ func (e *executor) Prepare(options common.ExecutorPrepareOptions) error {
 		return err
 	}
 
-	err = e.dynamicConfig()
+	if e.config.isDriverMode() {
+		err = e.initializeDriver()
+	} else {
+		err = e.dynamicConfig()
+	}
 	if err != nil {
 		return err
 	}
 
 	e.logStartupMessage()
+	e.logDriverConfig()
 
 	err = e.AbstractExecutor.PrepareBuildAndShell()
 	if err != nil {
 		return err
 	}
 
+	if e.config.isDriverMode() {
+		return e.prepareDriver()
+	}
+
 	// nothing to do, as there's no prepare_script
 	if e.config.PrepareExec == "" {
 		return nil
@@ -137,7 +174,11 @@ func (e *executor) prepareConfig() error {
 		CustomConfig: e.Config.Custom,
 	}
 
-	if e.config.RunExec == "" {
+	if e.config.DriverExec != "" && e.config.DriverSocket != "" {
+		return common.MakeBuildError("custom executor can't use both DriverExec and DriverSocket")
+	}
+
+	if e.config.RunExec == "" && !e.config.isDriverMode() {
 		return common.MakeBuildError("custom executor is missing RunExec")
 	}
 
@@ -198,6 +239,11 @@ func (e *executor) dynamicConfig() error {
 		return fmt.Errorf("error while parsing JSON output: %w", err)
 	}
 
+	err = config.validate(e)
+	if err != nil {
+		return err
+	}
+
 	config.InjectInto(e)
 
 	return nil
@@ -243,21 +289,32 @@ func (e *executor) prepareCommand(ctx context.Context, opts prepareCommandOpts)
 		UseWindowsLegacyProcessStrategy: e.Build.IsFeatureFlagOn(featureflags.UseWindowsLegacyProcessStrategy),
 	}
 
+	cmdOpts.Env = append(cmdOpts.Env, e.customEnv()...)
+
+	options := command.Options{
+		JobResponseFile: e.jobResponseFile,
+		FailureReasons:  e.failureReasons,
+	}
+
+	return commandFactory(ctx, opts.executable, opts.args, cmdOpts, options)
+}
+
+// customEnv returns the job_env variables and the variables of the job,
+// prefixed with CUSTOM_ENV_
+func (e *executor) customEnv() []string {
+	var env []string
+
 	// Append job_env defined variable first to avoid overwriting any CI/CD or predefined variables.
 	for k, v := range e.jobEnv {
-		cmdOpts.Env = append(cmdOpts.Env, fmt.Sprintf("%s=%s", k, v))
+		env = append(env, fmt.Sprintf("%s=%s", k, v))
 	}
 
 	variables := append(e.Build.GetAllVariables(), e.getCIJobServicesEnv())
 	for _, variable := range variables {
-		cmdOpts.Env = append(cmdOpts.Env, fmt.Sprintf("CUSTOM_ENV_%s=%s", variable.Key, variable.Value))
+		env = append(env, fmt.Sprintf("CUSTOM_ENV_%s=%s", variable.Key, variable.Value))
 	}
 
-	options := command.Options{
-		JobResponseFile: e.jobResponseFile,
-	}
-
-	return commandFactory(ctx, opts.executable, opts.args, cmdOpts, options)
+	return env
 }
 
 func (e *executor) getCIJobServicesEnv() common.JobVariable {
@@ -287,6 +344,21 @@ func (e *executor) getCIJobServicesEnv() common.JobVariable {
 }
 
 func (e *executor) Run(cmd common.ExecutorCommand) error {
+	// TODO: Remove this translation - https://gitlab.com/groups/gitlab-org/-/epics/6112
+	stage := runStageName(cmd.Stage, e.config.isDriverMode())
+	if stage != string(cmd.Stage) {
+		e.BuildLogger.Warningln("Starting with version 17.0 the 'build_script' stage " +
+			"will be replaced with 'step_script': https://gitlab.com/groups/gitlab-org/-/epics/6112")
+	}
+
+	ctx, cancelFunc := e.withStageTimeout(cmd.Context, stage)
+	defer cancelFunc()
+
+	if e.config.isDriverMode() {
+		err := e.runDriver(ctx, stage, cmd.Script)
+		return e.stageTimeoutError(ctx, cmd.Context, stage, err)
+	}
+
 	scriptDir, err := os.MkdirTemp(e.tempDir, "script")
 	if err != nil {
 		return err
@@ -298,15 +370,7 @@ func (e *executor) Run(cmd common.ExecutorCommand) error {
 		return err
 	}
 
-	// TODO: Remove this translation - https://gitlab.com/groups/gitlab-org/-/epics/6112
-	stage := cmd.Stage
-	if stage == "step_script" {
-		e.BuildLogger.Warningln("Starting with version 17.0 the 'build_script' stage " +
-			"will be replaced with 'step_script': https://gitlab.com/groups/gitlab-org/-/epics/6112")
-		stage = "build_script"
-	}
-
-	args := append(e.config.RunArgs, scriptFile, string(stage))
+	args := append(e.config.RunArgs, scriptFile, stage)
 
 	opts := prepareCommandOpts{
 		executable: e.config.RunExec,
@@ -314,7 +378,9 @@ func (e *executor) Run(cmd common.ExecutorCommand) error {
 		out:        e.defaultCommandOutputs(),
 	}
 
-	return e.prepareCommand(cmd.Context, opts).Run()
+	err = e.prepareCommand(ctx, opts).Run()
+
+	return e.stageTimeoutError(ctx, cmd.Context, stage, err)
 }
 
 func (e *executor) Cleanup() {
@@ -330,6 +396,11 @@ func (e *executor) Cleanup() {
 
 	defer func() { _ = os.RemoveAll(e.tempDir) }()
 
+	if e.config.isDriverMode() {
+		e.cleanupDriver()
+		return
+	}
+
 	// nothing to do, as there's no cleanup_script
 	if e.config.CleanupExec == "" {
 		return
@@ -0,0 +1,350 @@
+package driver
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/api"
+)
+
+const jsonRPCVersion = "2.0"
+
+// methodNotFoundErrorCode is the JSON-RPC error code of the requests of a
+// method that the receiver doesn't implement
+const methodNotFoundErrorCode = -32601
+
+// maxMessageSize is the size limit of the messages received from the driver
+const maxMessageSize = 16 * 1024 * 1024
+
+var ErrConnClosed = errors.New("driver connection closed")
+
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *int64          `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Error is the error of a driver response
+type Error struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("driver error %d: %s", e.Code, e.Message)
+}
+
+// ErrorData decodes the data of the error, it's empty when the driver didn't
+// send any or sent an invalid one
+func (e *Error) ErrorData() api.DriverErrorData {
+	var data api.DriverErrorData
+	if len(e.Data) > 0 {
+		_ = json.Unmarshal(e.Data, &data)
+	}
+
+	return data
+}
+
+// Output holds the writers of the output notifications of a request, the
+// output of a nil writer is discarded
+type Output struct {
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+type call struct {
+	output   Output
+	response chan *message
+}
+
+// Conn is a connection to a driver. It sends the requests of a single job and
+// dispatches the responses and notifications of the driver, until the driver
+// or the runner closes it.
+type Conn struct {
+	// CancelTimeout is how long a canceled request waits for the driver's
+	// response before giving up on it
+	CancelTimeout time.Duration
+
+	rwc    io.ReadWriteCloser
+	closer func() error
+
+	writeLock sync.Mutex
+	encoder   *json.Encoder
+
+	lock      sync.Mutex
+	nextID    int64
+	calls     map[int64]*call
+	terminals map[string]*Terminal
+	err       error
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewConn returns a connection that exchanges the messages with the driver
+// through rwc
+func NewConn(rwc io.ReadWriteCloser) *Conn {
+	return newConn(rwc, rwc.Close)
+}
+
+func newConn(rwc io.ReadWriteCloser, closer func() error) *Conn {
+	c := &Conn{
+		CancelTimeout: 10 * time.Second,
+		rwc:           rwc,
+		closer:        closer,
+		encoder:       json.NewEncoder(rwc),
+		calls:         make(map[int64]*call),
+		terminals:     make(map[string]*Terminal),
+		done:          make(chan struct{}),
+	}
+
+	go c.read()
+
+	return c
+}
+
+// Call sends a request to the driver and decodes its result into result,
+// unless it's nil. When ctx is done, the driver is sent a cancel notification
+// for the request, and Call waits up to CancelTimeout for its response.
+func (c *Conn) Call(ctx context.Context, method string, params interface{}, result interface{}, output Output) error {
+	id, cl, err := c.newCall(output)
+	if err != nil {
+		return err
+	}
+	defer c.removeCall(id)
+
+	err = c.send(&message{ID: &id, Method: method}, params)
+	if err != nil {
+		return fmt.Errorf("sending %s request: %w", method, err)
+	}
+
+	var response *message
+	select {
+	case response = <-cl.response:
+	case <-c.done:
+		return fmt.Errorf("%s request: %w", method, c.closeErr())
+	case <-ctx.Done():
+		return c.cancel(method, id, cl, ctx.Err())
+	}
+
+	if response.Error != nil {
+		return response.Error
+	}
+
+	if result == nil || len(response.Result) == 0 {
+		return nil
+	}
+
+	err = json.Unmarshal(response.Result, result)
+	if err != nil {
+		return fmt.Errorf("decoding %s result: %w", method, err)
+	}
+
+	return nil
+}
+
+func (c *Conn) cancel(method string, id int64, cl *call, cause error) error {
+	err := c.Notify(api.DriverMethodCancel, api.DriverCancelParams{ID: id})
+	if err != nil {
+		return fmt.Errorf("%s request: %w (sending cancel notification: %v)", method, cause, err)
+	}
+
+	select {
+	case <-cl.response:
+		return fmt.Errorf("%s request: %w", method, cause)
+	case <-c.done:
+		return fmt.Errorf("%s request: %w", method, cause)
+	case <-time.After(c.CancelTimeout):
+		return fmt.Errorf("%s request: %w (driver didn't answer the cancellation in %s)", method, cause, c.CancelTimeout)
+	}
+}
+
+// Notify sends a notification to the driver
+func (c *Conn) Notify(method string, params interface{}) error {
+	return c.send(&message{Method: method}, params)
+}
+
+// Done is closed when the connection is closed
+func (c *Conn) Done() <-chan struct{} {
+	return c.done
+}
+
+// Close closes the connection, the pending requests fail with ErrConnClosed
+func (c *Conn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		err = c.closer()
+		c.shutdown(ErrConnClosed)
+	})
+
+	return err
+}
+
+func (c *Conn) newCall(output Output) (int64, *call, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.err != nil {
+		return 0, nil, c.err
+	}
+
+	c.nextID++
+	cl := &call{output: output, response: make(chan *message, 1)}
+	c.calls[c.nextID] = cl
+
+	return c.nextID, cl, nil
+}
+
+func (c *Conn) removeCall(id int64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.calls, id)
+}
+
+func (c *Conn) getCall(id int64) *call {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.calls[id]
+}
+
+func (c *Conn) closeErr() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.err
+}
+
+func (c *Conn) send(msg *message, params interface{}) error {
+	msg.JSONRPC = jsonRPCVersion
+
+	if params != nil {
+		data, err := json.Marshal(params)
+		if err != nil {
+			return fmt.Errorf("encoding %s params: %w", msg.Method, err)
+		}
+		msg.Params = data
+	}
+
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	// json.Encoder terminates each message with a newline
+	return c.encoder.Encode(msg)
+}
+
+func (c *Conn) read() {
+	scanner := bufio.NewScanner(c.rwc)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxMessageSize)
+
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		var msg message
+		err := json.Unmarshal(line, &msg)
+		if err != nil {
+			c.shutdown(fmt.Errorf("decoding driver message: %w", err))
+			_ = c.Close()
+			return
+		}
+
+		c.dispatch(&msg)
+	}
+
+	err := scanner.Err()
+	if err == nil {
+		err = io.EOF
+	}
+
+	c.shutdown(fmt.Errorf("%w: %v", ErrConnClosed, err))
+}
+
+func (c *Conn) dispatch(msg *message) {
+	switch {
+	case msg.ID != nil && msg.Method != "":
+		// the runner doesn't serve any request of the driver
+		_ = c.send(&message{
+			ID:    msg.ID,
+			Error: &Error{Code: methodNotFoundErrorCode, Message: "method not found: " + msg.Method},
+		}, nil)
+
+	case msg.ID != nil:
+		if cl := c.getCall(*msg.ID); cl != nil {
+			// only the first response of a request is kept
+			select {
+			case cl.response <- msg:
+			default:
+			}
+		}
+
+	case msg.Method == api.DriverMethodOutput:
+		c.handleOutput(msg.Params)
+
+	case msg.Method == api.DriverMethodTerminalOutput:
+		var params api.DriverTerminalDataParams
+		if json.Unmarshal(msg.Params, &params) == nil {
+			if t := c.getTerminal(params.TerminalID); t != nil {
+				t.receive(params.Data)
+			}
+		}
+
+	case msg.Method == api.DriverMethodTerminalClose:
+		var params api.DriverTerminalCloseParams
+		if json.Unmarshal(msg.Params, &params) == nil {
+			if t := c.getTerminal(params.TerminalID); t != nil {
+				t.closeReceiver(io.EOF)
+			}
+		}
+	}
+}
+
+func (c *Conn) handleOutput(rawParams json.RawMessage) {
+	var params api.DriverOutputParams
+	if json.Unmarshal(rawParams, &params) != nil {
+		return
+	}
+
+	cl := c.getCall(params.RequestID)
+	if cl == nil {
+		return
+	}
+
+	w := cl.output.Stdout
+	if params.Stream == api.DriverOutputStderr {
+		w = cl.output.Stderr
+	}
+
+	if w != nil {
+		_, _ = w.Write(params.Data)
+	}
+}
+
+func (c *Conn) shutdown(err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.err != nil {
+		return
+	}
+
+	c.err = err
+	close(c.done)
+
+	for _, t := range c.terminals {
+		t.closeReceiver(err)
+	}
+}
@@ -0,0 +1,248 @@
+//go:build !integration
+
+package driver
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/api"
+)
+
+type fakeDriver struct {
+	t       *testing.T
+	conn    net.Conn
+	scanner *bufio.Scanner
+	encoder *json.Encoder
+}
+
+func newFakeDriver(t *testing.T) (*Conn, *fakeDriver) {
+	runnerSide, driverSide := net.Pipe()
+
+	c := NewConn(runnerSide)
+	t.Cleanup(func() { _ = c.Close() })
+
+	return c, &fakeDriver{
+		t:       t,
+		conn:    driverSide,
+		scanner: bufio.NewScanner(driverSide),
+		encoder: json.NewEncoder(driverSide),
+	}
+}
+
+func (d *fakeDriver) receive() *message {
+	require.True(d.t, d.scanner.Scan(), "reading message: %v", d.scanner.Err())
+
+	msg := new(message)
+	require.NoError(d.t, json.Unmarshal(d.scanner.Bytes(), msg))
+	assert.Equal(d.t, jsonRPCVersion, msg.JSONRPC)
+
+	return msg
+}
+
+func (d *fakeDriver) send(msg interface{}) {
+	require.NoError(d.t, d.encoder.Encode(msg))
+}
+
+func (d *fakeDriver) notify(method string, params interface{}) {
+	data, err := json.Marshal(params)
+	require.NoError(d.t, err)
+
+	d.send(&message{JSONRPC: jsonRPCVersion, Method: method, Params: data})
+}
+
+func TestConnCall(t *testing.T) {
+	c, d := newFakeDriver(t)
+
+	go func() {
+		req := d.receive()
+		assert.Equal(t, api.DriverMethodRun, req.Method)
+
+		var params api.DriverRunParams
+		assert.NoError(t, json.Unmarshal(req.Params, &params))
+		assert.Equal(t, "echo hello", params.Script)
+
+		d.notify(api.DriverMethodOutput, api.DriverOutputParams{RequestID: *req.ID, Stream: "stdout", Data: []byte("hello\n")})
+		d.notify(api.DriverMethodOutput, api.DriverOutputParams{RequestID: *req.ID, Stream: "stderr", Data: []byte("warning\n")})
+		d.notify(api.DriverMethodOutput, api.DriverOutputParams{RequestID: *req.ID + 1, Data: []byte("unknown request\n")})
+		d.send(&message{JSONRPC: jsonRPCVersion, ID: req.ID, Result: json.RawMessage(`{"protocol_version":1}`)})
+	}()
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+
+	var result api.DriverInitializeResult
+	err := c.Call(context.Background(), api.DriverMethodRun, api.DriverRunParams{Script: "echo hello"}, &result, Output{
+		Stdout: stdout,
+		Stderr: stderr,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, 1, result.ProtocolVersion)
+	assert.Equal(t, "hello\n", stdout.String())
+	assert.Equal(t, "warning\n", stderr.String())
+}
+
+func TestConnCallError(t *testing.T) {
+	c, d := newFakeDriver(t)
+
+	go func() {
+		req := d.receive()
+		d.send(&message{
+			JSONRPC: jsonRPCVersion,
+			ID:      req.ID,
+			Error: &Error{
+				Code:    api.DriverBuildFailureErrorCode,
+				Message: "script failed",
+				Data:    json.RawMessage(`{"exit_code":42}`),
+			},
+		})
+	}()
+
+	err := c.Call(context.Background(), api.DriverMethodRun, nil, nil, Output{})
+
+	var driverErr *Error
+	require.ErrorAs(t, err, &driverErr)
+	assert.Equal(t, api.DriverBuildFailureErrorCode, driverErr.Code)
+	assert.Equal(t, 42, driverErr.ErrorData().ExitCode)
+	assert.EqualError(t, err, "driver error 1: script failed")
+}
+
+func TestConnCallCancel(t *testing.T) {
+	tests := map[string]struct {
+		answer        bool
+		expectedError string
+	}{
+		"driver answers the cancellation": {
+			answer:        true,
+			expectedError: "run request: context canceled",
+		},
+		"driver ignores the cancellation": {
+			expectedError: "run request: context canceled (driver didn't answer the cancellation in 50ms)",
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			c, d := newFakeDriver(t)
+			c.CancelTimeout = 50 * time.Millisecond
+
+			ctx, cancel := context.WithCancel(context.Background())
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+
+				req := d.receive()
+				cancel()
+
+				notification := d.receive()
+				assert.Equal(t, api.DriverMethodCancel, notification.Method)
+				assert.Nil(t, notification.ID)
+
+				var params api.DriverCancelParams
+				assert.NoError(t, json.Unmarshal(notification.Params, &params))
+				assert.Equal(t, *req.ID, params.ID)
+
+				if tt.answer {
+					d.send(&message{JSONRPC: jsonRPCVersion, ID: req.ID, Error: &Error{Code: 2, Message: "canceled"}})
+				}
+			}()
+
+			err := c.Call(ctx, api.DriverMethodRun, nil, nil, Output{})
+			assert.ErrorIs(t, err, context.Canceled)
+			assert.EqualError(t, err, tt.expectedError)
+
+			<-done
+		})
+	}
+}
+
+func TestConnDriverRequest(t *testing.T) {
+	_, d := newFakeDriver(t)
+
+	id := int64(7)
+	d.send(&message{JSONRPC: jsonRPCVersion, ID: &id, Method: "unknown"})
+
+	response := d.receive()
+	require.NotNil(t, response.ID)
+	assert.Equal(t, id, *response.ID)
+	require.NotNil(t, response.Error)
+	assert.Equal(t, methodNotFoundErrorCode, response.Error.Code)
+}
+
+func TestConnClosed(t *testing.T) {
+	t.Run("by the driver", func(t *testing.T) {
+		c, d := newFakeDriver(t)
+
+		go func() {
+			d.receive()
+			_ = d.conn.Close()
+		}()
+
+		err := c.Call(context.Background(), api.DriverMethodPrepare, nil, nil, Output{})
+		assert.ErrorIs(t, err, ErrConnClosed)
+
+		<-c.Done()
+		err = c.Call(context.Background(), api.DriverMethodCleanup, nil, nil, Output{})
+		assert.ErrorIs(t, err, ErrConnClosed)
+	})
+
+	t.Run("invalid message", func(t *testing.T) {
+		c, d := newFakeDriver(t)
+
+		go func() {
+			_, _ = d.conn.Write([]byte("not json\n"))
+		}()
+
+		<-c.Done()
+		err := c.Call(context.Background(), api.DriverMethodPrepare, nil, nil, Output{})
+		assert.ErrorContains(t, err, "decoding driver message")
+	})
+}
+
+func TestConnTerminal(t *testing.T) {
+	c, d := newFakeDriver(t)
+
+	go func() {
+		req := d.receive()
+		assert.Equal(t, api.DriverMethodTerminalOpen, req.Method)
+		d.send(&message{JSONRPC: jsonRPCVersion, ID: req.ID, Result: json.RawMessage(`{"terminal_id":"t1"}`)})
+
+		input := d.receive()
+		assert.Equal(t, api.DriverMethodTerminalInput, input.Method)
+
+		var params api.DriverTerminalDataParams
+		assert.NoError(t, json.Unmarshal(input.Params, &params))
+		assert.Equal(t, "t1", params.TerminalID)
+		assert.Equal(t, "ls\n", string(params.Data))
+
+		d.notify(api.DriverMethodTerminalOutput, api.DriverTerminalDataParams{TerminalID: "t1", Data: []byte("file\n")})
+		d.notify(api.DriverMethodTerminalOutput, api.DriverTerminalDataParams{TerminalID: "t2", Data: []byte("other\n")})
+		d.notify(api.DriverMethodTerminalClose, api.DriverTerminalCloseParams{TerminalID: "t1"})
+	}()
+
+	terminal, err := c.OpenTerminal(context.Background(), api.DriverTerminalOpenParams{})
+	require.NoError(t, err)
+
+	_, err = terminal.Write([]byte("ls\n"))
+	require.NoError(t, err)
+
+	output, err := io.ReadAll(terminal)
+	require.NoError(t, err)
+	assert.Equal(t, "file\n", string(output))
+
+	select {
+	case <-terminal.Done():
+	default:
+		t.Error("terminal isn't closed")
+	}
+}
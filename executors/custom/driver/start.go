@@ -0,0 +1,86 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/process"
+)
+
+var newProcessKillWaiter = process.NewOSKillWait
+var newCommander = process.NewOSCmd
+
+// Start starts the driver executable and connects to it through its standard
+// input and output. Closing the connection closes the standard input of the
+// driver, which has until the graceful kill timeout of cmdOpts to exit before
+// it's killed.
+func Start(executable string, args []string, cmdOpts process.CommandOptions) (*Conn, error) {
+	stdinReader, stdinWriter, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("creating driver stdin pipe: %w", err)
+	}
+
+	stdoutReader, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		_ = stdinReader.Close()
+		_ = stdinWriter.Close()
+		return nil, fmt.Errorf("creating driver stdout pipe: %w", err)
+	}
+
+	cmdOpts.Stdin = stdinReader
+	cmdOpts.Stdout = stdoutWriter
+	cmd := newCommander(executable, args, cmdOpts)
+
+	err = cmd.Start()
+
+	// the driver process holds its own copies of these
+	_ = stdinReader.Close()
+	_ = stdoutWriter.Close()
+
+	if err != nil {
+		_ = stdinWriter.Close()
+		_ = stdoutReader.Close()
+		return nil, fmt.Errorf("failed to start driver: %w", err)
+	}
+
+	waitCh := make(chan error, 1)
+	go func() {
+		waitCh <- cmd.Wait()
+	}()
+
+	closer := func() error {
+		_ = stdinWriter.Close()
+		defer func() { _ = stdoutReader.Close() }()
+
+		select {
+		case err := <-waitCh:
+			return err
+		case <-time.After(cmdOpts.GracefulKillTimeout):
+			return newProcessKillWaiter(cmdOpts.Logger, cmdOpts.GracefulKillTimeout, cmdOpts.ForceKillTimeout).
+				KillAndWait(cmd, waitCh)
+		}
+	}
+
+	return newConn(&pipeConn{Reader: stdoutReader, WriteCloser: stdinWriter}, closer), nil
+}
+
+// Dial connects to a driver listening on a Unix socket
+func Dial(ctx context.Context, socket string) (*Conn, error) {
+	var dialer net.Dialer
+
+	netConn, err := dialer.DialContext(ctx, "unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to driver: %w", err)
+	}
+
+	return NewConn(netConn), nil
+}
+
+type pipeConn struct {
+	io.Reader
+	io.WriteCloser
+}
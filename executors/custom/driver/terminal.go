@@ -0,0 +1,142 @@
+package driver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/api"
+)
+
+// Terminal is an interactive terminal session opened by the driver. The output
+// of the driver is buffered until it's read, so that a slow terminal client
+// doesn't block the other messages of the connection.
+type Terminal struct {
+	conn *Conn
+	id   string
+
+	lock   sync.Mutex
+	cond   *sync.Cond
+	buf    bytes.Buffer
+	err    error
+	closed chan struct{}
+}
+
+// OpenTerminal asks the driver to open a terminal session in the job's
+// environment
+func (c *Conn) OpenTerminal(ctx context.Context, params api.DriverTerminalOpenParams) (*Terminal, error) {
+	var result api.DriverTerminalOpenResult
+
+	err := c.Call(ctx, api.DriverMethodTerminalOpen, params, &result, Output{})
+	if err != nil {
+		return nil, err
+	}
+
+	if result.TerminalID == "" {
+		return nil, fmt.Errorf("%s result: missing terminal ID", api.DriverMethodTerminalOpen)
+	}
+
+	t := &Terminal{
+		conn:   c,
+		id:     result.TerminalID,
+		closed: make(chan struct{}),
+	}
+	t.cond = sync.NewCond(&t.lock)
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.err != nil {
+		return nil, c.err
+	}
+	c.terminals[t.id] = t
+
+	return t, nil
+}
+
+func (c *Conn) getTerminal(id string) *Terminal {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.terminals[id]
+}
+
+func (c *Conn) removeTerminal(id string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.terminals, id)
+}
+
+// Read reads the output of the terminal, it returns io.EOF once the driver
+// closed the terminal and its output was read
+func (t *Terminal) Read(p []byte) (int, error) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for t.buf.Len() == 0 && t.err == nil {
+		t.cond.Wait()
+	}
+
+	if t.buf.Len() > 0 {
+		return t.buf.Read(p)
+	}
+
+	return 0, t.err
+}
+
+// Write sends input to the terminal
+func (t *Terminal) Write(p []byte) (int, error) {
+	err := t.conn.Notify(api.DriverMethodTerminalInput, api.DriverTerminalDataParams{
+		TerminalID: t.id,
+		Data:       p,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// Close asks the driver to close the terminal, unless it's already closed
+func (t *Terminal) Close() error {
+	t.conn.removeTerminal(t.id)
+	if !t.closeReceiver(ErrConnClosed) {
+		return nil
+	}
+
+	return t.conn.Notify(api.DriverMethodTerminalClose, api.DriverTerminalCloseParams{TerminalID: t.id})
+}
+
+// Done is closed when the driver or the runner closes the terminal
+func (t *Terminal) Done() <-chan struct{} {
+	return t.closed
+}
+
+func (t *Terminal) receive(data []byte) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.err != nil {
+		return
+	}
+
+	t.buf.Write(data)
+	t.cond.Broadcast()
+}
+
+func (t *Terminal) closeReceiver(err error) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.err != nil {
+		return false
+	}
+
+	t.err = err
+	close(t.closed)
+	t.cond.Broadcast()
+
+	return true
+}
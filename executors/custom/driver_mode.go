@@ -0,0 +1,191 @@
+package custom
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/sirupsen/logrus"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/api"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/driver"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/featureflags"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/process"
+)
+
+var startDriver = driver.Start
+var dialDriver = driver.Dial
+
+// initializeDriver connects to the driver of the job and initializes the
+// connection, the result of the initialize request configures the executor
+// like the output of config_exec
+func (e *executor) initializeDriver() error {
+	ctx, cancelFunc := context.WithTimeout(e.Context, e.config.GetConfigExecTimeout())
+	defer cancelFunc()
+
+	err := e.connectDriver(ctx)
+	if err != nil {
+		return err
+	}
+
+	job, err := json.Marshal(e.Build.JobResponse)
+	if err != nil {
+		return fmt.Errorf("encoding job response: %w", err)
+	}
+
+	params := api.DriverInitializeParams{
+		ProtocolVersion: api.DriverProtocolVersion,
+		RunnerVersion:   common.AppVersion.Version,
+		Job:             job,
+		Env:             e.customEnv(),
+	}
+
+	var result api.DriverInitializeResult
+	err = e.driver.Call(ctx, api.DriverMethodInitialize, params, &result, driver.Output{Stderr: e.Trace})
+	if err != nil {
+		return e.driverError(err)
+	}
+
+	if result.ProtocolVersion != api.DriverProtocolVersion {
+		return fmt.Errorf(
+			"driver protocol version %d isn't supported, the runner supports version %d",
+			result.ProtocolVersion,
+			api.DriverProtocolVersion,
+		)
+	}
+
+	config := &ConfigExecOutput{ConfigExecOutput: result.ConfigExecOutput}
+
+	err = config.validate(e)
+	if err != nil {
+		return err
+	}
+
+	config.InjectInto(e)
+
+	return nil
+}
+
+func (e *executor) connectDriver(ctx context.Context) error {
+	var err error
+
+	if e.config.DriverSocket != "" {
+		e.driver, err = dialDriver(ctx, e.config.DriverSocket)
+	} else {
+		stderrLogger := e.BuildLogger.WithFields(logrus.Fields{"driver_std": "err"})
+		e.driverStderr = stderrLogger.WriterLevel(logrus.WarnLevel)
+
+		e.driver, err = startDriver(e.config.DriverExec, e.config.DriverArgs, process.CommandOptions{
+			Dir:                             e.tempDir,
+			Env:                             append(os.Environ(), "TMPDIR="+e.tempDir),
+			Stderr:                          e.driverStderr,
+			Logger:                          common.NewProcessLoggerAdapter(e.BuildLogger),
+			GracefulKillTimeout:             e.config.GetGracefulKillTimeout(),
+			ForceKillTimeout:                e.config.GetForceKillTimeout(),
+			UseWindowsLegacyProcessStrategy: e.Build.IsFeatureFlagOn(featureflags.UseWindowsLegacyProcessStrategy),
+		})
+	}
+
+	if err != nil {
+		return err
+	}
+
+	e.driver.CancelTimeout = e.config.GetGracefulKillTimeout()
+
+	return nil
+}
+
+func (e *executor) prepareDriver() error {
+	ctx, cancelFunc := context.WithTimeout(e.Context, e.config.GetPrepareExecTimeout())
+	defer cancelFunc()
+
+	params := api.DriverPrepareParams{Env: e.customEnv()}
+	err := e.driver.Call(ctx, api.DriverMethodPrepare, params, nil, e.driverOutput())
+
+	return e.driverError(err)
+}
+
+func (e *executor) runDriver(ctx context.Context, stage string, script string) error {
+	params := api.DriverRunParams{
+		Env:    e.customEnv(),
+		Stage:  stage,
+		Shell:  e.Shell().Shell,
+		Script: script,
+	}
+	err := e.driver.Call(ctx, api.DriverMethodRun, params, nil, e.driverOutput())
+
+	return e.driverError(err)
+}
+
+// cleanupDriver sends the cleanup request and closes the connection to the
+// driver, which stops the driver process started for the job
+func (e *executor) cleanupDriver() {
+	if e.driver == nil {
+		return
+	}
+
+	defer func() {
+		err := e.driver.Close()
+		if err != nil {
+			e.Warningln("Closing the driver connection:", err)
+		}
+
+		if e.driverStderr != nil {
+			_ = e.driverStderr.Close()
+		}
+	}()
+
+	ctx, cancelFunc := context.WithTimeout(context.Background(), e.config.GetCleanupScriptTimeout())
+	defer cancelFunc()
+
+	stdoutLogger := e.BuildLogger.WithFields(logrus.Fields{"cleanup_std": "out"})
+	stderrLogger := e.BuildLogger.WithFields(logrus.Fields{"cleanup_std": "err"})
+
+	stdout := stdoutLogger.WriterLevel(logrus.DebugLevel)
+	defer func() { _ = stdout.Close() }()
+
+	stderr := stderrLogger.WriterLevel(logrus.WarnLevel)
+	defer func() { _ = stderr.Close() }()
+
+	params := api.DriverCleanupParams{Env: e.customEnv()}
+	err := e.driver.Call(ctx, api.DriverMethodCleanup, params, nil, driver.Output{Stdout: stdout, Stderr: stderr})
+	if err != nil {
+		e.Warningln("Cleanup request failed:", err)
+	}
+}
+
+func (e *executor) driverOutput() driver.Output {
+	return driver.Output{
+		Stdout: e.Trace,
+		Stderr: e.Trace,
+	}
+}
+
+// driverError turns the build failure errors of the driver into build errors,
+// like the BUILD_FAILURE_EXIT_CODE exit code of the executables, and the
+// errors with an exit code mapped by the driver into build errors with the
+// failure reason
+func (e *executor) driverError(err error) error {
+	var driverErr *driver.Error
+	if !errors.As(err, &driverErr) {
+		return err
+	}
+
+	exitCode := driverErr.ErrorData().ExitCode
+	if reason, ok := e.failureReasons[exitCode]; ok {
+		return &common.BuildError{Inner: err, ExitCode: exitCode, FailureReason: reason}
+	}
+
+	if driverErr.Code != api.DriverBuildFailureErrorCode {
+		return err
+	}
+
+	if exitCode == 0 {
+		exitCode = api.DriverBuildFailureErrorCode
+	}
+
+	return &common.BuildError{Inner: err, ExitCode: exitCode}
+}
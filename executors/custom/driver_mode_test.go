@@ -0,0 +1,192 @@
+//go:build !integration
+
+package custom
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/api"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/driver"
+)
+
+type driverMessage struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *int64          `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *driver.Error   `json:"error,omitempty"`
+}
+
+// serveFakeDriver answers the requests of the runner with the result of
+// handle, which can send output notifications for the request
+func serveFakeDriver(t *testing.T, conn net.Conn, handle func(req driverMessage, output func(string)) (interface{}, *driver.Error)) {
+	scanner := bufio.NewScanner(conn)
+	encoder := json.NewEncoder(conn)
+
+	for scanner.Scan() {
+		var req driverMessage
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &req))
+		if req.ID == nil {
+			continue
+		}
+
+		output := func(data string) {
+			params, err := json.Marshal(api.DriverOutputParams{RequestID: *req.ID, Stream: "stdout", Data: []byte(data)})
+			require.NoError(t, err)
+			require.NoError(t, encoder.Encode(driverMessage{JSONRPC: "2.0", Method: api.DriverMethodOutput, Params: params}))
+		}
+
+		result, err := handle(req, output)
+		require.NoError(t, encoder.Encode(driverMessage{JSONRPC: "2.0", ID: req.ID, Result: result, Error: err}))
+	}
+}
+
+func TestExecutor_DriverMode(t *testing.T) {
+	runnerSide, driverSide := net.Pipe()
+
+	var methods []string
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+
+		serveFakeDriver(t, driverSide, func(req driverMessage, output func(string)) (interface{}, *driver.Error) {
+			methods = append(methods, req.Method)
+
+			switch req.Method {
+			case api.DriverMethodInitialize:
+				var params api.DriverInitializeParams
+				require.NoError(t, json.Unmarshal(req.Params, &params))
+				assert.Equal(t, api.DriverProtocolVersion, params.ProtocolVersion)
+				assert.Contains(t, string(params.Job), `"id":1234`)
+				assert.Contains(t, params.Env, "CUSTOM_ENV_CI_JOB_ID=1234")
+
+				name, version, buildsDir := "fake", "1.0.0", "/driver/builds"
+				return api.DriverInitializeResult{
+					ProtocolVersion: api.DriverProtocolVersion,
+					ConfigExecOutput: api.ConfigExecOutput{
+						Driver:    &api.DriverInfo{Name: &name, Version: &version},
+						BuildsDir: &buildsDir,
+						JobEnv:    &map[string]string{"DRIVER_VAR": "value"},
+					},
+				}, nil
+
+			case api.DriverMethodPrepare:
+				var params api.DriverPrepareParams
+				require.NoError(t, json.Unmarshal(req.Params, &params))
+				assert.Contains(t, params.Env, "DRIVER_VAR=value")
+
+				output("preparing environment\n")
+				return nil, nil
+
+			case api.DriverMethodRun:
+				var params api.DriverRunParams
+				require.NoError(t, json.Unmarshal(req.Params, &params))
+				assert.Equal(t, "step_script", params.Stage)
+				assert.Equal(t, "bash", params.Shell)
+				assert.Equal(t, "exit 3", params.Script)
+
+				output("running script\n")
+				return nil, &driver.Error{
+					Code:    api.DriverBuildFailureErrorCode,
+					Message: "script failed",
+					Data:    json.RawMessage(`{"exit_code":3}`),
+				}
+			}
+
+			return nil, nil
+		})
+	}()
+
+	oldDialDriver := dialDriver
+	defer func() { dialDriver = oldDialDriver }()
+	dialDriver = func(_ context.Context, socket string) (*driver.Conn, error) {
+		assert.Equal(t, "/run/driver.sock", socket)
+		return driver.NewConn(runnerSide), nil
+	}
+
+	config := getRunnerConfig(&common.CustomConfig{DriverSocket: "/run/driver.sock"})
+	out := new(bytes.Buffer)
+
+	e := new(executor)
+	err := e.Prepare(common.ExecutorPrepareOptions{
+		Build: &common.Build{
+			JobResponse: common.JobResponse{
+				ID:        1234,
+				Variables: common.JobVariables{{Key: "CI_JOB_ID", Value: "1234"}},
+			},
+			Runner: &config,
+		},
+		Config:  &config,
+		Context: context.Background(),
+		Trace:   &common.Trace{Writer: out},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, "/driver/builds", e.Config.BuildsDir)
+	assert.Contains(t, out.String(), "Using Custom executor with driver fake 1.0.0...")
+	assert.Contains(t, out.String(), "preparing environment")
+
+	err = e.Run(common.ExecutorCommand{Context: context.Background(), Stage: "step_script", Script: "exit 3"})
+
+	var buildErr *common.BuildError
+	require.ErrorAs(t, err, &buildErr)
+	assert.Equal(t, 3, buildErr.ExitCode)
+	assert.Contains(t, out.String(), "running script")
+	assert.NotContains(t, out.String(), "will be replaced with 'step_script'")
+
+	e.Cleanup()
+	<-done
+
+	assert.Equal(t, []string{
+		api.DriverMethodInitialize,
+		api.DriverMethodPrepare,
+		api.DriverMethodRun,
+		api.DriverMethodCleanup,
+	}, methods)
+}
+
+func TestExecutor_DriverModeConfig(t *testing.T) {
+	tests := map[string]struct {
+		config        common.CustomConfig
+		expectedError string
+	}{
+		"driver socket without RunExec": {
+			config: common.CustomConfig{DriverSocket: "/run/driver.sock"},
+		},
+		"driver executable without RunExec": {
+			config: common.CustomConfig{DriverExec: "/usr/bin/driver"},
+		},
+		"both driver executable and socket": {
+			config:        common.CustomConfig{DriverExec: "/usr/bin/driver", DriverSocket: "/run/driver.sock"},
+			expectedError: "custom executor can't use both DriverExec and DriverSocket",
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			config := getRunnerConfig(&tt.config)
+
+			e := new(executor)
+			e.Config = config
+
+			err := e.prepareConfig()
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.True(t, e.config.isDriverMode())
+		})
+	}
+}
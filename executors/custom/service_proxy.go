@@ -0,0 +1,102 @@
+package custom
+
+import (
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strconv"
+
+	"github.com/sirupsen/logrus"
+
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/api"
+	"gitlab.com/gitlab-org/gitlab-runner/session/proxy"
+)
+
+const defaultServiceProtocol = "http"
+
+func (e *executor) Pool() proxy.Pool {
+	return e.ProxyPool
+}
+
+// registerServiceProxies adds the services declared by the driver to the
+// proxy pool of the session server
+func (e *executor) registerServiceProxies(services []api.ServiceEndpoint) {
+	if e.ProxyPool == nil {
+		e.ProxyPool = proxy.NewPool()
+	}
+
+	for _, service := range services {
+		if service.Name == "" || service.Host == "" || len(service.Ports) == 0 {
+			e.Warningln("Ignoring service without name, host or ports declared by the driver:", service.Name)
+			continue
+		}
+
+		ports := make([]proxy.Port, 0, len(service.Ports))
+		for _, port := range service.Ports {
+			protocol := port.Protocol
+			if protocol == "" {
+				protocol = defaultServiceProtocol
+			}
+
+			ports = append(ports, proxy.Port{Number: port.Number, Protocol: protocol, Name: port.Name})
+		}
+
+		e.ProxyPool[service.Name] = &proxy.Proxy{
+			Settings:          proxy.NewProxySettings(service.Name, ports),
+			ConnectionHandler: serviceProxy{host: service.Host},
+		}
+	}
+}
+
+// serviceProxy proxies the requests of the session server to a service of the
+// job's environment. The reverse proxy also handles the WebSocket upgrades.
+type serviceProxy struct {
+	host string
+}
+
+func (p serviceProxy) ProxyRequest(
+	w http.ResponseWriter,
+	r *http.Request,
+	requestedURI string,
+	port string,
+	settings *proxy.Settings,
+) {
+	logger := logrus.WithFields(logrus.Fields{
+		"uri":      r.RequestURI,
+		"method":   r.Method,
+		"port":     port,
+		"settings": settings,
+	})
+
+	portSettings, err := settings.PortByNameOrNumber(port)
+	if err != nil {
+		logger.WithError(err).Errorf("port proxy %q not found", port)
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	scheme, err := portSettings.Scheme()
+	if err != nil {
+		logger.WithError(err).Errorf("service proxy: invalid port protocol %q", portSettings.Protocol)
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	host := net.JoinHostPort(p.host, strconv.Itoa(portSettings.Number))
+
+	reverseProxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = scheme
+			req.URL.Host = host
+			req.URL.Path = "/" + requestedURI
+			req.URL.RawPath = ""
+			req.Host = host
+		},
+		ErrorHandler: func(w http.ResponseWriter, _ *http.Request, err error) {
+			logger.WithError(err).Errorf("service proxy: error proxying request")
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		},
+	}
+
+	reverseProxy.ServeHTTP(w, r)
+}
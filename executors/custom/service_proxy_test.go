@@ -0,0 +1,82 @@
+//go:build !integration
+
+package custom
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/api"
+	"gitlab.com/gitlab-org/gitlab-runner/session/proxy"
+)
+
+func TestExecutor_ServiceProxies(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "%s %s?%s", r.Method, r.URL.Path, r.URL.RawQuery)
+	}))
+	defer server.Close()
+
+	serverURL, err := url.Parse(server.URL)
+	require.NoError(t, err)
+
+	host, portString, err := net.SplitHostPort(serverURL.Host)
+	require.NoError(t, err)
+	port, err := strconv.Atoi(portString)
+	require.NoError(t, err)
+
+	e := new(executor)
+	e.registerServiceProxies([]api.ServiceEndpoint{
+		{Name: "web", Host: host, Ports: []api.ServicePort{{Number: port, Name: "http"}}},
+		{Name: "no-ports", Host: host},
+		{Host: host, Ports: []api.ServicePort{{Number: port}}},
+	})
+
+	pool := e.Pool()
+	require.Len(t, pool, 1)
+	require.Contains(t, pool, "web")
+	assert.Equal(t, []proxy.Port{{Number: port, Protocol: "http", Name: "http"}}, pool["web"].Settings.Ports)
+
+	tests := map[string]struct {
+		port           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		"port by number": {
+			port:           portString,
+			expectedStatus: http.StatusOK,
+			expectedBody:   "GET /status?verbose=1",
+		},
+		"port by name": {
+			port:           "http",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "GET /status?verbose=1",
+		},
+		"unknown port": {
+			port:           "1",
+			expectedStatus: http.StatusNotFound,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/session/proxy/web/"+tt.port+"/status?verbose=1", nil)
+
+			service := pool["web"]
+			service.ConnectionHandler.ProxyRequest(w, r, "status", tt.port, service.Settings)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			if tt.expectedBody != "" {
+				assert.Equal(t, tt.expectedBody, w.Body.String())
+			}
+		})
+	}
+}
@@ -4,10 +4,107 @@ package custom
 
 import (
 	"errors"
+	"net/http"
+	"os"
+	"os/exec"
 
+	"github.com/creack/pty"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/api"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/driver"
 	terminalsession "gitlab.com/gitlab-org/gitlab-runner/session/terminal"
+	terminal "gitlab.com/gitlab-org/gitlab-terminal"
 )
 
+// Connect opens an interactive web terminal session with the terminal command
+// declared by the driver or, in driver mode, with the driver itself
 func (e *executor) Connect() (terminalsession.Conn, error) {
-	return nil, errors.New("not yet supported")
+	if len(e.terminalCommand) > 0 {
+		return e.startTerminalCommand()
+	}
+
+	if e.driver == nil {
+		return nil, errors.New("not yet supported")
+	}
+
+	t, err := e.driver.OpenTerminal(e.Context, api.DriverTerminalOpenParams{Env: e.customEnv()})
+	if err != nil {
+		return nil, err
+	}
+
+	return terminalConn{logger: &e.BuildLogger, terminal: t}, nil
+}
+
+func (e *executor) startTerminalCommand() (terminalsession.Conn, error) {
+	cmd := exec.Command(e.terminalCommand[0], e.terminalCommand[1:]...)
+	cmd.Dir = e.tempDir
+	cmd.Env = append(os.Environ(), "TMPDIR="+e.tempDir)
+	cmd.Env = append(cmd.Env, e.customEnv()...)
+
+	shellFD, err := pty.Start(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	return commandTerminalConn{cmd: cmd, shellFd: shellFD}, nil
+}
+
+// commandTerminalConn is a terminal session with the terminal command declared
+// by the driver
+type commandTerminalConn struct {
+	cmd     *exec.Cmd
+	shellFd *os.File
+}
+
+func (t commandTerminalConn) Start(w http.ResponseWriter, r *http.Request, timeoutCh, disconnectCh chan error) {
+	proxy := terminal.NewFileDescriptorProxy(1) // one stopper: terminal exit handler
+
+	terminalsession.ProxyTerminal(
+		timeoutCh,
+		disconnectCh,
+		proxy.StopCh,
+		func() {
+			terminal.ProxyFileDescriptor(w, r, t.shellFd, proxy)
+		},
+	)
+}
+
+func (t commandTerminalConn) Close() error {
+	err := t.shellFd.Close()
+
+	// the command is killed in case it ignores the hang up of the closed TTY
+	_ = t.cmd.Process.Kill()
+	_ = t.cmd.Wait()
+
+	return err
+}
+
+type terminalConn struct {
+	logger   *common.BuildLogger
+	terminal *driver.Terminal
+}
+
+func (t terminalConn) Start(w http.ResponseWriter, r *http.Request, timeoutCh, disconnectCh chan error) {
+	proxy := terminal.NewStreamProxy(1) // one stopper: terminal exit handler
+
+	// the proxy doesn't stop by itself when the driver closes the terminal
+	go func() {
+		<-t.terminal.Done()
+		t.logger.Debugln("The driver terminal was closed")
+		proxy.GetStopCh() <- errors.New("driver terminal closed")
+	}()
+
+	terminalsession.ProxyTerminal(
+		timeoutCh,
+		disconnectCh,
+		proxy.StopCh,
+		func() {
+			terminal.ProxyStream(w, r, t.terminal, proxy)
+		},
+	)
+}
+
+func (t terminalConn) Close() error {
+	return t.terminal.Close()
 }
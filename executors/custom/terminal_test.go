@@ -3,9 +3,14 @@
 package custom
 
 import (
+	"bufio"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/api"
 )
 
 func TestExecutor_Connect(t *testing.T) {
@@ -15,3 +20,32 @@ func TestExecutor_Connect(t *testing.T) {
 	assert.Nil(t, connection)
 	assert.EqualError(t, err, "not yet supported")
 }
+
+func TestExecutor_ConnectTerminalCommand(t *testing.T) {
+	e := new(executor)
+	e.Build = &common.Build{
+		JobResponse: common.JobResponse{
+			Variables: common.JobVariables{{Key: "CI_JOB_ID", Value: "1234"}},
+		},
+		Runner: &common.RunnerConfig{},
+	}
+	e.tempDir = t.TempDir()
+
+	(&ConfigExecOutput{}).InjectInto(e)
+	assert.Nil(t, e.terminalCommand)
+
+	output := new(ConfigExecOutput)
+	output.Terminal = &api.TerminalInfo{Command: []string{"sh", "-c", `echo "job $CUSTOM_ENV_CI_JOB_ID"`}}
+	output.InjectInto(e)
+
+	connection, err := e.Connect()
+	require.NoError(t, err)
+	defer func() { _ = connection.Close() }()
+
+	conn, ok := connection.(commandTerminalConn)
+	require.True(t, ok)
+
+	line, err := bufio.NewReader(conn.shellFd).ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "job 1234\r\n", line)
+}
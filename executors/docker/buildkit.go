@@ -0,0 +1,148 @@
+package docker
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-connections/nat"
+
+	"gitlab.com/gitlab-org/gitlab-runner/executors/docker/internal/volumes"
+)
+
+const (
+	buildKitServiceName = "buildkitd"
+	buildKitPort        = 1234
+
+	// buildKitStateDir is where the rootless BuildKit image keeps its build
+	// cache. It's mounted from a cache volume so the cache survives the job.
+	buildKitStateDir = "/home/user/.local/share/buildkit"
+)
+
+var errBuildKitUnsupportedOS = errors.New("the BuildKit daemon is not supported on Windows")
+
+func buildKitHost() string {
+	return fmt.Sprintf("tcp://%s:%d", buildKitServiceName, buildKitPort)
+}
+
+// createBuildKitService provisions the rootless BuildKit daemon configured
+// with [runners.docker.buildkit]. It's handled like any other service
+// container, so it's reachable by the build container on the job's network,
+// health checked and removed together with the other services.
+func (e *executor) createBuildKitService(linksMap map[string]*types.Container) error {
+	if !e.Config.Docker.BuildKit.IsEnabled() {
+		return nil
+	}
+
+	if e.info.OSType == osTypeWindows {
+		return errBuildKitUnsupportedOS
+	}
+
+	image := e.Config.Docker.BuildKit.GetImage()
+
+	e.Println("Starting BuildKit daemon", image, "...")
+	buildKitImage, err := e.pullManager.GetDockerImage(image, nil)
+	if err != nil {
+		return fmt.Errorf("pulling BuildKit image: %w", err)
+	}
+
+	binds, err := e.createBuildKitCacheBinds()
+	if err != nil {
+		return err
+	}
+
+	containerName := e.getProjectUniqRandomizedName() + "-" + buildKitServiceName
+
+	// this will fail potentially some builds if there's name collision
+	_ = e.removeContainer(e.Context, containerName)
+
+	port := nat.Port(fmt.Sprintf("%d/tcp", buildKitPort))
+	config := &container.Config{
+		Image: buildKitImage.ID,
+		Labels: e.labeler.Labels(map[string]string{
+			"type":    labelServiceType,
+			"service": buildKitServiceName,
+		}),
+		Cmd: []string{
+			"--addr", fmt.Sprintf("tcp://0.0.0.0:%d", buildKitPort),
+			"--oci-worker-no-process-sandbox",
+		},
+		ExposedPorts: nat.PortSet{port: struct{}{}},
+		Env:          e.getEgressProxyVariables(),
+	}
+
+	hostConfig := &container.HostConfig{
+		DNS:           e.Config.Docker.DNS,
+		DNSSearch:     e.Config.Docker.DNSSearch,
+		RestartPolicy: neverRestartPolicy,
+		ExtraHosts:    e.Config.Docker.ExtraHosts,
+		// rootless BuildKit needs to create its own user and mount namespaces,
+		// which the default seccomp and AppArmor profiles deny
+		SecurityOpt: []string{"seccomp=unconfined", "apparmor=unconfined"},
+		Runtime:     e.Config.Docker.Runtime,
+		NetworkMode: e.networkMode,
+		Binds:       binds,
+		LogConfig: container.LogConfig{
+			Type: "json-file",
+		},
+	}
+
+	e.Debugln("Creating BuildKit container", containerName, "...")
+	resp, err := e.client.ContainerCreate(
+		e.Context,
+		config,
+		hostConfig,
+		e.networkConfig([]string{buildKitServiceName}),
+		containerName,
+	)
+	if err != nil {
+		return fmt.Errorf("creating BuildKit container: %w", err)
+	}
+	e.recordContainer(resp.ID)
+
+	e.Debugln(fmt.Sprintf("Starting BuildKit container %s (%s)...", containerName, resp.ID))
+	err = e.client.ContainerStart(e.Context, resp.ID, types.ContainerStartOptions{})
+	if err != nil {
+		e.temporary = append(e.temporary, resp.ID)
+		return fmt.Errorf("starting BuildKit container: %w", err)
+	}
+
+	buildKit := fakeContainer(resp.ID, containerName)
+	e.services = append(e.services, buildKit)
+	e.temporary = append(e.temporary, buildKit.ID)
+	linksMap[buildKitServiceName] = buildKit
+
+	return nil
+}
+
+// createBuildKitCacheBinds mounts the runner's cache volume for the BuildKit
+// state directory. A separate volumes manager is used, so that the volume
+// is only mounted in the BuildKit container.
+func (e *executor) createBuildKitCacheBinds() ([]string, error) {
+	vm, err := createVolumesManager(e)
+	if err != nil {
+		return nil, err
+	}
+
+	err = vm.Create(e.Context, buildKitStateDir)
+	if errors.Is(err, volumes.ErrCacheVolumesDisabled) {
+		e.Warningln("Container based cache volumes creation is disabled. BuildKit's cache will not be persisted")
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("creating BuildKit cache volume: %w", err)
+	}
+
+	e.acquireCacheVolumes(vm.CacheVolumes())
+
+	return vm.Binds(), nil
+}
+
+func (e *executor) getBuildKitVariables() []string {
+	if !e.Config.Docker.BuildKit.IsEnabled() {
+		return nil
+	}
+
+	return []string{"BUILDKIT_HOST=" + buildKitHost()}
+}
@@ -0,0 +1,156 @@
+//go:build !integration
+
+package docker
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/go-connections/nat"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/docker/internal/pull"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/docker/internal/volumes"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/docker"
+)
+
+func TestCreateBuildKitService(t *testing.T) {
+	tests := map[string]struct {
+		buildKit           *common.DockerBuildKitConfig
+		osType             string
+		cacheVolumeErr     error
+		expectedImage      string
+		expectedBinds      []string
+		expectedErr        error
+		expectedNoBuildKit bool
+	}{
+		"not configured": {
+			expectedNoBuildKit: true,
+		},
+		"disabled": {
+			buildKit:           &common.DockerBuildKitConfig{Image: "custom/buildkit"},
+			expectedNoBuildKit: true,
+		},
+		"enabled with default image": {
+			buildKit:      &common.DockerBuildKitConfig{Enabled: true},
+			expectedImage: common.DefaultDockerBuildKitImage,
+			expectedBinds: []string{"cache-volume:" + buildKitStateDir},
+		},
+		"enabled with custom image": {
+			buildKit:      &common.DockerBuildKitConfig{Enabled: true, Image: "custom/buildkit"},
+			expectedImage: "custom/buildkit",
+			expectedBinds: []string{"cache-volume:" + buildKitStateDir},
+		},
+		"enabled with cache disabled": {
+			buildKit:       &common.DockerBuildKitConfig{Enabled: true},
+			cacheVolumeErr: volumes.ErrCacheVolumesDisabled,
+			expectedImage:  common.DefaultDockerBuildKitImage,
+		},
+		"enabled on windows": {
+			buildKit:           &common.DockerBuildKitConfig{Enabled: true},
+			osType:             osTypeWindows,
+			expectedErr:        errBuildKitUnsupportedOS,
+			expectedNoBuildKit: true,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			c := docker.NewMockClient(t)
+			p := pull.NewMockManager(t)
+			vm := volumes.NewMockManager(t)
+
+			oldCreateVolumesManager := createVolumesManager
+			defer func() { createVolumesManager = oldCreateVolumesManager }()
+			createVolumesManager = func(_ *executor) (volumes.Manager, error) {
+				return vm, nil
+			}
+
+			e := &executor{
+				client:      c,
+				pullManager: p,
+				info:        types.Info{OSType: tt.osType},
+				networkMode: container.NetworkMode("job-network"),
+			}
+			e.Config.Docker = &common.DockerConfig{BuildKit: tt.buildKit}
+			e.Build = &common.Build{Runner: &common.RunnerConfig{}}
+			e.Context = context.Background()
+			require.NoError(t, e.createLabeler())
+
+			if !tt.expectedNoBuildKit {
+				p.On("GetDockerImage", tt.expectedImage, []common.DockerPullPolicy(nil)).
+					Return(&types.ImageInspect{ID: "buildkit-image"}, nil).
+					Once()
+
+				vm.On("Create", e.Context, buildKitStateDir).
+					Return(tt.cacheVolumeErr).
+					Once()
+				if tt.cacheVolumeErr == nil {
+					vm.On("CacheVolumes").Return(nil).Once()
+					vm.On("Binds").Return(tt.expectedBinds).Once()
+				}
+
+				c.On("NetworkList", e.Context, types.NetworkListOptions{}).
+					Return(nil, nil).
+					Once()
+				c.On("ContainerRemove", e.Context, mock.Anything, mock.Anything).
+					Return(nil).
+					Once()
+				c.On(
+					"ContainerCreate",
+					e.Context,
+					mock.MatchedBy(func(config *container.Config) bool {
+						_, exposed := config.ExposedPorts[nat.Port("1234/tcp")]
+						return config.Image == "buildkit-image" &&
+							config.Labels["com.gitlab.gitlab-runner.service"] == buildKitServiceName &&
+							exposed
+					}),
+					mock.MatchedBy(func(hostConfig *container.HostConfig) bool {
+						return !hostConfig.Privileged &&
+							assert.ObjectsAreEqual(tt.expectedBinds, hostConfig.Binds) &&
+							hostConfig.NetworkMode == "job-network"
+					}),
+					&network.NetworkingConfig{
+						EndpointsConfig: map[string]*network.EndpointSettings{
+							"job-network": {Aliases: []string{buildKitServiceName}},
+						},
+					},
+					mock.Anything,
+				).
+					Return(container.CreateResponse{ID: "buildkit-id"}, nil).
+					Once()
+				c.On("ContainerStart", e.Context, "buildkit-id", mock.Anything).
+					Return(nil).
+					Once()
+			}
+
+			linksMap := make(map[string]*types.Container)
+			err := e.createBuildKitService(linksMap)
+			if tt.expectedErr != nil {
+				assert.True(t, errors.Is(err, tt.expectedErr))
+				return
+			}
+			require.NoError(t, err)
+
+			if tt.expectedNoBuildKit {
+				assert.Empty(t, linksMap)
+				assert.Empty(t, e.services)
+				assert.Empty(t, e.getBuildKitVariables())
+				return
+			}
+
+			require.Contains(t, linksMap, buildKitServiceName)
+			assert.Equal(t, "buildkit-id", linksMap[buildKitServiceName].ID)
+			assert.Equal(t, []string{"buildkit-id"}, e.temporary)
+			assert.Len(t, e.services, 1)
+			assert.Equal(t, []string{"BUILDKIT_HOST=tcp://buildkitd:1234"}, e.getBuildKitVariables())
+		})
+	}
+}
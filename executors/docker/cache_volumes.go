@@ -0,0 +1,327 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+
+	"gitlab.com/gitlab-org/gitlab-runner/executors/docker/internal/labels"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/docker"
+)
+
+// cacheVolumesQuotaCheckInterval limits how often the size of the cache
+// volumes is measured on a Docker host, as it's expensive for the daemon.
+var cacheVolumesQuotaCheckInterval = time.Minute
+
+// cacheVolumes is shared by all the jobs handled by this process, so that the
+// last use of the cache volumes is known across jobs.
+var cacheVolumes = newCacheVolumeTracker()
+
+type cacheVolumeKey struct {
+	host string
+	name string
+}
+
+type cacheVolume struct {
+	name     string
+	project  string
+	size     int64
+	lastUsed time.Time
+}
+
+// cacheVolumeTracker tracks the last use of the cache volumes created by the
+// runner, to remove the least recently used ones when the cache volumes of a
+// Docker host exceed the configured quota. The last use of the volumes isn't
+// persisted, after a restart the volumes are ordered by their creation time
+// until they're used again.
+type cacheVolumeTracker struct {
+	lock        sync.Mutex
+	lastUsed    map[cacheVolumeKey]time.Time
+	active      map[cacheVolumeKey]int
+	lastChecked map[string]time.Time
+	usage       map[string]map[string]int64
+
+	now func() time.Time
+
+	usageDesc *prometheus.Desc
+	evictions *prometheus.CounterVec
+}
+
+func newCacheVolumeTracker() *cacheVolumeTracker {
+	return &cacheVolumeTracker{
+		lastUsed:    make(map[cacheVolumeKey]time.Time),
+		active:      make(map[cacheVolumeKey]int),
+		lastChecked: make(map[string]time.Time),
+		usage:       make(map[string]map[string]int64),
+		now:         time.Now,
+		usageDesc: prometheus.NewDesc(
+			"gitlab_runner_docker_cache_volumes_size_bytes",
+			"Size of the cache volumes created by the runner, as last measured on the Docker hosts with a cache volumes quota",
+			[]string{"project"},
+			nil,
+		),
+		evictions: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "gitlab_runner_docker_cache_volumes_evictions_total",
+				Help: "Total number of cache volumes removed to keep the Docker hosts within the cache volumes quota",
+			},
+			[]string{"project"},
+		),
+	}
+}
+
+// acquire marks the volumes as used by a running job. They're not removed
+// until they're released.
+func (t *cacheVolumeTracker) acquire(host string, names []string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	now := t.now()
+	for _, name := range names {
+		key := cacheVolumeKey{host: host, name: name}
+		t.lastUsed[key] = now
+		t.active[key]++
+	}
+}
+
+func (t *cacheVolumeTracker) release(host string, names []string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	now := t.now()
+	for _, name := range names {
+		key := cacheVolumeKey{host: host, name: name}
+		t.lastUsed[key] = now
+
+		t.active[key]--
+		if t.active[key] <= 0 {
+			delete(t.active, key)
+		}
+	}
+}
+
+// enforceQuota removes the least recently used cache volumes of the host,
+// until their total size is within the quota. Volumes used by running jobs
+// or referenced by any container are never removed.
+func (t *cacheVolumeTracker) enforceQuota(
+	ctx context.Context,
+	client docker.Client,
+	host string,
+	quota int64,
+	logger logrus.FieldLogger,
+) error {
+	if !t.shouldCheck(host) {
+		return nil
+	}
+
+	usage, err := client.DiskUsage(ctx, types.DiskUsageOptions{Types: []types.DiskUsageObject{types.VolumeObject}})
+	if err != nil {
+		return fmt.Errorf("retrieving volumes disk usage: %w", err)
+	}
+
+	total, candidates := t.update(host, usage)
+
+	for _, volume := range candidates {
+		if total <= quota {
+			break
+		}
+
+		err := client.VolumeRemove(ctx, volume.name, false)
+		if err != nil {
+			logger.WithError(err).WithField("volume", volume.name).Warningln("Failed to remove cache volume")
+			continue
+		}
+
+		logger.WithFields(logrus.Fields{
+			"volume":    volume.name,
+			"size":      volume.size,
+			"last-used": volume.lastUsed,
+		}).Infoln("Removed least recently used cache volume to stay within the quota")
+
+		total -= volume.size
+		t.forget(host, volume)
+	}
+
+	if total > quota {
+		logger.WithFields(logrus.Fields{
+			"size":  total,
+			"quota": quota,
+		}).Warningln("Cache volumes exceed the quota, but no more cache volumes can be removed")
+	}
+
+	return nil
+}
+
+func (t *cacheVolumeTracker) shouldCheck(host string) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	now := t.now()
+	if now.Sub(t.lastChecked[host]) < cacheVolumesQuotaCheckInterval {
+		return false
+	}
+	t.lastChecked[host] = now
+
+	return true
+}
+
+// update records the size of the cache volumes of the host, and returns their
+// total size and the volumes that can be removed, least recently used first.
+func (t *cacheVolumeTracker) update(host string, usage types.DiskUsage) (int64, []cacheVolume) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	var total int64
+	var candidates []cacheVolume
+	projects := make(map[string]int64)
+	existing := make(map[cacheVolumeKey]bool)
+
+	for _, v := range usage.Volumes {
+		if v == nil || !isRunnerCacheVolume(v.Labels) || v.UsageData == nil || v.UsageData.Size < 0 {
+			continue
+		}
+
+		key := cacheVolumeKey{host: host, name: v.Name}
+		existing[key] = true
+
+		volume := cacheVolume{
+			name:     v.Name,
+			project:  v.Labels[labels.Key("project.id")],
+			size:     v.UsageData.Size,
+			lastUsed: t.lastUsed[key],
+		}
+		if volume.lastUsed.IsZero() {
+			volume.lastUsed, _ = time.Parse(time.RFC3339, v.CreatedAt)
+		}
+
+		total += volume.size
+		projects[volume.project] += volume.size
+
+		if t.active[key] == 0 && v.UsageData.RefCount == 0 {
+			candidates = append(candidates, volume)
+		}
+	}
+
+	// forget the volumes removed by other means
+	for key := range t.lastUsed {
+		if key.host == host && !existing[key] && t.active[key] == 0 {
+			delete(t.lastUsed, key)
+		}
+	}
+
+	t.usage[host] = projects
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].lastUsed.Before(candidates[j].lastUsed)
+	})
+
+	return total, candidates
+}
+
+func (t *cacheVolumeTracker) forget(host string, volume cacheVolume) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	delete(t.lastUsed, cacheVolumeKey{host: host, name: volume.name})
+	t.usage[host][volume.project] -= volume.size
+	t.evictions.WithLabelValues(volume.project).Inc()
+}
+
+func isRunnerCacheVolume(volumeLabels map[string]string) bool {
+	return volumeLabels[labels.Key("managed")] == "true" && volumeLabels[labels.Key("type")] == "cache"
+}
+
+// Describe implements prometheus.Collector.
+func (t *cacheVolumeTracker) Describe(ch chan<- *prometheus.Desc) {
+	ch <- t.usageDesc
+	t.evictions.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (t *cacheVolumeTracker) Collect(ch chan<- prometheus.Metric) {
+	t.lock.Lock()
+	projects := make(map[string]int64)
+	for _, usage := range t.usage {
+		for project, size := range usage {
+			projects[project] += size
+		}
+	}
+	t.lock.Unlock()
+
+	for project, size := range projects {
+		ch <- prometheus.MustNewConstMetric(t.usageDesc, prometheus.GaugeValue, float64(size), project)
+	}
+
+	t.evictions.Collect(ch)
+}
+
+// Describe implements prometheus.Collector.
+func (p executorProvider) Describe(ch chan<- *prometheus.Desc) {
+	if p.cacheVolumes != nil {
+		p.cacheVolumes.Describe(ch)
+	}
+
+	if p.imageWarmers != nil {
+		p.imageWarmers.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector.
+func (p executorProvider) Collect(ch chan<- prometheus.Metric) {
+	if p.cacheVolumes != nil {
+		p.cacheVolumes.Collect(ch)
+	}
+
+	if p.imageWarmers != nil {
+		p.imageWarmers.Collect(ch)
+	}
+}
+
+func (e *executor) trackCacheVolumes() error {
+	if e.volumesManager == nil {
+		return errVolumesManagerUndefined
+	}
+
+	e.acquireCacheVolumes(e.volumesManager.CacheVolumes())
+
+	return nil
+}
+
+func (e *executor) acquireCacheVolumes(names []string) {
+	if len(names) == 0 {
+		return
+	}
+
+	cacheVolumes.acquire(e.Config.Docker.Host, names)
+	e.cacheVolumes = append(e.cacheVolumes, names...)
+}
+
+// releaseCacheVolumes releases the cache volumes used by the job, and removes
+// the least recently used cache volumes when the host exceeds its quota
+func (e *executor) releaseCacheVolumes(ctx context.Context) {
+	cacheVolumes.release(e.Config.Docker.Host, e.cacheVolumes)
+	e.cacheVolumes = nil
+
+	quota, err := e.Config.Docker.GetCacheVolumesQuota()
+	if err == nil && quota > 0 && e.client != nil {
+		logger := logrus.WithFields(logrus.Fields{
+			"host":   e.Config.Docker.Host,
+			"runner": e.Config.ShortDescription(),
+		})
+		err = cacheVolumes.enforceQuota(ctx, e.client, e.Config.Docker.Host, quota, logger)
+	}
+
+	if err != nil {
+		quotaLogger := e.WithFields(logrus.Fields{
+			"error": err,
+		})
+
+		quotaLogger.Errorln("Failed to enforce cache volumes quota")
+	}
+}
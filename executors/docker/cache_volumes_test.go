@@ -0,0 +1,96 @@
+//go:build !integration
+
+package docker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/docker"
+)
+
+func newTestCacheVolume(name, project string, size, refCount int64, createdAt string) *volume.Volume {
+	return &volume.Volume{
+		Name:      name,
+		CreatedAt: createdAt,
+		Labels: map[string]string{
+			"com.gitlab.gitlab-runner.managed":    "true",
+			"com.gitlab.gitlab-runner.type":       "cache",
+			"com.gitlab.gitlab-runner.project.id": project,
+		},
+		UsageData: &volume.UsageData{Size: size, RefCount: refCount},
+	}
+}
+
+func TestCacheVolumeTrackerEnforceQuota(t *testing.T) {
+	const host = "unix:///var/run/docker.sock"
+
+	now := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	usage := types.DiskUsage{
+		Volumes: []*volume.Volume{
+			newTestCacheVolume("oldest-created", "1", 100, 0, "2023-01-01T00:00:00Z"),
+			newTestCacheVolume("recently-used", "1", 100, 0, "2022-01-01T00:00:00Z"),
+			newTestCacheVolume("in-use", "2", 100, 1, "2021-01-01T00:00:00Z"),
+			newTestCacheVolume("used-by-job", "2", 100, 0, "2021-01-01T00:00:00Z"),
+			newTestCacheVolume("newest-created", "3", 100, 0, "2023-05-01T00:00:00Z"),
+			{
+				Name:      "not-managed-by-runner",
+				UsageData: &volume.UsageData{Size: 1000},
+			},
+		},
+	}
+
+	tracker := newCacheVolumeTracker()
+	tracker.now = func() time.Time { return now }
+
+	tracker.acquire(host, []string{"recently-used", "used-by-job"})
+	tracker.release(host, []string{"recently-used"})
+
+	c := docker.NewMockClient(t)
+	c.On("DiskUsage", mock.Anything, types.DiskUsageOptions{Types: []types.DiskUsageObject{types.VolumeObject}}).
+		Return(usage, nil).
+		Once()
+	c.On("VolumeRemove", mock.Anything, "oldest-created", false).Return(nil).Once()
+	c.On("VolumeRemove", mock.Anything, "newest-created", false).Return(nil).Once()
+
+	err := tracker.enforceQuota(context.Background(), c, host, 300, logrus.StandardLogger())
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]int64{"1": 100, "2": 200, "3": 0}, tracker.usage[host])
+	assert.Equal(t, float64(1), testutil.ToFloat64(tracker.evictions.WithLabelValues("1")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(tracker.evictions.WithLabelValues("3")))
+
+	// the quota isn't checked again until the interval has passed
+	err = tracker.enforceQuota(context.Background(), c, host, 300, logrus.StandardLogger())
+	require.NoError(t, err)
+}
+
+func TestCacheVolumeTrackerEnforceQuotaError(t *testing.T) {
+	c := docker.NewMockClient(t)
+	c.On("DiskUsage", mock.Anything, mock.Anything).Return(types.DiskUsage{}, assert.AnError).Once()
+
+	err := newCacheVolumeTracker().enforceQuota(context.Background(), c, "host", 100, logrus.StandardLogger())
+	assert.ErrorIs(t, err, assert.AnError)
+}
+
+func TestExecutorProviderCollectsCacheVolumesMetrics(t *testing.T) {
+	tracker := newCacheVolumeTracker()
+	tracker.usage["host"] = map[string]int64{"1": 100}
+
+	assert.Equal(t, 1, testutil.CollectAndCount(executorProvider{cacheVolumes: tracker}, "gitlab_runner_docker_cache_volumes_size_bytes"))
+
+	registry := prometheus.NewRegistry()
+	require.NoError(t, registry.Register(executorProvider{cacheVolumes: tracker}))
+	require.NoError(t, registry.Register(executorProvider{}))
+}
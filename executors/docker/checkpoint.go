@@ -0,0 +1,439 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/docker/internal/exec"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/limitwriter"
+)
+
+const (
+	// checkpointContainerDir is where the job's checkpoint is mounted in the
+	// predefined container, and the checkpoints directory in the container
+	// pruning the expired checkpoints
+	checkpointContainerDir = "/checkpoints"
+
+	checkpointPruneContainerType = "checkpoint-prune"
+
+	// checkpointID is the name of the build container's CRIU checkpoint. Docker
+	// stores it in a directory of that name, inside the job's checkpoint.
+	checkpointID = "build"
+
+	checkpointSnapshotFile = "build.tar"
+	checkpointStageFile    = "stage"
+
+	checkpointRestoredMarker = "checkpoint-restored"
+	checkpointResumeMarker   = "checkpoint-resume"
+)
+
+// checkpointPruneInterval limits how often the expired checkpoints are looked
+// for in the checkpoints directory of a Docker host
+var checkpointPruneInterval = time.Hour
+
+// checkpointPrunes is shared by all the jobs handled by this process, so that
+// the checkpoints directory isn't pruned by every job
+var checkpointPrunes = &checkpointPruneTracker{
+	lastPruned: make(map[checkpointPruneKey]time.Time),
+	now:        time.Now,
+}
+
+type checkpointPruneKey struct {
+	host string
+	dir  string
+}
+
+type checkpointPruneTracker struct {
+	lock       sync.Mutex
+	lastPruned map[checkpointPruneKey]time.Time
+
+	now func() time.Time
+}
+
+func (t *checkpointPruneTracker) shouldPrune(host string, dir string) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	key := checkpointPruneKey{host: host, dir: dir}
+
+	now := t.now()
+	if now.Sub(t.lastPruned[key]) < checkpointPruneInterval {
+		return false
+	}
+	t.lastPruned[key] = now
+
+	return true
+}
+
+var (
+	errCheckpointUnsupportedOS = errors.New("checkpoints are not supported on Windows")
+	errJobCheckpointed         = errors.New("the job was checkpointed and can't run anymore")
+)
+
+func (e *executor) isCheckpointEnabled() bool {
+	return e.Config.Docker.Checkpoint != nil && e.Config.Docker.Checkpoint.Dir != ""
+}
+
+// checkpointKey identifies the checkpoint of the job. The retries of a job run
+// in the same pipeline and with the same name, so they resume from it.
+func (e *executor) checkpointKey() string {
+	name := sha256.Sum256([]byte(e.Build.JobInfo.Name))
+
+	return fmt.Sprintf(
+		"project-%d-pipeline-%s-%x",
+		e.Build.JobInfo.ProjectID,
+		e.Build.GetAllVariables().Value("CI_PIPELINE_ID"),
+		name[:8],
+	)
+}
+
+// checkpointHostDir is the directory of the job's checkpoint on the Docker host
+func (e *executor) checkpointHostDir() string {
+	return path.Join(e.Config.Docker.Checkpoint.Dir, e.checkpointKey())
+}
+
+// checkpointContainerPath is the directory of the job's checkpoint in the
+// predefined container
+func (e *executor) checkpointContainerPath() string {
+	return checkpointContainerDir
+}
+
+// getCheckpointBinds mounts only the job's checkpoint, as the predefined
+// container also runs the job's hooks, which mustn't access the checkpoints of
+// other jobs
+func (e *executor) getCheckpointBinds() []string {
+	if !e.isCheckpointEnabled() || e.info.OSType == osTypeWindows {
+		return nil
+	}
+
+	return []string{e.checkpointHostDir() + ":" + e.checkpointContainerPath()}
+}
+
+func (s *commandExecutor) isCheckpointed() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.checkpointed
+}
+
+// Checkpoint saves the state of a job aborted by the runner's shutdown in the
+// directory configured with [runners.docker.checkpoint]. The build container is
+// checkpointed with CRIU when enabled, and the build directory is always saved,
+// so that a retry of the job can at least resume from its files.
+func (s *commandExecutor) Checkpoint(ctx context.Context) error {
+	if !s.isCheckpointEnabled() {
+		return nil
+	}
+
+	if s.info.OSType == osTypeWindows {
+		return errCheckpointUnsupportedOS
+	}
+
+	s.lock.Lock()
+	s.checkpointed = true
+	s.lock.Unlock()
+
+	s.Println("Checkpointing the job before it's aborted...")
+
+	var stage common.BuildStage
+	if buildContainer := s.getBuildContainer(); buildContainer != nil {
+		criu, err := s.checkpointBuildContainer(ctx, buildContainer.ID)
+		if err != nil {
+			return err
+		}
+
+		if criu {
+			stage = s.Build.CurrentStage()
+		}
+	}
+
+	if s.helperContainer != nil {
+		// the running stage is interrupted, so that the build directory
+		// doesn't change while it's saved
+		_ = s.waiter.StopKillWait(ctx, s.helperContainer.ID, nil)
+	}
+
+	return s.saveBuildDir(ctx, stage)
+}
+
+// checkpointBuildContainer stops the build container, checkpointing it with
+// CRIU when enabled. It returns whether the CRIU checkpoint was created.
+func (s *commandExecutor) checkpointBuildContainer(ctx context.Context, id string) (bool, error) {
+	inspect, err := s.client.ContainerInspect(ctx, id)
+	if err != nil {
+		return false, fmt.Errorf("inspecting build container: %w", err)
+	}
+
+	if inspect.State == nil || !inspect.State.Running {
+		return false, nil
+	}
+
+	if s.Config.Docker.Checkpoint.CRIU {
+		err = s.client.CheckpointCreate(ctx, id, types.CheckpointCreateOptions{
+			CheckpointID:  checkpointID,
+			CheckpointDir: s.checkpointHostDir(),
+			Exit:          true,
+		})
+		if err == nil {
+			s.Println("Created the CRIU checkpoint of the build container")
+			return true, nil
+		}
+
+		s.Warningln("Failed to create the CRIU checkpoint of the build container, only the build directory is saved:", err)
+	}
+
+	_ = s.waiter.StopKillWait(ctx, id, nil)
+
+	return false, nil
+}
+
+// saveBuildDir archives the build directory in the job's checkpoint, with the
+// stage the build container was checkpointed in, if any
+func (s *commandExecutor) saveBuildDir(ctx context.Context, stage common.BuildStage) error {
+	dir := s.checkpointContainerPath()
+
+	// the checkpoint is touched, so that it isn't pruned until it's expired
+	// since its last save
+	script := fmt.Sprintf(
+		"touch %q && tar -cf %q -C %q . && ",
+		dir,
+		path.Join(dir, checkpointSnapshotFile),
+		s.Build.FullProjectDir(),
+	)
+	if stage != "" {
+		script += fmt.Sprintf("echo %q > %q", stage, path.Join(dir, checkpointStageFile))
+	} else {
+		script += fmt.Sprintf("rm -f %q", path.Join(dir, checkpointStageFile))
+	}
+
+	_, err := s.execInPredefinedContainer(ctx, script)
+	if err != nil {
+		return fmt.Errorf("saving build directory: %w", err)
+	}
+
+	s.Println("Saved the build directory in the checkpoint", s.checkpointKey())
+
+	return nil
+}
+
+// restoreCheckpoint restores the build directory saved by a previous attempt
+// of the job, before the first stage running in the build container. When
+// that stage is the one the build container was checkpointed in, the build
+// container is resumed from its CRIU checkpoint. It returns whether the stage
+// was run by the resumed container.
+func (s *commandExecutor) restoreCheckpoint(cmd common.ExecutorCommand) (bool, error) {
+	if !s.isCheckpointEnabled() || s.info.OSType == osTypeWindows || s.checkpointRestored {
+		return false, nil
+	}
+	s.checkpointRestored = true
+
+	err := s.pruneCheckpoints(cmd.Context)
+	if err != nil {
+		s.Warningln("Failed to prune the expired checkpoints:", err)
+	}
+
+	output, err := s.execInPredefinedContainer(cmd.Context, s.checkpointRestoreScript(cmd.Stage))
+	if err != nil {
+		s.Warningln("Failed to restore the checkpoint of the job:", err)
+		return false, nil
+	}
+
+	if !strings.Contains(output, checkpointRestoredMarker) {
+		return false, nil
+	}
+
+	s.Println("Restored the build directory from the checkpoint", s.checkpointKey())
+
+	if !strings.Contains(output, checkpointResumeMarker) {
+		return false, nil
+	}
+
+	return s.resumeBuildContainer(cmd)
+}
+
+// checkpointRestoreScript restores the build directory from the checkpoint.
+// The checkpoint is the mount point of the job's checkpoint, so only its
+// content is removed once it's restored.
+func (s *commandExecutor) checkpointRestoreScript(stage common.BuildStage) string {
+	dir := s.checkpointContainerPath()
+	remove := fmt.Sprintf(
+		"rm -rf %q %q %q",
+		path.Join(dir, checkpointSnapshotFile),
+		path.Join(dir, checkpointStageFile),
+		path.Join(dir, checkpointID),
+	)
+
+	script := fmt.Sprintf(
+		"if [ -f %[1]q ]; then tar -xf %[1]q -C %[2]q && echo %[3]s; fi\n",
+		path.Join(dir, checkpointSnapshotFile),
+		s.Build.FullProjectDir(),
+		checkpointRestoredMarker,
+	)
+
+	if !s.Config.Docker.Checkpoint.CRIU {
+		return script + remove + "\n"
+	}
+
+	// the CRIU checkpoint is kept for the build container to be resumed from
+	// it, and is removed once it's done
+	return script + fmt.Sprintf(
+		"if [ \"$(cat %[1]q 2>/dev/null)\" = %[2]q ] && [ -d %[3]q ]; then "+
+			"echo %[4]s; rm -f %[5]q %[1]q; else %[6]s; fi\n",
+		path.Join(dir, checkpointStageFile),
+		stage,
+		path.Join(dir, checkpointID),
+		checkpointResumeMarker,
+		path.Join(dir, checkpointSnapshotFile),
+		remove,
+	)
+}
+
+// resumeBuildContainer starts the build container from its CRIU checkpoint,
+// and streams its output until it exits. When the container can't be
+// restored, the stage is run from the start.
+func (s *commandExecutor) resumeBuildContainer(cmd common.ExecutorCommand) (bool, error) {
+	ctr, err := s.requestBuildContainer()
+	if err != nil {
+		return false, err
+	}
+
+	defer func() {
+		err := s.client.CheckpointDelete(s.Context, ctr.ID, types.CheckpointDeleteOptions{
+			CheckpointID:  checkpointID,
+			CheckpointDir: s.checkpointHostDir(),
+		})
+		if err != nil {
+			s.Warningln("Failed to remove the CRIU checkpoint of the build container:", err)
+		}
+	}()
+
+	hijacked, err := s.client.ContainerAttach(cmd.Context, ctr.ID, types.ContainerAttachOptions{
+		Stream: true,
+		Stdout: true,
+		Stderr: true,
+	})
+	if err != nil {
+		return false, err
+	}
+	defer hijacked.Close()
+
+	err = s.client.ContainerStart(cmd.Context, ctr.ID, types.ContainerStartOptions{
+		CheckpointID:  checkpointID,
+		CheckpointDir: s.checkpointHostDir(),
+	})
+	if err != nil {
+		s.Warningln("Failed to resume the build container from its CRIU checkpoint, running the stage from the start:", err)
+		return false, nil
+	}
+
+	s.Println("Resumed the build container from its CRIU checkpoint")
+	s.SetCurrentStage(ExecutorStageRun)
+
+	outputCh := make(chan error, 1)
+	go func() {
+		_, err := stdcopy.StdCopy(s.Trace, s.Trace, hijacked.Reader)
+		outputCh <- err
+	}()
+
+	select {
+	case <-cmd.Context.Done():
+	case <-outputCh:
+	}
+
+	return true, s.waiter.StopKillWait(s.Context, ctr.ID, nil)
+}
+
+// execInPredefinedContainer runs the script in the predefined container and
+// returns its output
+func (s *commandExecutor) execInPredefinedContainer(ctx context.Context, script string) (string, error) {
+	c, err := s.requestPredefinedContainer()
+	if err != nil {
+		return "", fmt.Errorf("requesting new predefined container: %w", err)
+	}
+
+	output := new(bytes.Buffer)
+	// limit how much data we read from the container log to
+	// avoid memory exhaustion
+	lw := limitwriter.New(output, 1024)
+	streams := exec.IOStreams{
+		Stdin:  strings.NewReader(script),
+		Stderr: lw,
+		Stdout: lw,
+	}
+
+	dockerExec := exec.NewDocker(s.Context, s.client, s.waiter, s.Build.Log())
+	err = dockerExec.Exec(ctx, c.ID, streams)
+	if err != nil {
+		return output.String(), fmt.Errorf("%w: %s", err, strings.TrimSpace(output.String()))
+	}
+
+	return output.String(), nil
+}
+
+// pruneCheckpoints removes the checkpoints that weren't saved for longer than
+// the configured max age, left by the jobs that were never retried. They're
+// removed by a dedicated container, as only the job's own checkpoint is
+// mounted in the predefined container.
+func (s *commandExecutor) pruneCheckpoints(ctx context.Context) error {
+	maxAge, err := s.Config.Docker.Checkpoint.GetMaxAge()
+	if err != nil {
+		return err
+	}
+
+	if !checkpointPrunes.shouldPrune(s.Config.Docker.Host, s.Config.Docker.Checkpoint.Dir) {
+		return nil
+	}
+
+	image, err := s.getPrebuiltImage()
+	if err != nil {
+		return fmt.Errorf("getting helper image: %w", err)
+	}
+
+	config := &container.Config{
+		Image:  image.ID,
+		Labels: s.labeler.Labels(map[string]string{"type": checkpointPruneContainerType}),
+		Cmd: []string{
+			"find", checkpointContainerDir, "-mindepth", "1", "-maxdepth", "1",
+			"-mmin", fmt.Sprintf("+%d", int(maxAge.Minutes())),
+			"-exec", "rm", "-rf", "{}", "+",
+		},
+	}
+
+	hostConfig := &container.HostConfig{
+		Binds:       []string{s.Config.Docker.Checkpoint.Dir + ":" + checkpointContainerDir},
+		NetworkMode: container.NetworkMode("none"),
+		LogConfig: container.LogConfig{
+			Type: "json-file",
+		},
+	}
+
+	containerName := s.getProjectUniqRandomizedName() + "-" + checkpointPruneContainerType
+
+	s.Debugln("Creating container", containerName, "...")
+	resp, err := s.client.ContainerCreate(ctx, config, hostConfig, nil, containerName)
+	if resp.ID != "" {
+		defer func() { _ = s.removeContainer(s.Context, resp.ID) }()
+	}
+	if err != nil {
+		return fmt.Errorf("creating checkpoint prune container: %w", err)
+	}
+
+	err = s.client.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{})
+	if err != nil {
+		return fmt.Errorf("starting checkpoint prune container: %w", err)
+	}
+
+	return s.waiter.Wait(ctx, resp.ID)
+}
@@ -0,0 +1,248 @@
+//go:build !integration
+
+package docker
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/strslice"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/docker/internal/labels"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/docker/internal/wait"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/docker"
+)
+
+func newCheckpointTestExecutor(config *common.DockerCheckpointConfig) *commandExecutor {
+	return &commandExecutor{
+		executor: executor{
+			AbstractExecutor: executors.AbstractExecutor{
+				Build: &common.Build{
+					JobResponse: common.JobResponse{
+						JobInfo: common.JobInfo{Name: "test", ProjectID: 123},
+						Variables: common.JobVariables{
+							{Key: "CI_PIPELINE_ID", Value: "456", Public: true},
+						},
+					},
+					Runner:   &common.RunnerConfig{},
+					BuildDir: "/builds/group/project",
+				},
+				Config: common.RunnerConfig{
+					RunnerSettings: common.RunnerSettings{
+						Docker: &common.DockerConfig{Checkpoint: config},
+					},
+				},
+				Context: context.Background(),
+			},
+		},
+	}
+}
+
+func TestCheckpointKey(t *testing.T) {
+	e := newCheckpointTestExecutor(&common.DockerCheckpointConfig{Dir: "/mnt/checkpoints"})
+
+	assert.Equal(t, "project-123-pipeline-456-9f86d081884c7d65", e.checkpointKey())
+	assert.Equal(t, "/mnt/checkpoints/project-123-pipeline-456-9f86d081884c7d65", e.checkpointHostDir())
+	assert.Equal(t, "/checkpoints", e.checkpointContainerPath())
+
+	e.Build.JobInfo.Name = "other"
+	assert.NotEqual(t, "project-123-pipeline-456-9f86d081884c7d65", e.checkpointKey())
+}
+
+func TestGetCheckpointBinds(t *testing.T) {
+	tests := map[string]struct {
+		config        *common.DockerCheckpointConfig
+		osType        string
+		expectedBinds []string
+	}{
+		"not configured": {},
+		"no directory": {
+			config: &common.DockerCheckpointConfig{CRIU: true},
+		},
+		"configured": {
+			config:        &common.DockerCheckpointConfig{Dir: "/mnt/checkpoints"},
+			expectedBinds: []string{"/mnt/checkpoints/project-123-pipeline-456-9f86d081884c7d65:/checkpoints"},
+		},
+		"windows": {
+			config: &common.DockerCheckpointConfig{Dir: "/mnt/checkpoints"},
+			osType: osTypeWindows,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			e := newCheckpointTestExecutor(tt.config)
+			e.info.OSType = tt.osType
+
+			assert.Equal(t, tt.expectedBinds, e.getCheckpointBinds())
+		})
+	}
+}
+
+func TestCheckpointRestoreScript(t *testing.T) {
+	e := newCheckpointTestExecutor(&common.DockerCheckpointConfig{Dir: "/mnt/checkpoints"})
+	dir := e.checkpointContainerPath()
+
+	script := e.checkpointRestoreScript("step_script")
+	assert.Contains(t, script, `tar -xf "`+dir+`/build.tar" -C "/builds/group/project"`)
+	assert.Contains(t, script, `rm -rf "`+dir+`/build.tar" "`+dir+`/stage" "`+dir+`/build"`)
+	assert.NotContains(t, script, `rm -rf "`+dir+`"`+"\n")
+	assert.NotContains(t, script, checkpointResumeMarker)
+
+	e.Config.Docker.Checkpoint.CRIU = true
+
+	script = e.checkpointRestoreScript("step_script")
+	assert.Contains(t, script, `[ "$(cat "`+dir+`/stage" 2>/dev/null)" = "step_script" ]`)
+	assert.Contains(t, script, `[ -d "`+dir+`/build" ]`)
+	assert.Contains(t, script, "echo "+checkpointResumeMarker)
+}
+
+func TestCheckpoint(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		e := newCheckpointTestExecutor(nil)
+
+		assert.NoError(t, e.Checkpoint(context.Background()))
+		assert.False(t, e.isCheckpointed())
+	})
+
+	t.Run("windows", func(t *testing.T) {
+		e := newCheckpointTestExecutor(&common.DockerCheckpointConfig{Dir: "/mnt/checkpoints"})
+		e.info.OSType = osTypeWindows
+
+		assert.ErrorIs(t, e.Checkpoint(context.Background()), errCheckpointUnsupportedOS)
+		assert.False(t, e.isCheckpointed())
+	})
+}
+
+func TestCheckpointBuildContainer(t *testing.T) {
+	running := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{State: &types.ContainerState{Running: true}},
+	}
+
+	tests := map[string]struct {
+		criu         bool
+		setupMocks   func(c *docker.MockClient, w *wait.MockKillWaiter)
+		expectedCRIU bool
+	}{
+		"not running": {
+			setupMocks: func(c *docker.MockClient, w *wait.MockKillWaiter) {
+				c.On("ContainerInspect", mock.Anything, "build-id").
+					Return(types.ContainerJSON{
+						ContainerJSONBase: &types.ContainerJSONBase{State: &types.ContainerState{}},
+					}, nil).
+					Once()
+			},
+		},
+		"stopped without CRIU": {
+			setupMocks: func(c *docker.MockClient, w *wait.MockKillWaiter) {
+				c.On("ContainerInspect", mock.Anything, "build-id").Return(running, nil).Once()
+				w.On("StopKillWait", mock.Anything, "build-id", (*int)(nil)).Return(nil).Once()
+			},
+		},
+		"CRIU checkpoint": {
+			criu: true,
+			setupMocks: func(c *docker.MockClient, w *wait.MockKillWaiter) {
+				c.On("ContainerInspect", mock.Anything, "build-id").Return(running, nil).Once()
+				c.On("CheckpointCreate", mock.Anything, "build-id", types.CheckpointCreateOptions{
+					CheckpointID:  "build",
+					CheckpointDir: "/mnt/checkpoints/project-123-pipeline-456-9f86d081884c7d65",
+					Exit:          true,
+				}).Return(nil).Once()
+			},
+			expectedCRIU: true,
+		},
+		"CRIU checkpoint failure": {
+			criu: true,
+			setupMocks: func(c *docker.MockClient, w *wait.MockKillWaiter) {
+				c.On("ContainerInspect", mock.Anything, "build-id").Return(running, nil).Once()
+				c.On("CheckpointCreate", mock.Anything, "build-id", mock.Anything).
+					Return(errors.New("checkpoint only supported in experimental mode")).
+					Once()
+				w.On("StopKillWait", mock.Anything, "build-id", (*int)(nil)).Return(nil).Once()
+			},
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			e := newCheckpointTestExecutor(&common.DockerCheckpointConfig{Dir: "/mnt/checkpoints", CRIU: tt.criu})
+			e.BuildLogger = common.NewBuildLogger(&common.Trace{Writer: io.Discard}, e.Build.Log())
+
+			c := docker.NewMockClient(t)
+			w := wait.NewMockKillWaiter(t)
+			e.client = c
+			e.waiter = w
+			tt.setupMocks(c, w)
+
+			criu, err := e.checkpointBuildContainer(context.Background(), "build-id")
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedCRIU, criu)
+		})
+	}
+}
+
+func TestRunCheckpointed(t *testing.T) {
+	e := newCheckpointTestExecutor(&common.DockerCheckpointConfig{Dir: "/mnt/checkpoints"})
+	e.checkpointed = true
+
+	err := e.Run(common.ExecutorCommand{Stage: "step_script", Context: context.Background()})
+	assert.ErrorIs(t, err, errJobCheckpointed)
+}
+
+func TestPruneCheckpoints(t *testing.T) {
+	oldPrunes := checkpointPrunes
+	defer func() { checkpointPrunes = oldPrunes }()
+	checkpointPrunes = &checkpointPruneTracker{
+		lastPruned: make(map[checkpointPruneKey]time.Time),
+		now:        time.Now,
+	}
+
+	e := newCheckpointTestExecutor(&common.DockerCheckpointConfig{Dir: "/mnt/checkpoints", MaxAge: "72h"})
+	e.BuildLogger = common.NewBuildLogger(&common.Trace{Writer: io.Discard}, e.Build.Log())
+	e.labeler = labels.NewLabeler(e.Build)
+
+	c := docker.NewMockClient(t)
+	w := wait.NewMockKillWaiter(t)
+	e.client = c
+	e.waiter = w
+
+	c.On("ImageInspectWithRaw", mock.Anything, mock.Anything).
+		Return(types.ImageInspect{ID: "helper-image"}, nil, nil).
+		Once()
+	c.On(
+		"ContainerCreate",
+		mock.Anything,
+		mock.MatchedBy(func(config *container.Config) bool {
+			return config.Image == "helper-image" &&
+				assert.Equal(t, strslice.StrSlice{
+					"find", "/checkpoints", "-mindepth", "1", "-maxdepth", "1",
+					"-mmin", "+4320", "-exec", "rm", "-rf", "{}", "+",
+				}, config.Cmd)
+		}),
+		mock.MatchedBy(func(hostConfig *container.HostConfig) bool {
+			return assert.Equal(t, []string{"/mnt/checkpoints:/checkpoints"}, hostConfig.Binds)
+		}),
+		(*network.NetworkingConfig)(nil),
+		mock.Anything,
+	).Return(container.CreateResponse{ID: "prune-id"}, nil).Once()
+	c.On("ContainerStart", mock.Anything, "prune-id", mock.Anything).Return(nil).Once()
+	w.On("Wait", mock.Anything, "prune-id").Return(nil).Once()
+	c.On("NetworkList", mock.Anything, mock.Anything).Return(nil, nil).Once()
+	c.On("ContainerRemove", mock.Anything, "prune-id", mock.Anything).Return(nil).Once()
+
+	require.NoError(t, e.pruneCheckpoints(context.Background()))
+
+	// the checkpoints directory was pruned recently
+	require.NoError(t, e.pruneCheckpoints(context.Background()))
+}
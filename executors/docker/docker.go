@@ -86,6 +86,9 @@ type executor struct {
 
 	services []*types.Container
 
+	serviceReadinessProbes map[string]*common.ReadinessProbe // keyed by service container ID
+	sharedServices         []sharedServiceUse
+
 	links []string
 
 	devices        []container.DeviceMapping
@@ -100,9 +103,15 @@ type executor struct {
 
 	networkMode container.NetworkMode
 
+	overwrites *overwrites
+
+	cacheVolumes []string // names of the reusable cache volumes used by the job
+
 	projectUniqRandomizedName string
 
 	tunnelClient executors.Client
+
+	resourceUsage *resourceUsageCollector
 }
 
 func init() {
@@ -211,6 +220,15 @@ func (e *executor) getPrebuiltImage() (*types.ImageInspect, error) {
 		return e.pullManager.GetDockerImage(imageNameFromConfig, nil)
 	}
 
+	// The helper image found on the host, or loaded from the bundled archive,
+	// can't be verified against the digest it was pushed with, so it's pulled,
+	// and verified, by the pull manager instead
+	if e.Config.Docker.ImageVerification != nil {
+		e.Println("Using helper image: ", e.helperImageInfo.String())
+
+		return e.pullManager.GetDockerImage(e.helperImageInfo.String(), nil)
+	}
+
 	e.Debugln(fmt.Sprintf("Looking for prebuilt image %s...", e.helperImageInfo))
 	image, _, err := e.client.ImageInspectWithRaw(e.Context, e.helperImageInfo.String())
 	if err == nil {
@@ -403,7 +421,7 @@ func (e *executor) createService(
 	config := &container.Config{
 		Image:  serviceImage.ID,
 		Labels: e.labeler.Labels(labels),
-		Env:    e.getServiceVariables(serviceDefinition),
+		Env:    append(e.getServiceVariables(serviceDefinition), e.getEgressProxyVariables()...),
 	}
 
 	if len(serviceDefinition.Command) > 0 {
@@ -411,7 +429,10 @@ func (e *executor) createService(
 	}
 	config.Entrypoint = e.overwriteEntrypoint(&serviceDefinition)
 
-	hostConfig := e.createHostConfigForService()
+	hostConfig, err := e.createHostConfigForService()
+	if err != nil {
+		return nil, err
+	}
 	hostConfig.Privileged = hostConfig.Privileged && e.isInPrivilegedServiceList(serviceDefinition)
 	networkConfig := e.networkConfig(linkNames)
 
@@ -420,6 +441,7 @@ func (e *executor) createService(
 	if err != nil {
 		return nil, err
 	}
+	e.recordContainer(resp.ID)
 
 	e.Debugln(fmt.Sprintf("Starting service container %s (%s)...", containerName, resp.ID))
 	err = e.client.ContainerStart(e.Context, resp.ID, types.ContainerStartOptions{})
@@ -431,13 +453,22 @@ func (e *executor) createService(
 	return fakeContainer(resp.ID, containerName), nil
 }
 
-func (e *executor) createHostConfigForService() *container.HostConfig {
+func (e *executor) createHostConfigForService() (*container.HostConfig, error) {
 	privileged := e.Config.Docker.Privileged
 	if e.Config.Docker.ServicesPrivileged != nil {
 		privileged = *e.Config.Docker.ServicesPrivileged
 	}
 
+	overwrites, err := e.getOverwrites()
+	if err != nil {
+		return nil, err
+	}
+
 	return &container.HostConfig{
+		Resources: container.Resources{
+			Memory:   overwrites.serviceResources.memory,
+			NanoCPUs: overwrites.serviceResources.nanoCPUs,
+		},
 		DNS:           e.Config.Docker.DNS,
 		DNSSearch:     e.Config.Docker.DNSSearch,
 		RestartPolicy: neverRestartPolicy,
@@ -448,12 +479,12 @@ func (e *executor) createHostConfigForService() *container.HostConfig {
 		UsernsMode:    container.UsernsMode(e.Config.Docker.UsernsMode),
 		NetworkMode:   e.networkMode,
 		Binds:         e.volumesManager.Binds(),
-		ShmSize:       e.Config.Docker.ShmSize,
+		ShmSize:       overwrites.serviceResources.shmSize,
 		Tmpfs:         e.Config.Docker.ServicesTmpfs,
 		LogConfig: container.LogConfig{
 			Type: "json-file",
 		},
-	}
+	}, nil
 }
 
 func (e *executor) networkConfig(aliases []string) *network.NetworkingConfig {
@@ -482,16 +513,41 @@ func (e *executor) createBuildNetwork() error {
 		return errNetworksManagerUndefined
 	}
 
-	networkMode, err := e.networksManager.Create(e.Context, e.Config.Docker.NetworkMode, e.Config.Docker.EnableIPv6)
+	networkMode, err := e.networksManager.Create(
+		e.Context,
+		e.Config.Docker.NetworkMode,
+		e.Config.Docker.EnableIPv6,
+		e.isEgressPolicyEnabled(),
+	)
 	if err != nil {
 		return err
 	}
 
 	e.networkMode = networkMode
 
+	// A user defined network that isn't configured by the user was created for this build
+	perBuild := networkMode.UserDefined() != "" && e.Config.Docker.NetworkMode == ""
+	if perBuild {
+		e.Build.RecordExecutorResource(common.ExecutorResource{
+			Type: common.ExecutorResourceNetwork,
+			ID:   networkMode.UserDefined(),
+		})
+	}
+
+	if e.isEgressPolicyEnabled() && !perBuild {
+		return errEgressPolicyRequiresNetworkPerBuild
+	}
+
 	return nil
 }
 
+func (e *executor) recordContainer(id string) {
+	e.Build.RecordExecutorResource(common.ExecutorResource{
+		Type: common.ExecutorResourceContainer,
+		ID:   id,
+	})
+}
+
 func (e *executor) cleanupNetwork(ctx context.Context) error {
 	if e.networksManager == nil {
 		return errNetworksManagerUndefined
@@ -559,6 +615,9 @@ func (e *executor) createContainer(
 		return nil, err
 	}
 	hostConfig.Privileged = hostConfig.Privileged && e.isInPrivilegedImageList(imageDefinition)
+	if containerType == predefinedContainerType {
+		hostConfig.Binds = append(hostConfig.Binds, e.getCheckpointBinds()...)
+	}
 
 	aliases := []string{"build", containerName}
 	networkConfig := e.networkConfig(aliases)
@@ -570,6 +629,7 @@ func (e *executor) createContainer(
 	resp, err := e.client.ContainerCreate(e.Context, config, hostConfig, networkConfig, containerName)
 	if resp.ID != "" {
 		e.temporary = append(e.temporary, resp.ID)
+		e.recordContainer(resp.ID)
 	}
 	if err != nil {
 		return nil, err
@@ -598,12 +658,13 @@ func (e *executor) createContainerConfig(
 		AttachStderr: true,
 		OpenStdin:    true,
 		StdinOnce:    true,
-		Env:          e.Build.GetAllVariables().StringList(),
+		Env:          append(e.Build.GetAllVariables().StringList(), e.getEgressProxyVariables()...),
 	}
 
-	// user config should only be set in build containers
+	// user config and the BuildKit host should only be set in build containers
 	if containerType == buildContainerType {
 		config.User = e.Config.Docker.User
+		config.Env = append(config.Env, e.getBuildKitVariables()...)
 	}
 
 	config.Entrypoint = e.overwriteEntrypoint(&imageDefinition)
@@ -613,7 +674,7 @@ func (e *executor) createContainerConfig(
 }
 
 func (e *executor) createHostConfig() (*container.HostConfig, error) {
-	nanoCPUs, err := e.Config.Docker.GetNanoCPUs()
+	overwrites, err := e.getOverwrites()
 	if err != nil {
 		return nil, err
 	}
@@ -631,12 +692,12 @@ func (e *executor) createHostConfig() (*container.HostConfig, error) {
 
 	return &container.HostConfig{
 		Resources: container.Resources{
-			Memory:            e.Config.Docker.GetMemory(),
-			MemorySwap:        e.Config.Docker.GetMemorySwap(),
+			Memory:            overwrites.buildResources.memory,
+			MemorySwap:        overwrites.buildResources.memorySwap,
 			MemoryReservation: e.Config.Docker.GetMemoryReservation(),
 			CpusetCpus:        e.Config.Docker.CPUSetCPUs,
 			CPUShares:         e.Config.Docker.CPUShares,
-			NanoCPUs:          nanoCPUs,
+			NanoCPUs:          overwrites.buildResources.nanoCPUs,
 			Devices:           e.devices,
 			DeviceRequests:    e.deviceRequests,
 			OomKillDisable:    e.Config.Docker.GetOomKillDisable(),
@@ -658,7 +719,7 @@ func (e *executor) createHostConfig() (*container.HostConfig, error) {
 		Links:         append(e.Config.Docker.Links, e.links...),
 		Binds:         e.volumesManager.Binds(),
 		OomScoreAdj:   e.Config.Docker.OomScoreAdjust,
-		ShmSize:       e.Config.Docker.ShmSize,
+		ShmSize:       overwrites.buildResources.shmSize,
 		Isolation:     isolation,
 		VolumeDriver:  e.Config.Docker.VolumeDriver,
 		VolumesFrom:   e.Config.Docker.VolumesFrom,
@@ -894,6 +955,8 @@ func (e *executor) createDependencies() error {
 		e.createVolumesManager,
 		e.createVolumes,
 		e.createBuildVolume,
+		e.trackCacheVolumes,
+		e.createEgressProxy,
 		e.createServices,
 	}
 
@@ -976,6 +1039,7 @@ func (e *executor) Prepare(options common.ExecutorPrepareOptions) error {
 	}
 
 	e.AbstractExecutor.PrepareConfiguration(options)
+	e.setupResourceUsage()
 
 	err := e.connectDocker(options)
 	if err != nil {
@@ -1004,6 +1068,11 @@ func (e *executor) Prepare(options common.ExecutorPrepareOptions) error {
 		return errors.New("docker doesn't support shells that require script file")
 	}
 
+	_, err = e.getOverwrites()
+	if err != nil {
+		return err
+	}
+
 	imageName, err := e.expandImageName(e.Build.Image.Name, []string{})
 	if err != nil {
 		return err
@@ -1122,6 +1191,10 @@ func (e *executor) Cleanup() {
 
 	wg.Wait()
 
+	e.releaseSharedServices(ctx)
+	e.releaseCacheVolumes(ctx)
+	e.recordUsedImages()
+
 	err := e.cleanupVolume(ctx)
 	if err != nil {
 		volumeLogger := e.WithFields(logrus.Fields{
@@ -32,6 +32,11 @@ type commandExecutor struct {
 	buildContainer                  *types.ContainerJSON
 	lock                            sync.Mutex
 	terminalWaitForContainerTimeout time.Duration
+
+	// checkpointed is set once the job is checkpointed, to prevent its
+	// remaining stages from running
+	checkpointed       bool
+	checkpointRestored bool
 }
 
 func (s *commandExecutor) getBuildContainer() *types.ContainerJSON {
@@ -67,6 +72,10 @@ func (s *commandExecutor) Prepare(options common.ExecutorPrepareOptions) error {
 		s.Println("Not using umask - FF_DISABLE_UMASK_FOR_DOCKER_EXECUTOR is set!")
 	}
 
+	if isDaemonUserNamespaced(s.info) {
+		s.Debugln("Docker daemon uses user namespaces, ownership of files will be fixed for non-root images")
+	}
+
 	return nil
 }
 
@@ -89,6 +98,17 @@ func (s *commandExecutor) Run(cmd common.ExecutorCommand) error {
 		return fmt.Errorf("getting job section attempts: %w", err)
 	}
 
+	if s.isCheckpointed() {
+		return errJobCheckpointed
+	}
+
+	if !cmd.Predefined {
+		resumed, err := s.restoreCheckpoint(cmd)
+		if resumed || err != nil {
+			return err
+		}
+	}
+
 	var runErr error
 	for attempts := 1; attempts <= maxAttempts; attempts++ {
 		if attempts > 1 {
@@ -103,7 +123,9 @@ func (s *commandExecutor) Run(cmd common.ExecutorCommand) error {
 		s.Debugln("Executing on", ctr.Name, "the", cmd.Script)
 		s.SetCurrentStage(ExecutorStageRun)
 
+		stopWatchingResourceUsage := s.watchResourceUsage(cmd.Context, ctr.ID)
 		runErr = s.startAndWatchContainer(cmd.Context, ctr.ID, bytes.NewBufferString(cmd.Script))
+		stopWatchingResourceUsage()
 		if !docker.IsErrNotFound(runErr) {
 			return runErr
 		}
@@ -208,7 +230,7 @@ func (s *commandExecutor) requestBuildContainer() (*types.ContainerJSON, error)
 }
 
 func (s *commandExecutor) changeFilesOwnership() error {
-	if !s.isUmaskDisabled() {
+	if !s.isUmaskDisabled() && !isDaemonUserNamespaced(s.info) {
 		return nil
 	}
 
@@ -281,25 +303,52 @@ func (s *commandExecutor) executeChown(dockerExec exec.Docker, uid int, gid int)
 		return fmt.Errorf("requesting new predefined container: %w", err)
 	}
 
-	err = s.executeChownOnDir(c, dockerExec, uid, gid, s.Build.FullProjectDir())
-	if err != nil {
-		return err
+	for _, dir := range []string{s.Build.FullProjectDir(), s.Build.TmpProjectDir()} {
+		err = s.executeChownOnDir(c, dockerExec, uid, gid, dir, chownCommand(uid, gid, dir))
+		if err != nil {
+			return err
+		}
 	}
 
-	err = s.executeChownOnDir(c, dockerExec, uid, gid, s.Build.TmpProjectDir())
-	if err != nil {
-		return err
+	if !isDaemonUserNamespaced(s.info) {
+		return nil
+	}
+
+	// Cache volumes are created by the daemon and owned by the remapped root
+	// user, so they're only writable by the build when their ownership is fixed
+	for _, dir := range s.volumesManager.CacheDestinations() {
+		err = s.executeChownOnDir(c, dockerExec, uid, gid, dir, cacheChownCommand(uid, gid, dir))
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
+func chownCommand(uid int, gid int, dir string) string {
+	return fmt.Sprintf("chown -RP -- %d:%d %q", uid, gid, dir)
+}
+
+// cacheChownCommand changes the ownership of the files of a cache volume only
+// when the volume isn't owned by the user yet. A freshly created volume is
+// owned by the daemon's root user, while the files of a reused volume already
+// belong to the user, and walking them again would slow down every job.
+func cacheChownCommand(uid int, gid int, dir string) string {
+	return fmt.Sprintf(
+		`[ "$(stat -c %%u:%%g %q)" = "%d:%d" ] || %s`,
+		dir, uid, gid,
+		chownCommand(uid, gid, dir),
+	)
+}
+
 func (s *commandExecutor) executeChownOnDir(
 	c *types.ContainerJSON,
 	dockerExec exec.Docker,
 	uid int,
 	gid int,
 	dir string,
+	command string,
 ) error {
 	s.Println(fmt.Sprintf("Changing ownership of files at %q to %d:%d", dir, uid, gid))
 
@@ -308,7 +357,7 @@ func (s *commandExecutor) executeChownOnDir(
 	// avoid memory exhaustion
 	lw := limitwriter.New(output, 1024)
 	streams := exec.IOStreams{
-		Stdin:  strings.NewReader(fmt.Sprintf("chown -RP -- %d:%d %q", uid, gid, dir)),
+		Stdin:  strings.NewReader(command),
 		Stderr: lw,
 		Stdout: lw,
 	}
@@ -367,17 +416,23 @@ func init() {
 		features.ServiceMultipleAliases = true
 	}
 
-	common.RegisterExecutorProvider("docker", executors.DefaultExecutorProvider{
-		Creator:          creator,
-		FeaturesUpdater:  featuresUpdater,
-		ConfigUpdater:    configUpdater,
-		DefaultShellName: options.Shell.Shell,
+	common.RegisterExecutorProvider("docker", executorProvider{
+		DefaultExecutorProvider: executors.DefaultExecutorProvider{
+			Creator:          creator,
+			FeaturesUpdater:  featuresUpdater,
+			ConfigUpdater:    configUpdater,
+			DefaultShellName: options.Shell.Shell,
+		},
+		cacheVolumes: cacheVolumes,
+		imageWarmers: imageWarmers,
 	})
 
-	common.RegisterExecutorProvider("docker-windows", executors.DefaultExecutorProvider{
-		Creator:          creator,
-		FeaturesUpdater:  featuresUpdater,
-		ConfigUpdater:    configUpdater,
-		DefaultShellName: options.Shell.Shell,
+	common.RegisterExecutorProvider("docker-windows", executorProvider{
+		DefaultExecutorProvider: executors.DefaultExecutorProvider{
+			Creator:          creator,
+			FeaturesUpdater:  featuresUpdater,
+			ConfigUpdater:    configUpdater,
+			DefaultShellName: options.Shell.Shell,
+		},
 	})
 }
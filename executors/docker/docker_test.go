@@ -236,6 +236,35 @@ func TestHelperImageWithVariable(t *testing.T) {
 	assert.Equal(t, "helper-image", img.ID)
 }
 
+func TestHelperImageWithImageVerification(t *testing.T) {
+	c := docker.NewMockClient(t)
+	p := pull.NewMockManager(t)
+
+	e := executorWithMockClient(c)
+	e.pullManager = p
+	e.helperImageInfo = helperimage.Info{
+		Architecture:            "x86_64",
+		Name:                    helperimage.GitLabRegistryName,
+		Tag:                     "x86_64-latest",
+		IsSupportingLocalImport: true,
+	}
+
+	e.Config = common.RunnerConfig{}
+	e.Config.Docker = &common.DockerConfig{
+		ImageVerification: &common.DockerImageVerificationConfig{Provider: "notation"},
+	}
+
+	// neither the image found on the host nor the bundled image is used
+	p.On("GetDockerImage", e.helperImageInfo.String(), []common.DockerPullPolicy(nil)).
+		Return(&types.ImageInspect{ID: "helper-image"}, nil).
+		Once()
+
+	img, err := e.getPrebuiltImage()
+	assert.NoError(t, err)
+	require.NotNil(t, img)
+	assert.Equal(t, "helper-image", img.ID)
+}
+
 func TestPrepareBuildsDir(t *testing.T) {
 	tests := map[string]struct {
 		parser                  parser.Parser
@@ -739,6 +768,9 @@ func TestCreateDependencies(t *testing.T) {
 					binds = append(binds, args.Get(1).(string))
 				}).
 				Once()
+			vm.On("CacheVolumes").
+				Return(nil).
+				Once()
 			vm.On("Binds").
 				Return(func() []string {
 					return binds
@@ -1259,7 +1291,7 @@ func TestDockerCreateNetwork(t *testing.T) {
 			createNetworkManager: true,
 			networkPerBuild:      "false",
 			networksManagerAssertions: func(nm *networks.MockManager) {
-				nm.On("Create", mock.Anything, mock.Anything, mock.Anything).
+				nm.On("Create", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
 					Return(container.NetworkMode("test"), nil).
 					Once()
 				nm.On("Inspect", mock.Anything).
@@ -1274,7 +1306,7 @@ func TestDockerCreateNetwork(t *testing.T) {
 			createNetworkManager: true,
 			networkPerBuild:      "true",
 			networksManagerAssertions: func(nm *networks.MockManager) {
-				nm.On("Create", mock.Anything, mock.Anything, mock.Anything).
+				nm.On("Create", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
 					Return(container.NetworkMode("test"), nil).
 					Once()
 				nm.On("Inspect", mock.Anything).
@@ -1289,7 +1321,7 @@ func TestDockerCreateNetwork(t *testing.T) {
 			createNetworkManager: true,
 			networkPerBuild:      "true",
 			networksManagerAssertions: func(nm *networks.MockManager) {
-				nm.On("Create", mock.Anything, mock.Anything, mock.Anything).
+				nm.On("Create", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
 					Return(container.NetworkMode("fail"), testErr).
 					Once()
 			},
@@ -1299,7 +1331,7 @@ func TestDockerCreateNetwork(t *testing.T) {
 			createNetworkManager: true,
 			networkPerBuild:      "true",
 			networksManagerAssertions: func(nm *networks.MockManager) {
-				nm.On("Create", mock.Anything, mock.Anything, mock.Anything).
+				nm.On("Create", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
 					Return(container.NetworkMode("test"), nil).
 					Once()
 				nm.On("Inspect", mock.Anything).
@@ -1320,7 +1352,7 @@ func TestDockerCreateNetwork(t *testing.T) {
 					Once()
 			},
 			networksManagerAssertions: func(nm *networks.MockManager) {
-				nm.On("Create", mock.Anything, mock.Anything, mock.Anything).
+				nm.On("Create", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
 					Return(container.NetworkMode("test"), nil).
 					Once()
 				nm.On("Inspect", mock.Anything).
@@ -1343,7 +1375,7 @@ func TestDockerCreateNetwork(t *testing.T) {
 			createNetworkManager: true,
 			networkPerBuild:      "true",
 			networksManagerAssertions: func(nm *networks.MockManager) {
-				nm.On("Create", mock.Anything, mock.Anything, mock.Anything).
+				nm.On("Create", mock.Anything, mock.Anything, mock.Anything, mock.Anything).
 					Return(container.NetworkMode("test"), nil).
 					Once()
 				nm.On("Inspect", mock.Anything).
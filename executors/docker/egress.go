@@ -0,0 +1,233 @@
+package docker
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/egress"
+)
+
+const (
+	egressProxyServiceName = "egress-proxy"
+	egressProxyPort        = 8080
+
+	labelEgressProxyType = "egress-proxy"
+
+	// egressProxyEgressNetwork is the network the egress proxy reaches the
+	// allowed destinations through, as the job's network is internal
+	egressProxyEgressNetwork = "bridge"
+)
+
+var (
+	errEgressPolicyRequiresNetworkPerBuild = errors.New(
+		"the egress policy requires a network per build: enable FF_NETWORK_PER_BUILD and don't set network_mode",
+	)
+	errEgressPolicyUnsupportedOS = errors.New("the egress policy is not supported on Windows")
+)
+
+func egressProxyURL() string {
+	return fmt.Sprintf("http://%s:%d", egressProxyServiceName, egressProxyPort)
+}
+
+func (e *executor) isEgressPolicyEnabled() bool {
+	return e.Config.Docker.EgressPolicy != nil
+}
+
+// createEgressProxy starts the proxy enforcing the egress policy configured
+// with [runners.docker.egress_policy]. The job's network is internal, so the
+// build and service containers can reach the outside only through the proxy,
+// which is also connected to the default bridge network.
+func (e *executor) createEgressProxy() error {
+	if !e.isEgressPolicyEnabled() {
+		return nil
+	}
+
+	if e.info.OSType == osTypeWindows {
+		return errEgressPolicyUnsupportedOS
+	}
+
+	e.Println("Restricting the job's egress to the destinations allowed by the egress policy...")
+
+	proxyImage, err := e.getPrebuiltImage()
+	if err != nil {
+		return fmt.Errorf("getPrebuiltImage: %w", err)
+	}
+
+	cmd, err := e.createEgressProxyCommand()
+	if err != nil {
+		return err
+	}
+
+	containerName := e.getProjectUniqRandomizedName() + "-" + egressProxyServiceName
+
+	// this will fail potentially some builds if there's name collision
+	_ = e.removeContainer(e.Context, containerName)
+
+	config := &container.Config{
+		Image:  proxyImage.ID,
+		Cmd:    cmd,
+		Labels: e.labeler.Labels(map[string]string{"type": labelEgressProxyType}),
+	}
+
+	hostConfig := &container.HostConfig{
+		DNS:           e.Config.Docker.DNS,
+		DNSSearch:     e.Config.Docker.DNSSearch,
+		RestartPolicy: neverRestartPolicy,
+		ExtraHosts:    e.Config.Docker.ExtraHosts,
+		NetworkMode:   e.networkMode,
+		LogConfig: container.LogConfig{
+			Type: "json-file",
+		},
+	}
+
+	e.Debugln("Creating egress proxy container", containerName, "...")
+	resp, err := e.client.ContainerCreate(
+		e.Context,
+		config,
+		hostConfig,
+		e.networkConfig([]string{egressProxyServiceName}),
+		containerName,
+	)
+	if err != nil {
+		return fmt.Errorf("creating egress proxy container: %w", err)
+	}
+	e.recordContainer(resp.ID)
+	e.temporary = append(e.temporary, resp.ID)
+
+	err = e.client.NetworkConnect(e.Context, egressProxyEgressNetwork, resp.ID, nil)
+	if err != nil {
+		return fmt.Errorf("connecting egress proxy container to %s network: %w", egressProxyEgressNetwork, err)
+	}
+
+	e.Debugln(fmt.Sprintf("Starting egress proxy container %s (%s)...", containerName, resp.ID))
+	err = e.client.ContainerStart(e.Context, resp.ID, types.ContainerStartOptions{})
+	if err != nil {
+		return fmt.Errorf("starting egress proxy container: %w", err)
+	}
+
+	sink := &egressViolationWriter{
+		report: func(destination string) {
+			e.Warningln(fmt.Sprintf("Connection to %s blocked by the egress policy", destination))
+		},
+	}
+
+	return e.captureContainerLogs(e.Context, resp.ID, containerName, time.Time{}, sink)
+}
+
+// createEgressProxyCommand returns the command of the egress proxy. Besides
+// the configured destinations, the job's network and the GitLab instance are
+// always allowed, for the services and the helper to keep working.
+func (e *executor) createEgressProxyCommand() ([]string, error) {
+	if e.networksManager == nil {
+		return nil, errNetworksManagerUndefined
+	}
+
+	buildNetwork, err := e.networksManager.Inspect(e.Context)
+	if err != nil {
+		return nil, fmt.Errorf("inspecting build network: %w", err)
+	}
+
+	cmd := []string{"gitlab-runner-helper", "egress-proxy", "--listen", fmt.Sprintf(":%d", egressProxyPort)}
+
+	for _, ipam := range buildNetwork.IPAM.Config {
+		if ipam.Subnet != "" {
+			cmd = append(cmd, "--allowed-cidr", ipam.Subnet)
+		}
+	}
+
+	for _, cidr := range e.Config.Docker.EgressPolicy.AllowedCIDRs {
+		cmd = append(cmd, "--allowed-cidr", cidr)
+	}
+
+	for _, host := range append(e.getGitLabHosts(), e.Config.Docker.EgressPolicy.AllowedHosts...) {
+		cmd = append(cmd, "--allowed-host", host)
+	}
+
+	return cmd, nil
+}
+
+func (e *executor) getGitLabHosts() []string {
+	var hosts []string
+	seen := make(map[string]bool)
+
+	urls := []string{e.Config.URL, e.Config.CloneURL, e.Build.GetAllVariables().Value("CI_SERVER_URL")}
+	for _, rawURL := range urls {
+		u, err := url.Parse(rawURL)
+		if err != nil || u.Hostname() == "" || seen[u.Hostname()] {
+			continue
+		}
+
+		seen[u.Hostname()] = true
+		hosts = append(hosts, u.Hostname())
+	}
+
+	return hosts
+}
+
+// getEgressProxyVariables returns the variables making the containers use the
+// egress proxy
+func (e *executor) getEgressProxyVariables() []string {
+	if !e.isEgressPolicyEnabled() {
+		return nil
+	}
+
+	proxy := egressProxyURL()
+	noProxy := "localhost,127.0.0.1"
+
+	return []string{
+		"HTTP_PROXY=" + proxy,
+		"HTTPS_PROXY=" + proxy,
+		"NO_PROXY=" + noProxy,
+		"http_proxy=" + proxy,
+		"https_proxy=" + proxy,
+		"no_proxy=" + noProxy,
+	}
+}
+
+// egressViolationWriter reports the destinations denied by the egress proxy,
+// read from the lines of its logs
+type egressViolationWriter struct {
+	buf    []byte
+	report func(destination string)
+}
+
+func (w *egressViolationWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+
+		w.reportLine(string(w.buf[:i]))
+		w.buf = w.buf[i+1:]
+	}
+
+	return len(p), nil
+}
+
+func (w *egressViolationWriter) Close() error {
+	if len(w.buf) > 0 {
+		w.reportLine(string(w.buf))
+		w.buf = nil
+	}
+
+	return nil
+}
+
+func (w *egressViolationWriter) reportLine(line string) {
+	_, destination, ok := strings.Cut(line, egress.DeniedMessage)
+	if !ok {
+		return
+	}
+
+	w.report(strings.TrimSpace(destination))
+}
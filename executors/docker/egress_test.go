@@ -0,0 +1,209 @@
+//go:build !integration
+
+package docker
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/docker/internal/labels"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/docker/internal/networks"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/docker/internal/pull"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/docker"
+)
+
+func newEgressTestExecutor(policy *common.DockerEgressPolicyConfig, networkMode string) *executor {
+	return &executor{
+		AbstractExecutor: executors.AbstractExecutor{
+			Build: &common.Build{
+				JobResponse: common.JobResponse{
+					Variables: common.JobVariables{
+						{Key: "CI_SERVER_URL", Value: "https://gitlab.example.com", Public: true},
+					},
+				},
+				Runner: &common.RunnerConfig{},
+			},
+			Config: common.RunnerConfig{
+				RunnerCredentials: common.RunnerCredentials{URL: "https://gitlab.example.com/"},
+				RunnerSettings: common.RunnerSettings{
+					CloneURL: "https://clone.example.com",
+					Docker: &common.DockerConfig{
+						NetworkMode:  networkMode,
+						EgressPolicy: policy,
+					},
+				},
+			},
+			Context: context.Background(),
+		},
+	}
+}
+
+func TestCreateEgressProxyCommand(t *testing.T) {
+	e := newEgressTestExecutor(&common.DockerEgressPolicyConfig{
+		AllowedCIDRs: []string{"10.0.0.0/8"},
+		AllowedHosts: []string{"*.example.org"},
+	}, "")
+
+	nm := networks.NewMockManager(t)
+	nm.On("Inspect", e.Context).
+		Return(types.NetworkResource{
+			IPAM: network.IPAM{Config: []network.IPAMConfig{{Subnet: "172.18.0.0/16"}}},
+		}, nil).
+		Once()
+	e.networksManager = nm
+
+	cmd, err := e.createEgressProxyCommand()
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"gitlab-runner-helper", "egress-proxy", "--listen", ":8080",
+		"--allowed-cidr", "172.18.0.0/16",
+		"--allowed-cidr", "10.0.0.0/8",
+		"--allowed-host", "gitlab.example.com",
+		"--allowed-host", "clone.example.com",
+		"--allowed-host", "*.example.org",
+	}, cmd)
+}
+
+func TestGetEgressProxyVariables(t *testing.T) {
+	e := newEgressTestExecutor(nil, "")
+	assert.Empty(t, e.getEgressProxyVariables())
+
+	e = newEgressTestExecutor(&common.DockerEgressPolicyConfig{}, "")
+	assert.Contains(t, e.getEgressProxyVariables(), "HTTPS_PROXY=http://egress-proxy:8080")
+	assert.Contains(t, e.getEgressProxyVariables(), "no_proxy=localhost,127.0.0.1")
+}
+
+func TestCreateBuildNetworkWithEgressPolicy(t *testing.T) {
+	tests := map[string]struct {
+		networkMode         string
+		createdNetworkMode  container.NetworkMode
+		expectedErr         error
+		expectedNetworkMode container.NetworkMode
+	}{
+		"network per build": {
+			createdNetworkMode:  "runner-job-network",
+			expectedNetworkMode: "runner-job-network",
+		},
+		"network per build disabled": {
+			createdNetworkMode: "",
+			expectedErr:        errEgressPolicyRequiresNetworkPerBuild,
+		},
+		"network mode configured": {
+			networkMode:        "host",
+			createdNetworkMode: "host",
+			expectedErr:        errEgressPolicyRequiresNetworkPerBuild,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			e := newEgressTestExecutor(&common.DockerEgressPolicyConfig{}, tt.networkMode)
+
+			nm := networks.NewMockManager(t)
+			nm.On("Create", e.Context, tt.networkMode, false, true).
+				Return(tt.createdNetworkMode, nil).
+				Once()
+			e.networksManager = nm
+
+			err := e.createBuildNetwork()
+			assert.ErrorIs(t, err, tt.expectedErr)
+			if tt.expectedErr == nil {
+				assert.Equal(t, tt.expectedNetworkMode, e.networkMode)
+			}
+		})
+	}
+}
+
+func TestEgressViolationWriter(t *testing.T) {
+	var reported []string
+	w := &egressViolationWriter{
+		report: func(destination string) { reported = append(reported, destination) },
+	}
+
+	_, err := w.Write([]byte("2023-06-01T12:00:00.000000000Z Egress proxy listening on :8080\n2023-06-01T12:00:01.0"))
+	require.NoError(t, err)
+	_, err = w.Write([]byte("00000000Z egress denied: example.net:443\n2023-06-01T12:00:02.000000000Z egress denied: 203.0.113.10:22"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"example.net:443"}, reported)
+
+	require.NoError(t, w.Close())
+	assert.Equal(t, []string{"example.net:443", "203.0.113.10:22"}, reported)
+}
+
+func TestGetSharedServiceConfigWithEgressPolicy(t *testing.T) {
+	e := newEgressTestExecutor(&common.DockerEgressPolicyConfig{}, "")
+	e.Config.Docker.SharedServices = &common.DockerSharedServicesConfig{
+		Services: []common.DockerSharedService{{Image: "postgres:*"}},
+	}
+
+	assert.Nil(t, e.getSharedServiceConfig("postgres:15"), "services aren't shared with an egress policy")
+}
+
+func TestCreateEgressProxy(t *testing.T) {
+	e := newEgressTestExecutor(&common.DockerEgressPolicyConfig{AllowedHosts: []string{"*.example.org"}}, "")
+	e.Config.Docker.HelperImage = "helper:latest"
+	e.networkMode = "runner-job-network"
+	e.labeler = labels.NewLabeler(e.Build)
+
+	nm := networks.NewMockManager(t)
+	nm.On("Inspect", e.Context).Return(types.NetworkResource{}, nil).Once()
+	e.networksManager = nm
+
+	pm := pull.NewMockManager(t)
+	pm.On("GetDockerImage", "helper:latest", []common.DockerPullPolicy(nil)).
+		Return(&types.ImageInspect{ID: "helper-id"}, nil).
+		Once()
+	e.pullManager = pm
+
+	c := docker.NewMockClient(t)
+	e.client = c
+
+	c.On("NetworkList", e.Context, mock.Anything).Return(nil, nil).Once()
+	c.On("ContainerRemove", e.Context, mock.Anything, mock.Anything).Return(nil).Once()
+	c.On(
+		"ContainerCreate",
+		e.Context,
+		mock.MatchedBy(func(config *container.Config) bool {
+			return assert.Equal(t, "helper-id", config.Image) &&
+				assert.Equal(t, "egress-proxy", config.Labels["com.gitlab.gitlab-runner.type"]) &&
+				assert.Contains(t, config.Cmd, "*.example.org")
+		}),
+		mock.MatchedBy(func(hostConfig *container.HostConfig) bool {
+			return hostConfig.NetworkMode == "runner-job-network"
+		}),
+		&network.NetworkingConfig{
+			EndpointsConfig: map[string]*network.EndpointSettings{
+				"runner-job-network": {Aliases: []string{"egress-proxy"}},
+			},
+		},
+		mock.Anything,
+	).
+		Return(container.CreateResponse{ID: "proxy-id"}, nil).
+		Once()
+	c.On("NetworkConnect", e.Context, "bridge", "proxy-id", (*network.EndpointSettings)(nil)).Return(nil).Once()
+	c.On("ContainerStart", e.Context, "proxy-id", types.ContainerStartOptions{}).Return(nil).Once()
+	c.On("ContainerLogs", e.Context, "proxy-id", mock.Anything).
+		Return(io.NopCloser(strings.NewReader("")), nil).
+		Once()
+
+	require.NoError(t, e.createEgressProxy())
+	assert.Equal(t, []string{"proxy-id"}, e.temporary)
+}
+
+func TestCreateEgressProxyDisabled(t *testing.T) {
+	e := newEgressTestExecutor(nil, "")
+
+	assert.NoError(t, e.createEgressProxy())
+	assert.Empty(t, e.temporary)
+}
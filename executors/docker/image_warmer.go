@@ -0,0 +1,468 @@
+package docker
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/docker/docker/api/types"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/docker"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/docker/auth"
+)
+
+var newImageWarmerDockerClient = func(config *common.DockerConfig) (docker.Client, error) {
+	return docker.New(config.Credentials)
+}
+
+// imageWarmers is shared by all the jobs handled by this process, so that the
+// images used by the jobs of a runner are known to the runner's image warmer.
+var imageWarmers = newImageWarmerRegistry()
+
+type imageWarmerKey struct {
+	runner string
+	image  string
+}
+
+type recentImage struct {
+	name     string
+	lastUsed time.Time
+	// internal images, like the helper image, are used by the runner itself
+	// and aren't checked against the allowed images
+	internal bool
+}
+
+type imageWarmer struct {
+	config common.RunnerConfig
+	cancel func()
+	done   chan struct{}
+}
+
+// imageWarmerRegistry runs an image warmer for every runner that has it
+// configured. The warmer pulls the configured images and the images most
+// recently used by the runner's jobs on a schedule, so that the jobs find
+// them up to date on the Docker host. The recently used images aren't
+// persisted, after a restart only the configured images are warmed until the
+// jobs use other images again.
+type imageWarmerRegistry struct {
+	lock       sync.Mutex
+	warmers    map[string]*imageWarmer
+	recent     map[string]map[string]recentImage
+	lastPulled map[imageWarmerKey]time.Time
+
+	now func() time.Time
+
+	lastPullDesc *prometheus.Desc
+	pulls        *prometheus.CounterVec
+}
+
+func newImageWarmerRegistry() *imageWarmerRegistry {
+	return &imageWarmerRegistry{
+		warmers:    make(map[string]*imageWarmer),
+		recent:     make(map[string]map[string]recentImage),
+		lastPulled: make(map[imageWarmerKey]time.Time),
+		now:        time.Now,
+		lastPullDesc: prometheus.NewDesc(
+			"gitlab_runner_docker_image_warmer_last_pull_timestamp_seconds",
+			"Unix timestamp of the last successful pull of the images kept warm on the Docker hosts",
+			[]string{"runner", "image"},
+			nil,
+		),
+		pulls: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "gitlab_runner_docker_image_warmer_pulls_total",
+				Help: "Total number of images pulled by the image warmers",
+			},
+			[]string{"runner", "status"},
+		),
+	}
+}
+
+// configure starts the image warmers of the runners that have it configured,
+// restarts the ones whose configuration changed and stops the others
+func (r *imageWarmerRegistry) configure(runners []*common.RunnerConfig) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	configured := make(map[string]bool)
+
+	for _, runner := range runners {
+		if !isImageWarmerConfigured(runner) {
+			continue
+		}
+
+		name := runner.ShortDescription()
+		logger := logrus.WithField("runner", name)
+
+		interval, err := runner.Docker.ImageWarmer.GetInterval()
+		if err != nil {
+			logger.WithError(err).Errorln("Invalid image warmer configuration")
+			continue
+		}
+
+		configured[name] = true
+
+		warmer, ok := r.warmers[name]
+		if ok && reflect.DeepEqual(warmer.config.Docker, runner.Docker) &&
+			reflect.DeepEqual(warmer.config.Environment, runner.Environment) {
+			continue
+		}
+
+		if ok {
+			warmer.cancel()
+		}
+
+		logger.WithField("interval", interval).Debugln("Starting image warmer")
+		r.warmers[name] = r.start(*runner, interval)
+	}
+
+	for name, warmer := range r.warmers {
+		if configured[name] {
+			continue
+		}
+
+		warmer.cancel()
+		delete(r.warmers, name)
+
+		for key := range r.lastPulled {
+			if key.runner == name {
+				delete(r.lastPulled, key)
+			}
+		}
+	}
+}
+
+func isImageWarmerConfigured(runner *common.RunnerConfig) bool {
+	if runner.Executor != "docker" && runner.Executor != "docker-windows" {
+		return false
+	}
+
+	return runner.Docker != nil && runner.Docker.ImageWarmer != nil
+}
+
+func (r *imageWarmerRegistry) start(config common.RunnerConfig, interval time.Duration) *imageWarmer {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	warmer := &imageWarmer{
+		config: config,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		defer close(warmer.done)
+
+		logger := logrus.WithFields(logrus.Fields{
+			"runner": config.ShortDescription(),
+			"host":   config.Docker.Host,
+		})
+
+		for {
+			r.warm(ctx, &warmer.config, logger)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+			}
+		}
+	}()
+
+	return warmer
+}
+
+// stop stops all the image warmers and waits for them to finish their pulls
+func (r *imageWarmerRegistry) stop(ctx context.Context) {
+	r.lock.Lock()
+	warmers := r.warmers
+	r.warmers = make(map[string]*imageWarmer)
+	r.lock.Unlock()
+
+	for _, warmer := range warmers {
+		warmer.cancel()
+	}
+
+	for _, warmer := range warmers {
+		select {
+		case <-warmer.done:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// warm pulls the images of the runner, the failures are logged and the
+// images are pulled again on the next run
+func (r *imageWarmerRegistry) warm(ctx context.Context, config *common.RunnerConfig, logger logrus.FieldLogger) {
+	runner := config.ShortDescription()
+
+	images := r.images(config, logger)
+	r.forgetPulled(runner, images)
+
+	if len(images) == 0 {
+		return
+	}
+
+	client, err := newImageWarmerDockerClient(config.Docker)
+	if err != nil {
+		logger.WithError(err).Warningln("Failed to connect to Docker to warm images")
+		return
+	}
+	defer client.Close()
+
+	dockerAuthConfig := config.GetVariables().Value("DOCKER_AUTH_CONFIG")
+
+	for _, image := range images {
+		err := pullWarmImage(ctx, client, image, dockerAuthConfig)
+		if ctx.Err() != nil {
+			return
+		}
+
+		imageLogger := logger.WithField("image", image)
+		if err != nil {
+			r.pulls.WithLabelValues(runner, "failure").Inc()
+			imageLogger.WithError(err).Warningln("Failed to warm image")
+			continue
+		}
+
+		r.pulled(runner, image)
+		imageLogger.Debugln("Warmed image")
+	}
+}
+
+func pullWarmImage(ctx context.Context, client docker.Client, image string, dockerAuthConfig string) error {
+	registryInfo, err := auth.ResolveConfigForImage(image, dockerAuthConfig, "", nil)
+	if err != nil {
+		return fmt.Errorf("resolving credentials: %w", err)
+	}
+
+	options := types.ImagePullOptions{}
+	if registryInfo != nil {
+		options.RegistryAuth, _ = auth.EncodeConfig(&registryInfo.AuthConfig)
+	}
+
+	ref := image
+	// Add :latest to limit the download results
+	if !strings.ContainsAny(ref, ":@") {
+		ref += ":latest"
+	}
+
+	return client.ImagePullBlocking(ctx, ref, options)
+}
+
+// images returns the configured images followed by the images most recently
+// used by the runner's jobs. The images that aren't allowed by the runner's
+// configuration are skipped.
+func (r *imageWarmerRegistry) images(config *common.RunnerConfig, logger logrus.FieldLogger) []string {
+	warmerConfig := config.Docker.ImageWarmer
+
+	var images []string
+	seen := make(map[string]bool)
+	add := func(image string, internal bool) {
+		if image == "" || seen[image] {
+			return
+		}
+		seen[image] = true
+
+		if !internal && !isImageAllowedForWarming(config.Docker, image) {
+			logger.WithField("image", image).Warningln("Image isn't allowed by the runner's configuration, skipping warming")
+			return
+		}
+
+		images = append(images, image)
+	}
+
+	for _, image := range warmerConfig.Images {
+		add(image, false)
+	}
+
+	for _, image := range r.recentImages(config.ShortDescription(), warmerConfig.RecentImages) {
+		add(image.name, image.internal)
+	}
+
+	return images
+}
+
+// isImageAllowedForWarming checks the image against the allowed_images and
+// allowed_services of the runner. The images configured for the runner are
+// always allowed, as they're when used by the jobs.
+func isImageAllowedForWarming(config *common.DockerConfig, image string) bool {
+	if len(config.AllowedImages) == 0 && len(config.AllowedServices) == 0 {
+		return true
+	}
+
+	if image == config.Image || image == config.HelperImage {
+		return true
+	}
+
+	for _, service := range config.Services {
+		if image == service.Name {
+			return true
+		}
+	}
+
+	for _, patterns := range [][]string{config.AllowedImages, config.AllowedServices} {
+		for _, pattern := range patterns {
+			if ok, _ := doublestar.Match(pattern, image); ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// recordUsage records the images used by a job of the runner. Only the limit
+// most recently used images are kept.
+func (r *imageWarmerRegistry) recordUsage(runner string, images []string, helperImage string, limit int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	recent := r.recent[runner]
+	if recent == nil {
+		recent = make(map[string]recentImage)
+		r.recent[runner] = recent
+	}
+
+	now := r.now()
+	for _, image := range images {
+		recent[image] = recentImage{
+			name:     image,
+			lastUsed: now,
+			internal: image == helperImage,
+		}
+	}
+
+	sorted := sortRecentImages(recent)
+	for i := limit; i < len(sorted); i++ {
+		delete(recent, sorted[i].name)
+	}
+}
+
+func (r *imageWarmerRegistry) recentImages(runner string, limit int) []recentImage {
+	if limit <= 0 {
+		return nil
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	sorted := sortRecentImages(r.recent[runner])
+	if len(sorted) > limit {
+		sorted = sorted[:limit]
+	}
+
+	return sorted
+}
+
+// sortRecentImages returns the images, most recently used first
+func sortRecentImages(images map[string]recentImage) []recentImage {
+	sorted := make([]recentImage, 0, len(images))
+	for _, image := range images {
+		sorted = append(sorted, image)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].lastUsed.Equal(sorted[j].lastUsed) {
+			return sorted[i].name < sorted[j].name
+		}
+		return sorted[i].lastUsed.After(sorted[j].lastUsed)
+	})
+
+	return sorted
+}
+
+func (r *imageWarmerRegistry) pulled(runner string, image string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.lastPulled[imageWarmerKey{runner: runner, image: image}] = r.now()
+	r.pulls.WithLabelValues(runner, "success").Inc()
+}
+
+// forgetPulled forgets the last pull of the runner's images that aren't warmed
+// anymore, so that they're not reported
+func (r *imageWarmerRegistry) forgetPulled(runner string, images []string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	warmed := make(map[string]bool)
+	for _, image := range images {
+		warmed[image] = true
+	}
+
+	for key := range r.lastPulled {
+		if key.runner == runner && !warmed[key.image] {
+			delete(r.lastPulled, key)
+		}
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (r *imageWarmerRegistry) Describe(ch chan<- *prometheus.Desc) {
+	ch <- r.lastPullDesc
+	r.pulls.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (r *imageWarmerRegistry) Collect(ch chan<- prometheus.Metric) {
+	r.lock.Lock()
+	lastPulled := make(map[imageWarmerKey]time.Time, len(r.lastPulled))
+	for key, pulled := range r.lastPulled {
+		lastPulled[key] = pulled
+	}
+	r.lock.Unlock()
+
+	for key, pulled := range lastPulled {
+		ch <- prometheus.MustNewConstMetric(
+			r.lastPullDesc,
+			prometheus.GaugeValue,
+			float64(pulled.Unix()),
+			key.runner,
+			key.image,
+		)
+	}
+
+	r.pulls.Collect(ch)
+}
+
+// Init implements common.ManagedExecutorProvider.
+func (p executorProvider) Init() {}
+
+// Configure implements common.ConfigurableExecutorProvider.
+func (p executorProvider) Configure(runners []*common.RunnerConfig) {
+	if p.imageWarmers != nil {
+		p.imageWarmers.configure(runners)
+	}
+}
+
+// Shutdown implements common.ManagedExecutorProvider.
+func (p executorProvider) Shutdown(ctx context.Context) {
+	if p.imageWarmers != nil {
+		p.imageWarmers.stop(ctx)
+	}
+}
+
+// recordUsedImages records the images used by the job, so that the most
+// recently used ones are kept up to date by the runner's image warmer
+func (e *executor) recordUsedImages() {
+	warmerConfig := e.Config.Docker.ImageWarmer
+	if warmerConfig == nil || warmerConfig.RecentImages <= 0 || e.pullManager == nil {
+		return
+	}
+
+	imageWarmers.recordUsage(
+		e.Config.ShortDescription(),
+		e.pullManager.UsedImages(),
+		e.helperImageInfo.String(),
+		warmerConfig.RecentImages,
+	)
+}
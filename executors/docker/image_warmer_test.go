@@ -0,0 +1,157 @@
+//go:build !integration
+
+package docker
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/docker"
+)
+
+func newImageWarmerTestConfig(warmerConfig *common.DockerImageWarmerConfig) *common.RunnerConfig {
+	return &common.RunnerConfig{
+		RunnerCredentials: common.RunnerCredentials{Token: "runner-token"},
+		RunnerSettings: common.RunnerSettings{
+			Executor: "docker",
+			Docker: &common.DockerConfig{
+				Image:         "ruby:3.2",
+				AllowedImages: []string{"alpine:*"},
+				ImageWarmer:   warmerConfig,
+			},
+		},
+	}
+}
+
+func TestImageWarmerRegistryRecordUsage(t *testing.T) {
+	r := newImageWarmerRegistry()
+	now := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	r.now = func() time.Time { return now }
+
+	r.recordUsage("runner", []string{"alpine:3.18", "helper:latest"}, "helper:latest", 2)
+
+	now = now.Add(time.Minute)
+	r.recordUsage("runner", []string{"postgres:15"}, "helper:latest", 2)
+
+	assert.Equal(t, []recentImage{
+		{name: "postgres:15", lastUsed: now},
+		{name: "alpine:3.18", lastUsed: now.Add(-time.Minute)},
+	}, r.recentImages("runner", 2))
+	assert.Len(t, r.recent["runner"], 2, "only the most recently used images are kept")
+
+	assert.Len(t, r.recentImages("runner", 1), 1)
+	assert.Empty(t, r.recentImages("runner", 0))
+	assert.Empty(t, r.recentImages("other-runner", 2))
+}
+
+func TestImageWarmerRegistryWarm(t *testing.T) {
+	defer func(f func(*common.DockerConfig) (docker.Client, error)) { newImageWarmerDockerClient = f }(newImageWarmerDockerClient)
+
+	c := docker.NewMockClient(t)
+	newImageWarmerDockerClient = func(*common.DockerConfig) (docker.Client, error) { return c, nil }
+
+	config := newImageWarmerTestConfig(&common.DockerImageWarmerConfig{
+		Images:       []string{"alpine:3.18", "ruby:3.2", "not-allowed:latest"},
+		RecentImages: 3,
+	})
+	runner := config.ShortDescription()
+
+	r := newImageWarmerRegistry()
+	r.recordUsage(runner, []string{"helper", "alpine:3.18", "untrusted:latest"}, "helper", 3)
+	r.lastPulled[imageWarmerKey{runner: runner, image: "not-warmed-anymore"}] = time.Now()
+
+	c.On("ImagePullBlocking", mock.Anything, "alpine:3.18", mock.AnythingOfType("types.ImagePullOptions")).Return(nil).Once()
+	c.On("ImagePullBlocking", mock.Anything, "ruby:3.2", mock.AnythingOfType("types.ImagePullOptions")).Return(nil).Once()
+	c.On("ImagePullBlocking", mock.Anything, "helper:latest", mock.AnythingOfType("types.ImagePullOptions")).Return(assert.AnError).Once()
+	c.On("Close").Return(nil).Once()
+
+	r.warm(context.Background(), config, logrus.StandardLogger())
+
+	assert.Len(t, r.lastPulled, 2)
+	assert.Contains(t, r.lastPulled, imageWarmerKey{runner: runner, image: "alpine:3.18"})
+	assert.Contains(t, r.lastPulled, imageWarmerKey{runner: runner, image: "ruby:3.2"})
+	assert.Equal(t, float64(2), testutil.ToFloat64(r.pulls.WithLabelValues(runner, "success")))
+	assert.Equal(t, float64(1), testutil.ToFloat64(r.pulls.WithLabelValues(runner, "failure")))
+	assert.Equal(t, 2, testutil.CollectAndCount(r, "gitlab_runner_docker_image_warmer_last_pull_timestamp_seconds"))
+}
+
+func TestImageWarmerRegistryConfigure(t *testing.T) {
+	defer func(f func(*common.DockerConfig) (docker.Client, error)) { newImageWarmerDockerClient = f }(newImageWarmerDockerClient)
+
+	warmed := make(chan string, 10)
+	newImageWarmerDockerClient = func(config *common.DockerConfig) (docker.Client, error) {
+		warmed <- config.ImageWarmer.Images[0]
+		return nil, assert.AnError
+	}
+
+	config := newImageWarmerTestConfig(&common.DockerImageWarmerConfig{Images: []string{"alpine:3.18"}})
+	shellConfig := &common.RunnerConfig{RunnerSettings: common.RunnerSettings{Executor: "shell"}}
+	invalidConfig := newImageWarmerTestConfig(&common.DockerImageWarmerConfig{Interval: "invalid"})
+	invalidConfig.Token = "invalid-token"
+
+	r := newImageWarmerRegistry()
+	r.configure([]*common.RunnerConfig{config, shellConfig, invalidConfig})
+	require.Len(t, r.warmers, 1)
+
+	select {
+	case image := <-warmed:
+		assert.Equal(t, "alpine:3.18", image)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "images weren't warmed when the warmer started")
+	}
+
+	warmer := r.warmers[config.ShortDescription()]
+	r.configure([]*common.RunnerConfig{config})
+	assert.Same(t, warmer, r.warmers[config.ShortDescription()], "the warmer isn't restarted when its configuration didn't change")
+
+	r.configure(nil)
+	assert.Empty(t, r.warmers)
+
+	select {
+	case <-warmer.done:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "the warmer wasn't stopped")
+	}
+
+	r.configure([]*common.RunnerConfig{config})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	r.stop(ctx)
+	assert.NoError(t, ctx.Err())
+	assert.Empty(t, r.warmers)
+}
+
+func TestIsImageAllowedForWarming(t *testing.T) {
+	config := &common.DockerConfig{
+		Image:           "ruby:3.2",
+		HelperImage:     "custom-helper:latest",
+		Services:        []common.Service{{Name: "postgres:15"}},
+		AllowedImages:   []string{"alpine:*"},
+		AllowedServices: []string{"redis:*"},
+	}
+
+	tests := map[string]bool{
+		"alpine:3.18":          true,
+		"redis:7":              true,
+		"ruby:3.2":             true,
+		"custom-helper:latest": true,
+		"postgres:15":          true,
+		"ubuntu:22.04":         false,
+	}
+
+	for image, expected := range tests {
+		t.Run(image, func(t *testing.T) {
+			assert.Equal(t, expected, isImageAllowedForWarming(config, image))
+		})
+	}
+
+	assert.True(t, isImageAllowedForWarming(&common.DockerConfig{}, "ubuntu:22.04"), "all images are allowed without allowed images")
+}
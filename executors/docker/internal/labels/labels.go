@@ -14,6 +14,11 @@ type Labeler interface {
 	Labels(otherLabels map[string]string) map[string]string
 }
 
+// Key returns the name of the label, as applied by the Labeler to docker entities.
+func Key(name string) string {
+	return fmt.Sprintf("%s.%s", dockerLabelPrefix, name)
+}
+
 // NewLabeler returns a new instance of a Labeler bound to this build.
 func NewLabeler(b *common.Build) Labeler {
 	return &labeler{
@@ -42,7 +47,7 @@ func (l *labeler) Labels(otherLabels map[string]string) map[string]string {
 	}
 
 	for k, v := range otherLabels {
-		labels[fmt.Sprintf("%s.%s", dockerLabelPrefix, k)] = v
+		labels[Key(k)] = v
 	}
 
 	return labels
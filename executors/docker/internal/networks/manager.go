@@ -18,7 +18,9 @@ var errBuildNetworkExists = errors.New("build network is not empty")
 
 //go:generate mockery --name=Manager --inpackage
 type Manager interface {
-	Create(ctx context.Context, networkMode string, enableIPv6 bool) (container.NetworkMode, error)
+	// Create creates the per-build network when it's enabled. An internal
+	// network has no external connectivity.
+	Create(ctx context.Context, networkMode string, enableIPv6 bool, internal bool) (container.NetworkMode, error)
 	Inspect(ctx context.Context) (types.NetworkResource, error)
 	Cleanup(ctx context.Context) error
 }
@@ -43,7 +45,12 @@ func NewManager(logger debugLogger, dockerClient docker.Client, build *common.Bu
 	}
 }
 
-func (m *manager) Create(ctx context.Context, networkMode string, enableIPv6 bool) (container.NetworkMode, error) {
+func (m *manager) Create(
+	ctx context.Context,
+	networkMode string,
+	enableIPv6 bool,
+	internal bool,
+) (container.NetworkMode, error) {
 	m.networkMode = container.NetworkMode(networkMode)
 	m.perBuild = false
 
@@ -69,6 +76,7 @@ func (m *manager) Create(ctx context.Context, networkMode string, enableIPv6 boo
 		types.NetworkCreate{
 			Labels:     m.labeler.Labels(map[string]string{}),
 			EnableIPv6: enableIPv6,
+			Internal:   internal,
 		},
 	)
 	if err != nil {
@@ -66,6 +66,7 @@ func TestCreateNetwork(t *testing.T) {
 		networkPerBuild     string
 		buildNetwork        types.NetworkResource
 		enableIPv6          bool
+		internal            bool
 		expectedNetworkMode container.NetworkMode
 		expectedErr         error
 		clientAssertions    func(*docker.MockClient)
@@ -153,6 +154,31 @@ func TestCreateNetwork(t *testing.T) {
 			expectedNetworkMode: "",
 			expectedErr:         errBuildNetworkExists,
 		},
+		"internal network created": {
+			networkMode:         "",
+			networkPerBuild:     "true",
+			expectedNetworkMode: container.NetworkMode("runner-test-tok-project-0-concurrent-0-job-0-network"),
+			internal:            true,
+			clientAssertions: func(mc *docker.MockClient) {
+				mc.On(
+					"NetworkCreate",
+					mock.Anything,
+					mock.AnythingOfType("string"),
+					mock.MatchedBy(func(options types.NetworkCreate) bool {
+						return options.Internal
+					}),
+				).
+					Return(types.NetworkCreateResponse{ID: "test-network"}, nil).
+					Once()
+				mc.On("NetworkInspect", mock.Anything, mock.AnythingOfType("string")).
+					Return(types.NetworkResource{
+						ID:       "test-network",
+						Name:     "test-network",
+						Internal: true,
+					}, nil).
+					Once()
+			},
+		},
 		"IPv6 network created": {
 			networkMode:         "",
 			networkPerBuild:     "true",
@@ -196,7 +222,7 @@ func TestCreateNetwork(t *testing.T) {
 				testCase.clientAssertions(client)
 			}
 
-			networkMode, err := m.Create(context.Background(), testCase.networkMode, testCase.enableIPv6)
+			networkMode, err := m.Create(context.Background(), testCase.networkMode, testCase.enableIPv6, testCase.internal)
 
 			assert.Equal(t, testCase.expectedNetworkMode, networkMode)
 			assert.Equal(t, testCase.expectedErr, err)
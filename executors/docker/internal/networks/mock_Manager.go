@@ -31,23 +31,23 @@ func (_m *MockManager) Cleanup(ctx context.Context) error {
 	return r0
 }
 
-// Create provides a mock function with given fields: ctx, networkMode, enableIPv6
-func (_m *MockManager) Create(ctx context.Context, networkMode string, enableIPv6 bool) (container.NetworkMode, error) {
-	ret := _m.Called(ctx, networkMode, enableIPv6)
+// Create provides a mock function with given fields: ctx, networkMode, enableIPv6, internal
+func (_m *MockManager) Create(ctx context.Context, networkMode string, enableIPv6 bool, internal bool) (container.NetworkMode, error) {
+	ret := _m.Called(ctx, networkMode, enableIPv6, internal)
 
 	var r0 container.NetworkMode
 	var r1 error
-	if rf, ok := ret.Get(0).(func(context.Context, string, bool) (container.NetworkMode, error)); ok {
-		return rf(ctx, networkMode, enableIPv6)
+	if rf, ok := ret.Get(0).(func(context.Context, string, bool, bool) (container.NetworkMode, error)); ok {
+		return rf(ctx, networkMode, enableIPv6, internal)
 	}
-	if rf, ok := ret.Get(0).(func(context.Context, string, bool) container.NetworkMode); ok {
-		r0 = rf(ctx, networkMode, enableIPv6)
+	if rf, ok := ret.Get(0).(func(context.Context, string, bool, bool) container.NetworkMode); ok {
+		r0 = rf(ctx, networkMode, enableIPv6, internal)
 	} else {
 		r0 = ret.Get(0).(container.NetworkMode)
 	}
 
-	if rf, ok := ret.Get(1).(func(context.Context, string, bool) error); ok {
-		r1 = rf(ctx, networkMode, enableIPv6)
+	if rf, ok := ret.Get(1).(func(context.Context, string, bool, bool) error); ok {
+		r1 = rf(ctx, networkMode, enableIPv6, internal)
 	} else {
 		r1 = ret.Error(1)
 	}
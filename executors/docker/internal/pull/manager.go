@@ -3,6 +3,7 @@ package pull
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 
@@ -17,6 +18,9 @@ import (
 //go:generate mockery --name=Manager --inpackage
 type Manager interface {
 	GetDockerImage(imageName string, imagePullPolicies []common.DockerPullPolicy) (*types.ImageInspect, error)
+	// UsedImages returns the names of the images used so far, excluding the
+	// images referenced by their ID
+	UsedImages() []string
 }
 
 type ManagerConfig struct {
@@ -24,6 +28,8 @@ type ManagerConfig struct {
 	AuthConfig   string
 	ShellUser    string
 	Credentials  []common.Credentials
+	// Verifier, when set, verifies the signature of every image before it's used
+	Verifier Verifier
 }
 
 //go:generate mockery --name=pullLogger --inpackage
@@ -38,6 +44,9 @@ type manager struct {
 	usedImages     map[string]string
 	usedImagesLock sync.Mutex
 
+	verifiedImages     map[string]string
+	verifiedImagesLock sync.Mutex
+
 	context             context.Context
 	config              ManagerConfig
 	client              docker.Client
@@ -94,6 +103,10 @@ func (m *manager) GetDockerImage(
 			continue
 		}
 
+		if err := m.verifyImage(imageName, img); err != nil {
+			return nil, &common.BuildError{Inner: err, FailureReason: common.ImagePullFailure}
+		}
+
 		m.markImageAsUsed(imageName, img)
 
 		return img, nil
@@ -134,6 +147,21 @@ func (m *manager) wasImageUsed(imageName, imageID string) bool {
 	return m.usedImages[imageName] == imageID
 }
 
+func (m *manager) UsedImages() []string {
+	m.usedImagesLock.Lock()
+	defer m.usedImagesLock.Unlock()
+
+	var images []string
+	for imageName, imageID := range m.usedImages {
+		if imageName != imageID {
+			images = append(images, imageName)
+		}
+	}
+	sort.Strings(images)
+
+	return images
+}
+
 func (m *manager) markImageAsUsed(imageName string, image *types.ImageInspect) {
 	m.usedImagesLock.Lock()
 	defer m.usedImagesLock.Unlock()
@@ -154,6 +182,45 @@ func (m *manager) markImageAsUsed(imageName string, image *types.ImageInspect) {
 	}
 }
 
+// verifyImage verifies the signature of the image against the digest it was
+// pulled with. The containers are created from the image ID, so they run
+// exactly the verified image.
+func (m *manager) verifyImage(imageName string, image *types.ImageInspect) error {
+	if m.config.Verifier == nil {
+		return nil
+	}
+
+	m.verifiedImagesLock.Lock()
+	defer m.verifiedImagesLock.Unlock()
+
+	if m.verifiedImages[imageName] == image.ID {
+		return nil
+	}
+
+	ref, err := resolveDigestReference(imageName, image)
+	if err != nil {
+		return err
+	}
+
+	authConfig, err := m.resolveAuthConfigForImage(imageName)
+	if err != nil {
+		return err
+	}
+
+	m.logger.Println("Verifying signature of image", ref, "...")
+	if err := m.config.Verifier.Verify(m.context, ref, authConfig); err != nil {
+		return err
+	}
+	m.logger.Println("Verified signature of image", ref)
+
+	if m.verifiedImages == nil {
+		m.verifiedImages = make(map[string]string)
+	}
+	m.verifiedImages[imageName] = image.ID
+
+	return nil
+}
+
 func (m *manager) getImageUsingPullPolicy(
 	imageName string,
 	pullPolicy common.DockerPullPolicy,
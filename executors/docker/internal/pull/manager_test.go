@@ -238,6 +238,7 @@ func TestDockerGetImageById(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NotNil(t, image)
 	assert.Equal(t, "ID", image.ID)
+	assert.Empty(t, m.UsedImages())
 }
 
 func TestDockerUnknownPolicyMode(t *testing.T) {
@@ -290,6 +291,7 @@ func TestDockerPolicyModeIfNotPresentForExistingImage(t *testing.T) {
 	image, err := m.GetDockerImage("existing", nil)
 	assert.NoError(t, err)
 	assert.NotNil(t, image)
+	assert.Equal(t, []string{"existing"}, m.UsedImages())
 }
 
 func TestDockerPolicyModeIfNotPresentForNotExistingImage(t *testing.T) {
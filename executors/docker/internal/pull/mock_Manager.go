@@ -40,6 +40,22 @@ func (_m *MockManager) GetDockerImage(imageName string, imagePullPolicies []comm
 	return r0, r1
 }
 
+// UsedImages provides a mock function with given fields:
+func (_m *MockManager) UsedImages() []string {
+	ret := _m.Called()
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func() []string); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	return r0
+}
+
 type mockConstructorTestingTNewMockManager interface {
 	mock.TestingT
 	Cleanup(func())
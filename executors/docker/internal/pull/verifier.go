@@ -0,0 +1,182 @@
+package pull
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/docker/cli/cli/config/configfile"
+	cli "github.com/docker/cli/cli/config/types"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/api/types"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+var (
+	errMissingPublicKey = errors.New("public key is required to verify cosign signatures")
+	errNoRepoDigest     = errors.New("image has no repository digest, its signature can't be verified")
+)
+
+// dockerHubAuthKey is the key of the Docker Hub credentials in the Docker
+// client configuration
+const dockerHubAuthKey = "https://index.docker.io/v1/"
+
+//go:generate mockery --name=Verifier --inpackage
+type Verifier interface {
+	// Verify verifies the signature of the image ref, pinned to its digest.
+	// The signature is fetched with authConfig, when the registry requires
+	// credentials.
+	Verify(ctx context.Context, ref string, authConfig *cli.AuthConfig) error
+}
+
+type verificationError struct {
+	ref    string
+	err    error
+	output string
+}
+
+func (e *verificationError) Error() string {
+	msg := fmt.Sprintf("verifying signature of image %q: %v", e.ref, e.err)
+	if e.output != "" {
+		msg += ": " + e.output
+	}
+
+	return msg
+}
+
+func (e *verificationError) Unwrap() error {
+	return e.err
+}
+
+type commandRunner func(ctx context.Context, env []string, name string, args ...string) ([]byte, error)
+
+func runCommand(ctx context.Context, env []string, name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = append(os.Environ(), env...)
+
+	return cmd.CombinedOutput()
+}
+
+// commandVerifier verifies signatures with the cosign or notation CLI,
+// installed on the runner's host. notation uses the trust store and trust
+// policy configured on the host. Both read the registry credentials from the
+// Docker client configuration, so the credentials of the image are passed in
+// a configuration written for the command.
+type commandVerifier struct {
+	command []string
+	run     commandRunner
+}
+
+func NewVerifier(config *common.DockerImageVerificationConfig) (Verifier, error) {
+	switch config.GetProvider() {
+	case common.DockerImageVerificationProviderCosign:
+		if config.PublicKey == "" {
+			return nil, errMissingPublicKey
+		}
+
+		return &commandVerifier{
+			command: []string{"cosign", "verify", "--key", config.PublicKey},
+			run:     runCommand,
+		}, nil
+	case common.DockerImageVerificationProviderNotation:
+		return &commandVerifier{
+			command: []string{"notation", "verify"},
+			run:     runCommand,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported image verification provider %q", config.Provider)
+	}
+}
+
+func (v *commandVerifier) Verify(ctx context.Context, ref string, authConfig *cli.AuthConfig) error {
+	args := append(append([]string{}, v.command[1:]...), ref)
+
+	var env []string
+	if authConfig != nil {
+		dir, err := writeRegistryConfig(ref, authConfig)
+		if err != nil {
+			return &verificationError{ref: ref, err: err}
+		}
+		defer func() { _ = os.RemoveAll(dir) }()
+
+		env = append(env, "DOCKER_CONFIG="+dir)
+	}
+
+	output, err := v.run(ctx, env, v.command[0], args...)
+	if err != nil {
+		return &verificationError{ref: ref, err: err, output: string(bytes.TrimSpace(output))}
+	}
+
+	return nil
+}
+
+// writeRegistryConfig writes the credentials of the registry of ref to the
+// Docker client configuration of a new directory, which is only readable by
+// the runner's user
+func writeRegistryConfig(ref string, authConfig *cli.AuthConfig) (string, error) {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return "", fmt.Errorf("parsing image name %q: %w", ref, err)
+	}
+
+	registry := reference.Domain(named)
+	if registry == "docker.io" {
+		registry = dockerHubAuthKey
+	}
+
+	dir, err := os.MkdirTemp("", "image-verification")
+	if err != nil {
+		return "", fmt.Errorf("creating registry credentials directory: %w", err)
+	}
+
+	config := configfile.New(filepath.Join(dir, "config.json"))
+	config.AuthConfigs[registry] = *authConfig
+
+	file, err := os.OpenFile(config.Filename, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0o600)
+	if err == nil {
+		err = config.SaveToWriter(file)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return "", fmt.Errorf("writing registry credentials: %w", err)
+	}
+
+	return dir, nil
+}
+
+// resolveDigestReference returns the reference of the image, pinned to the
+// digest it was pulled with from the repository named by imageName
+func resolveDigestReference(imageName string, image *types.ImageInspect) (string, error) {
+	named, err := reference.ParseNormalizedNamed(imageName)
+	if err != nil {
+		return "", fmt.Errorf("parsing image name %q: %w", imageName, err)
+	}
+
+	for _, repoDigest := range image.RepoDigests {
+		digested, err := reference.ParseNormalizedNamed(repoDigest)
+		if err != nil {
+			continue
+		}
+
+		canonical, ok := digested.(reference.Canonical)
+		if !ok || canonical.Name() != named.Name() {
+			continue
+		}
+
+		if pinned, ok := named.(reference.Digested); ok && pinned.Digest() != canonical.Digest() {
+			continue
+		}
+
+		return canonical.String(), nil
+	}
+
+	return "", fmt.Errorf("%s: %w", imageName, errNoRepoDigest)
+}
@@ -0,0 +1,267 @@
+//go:build !integration
+
+package pull
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	cli "github.com/docker/cli/cli/config/types"
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/docker"
+)
+
+const testDigest = "sha256:b5bb9d8014a0f9b1d61e21e796d78dccdf1352f23cd32812f4850b878ae4944c"
+
+type discardPullLogger struct{}
+
+func (discardPullLogger) Debugln(args ...interface{})   {}
+func (discardPullLogger) Infoln(args ...interface{})    {}
+func (discardPullLogger) Warningln(args ...interface{}) {}
+func (discardPullLogger) Println(args ...interface{})   {}
+
+func TestNewVerifier(t *testing.T) {
+	tests := map[string]struct {
+		config          *common.DockerImageVerificationConfig
+		expectedCommand []string
+		expectedErr     string
+	}{
+		"cosign by default": {
+			config:          &common.DockerImageVerificationConfig{PublicKey: "/etc/cosign.pub"},
+			expectedCommand: []string{"cosign", "verify", "--key", "/etc/cosign.pub"},
+		},
+		"cosign without public key": {
+			config:      &common.DockerImageVerificationConfig{Provider: "cosign"},
+			expectedErr: errMissingPublicKey.Error(),
+		},
+		"notation": {
+			config:          &common.DockerImageVerificationConfig{Provider: "notation"},
+			expectedCommand: []string{"notation", "verify"},
+		},
+		"unsupported provider": {
+			config:      &common.DockerImageVerificationConfig{Provider: "gpg"},
+			expectedErr: `unsupported image verification provider "gpg"`,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			v, err := NewVerifier(tt.config)
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			require.IsType(t, &commandVerifier{}, v)
+			assert.Equal(t, tt.expectedCommand, v.(*commandVerifier).command)
+		})
+	}
+}
+
+func TestCommandVerifierVerify(t *testing.T) {
+	ref := "docker.io/library/alpine@" + testDigest
+
+	var executed []string
+	v := &commandVerifier{
+		command: []string{"cosign", "verify", "--key", "cosign.pub"},
+		run: func(ctx context.Context, env []string, name string, args ...string) ([]byte, error) {
+			executed = append([]string{name}, args...)
+			assert.Empty(t, env)
+			return []byte("no matching signatures\n"), errors.New("exit status 1")
+		},
+	}
+
+	err := v.Verify(context.Background(), ref, nil)
+
+	assert.Equal(t, []string{"cosign", "verify", "--key", "cosign.pub", ref}, executed)
+	assert.EqualError(
+		t,
+		err,
+		`verifying signature of image "docker.io/library/alpine@`+testDigest+`": exit status 1: no matching signatures`,
+	)
+}
+
+func TestCommandVerifierVerifyWithCredentials(t *testing.T) {
+	tests := map[string]struct {
+		ref         string
+		expectedKey string
+	}{
+		"private registry": {
+			ref:         "registry.example.com/group/image@" + testDigest,
+			expectedKey: "registry.example.com",
+		},
+		"docker hub": {
+			ref:         "docker.io/library/alpine@" + testDigest,
+			expectedKey: dockerHubAuthKey,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			var configDir string
+			v := &commandVerifier{
+				command: []string{"notation", "verify"},
+				run: func(ctx context.Context, env []string, name string, args ...string) ([]byte, error) {
+					require.Len(t, env, 1)
+					configDir = strings.TrimPrefix(env[0], "DOCKER_CONFIG=")
+
+					info, err := os.Stat(filepath.Join(configDir, "config.json"))
+					require.NoError(t, err)
+					assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+					data, err := os.ReadFile(filepath.Join(configDir, "config.json"))
+					require.NoError(t, err)
+
+					var config struct {
+						Auths map[string]cli.AuthConfig `json:"auths"`
+					}
+					require.NoError(t, json.Unmarshal(data, &config))
+					require.Contains(t, config.Auths, tt.expectedKey)
+					// user:password
+					assert.Equal(t, "dXNlcjpwYXNzd29yZA==", config.Auths[tt.expectedKey].Auth)
+
+					return nil, nil
+				},
+			}
+
+			err := v.Verify(context.Background(), tt.ref, &cli.AuthConfig{
+				Username:      "user",
+				Password:      "password",
+				ServerAddress: "registry.example.com",
+			})
+			require.NoError(t, err)
+
+			assert.NoDirExists(t, configDir, "the credentials are removed once verified")
+		})
+	}
+}
+
+func TestResolveDigestReference(t *testing.T) {
+	tests := map[string]struct {
+		imageName   string
+		repoDigests []string
+		expectedRef string
+		expectedErr error
+	}{
+		"docker hub image": {
+			imageName:   "alpine:3.18",
+			repoDigests: []string{"alpine@" + testDigest},
+			expectedRef: "docker.io/library/alpine@" + testDigest,
+		},
+		"image from another repository tagged locally": {
+			imageName: "registry.example.com/group/image:latest",
+			repoDigests: []string{
+				"alpine@sha256:0000000000000000000000000000000000000000000000000000000000000000",
+				"registry.example.com/group/image@" + testDigest,
+			},
+			expectedRef: "registry.example.com/group/image@" + testDigest,
+		},
+		"image pinned to digest": {
+			imageName:   "alpine@" + testDigest,
+			repoDigests: []string{"alpine@" + testDigest},
+			expectedRef: "docker.io/library/alpine@" + testDigest,
+		},
+		"image pinned to another digest": {
+			imageName:   "alpine@sha256:0000000000000000000000000000000000000000000000000000000000000000",
+			repoDigests: []string{"alpine@" + testDigest},
+			expectedErr: errNoRepoDigest,
+		},
+		"locally built image": {
+			imageName:   "my-image:latest",
+			expectedErr: errNoRepoDigest,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			ref, err := resolveDigestReference(tt.imageName, &types.ImageInspect{RepoDigests: tt.repoDigests})
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedRef, ref)
+		})
+	}
+}
+
+func TestGetDockerImageVerifiesSignature(t *testing.T) {
+	image := types.ImageInspect{ID: "image-id", RepoDigests: []string{"alpine@" + testDigest}}
+	ref := "docker.io/library/alpine@" + testDigest
+
+	t.Run("verified once", func(t *testing.T) {
+		c := docker.NewMockClient(t)
+		v := NewMockVerifier(t)
+
+		m := newDefaultTestManager(c, &common.DockerConfig{PullPolicy: common.StringOrArray{common.PullPolicyNever}})
+		m.config.Verifier = v
+		m.logger = discardPullLogger{}
+
+		c.On("ImageInspectWithRaw", m.context, "alpine").Return(image, nil, nil)
+		v.On("Verify", m.context, ref, (*cli.AuthConfig)(nil)).Return(nil).Once()
+
+		for i := 0; i < 2; i++ {
+			img, err := m.GetDockerImage("alpine", []common.DockerPullPolicy{common.PullPolicyNever})
+			require.NoError(t, err)
+			assert.Equal(t, "image-id", img.ID)
+		}
+	})
+
+	t.Run("verified with the registry credentials", func(t *testing.T) {
+		privateImage := types.ImageInspect{
+			ID:          "image-id",
+			RepoDigests: []string{"registry.example.com/group/image@" + testDigest},
+		}
+
+		c := docker.NewMockClient(t)
+		v := NewMockVerifier(t)
+
+		m := newDefaultTestManager(c, &common.DockerConfig{PullPolicy: common.StringOrArray{common.PullPolicyNever}})
+		m.config.Verifier = v
+		m.config.Credentials = []common.Credentials{
+			{Type: "registry", URL: "registry.example.com", Username: "user", Password: "password"},
+		}
+		m.logger = discardPullLogger{}
+
+		c.On("ImageInspectWithRaw", m.context, "registry.example.com/group/image").Return(privateImage, nil, nil).Once()
+		v.On("Verify", m.context, "registry.example.com/group/image@"+testDigest, &cli.AuthConfig{
+			Username:      "user",
+			Password:      "password",
+			ServerAddress: "registry.example.com",
+		}).Return(nil).Once()
+
+		_, err := m.GetDockerImage("registry.example.com/group/image", []common.DockerPullPolicy{common.PullPolicyNever})
+		require.NoError(t, err)
+	})
+
+	t.Run("verification failed", func(t *testing.T) {
+		c := docker.NewMockClient(t)
+		v := NewMockVerifier(t)
+
+		m := newDefaultTestManager(c, &common.DockerConfig{PullPolicy: common.StringOrArray{common.PullPolicyNever}})
+		m.config.Verifier = v
+		m.logger = discardPullLogger{}
+
+		c.On("ImageInspectWithRaw", m.context, "alpine").Return(image, nil, nil).Once()
+		v.On("Verify", m.context, ref, (*cli.AuthConfig)(nil)).Return(assert.AnError).Once()
+
+		img, err := m.GetDockerImage("alpine", []common.DockerPullPolicy{common.PullPolicyNever})
+		assert.Nil(t, img)
+
+		var buildErr *common.BuildError
+		require.ErrorAs(t, err, &buildErr)
+		assert.Equal(t, common.ImagePullFailure, buildErr.FailureReason)
+		assert.ErrorIs(t, err, assert.AnError)
+	})
+}
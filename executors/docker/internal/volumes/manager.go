@@ -21,6 +21,8 @@ type Manager interface {
 	CreateTemporary(ctx context.Context, destination string) error
 	RemoveTemporary(ctx context.Context) error
 	Binds() []string
+	CacheVolumes() []string
+	CacheDestinations() []string
 }
 
 type ManagerConfig struct {
@@ -43,6 +45,8 @@ type manager struct {
 
 	volumeBindings   []string
 	temporaryVolumes []string
+	cacheVolumes     []string
+	cacheDirs        []string
 	managedVolumes   pathList
 }
 
@@ -146,9 +150,14 @@ func (m *manager) addCacheVolume(ctx context.Context, volume *parser.Volume) err
 		return m.createHostBasedCacheVolume(volume.Destination)
 	}
 
-	_, err := m.createCacheVolume(ctx, volume.Destination, true, m.config.DriverOpts)
+	volumeName, err := m.createCacheVolume(ctx, volume.Destination, true, m.config.DriverOpts)
+	if err != nil {
+		return err
+	}
 
-	return err
+	m.cacheVolumes = append(m.cacheVolumes, volumeName)
+
+	return nil
 }
 
 func (m *manager) createHostBasedCacheVolume(destination string) error {
@@ -168,6 +177,7 @@ func (m *manager) createHostBasedCacheVolume(destination string) error {
 		Source:      hostPath,
 		Destination: destination,
 	})
+	m.cacheDirs = append(m.cacheDirs, destination)
 
 	return nil
 }
@@ -218,6 +228,10 @@ func (m *manager) createCacheVolume(
 	})
 	m.logger.Debugln(fmt.Sprintf("Using volume %q as cache %q...", v.Name, destination))
 
+	if reusable {
+		m.cacheDirs = append(m.cacheDirs, destination)
+	}
+
 	return volumeName, nil
 }
 
@@ -258,3 +272,15 @@ func (m *manager) RemoveTemporary(ctx context.Context) error {
 func (m *manager) Binds() []string {
 	return m.volumeBindings
 }
+
+// CacheVolumes returns the names of the reusable cache volumes created by the
+// manager.
+func (m *manager) CacheVolumes() []string {
+	return m.cacheVolumes
+}
+
+// CacheDestinations returns the paths, in the containers, of the reusable
+// cache volumes, including the ones bound to host directories.
+func (m *manager) CacheDestinations() []string {
+	return m.cacheDirs
+}
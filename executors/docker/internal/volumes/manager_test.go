@@ -5,6 +5,7 @@ package volumes
 import (
 	"context"
 	"errors"
+	"strings"
 	"testing"
 
 	"github.com/docker/docker/api/types/volume"
@@ -314,6 +315,9 @@ func TestDefaultManager_CreateUserVolumes_CacheVolume_HostBased(t *testing.T) {
 			err = m.Create(context.Background(), testCase.volume)
 			assert.ErrorIs(t, err, testCase.expectedError)
 			assert.Equal(t, testCase.expectedBinding, m.volumeBindings)
+			if testCase.expectedError == nil {
+				assert.Equal(t, []string{bindDestination(testCase.expectedBinding[1])}, m.CacheDestinations())
+			}
 		})
 	}
 }
@@ -411,6 +415,8 @@ func TestDefaultManager_CreateUserVolumes_CacheVolume_VolumeBased(t *testing.T)
 
 			assert.NoError(t, err)
 			assert.Equal(t, testCase.expectedBindings, m.Binds())
+			assert.Equal(t, []string{testCase.expectedVolumeName}, m.CacheVolumes())
+			assert.Equal(t, []string{bindDestination(testCase.expectedBindings[1])}, m.CacheDestinations())
 		})
 	}
 }
@@ -616,6 +622,11 @@ func TestDefaultManager_Binds(t *testing.T) {
 	assert.Equal(t, expectedElements, m.Binds())
 }
 
+func bindDestination(bind string) string {
+	_, destination, _ := strings.Cut(bind, ":")
+	return destination
+}
+
 func testCreateOptionsContent(v volume.CreateOptions, expectedVolumeName string) bool {
 	return v.Name == expectedVolumeName &&
 		// ensure labeler has been used
@@ -29,6 +29,38 @@ func (_m *MockManager) Binds() []string {
 	return r0
 }
 
+// CacheDestinations provides a mock function with given fields:
+func (_m *MockManager) CacheDestinations() []string {
+	ret := _m.Called()
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func() []string); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	return r0
+}
+
+// CacheVolumes provides a mock function with given fields:
+func (_m *MockManager) CacheVolumes() []string {
+	ret := _m.Called()
+
+	var r0 []string
+	if rf, ok := ret.Get(0).(func() []string); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).([]string)
+		}
+	}
+
+	return r0
+}
+
 // Create provides a mock function with given fields: ctx, volume
 func (_m *MockManager) Create(ctx context.Context, volume string) error {
 	ret := _m.Called(ctx, volume)
@@ -0,0 +1,80 @@
+package docker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/docker/docker/api/types"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/docker"
+)
+
+var newOrphanedJobsDockerClient = func(config *common.DockerConfig) (docker.Client, error) {
+	return docker.New(config.Credentials)
+}
+
+// executorProvider extends the default provider with the ability to remove the
+// containers and networks of jobs orphaned by a runner restart, and to warm
+// the images of the runners in the background.
+type executorProvider struct {
+	executors.DefaultExecutorProvider
+
+	// cacheVolumes and imageWarmers are only set for one of the registered
+	// providers, as they're shared and their metrics can be registered only once
+	cacheVolumes *cacheVolumeTracker
+	imageWarmers *imageWarmerRegistry
+}
+
+func (p executorProvider) CleanupOrphanedJob(
+	ctx context.Context,
+	config *common.RunnerConfig,
+	job common.JobStateEntry,
+) error {
+	if config.Docker == nil {
+		return errors.New("missing docker configuration")
+	}
+
+	client, err := newOrphanedJobsDockerClient(config.Docker)
+	if err != nil {
+		return fmt.Errorf("connecting to docker: %w", err)
+	}
+	defer client.Close()
+
+	return removeOrphanedResources(ctx, client, job.Resources)
+}
+
+// removeOrphanedResources removes containers first, as the networks can't be
+// removed while containers are still connected to them.
+func removeOrphanedResources(ctx context.Context, client docker.Client, resources []common.ExecutorResource) error {
+	var errs []error
+
+	for _, resource := range resources {
+		if resource.Type != common.ExecutorResourceContainer {
+			continue
+		}
+
+		err := client.ContainerRemove(ctx, resource.ID, types.ContainerRemoveOptions{
+			RemoveVolumes: true,
+			Force:         true,
+		})
+		if err != nil && !docker.IsErrNotFound(err) {
+			errs = append(errs, fmt.Errorf("removing container %s: %w", resource.ID, err))
+		}
+	}
+
+	for _, resource := range resources {
+		if resource.Type != common.ExecutorResourceNetwork {
+			continue
+		}
+
+		err := client.NetworkRemove(ctx, resource.ID)
+		if err != nil && !docker.IsErrNotFound(err) {
+			errs = append(errs, fmt.Errorf("removing network %s: %w", resource.ID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,101 @@
+//go:build !integration
+
+package docker
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/docker"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/docker/test"
+)
+
+func TestExecutorProviderCleanupOrphanedJob(t *testing.T) {
+	job := common.JobStateEntry{
+		ID: 1,
+		Resources: []common.ExecutorResource{
+			{Type: common.ExecutorResourceNetwork, ID: "network"},
+			{Type: common.ExecutorResourceContainer, ID: "build"},
+			{Type: common.ExecutorResourceContainer, ID: "removed"},
+			{Type: common.ExecutorResourcePod, ID: "ignored"},
+		},
+	}
+
+	removeOptions := types.ContainerRemoveOptions{RemoveVolumes: true, Force: true}
+
+	tests := map[string]struct {
+		config        *common.RunnerConfig
+		setupClient   func(c *docker.MockClient)
+		expectedError string
+	}{
+		"missing docker configuration": {
+			config:        &common.RunnerConfig{},
+			expectedError: "missing docker configuration",
+		},
+		"resources removed": {
+			config: &common.RunnerConfig{RunnerSettings: common.RunnerSettings{Docker: &common.DockerConfig{}}},
+			setupClient: func(c *docker.MockClient) {
+				containerRemove := c.On("ContainerRemove", mock.Anything, "build", removeOptions).
+					Return(nil).
+					Once()
+				c.On("ContainerRemove", mock.Anything, "removed", removeOptions).
+					Return(&test.NotFoundError{}).
+					Once()
+				c.On("NetworkRemove", mock.Anything, "network").
+					Return(nil).
+					Once().
+					NotBefore(containerRemove)
+				c.On("Close").Return(nil).Once()
+			},
+		},
+		"removal failure": {
+			config: &common.RunnerConfig{RunnerSettings: common.RunnerSettings{Docker: &common.DockerConfig{}}},
+			setupClient: func(c *docker.MockClient) {
+				c.On("ContainerRemove", mock.Anything, "build", removeOptions).
+					Return(errors.New("daemon error")).
+					Once()
+				c.On("ContainerRemove", mock.Anything, "removed", removeOptions).
+					Return(nil).
+					Once()
+				c.On("NetworkRemove", mock.Anything, "network").
+					Return(errors.New("network in use")).
+					Once()
+				c.On("Close").Return(nil).Once()
+			},
+			expectedError: "removing container build: daemon error\nremoving network network: network in use",
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			client := docker.NewMockClient(t)
+			if tt.setupClient != nil {
+				tt.setupClient(client)
+			}
+
+			oldNewClient := newOrphanedJobsDockerClient
+			defer func() { newOrphanedJobsDockerClient = oldNewClient }()
+			newOrphanedJobsDockerClient = func(_ *common.DockerConfig) (docker.Client, error) {
+				return client, nil
+			}
+
+			provider, ok := common.GetExecutorProvider("docker").(common.OrphanedJobCleaner)
+			require.True(t, ok)
+
+			err := provider.CleanupOrphanedJob(context.Background(), tt.config, job)
+			if tt.expectedError != "" {
+				assert.EqualError(t, err, tt.expectedError)
+				return
+			}
+
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,271 @@
+package docker
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/docker/go-units"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+const (
+	// CPULimitOverwriteVariableValue is the key for the JobVariable containing user overwritten number of CPUs
+	CPULimitOverwriteVariableValue = "DOCKER_CPU_LIMIT"
+	// MemoryLimitOverwriteVariableValue is the key for the JobVariable containing user overwritten memory limit
+	MemoryLimitOverwriteVariableValue = "DOCKER_MEMORY_LIMIT"
+	// ShmSizeLimitOverwriteVariableValue is the key for the JobVariable containing user overwritten shared
+	// memory size
+	ShmSizeLimitOverwriteVariableValue = "DOCKER_SHM_SIZE_LIMIT"
+	// ServiceCPULimitOverwriteVariableValue is the key for the JobVariable containing user overwritten number
+	// of CPUs of the services
+	ServiceCPULimitOverwriteVariableValue = "DOCKER_SERVICE_CPU_LIMIT"
+	// ServiceMemoryLimitOverwriteVariableValue is the key for the JobVariable containing user overwritten memory
+	// limit of the services
+	ServiceMemoryLimitOverwriteVariableValue = "DOCKER_SERVICE_MEMORY_LIMIT"
+	// ServiceShmSizeLimitOverwriteVariableValue is the key for the JobVariable containing user overwritten shared
+	// memory size of the services
+	ServiceShmSizeLimitOverwriteVariableValue = "DOCKER_SERVICE_SHM_SIZE_LIMIT"
+)
+
+type overwriteTooHighError struct {
+	resource  string
+	max       string
+	overwrite string
+}
+
+func (o *overwriteTooHighError) Error() string {
+	return fmt.Sprintf("the resource %q requested %q is higher than limit allowed %q", o.resource, o.overwrite, o.max)
+}
+
+func (o *overwriteTooHighError) Is(err error) bool {
+	_, ok := err.(*overwriteTooHighError)
+	return ok
+}
+
+type overwriteNotPositiveError struct {
+	resource  string
+	overwrite string
+}
+
+func (o *overwriteNotPositiveError) Error() string {
+	return fmt.Sprintf("the resource %q requested %q must be greater than zero", o.resource, o.overwrite)
+}
+
+func (o *overwriteNotPositiveError) Is(err error) bool {
+	_, ok := err.(*overwriteNotPositiveError)
+	return ok
+}
+
+// containerResources are the resources of a container that can be
+// overwritten by the job
+type containerResources struct {
+	nanoCPUs   int64
+	memory     int64
+	memorySwap int64
+	shmSize    int64
+}
+
+type overwrites struct {
+	buildResources   containerResources
+	serviceResources containerResources
+}
+
+type resourceParser func(value string) (int64, error)
+
+func parseShmSize(value string) (int64, error) {
+	return strconv.ParseInt(value, 10, 64)
+}
+
+func createOverwrites(
+	config *common.DockerConfig,
+	variables common.JobVariables,
+	logger common.BuildLogger,
+) (*overwrites, error) {
+	o := &overwrites{}
+
+	variables = variables.Expand()
+
+	nanoCPUs, err := config.GetNanoCPUs()
+	if err != nil {
+		return nil, err
+	}
+
+	o.buildResources, err = o.evaluateMaxResourcesOverwrite(
+		"CPULimit",
+		"MemoryLimit",
+		"ShmSizeLimit",
+		containerResources{nanoCPUs: nanoCPUs, memory: config.GetMemory(), shmSize: config.ShmSize},
+		config.CPUSOverwriteMaxAllowed,
+		config.MemoryOverwriteMaxAllowed,
+		formatShmSize(config.ShmSizeOverwriteMaxAllowed),
+		variables.Value(CPULimitOverwriteVariableValue),
+		variables.Value(MemoryLimitOverwriteVariableValue),
+		variables.Value(ShmSizeLimitOverwriteVariableValue),
+		logger,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid build resources specified: %w", err)
+	}
+
+	o.buildResources.memorySwap = scaleMemorySwap(config.GetMemorySwap(), config.GetMemory(), o.buildResources.memory)
+
+	o.serviceResources, err = o.evaluateMaxResourcesOverwrite(
+		"ServiceCPULimit",
+		"ServiceMemoryLimit",
+		"ServiceShmSizeLimit",
+		containerResources{shmSize: config.ShmSize},
+		config.ServiceCPUSOverwriteMaxAllowed,
+		config.ServiceMemoryOverwriteMaxAllowed,
+		formatShmSize(config.ServiceShmSizeOverwriteMaxAllowed),
+		variables.Value(ServiceCPULimitOverwriteVariableValue),
+		variables.Value(ServiceMemoryLimitOverwriteVariableValue),
+		variables.Value(ServiceShmSizeLimitOverwriteVariableValue),
+		logger,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid service resources specified: %w", err)
+	}
+
+	return o, nil
+}
+
+// scaleMemorySwap returns the memory_swap of the build container, which is the
+// total of its memory and swap. Docker rejects a memory_swap lower than the
+// memory, so the swap configured in addition to the memory is kept when the
+// job overwrites the memory.
+func scaleMemorySwap(memorySwap int64, memory int64, overwrittenMemory int64) int64 {
+	// Docker's default of twice the memory
+	if memorySwap == 0 || memory == 0 || memorySwap < memory {
+		return memorySwap
+	}
+
+	return overwrittenMemory + memorySwap - memory
+}
+
+func formatShmSize(size int64) string {
+	if size == 0 {
+		return ""
+	}
+
+	return strconv.FormatInt(size, 10)
+}
+
+func (o *overwrites) evaluateMaxResourcesOverwrite(
+	cpuFieldName,
+	memoryFieldName,
+	shmSizeFieldName string,
+	current containerResources,
+	maxCPU,
+	maxMemory,
+	maxShmSize,
+	overwriteCPU,
+	overwriteMemory,
+	overwriteShmSize string,
+	logger common.BuildLogger,
+) (containerResources, error) {
+	var resources containerResources
+	var err error
+
+	resources.nanoCPUs, err = o.evaluateMaxResourceOverwrite(
+		cpuFieldName,
+		current.nanoCPUs,
+		maxCPU,
+		overwriteCPU,
+		common.ParseNanoCPUs,
+		logger,
+	)
+	if err != nil {
+		return resources, err
+	}
+
+	resources.memory, err = o.evaluateMaxResourceOverwrite(
+		memoryFieldName,
+		current.memory,
+		maxMemory,
+		overwriteMemory,
+		units.RAMInBytes,
+		logger,
+	)
+	if err != nil {
+		return resources, err
+	}
+
+	resources.shmSize, err = o.evaluateMaxResourceOverwrite(
+		shmSizeFieldName,
+		current.shmSize,
+		maxShmSize,
+		overwriteShmSize,
+		parseShmSize,
+		logger,
+	)
+
+	return resources, err
+}
+
+func (o *overwrites) evaluateMaxResourceOverwrite(
+	fieldName string,
+	value int64,
+	maxResource,
+	overwriteValue string,
+	parse resourceParser,
+	logger common.BuildLogger,
+) (int64, error) {
+	if maxResource == "" {
+		logger.Debugln("setting allowing overrides for", fieldName, "is empty, disabling override.")
+		return value, nil
+	}
+
+	if overwriteValue == "" {
+		return value, nil
+	}
+
+	maxValue, err := parse(maxResource)
+	if err != nil {
+		return value, fmt.Errorf("parsing resource limit: %q", err.Error())
+	}
+
+	overwrite, err := parse(overwriteValue)
+	if err != nil {
+		return value, fmt.Errorf("parsing resource limit: %q", err.Error())
+	}
+
+	// zero lifts the limit of the container, which would escape the bounds
+	// set by the administrator
+	if overwrite <= 0 {
+		return 0, &overwriteNotPositiveError{
+			resource:  fieldName,
+			overwrite: overwriteValue,
+		}
+	}
+
+	if overwrite > maxValue {
+		return 0, &overwriteTooHighError{
+			resource:  fieldName,
+			max:       maxResource,
+			overwrite: overwriteValue,
+		}
+	}
+
+	logger.Println(fmt.Sprintf("%q overwritten with %q", fieldName, overwriteValue))
+
+	return overwrite, nil
+}
+
+// getOverwrites returns the container resources overwritten by the job. They
+// are evaluated in Prepare, but are evaluated on first use when the executor
+// is used without it.
+func (e *executor) getOverwrites() (*overwrites, error) {
+	if e.overwrites != nil {
+		return e.overwrites, nil
+	}
+
+	o, err := createOverwrites(e.Config.Docker, e.Build.GetAllVariables(), e.BuildLogger)
+	if err != nil {
+		return nil, err
+	}
+
+	e.overwrites = o
+
+	return o, nil
+}
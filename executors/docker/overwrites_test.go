@@ -0,0 +1,233 @@
+//go:build !integration
+
+package docker
+
+import (
+	"os"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+func TestOverwrites(t *testing.T) {
+	logger := common.NewBuildLogger(&common.Trace{Writer: os.Stdout}, logrus.WithFields(logrus.Fields{}))
+
+	tests := map[string]struct {
+		config        *common.DockerConfig
+		variables     common.JobVariables
+		expected      *overwrites
+		expectedError error
+	}{
+		"no overwrites allowed": {
+			config: &common.DockerConfig{
+				CPUS:    "1.5",
+				Memory:  "1g",
+				ShmSize: 1024,
+			},
+			variables: common.JobVariables{
+				{Key: CPULimitOverwriteVariableValue, Value: "2"},
+				{Key: MemoryLimitOverwriteVariableValue, Value: "2g"},
+				{Key: ShmSizeLimitOverwriteVariableValue, Value: "2048"},
+				{Key: ServiceCPULimitOverwriteVariableValue, Value: "2"},
+			},
+			expected: &overwrites{
+				buildResources:   containerResources{nanoCPUs: 1.5e9, memory: 1 << 30, shmSize: 1024},
+				serviceResources: containerResources{shmSize: 1024},
+			},
+		},
+		"no overwrites requested": {
+			config: &common.DockerConfig{
+				CPUS:                           "1",
+				Memory:                         "1g",
+				CPUSOverwriteMaxAllowed:        "4",
+				MemoryOverwriteMaxAllowed:      "4g",
+				ServiceCPUSOverwriteMaxAllowed: "2",
+			},
+			expected: &overwrites{
+				buildResources: containerResources{nanoCPUs: 1e9, memory: 1 << 30},
+			},
+		},
+		"overwrites within the allowed maximum": {
+			config: &common.DockerConfig{
+				CPUS:                              "1",
+				Memory:                            "1g",
+				ShmSize:                           1024,
+				CPUSOverwriteMaxAllowed:           "4",
+				MemoryOverwriteMaxAllowed:         "4g",
+				ShmSizeOverwriteMaxAllowed:        4096,
+				ServiceCPUSOverwriteMaxAllowed:    "2",
+				ServiceMemoryOverwriteMaxAllowed:  "512m",
+				ServiceShmSizeOverwriteMaxAllowed: 2048,
+			},
+			variables: common.JobVariables{
+				{Key: CPULimitOverwriteVariableValue, Value: "2.5"},
+				{Key: MemoryLimitOverwriteVariableValue, Value: "4g"},
+				{Key: ShmSizeLimitOverwriteVariableValue, Value: "$SHM_SIZE"},
+				{Key: "SHM_SIZE", Value: "2048"},
+				{Key: ServiceCPULimitOverwriteVariableValue, Value: "0.5"},
+				{Key: ServiceMemoryLimitOverwriteVariableValue, Value: "256m"},
+				{Key: ServiceShmSizeLimitOverwriteVariableValue, Value: "2048"},
+			},
+			expected: &overwrites{
+				buildResources:   containerResources{nanoCPUs: 2.5e9, memory: 4 << 30, shmSize: 2048},
+				serviceResources: containerResources{nanoCPUs: 0.5e9, memory: 256 << 20, shmSize: 2048},
+			},
+		},
+		"memory overwrite keeps the configured swap": {
+			config: &common.DockerConfig{
+				Memory:                    "1g",
+				MemorySwap:                "1536m",
+				MemoryOverwriteMaxAllowed: "4g",
+			},
+			variables: common.JobVariables{
+				{Key: MemoryLimitOverwriteVariableValue, Value: "2g"},
+			},
+			expected: &overwrites{
+				buildResources: containerResources{memory: 2 << 30, memorySwap: 2<<30 + 512<<20},
+			},
+		},
+		"memory overwrite lower than the configured swap": {
+			config: &common.DockerConfig{
+				Memory:                    "2g",
+				MemorySwap:                "2g",
+				MemoryOverwriteMaxAllowed: "4g",
+			},
+			variables: common.JobVariables{
+				{Key: MemoryLimitOverwriteVariableValue, Value: "512m"},
+			},
+			expected: &overwrites{
+				buildResources: containerResources{memory: 512 << 20, memorySwap: 512 << 20},
+			},
+		},
+		"build overwrite too high": {
+			config: &common.DockerConfig{
+				MemoryOverwriteMaxAllowed: "4g",
+			},
+			variables: common.JobVariables{
+				{Key: MemoryLimitOverwriteVariableValue, Value: "5g"},
+			},
+			expectedError: new(overwriteTooHighError),
+		},
+		"service overwrite too high": {
+			config: &common.DockerConfig{
+				ServiceCPUSOverwriteMaxAllowed: "1",
+			},
+			variables: common.JobVariables{
+				{Key: ServiceCPULimitOverwriteVariableValue, Value: "1.5"},
+			},
+			expectedError: new(overwriteTooHighError),
+		},
+		"build overwrite lifting the limit": {
+			config: &common.DockerConfig{
+				Memory:                    "1g",
+				MemoryOverwriteMaxAllowed: "4g",
+			},
+			variables: common.JobVariables{
+				{Key: MemoryLimitOverwriteVariableValue, Value: "0"},
+			},
+			expectedError: new(overwriteNotPositiveError),
+		},
+		"build overwrite negative": {
+			config: &common.DockerConfig{
+				CPUSOverwriteMaxAllowed: "4",
+			},
+			variables: common.JobVariables{
+				{Key: CPULimitOverwriteVariableValue, Value: "-1"},
+			},
+			expectedError: new(overwriteNotPositiveError),
+		},
+		"shm size overwrite negative": {
+			config: &common.DockerConfig{
+				ShmSizeOverwriteMaxAllowed: 4096,
+			},
+			variables: common.JobVariables{
+				{Key: ShmSizeLimitOverwriteVariableValue, Value: "-2048"},
+			},
+			expectedError: new(overwriteNotPositiveError),
+		},
+		"service overwrite lifting the limit": {
+			config: &common.DockerConfig{
+				ServiceMemoryOverwriteMaxAllowed: "512m",
+			},
+			variables: common.JobVariables{
+				{Key: ServiceMemoryLimitOverwriteVariableValue, Value: "0"},
+			},
+			expectedError: new(overwriteNotPositiveError),
+		},
+		"service cpu overwrite lifting the limit": {
+			config: &common.DockerConfig{
+				ServiceCPUSOverwriteMaxAllowed: "1",
+			},
+			variables: common.JobVariables{
+				{Key: ServiceCPULimitOverwriteVariableValue, Value: "0"},
+			},
+			expectedError: new(overwriteNotPositiveError),
+		},
+		"malformed overwrite": {
+			config: &common.DockerConfig{
+				CPUSOverwriteMaxAllowed: "4",
+			},
+			variables: common.JobVariables{
+				{Key: CPULimitOverwriteVariableValue, Value: "two"},
+			},
+			expectedError: assert.AnError,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			o, err := createOverwrites(tt.config, tt.variables, logger)
+			if tt.expectedError == assert.AnError {
+				assert.Error(t, err)
+				return
+			}
+			if tt.expectedError != nil {
+				assert.ErrorIs(t, err, tt.expectedError)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expected, o)
+		})
+	}
+}
+
+func TestDockerResourcesOverwrite(t *testing.T) {
+	dockerConfig := &common.DockerConfig{
+		Memory:                    "1g",
+		MemorySwap:                "1g",
+		MemoryOverwriteMaxAllowed: "4g",
+	}
+
+	cce := func(t *testing.T, config *container.Config, hostConfig *container.HostConfig) {
+		assert.Equal(t, int64(2<<30), hostConfig.Memory)
+		assert.Equal(t, int64(2<<30), hostConfig.MemorySwap)
+	}
+
+	c, e := prepareTestDockerConfiguration(t, dockerConfig, cce)
+	defer c.AssertExpectations(t)
+
+	e.Build.Variables = common.JobVariables{
+		{Key: MemoryLimitOverwriteVariableValue, Value: "2g"},
+	}
+
+	c.On("ContainerInspect", mock.Anything, "abc").
+		Return(types.ContainerJSON{}, nil).Once()
+
+	require.NoError(t, e.createVolumesManager())
+	require.NoError(t, e.createPullManager())
+
+	_, err := e.createContainer(buildContainerType, common.Image{Name: "alpine"}, []string{"/bin/sh"}, []string{})
+	assert.NoError(t, err)
+
+	hostConfig, err := e.createHostConfigForService()
+	require.NoError(t, err)
+	assert.Zero(t, hostConfig.Memory)
+}
@@ -1,6 +1,8 @@
 package docker
 
 import (
+	"fmt"
+
 	"gitlab.com/gitlab-org/gitlab-runner/executors/docker/internal/pull"
 )
 
@@ -12,6 +14,14 @@ var createPullManager = func(e *executor) (pull.Manager, error) {
 		Credentials:  e.Build.Credentials,
 	}
 
+	if e.Config.Docker.ImageVerification != nil {
+		verifier, err := pull.NewVerifier(e.Config.Docker.ImageVerification)
+		if err != nil {
+			return nil, fmt.Errorf("creating image verifier: %w", err)
+		}
+		config.Verifier = verifier
+	}
+
 	pullManager := pull.NewManager(e.Context, &e.BuildLogger, config, e.client, func() {
 		e.SetCurrentStage(ExecutorStagePullingImage)
 	})
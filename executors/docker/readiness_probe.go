@@ -0,0 +1,174 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/stdcopy"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+var errReadinessProbeTimeout = errors.New("probe timed out")
+
+// runServiceReadinessProbe checks that the service is ready with its readiness
+// probe. Exec probes are run in the service container, HTTP and TCP probes
+// are run by the health check container.
+func (e *executor) runServiceReadinessProbe(service *types.Container, timeout time.Duration) error {
+	probe := e.serviceReadinessProbes[service.ID]
+	if probe == nil || len(probe.Exec) == 0 {
+		return e.runServiceHealthCheckContainer(service, probe, timeout)
+	}
+
+	ctx, cancel := context.WithTimeout(e.Context, timeout)
+	defer cancel()
+
+	for attempt := 1; ; attempt++ {
+		output, err := e.execServiceReadinessProbe(ctx, service.ID, probe)
+		if err == nil {
+			return nil
+		}
+
+		if ctx.Err() != nil {
+			err = fmt.Errorf("service %q timeout: %w", service.Names[0], err)
+		} else if probe.Retries > 0 && attempt >= probe.Retries {
+			err = fmt.Errorf("service %q readiness probe failed after %d attempts: %w", service.Names[0], attempt, err)
+		} else {
+			select {
+			case <-ctx.Done():
+			case <-time.After(probe.GetPeriod()):
+			}
+			continue
+		}
+
+		return &serviceHealthCheckError{
+			Inner:      err,
+			Logs:       output,
+			LogsSource: "Readiness probe output",
+		}
+	}
+}
+
+// execServiceReadinessProbe runs the probe's command in the service container
+// and returns its output
+func (e *executor) execServiceReadinessProbe(
+	ctx context.Context,
+	containerID string,
+	probe *common.ReadinessProbe,
+) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, probe.GetTimeout())
+	defer cancel()
+
+	output, err := e.execServiceCommand(ctx, containerID, probe.Exec, nil)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return output, errReadinessProbeTimeout
+	}
+
+	return output, err
+}
+
+// execServiceCommand runs the command in the service container and returns
+// its combined output. A non-zero exit code is returned as an error.
+func (e *executor) execServiceCommand(
+	ctx context.Context,
+	containerID string,
+	cmd []string,
+	env []string,
+) (string, error) {
+	exec, err := e.client.ContainerExecCreate(ctx, containerID, types.ExecConfig{
+		Cmd:          cmd,
+		Env:          env,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return "", fmt.Errorf("creating exec: %w", err)
+	}
+
+	resp, err := e.client.ContainerExecAttach(ctx, exec.ID, types.ExecStartCheck{})
+	if err != nil {
+		return "", fmt.Errorf("attaching to exec: %w", err)
+	}
+	defer resp.Close()
+
+	var output bytes.Buffer
+	done := make(chan error, 1)
+	go func() {
+		_, err := stdcopy.StdCopy(&output, &output, resp.Reader)
+		done <- err
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		// closing the connection unblocks the copy
+		resp.Close()
+		<-done
+		return output.String(), ctx.Err()
+	}
+
+	if err != nil {
+		return output.String(), fmt.Errorf("reading exec output: %w", err)
+	}
+
+	inspect, err := e.client.ContainerExecInspect(ctx, exec.ID)
+	if err != nil {
+		return output.String(), fmt.Errorf("inspecting exec: %w", err)
+	}
+
+	if inspect.ExitCode != 0 {
+		return output.String(), fmt.Errorf("exited with code %d", inspect.ExitCode)
+	}
+
+	return output.String(), nil
+}
+
+// createServiceHealthCheckEnvironment returns the environment of the health
+// check container, with the settings of the service's HTTP or TCP probe
+func (e *executor) createServiceHealthCheckEnvironment(
+	service *types.Container,
+	probe *common.ReadinessProbe,
+) ([]string, error) {
+	if probe == nil {
+		return e.addServiceHealthCheckEnvironment(service)
+	}
+
+	var environment []string
+	if probe.Port > 0 && e.networkMode.UserDefined() != "" {
+		environment = []string{"WAIT_FOR_SERVICE_TCP_ADDR=" + service.ID[:12]}
+	} else {
+		var err error
+		environment, err = e.addServiceHealthCheckEnvironment(service)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return append(environment, readinessProbeEnvironment(probe)...), nil
+}
+
+func readinessProbeEnvironment(probe *common.ReadinessProbe) []string {
+	environment := []string{
+		"READINESS_PROBE_TIMEOUT=" + strconv.Itoa(int(probe.GetTimeout().Seconds())),
+		"READINESS_PROBE_PERIOD=" + strconv.Itoa(int(probe.GetPeriod().Seconds())),
+	}
+
+	if probe.HTTPPath != "" {
+		environment = append(environment, "READINESS_PROBE_HTTP_PATH="+probe.HTTPPath)
+	}
+
+	if probe.Port > 0 {
+		environment = append(environment, "READINESS_PROBE_PORT="+strconv.Itoa(probe.Port))
+	}
+
+	if probe.Retries > 0 {
+		environment = append(environment, "READINESS_PROBE_RETRIES="+strconv.Itoa(probe.Retries))
+	}
+
+	return environment
+}
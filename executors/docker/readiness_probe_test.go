@@ -0,0 +1,147 @@
+//go:build !integration
+
+package docker
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/docker"
+)
+
+func newProbeExecResponse(t *testing.T, output string) types.HijackedResponse {
+	var buf bytes.Buffer
+	_, err := stdcopy.NewStdWriter(&buf, stdcopy.Stdout).Write([]byte(output))
+	require.NoError(t, err)
+
+	return types.HijackedResponse{
+		Conn:   nopConn{},
+		Reader: bufio.NewReader(&buf),
+	}
+}
+
+func TestRunServiceReadinessProbeExec(t *testing.T) {
+	service := &types.Container{ID: "service-id", Names: []string{"postgres"}}
+	probe := &common.ReadinessProbe{
+		Exec:          []string{"pg_isready"},
+		PeriodSeconds: 1,
+		Retries:       2,
+	}
+	execConfig := types.ExecConfig{Cmd: []string{"pg_isready"}, AttachStdout: true, AttachStderr: true}
+
+	tests := map[string]struct {
+		exitCodes   []int
+		expectedErr string
+	}{
+		"ready on first attempt": {
+			exitCodes: []int{0},
+		},
+		"ready on second attempt": {
+			exitCodes: []int{1, 0},
+		},
+		"not ready after retries": {
+			exitCodes:   []int{1, 1},
+			expectedErr: `service "postgres" readiness probe failed after 2 attempts: exited with code 1`,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			c := docker.NewMockClient(t)
+
+			for _, exitCode := range tt.exitCodes {
+				c.On("ContainerExecCreate", mock.Anything, service.ID, execConfig).
+					Return(types.IDResponse{ID: "exec-id"}, nil).
+					Once()
+				c.On("ContainerExecAttach", mock.Anything, "exec-id", types.ExecStartCheck{}).
+					Return(newProbeExecResponse(t, "accepting connections\n"), nil).
+					Once()
+				c.On("ContainerExecInspect", mock.Anything, "exec-id").
+					Return(types.ContainerExecInspect{ExitCode: exitCode}, nil).
+					Once()
+			}
+
+			e := &executor{
+				client:                 c,
+				serviceReadinessProbes: map[string]*common.ReadinessProbe{service.ID: probe},
+			}
+			e.Context = context.Background()
+
+			err := e.runServiceReadinessProbe(service, time.Minute)
+			if tt.expectedErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			var healthCheckErr *serviceHealthCheckError
+			require.ErrorAs(t, err, &healthCheckErr)
+			assert.EqualError(t, err, tt.expectedErr)
+			assert.Equal(t, "accepting connections\n", healthCheckErr.Logs)
+			assert.Equal(t, "Readiness probe output", healthCheckErr.LogsSource)
+		})
+	}
+}
+
+func TestCreateServiceHealthCheckEnvironment(t *testing.T) {
+	service := &types.Container{
+		ID:    "0000000000000000000000000000000000000000000000000000000000000000",
+		Names: []string{"default"},
+	}
+
+	tests := map[string]struct {
+		networkMode         string
+		probe               *common.ReadinessProbe
+		expectedEnvironment []string
+	}{
+		"no probe": {
+			networkMode:         "default",
+			expectedEnvironment: []string{},
+		},
+		"HTTP probe with port in user defined network": {
+			networkMode: "user-defined",
+			probe: &common.ReadinessProbe{
+				HTTPPath:       "/health",
+				Port:           8080,
+				TimeoutSeconds: 2,
+				Retries:        5,
+			},
+			expectedEnvironment: []string{
+				"WAIT_FOR_SERVICE_TCP_ADDR=000000000000",
+				"READINESS_PROBE_TIMEOUT=2",
+				"READINESS_PROBE_PERIOD=1",
+				"READINESS_PROBE_HTTP_PATH=/health",
+				"READINESS_PROBE_PORT=8080",
+				"READINESS_PROBE_RETRIES=5",
+			},
+		},
+		"TCP probe with defaults": {
+			networkMode: "default",
+			probe:       &common.ReadinessProbe{},
+			expectedEnvironment: []string{
+				"READINESS_PROBE_TIMEOUT=1",
+				"READINESS_PROBE_PERIOD=1",
+			},
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			e := &executor{networkMode: container.NetworkMode(tt.networkMode)}
+
+			environment, err := e.createServiceHealthCheckEnvironment(service, tt.probe)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedEnvironment, environment)
+		})
+	}
+}
@@ -0,0 +1,195 @@
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/sirupsen/logrus"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/featureflags"
+)
+
+var resourceUsageRetryInterval = time.Second
+
+// resourceUsageCollector accumulates the stats of the containers the job
+// scripts are run in. Containers are restarted for every stage, which resets
+// their counters, so the last sample of every run is added to the total.
+type resourceUsageCollector struct {
+	lock  sync.Mutex
+	usage common.ResourceUsage
+}
+
+func newResourceUsageCollector() *resourceUsageCollector {
+	return &resourceUsageCollector{
+		usage: common.ResourceUsage{
+			Disk:    &common.ResourceUsageIO{},
+			Network: &common.ResourceUsageIO{},
+		},
+	}
+}
+
+// watch streams the stats of the container until the returned function is
+// called. It is expected to be called right before the container is started.
+func (c *resourceUsageCollector) watch(
+	ctx context.Context,
+	client statsClient,
+	id string,
+	logger logrus.FieldLogger,
+) func() {
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+
+	var last *types.StatsJSON
+
+	go func() {
+		defer close(done)
+
+		for ctx.Err() == nil {
+			err := streamContainerStats(ctx, client, id, func(stats *types.StatsJSON) {
+				// Stats of a container that isn't running yet are all zeroes
+				if stats.Read.IsZero() {
+					return
+				}
+
+				last = stats
+				c.observeMemory(stats)
+			})
+
+			// The stream ends when the container stops, which also happens
+			// between the stages of the job, so it's reopened until we're done.
+			if err != nil && ctx.Err() == nil {
+				logger.WithError(err).Debugln("Streaming container stats failed")
+			}
+
+			select {
+			case <-ctx.Done():
+			case <-time.After(resourceUsageRetryInterval):
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-done
+
+		if last != nil {
+			c.addCounters(last)
+		}
+	}
+}
+
+func (c *resourceUsageCollector) observeMemory(stats *types.StatsJSON) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, value := range []uint64{
+		stats.MemoryStats.Usage,
+		stats.MemoryStats.MaxUsage,
+		stats.MemoryStats.PrivateWorkingSet,
+	} {
+		if value > c.usage.PeakMemoryBytes {
+			c.usage.PeakMemoryBytes = value
+		}
+	}
+}
+
+func (c *resourceUsageCollector) addCounters(stats *types.StatsJSON) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.usage.CPUSeconds += time.Duration(stats.CPUStats.CPUUsage.TotalUsage).Seconds()
+
+	for _, entry := range stats.BlkioStats.IoServiceBytesRecursive {
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			c.usage.Disk.InBytes += entry.Value
+		case "write":
+			c.usage.Disk.OutBytes += entry.Value
+		}
+	}
+	c.usage.Disk.Add(common.ResourceUsageIO{
+		InBytes:  stats.StorageStats.ReadSizeBytes,
+		OutBytes: stats.StorageStats.WriteSizeBytes,
+	})
+
+	for _, network := range stats.Networks {
+		c.usage.Network.Add(common.ResourceUsageIO{
+			InBytes:  network.RxBytes,
+			OutBytes: network.TxBytes,
+		})
+	}
+}
+
+func (c *resourceUsageCollector) get() *common.ResourceUsage {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	usage := c.usage
+	disk := *c.usage.Disk
+	network := *c.usage.Network
+	usage.Disk = &disk
+	usage.Network = &network
+
+	return &usage
+}
+
+type statsClient interface {
+	ContainerStats(ctx context.Context, containerID string, stream bool) (types.ContainerStats, error)
+}
+
+func streamContainerStats(
+	ctx context.Context,
+	client statsClient,
+	id string,
+	fn func(stats *types.StatsJSON),
+) error {
+	resp, err := client.ContainerStats(ctx, id, true)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var stats types.StatsJSON
+		err := decoder.Decode(&stats)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		fn(&stats)
+	}
+}
+
+func (e *executor) watchResourceUsage(ctx context.Context, id string) func() {
+	if e.resourceUsage == nil {
+		return func() {}
+	}
+
+	return e.resourceUsage.watch(ctx, e.client, id, e.Build.Log())
+}
+
+// ResourceUsage implements common.ResourceUsageReporter.
+func (e *executor) ResourceUsage() (*common.ResourceUsage, error) {
+	if e.resourceUsage == nil {
+		return nil, nil
+	}
+
+	return e.resourceUsage.get(), nil
+}
+
+func (e *executor) setupResourceUsage() {
+	if e.Build.IsFeatureFlagOn(featureflags.ReportResourceUsage) {
+		e.resourceUsage = newResourceUsageCollector()
+	}
+}
@@ -0,0 +1,125 @@
+//go:build !integration
+
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/docker"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/featureflags"
+)
+
+type containerStatsBody struct {
+	io.Reader
+	closed chan struct{}
+}
+
+func (b *containerStatsBody) Close() error {
+	close(b.closed)
+	return nil
+}
+
+func newContainerStatsBody(t *testing.T, samples ...types.StatsJSON) *containerStatsBody {
+	var body strings.Builder
+	encoder := json.NewEncoder(&body)
+	for _, sample := range samples {
+		require.NoError(t, encoder.Encode(sample))
+	}
+
+	return &containerStatsBody{
+		Reader: strings.NewReader(body.String()),
+		closed: make(chan struct{}),
+	}
+}
+
+func newContainerStatsSample(memory uint64, cpu time.Duration, read, written, rx, tx uint64) types.StatsJSON {
+	sample := types.StatsJSON{
+		Networks: map[string]types.NetworkStats{
+			"eth0": {RxBytes: rx, TxBytes: tx},
+		},
+	}
+	sample.Read = time.Now()
+	sample.MemoryStats.Usage = memory
+	sample.CPUStats.CPUUsage.TotalUsage = uint64(cpu)
+	sample.BlkioStats.IoServiceBytesRecursive = []types.BlkioStatEntry{
+		{Op: "read", Value: read},
+		{Op: "write", Value: written},
+	}
+
+	return sample
+}
+
+func TestResourceUsageCollector(t *testing.T) {
+	bodies := []*containerStatsBody{
+		newContainerStatsBody(
+			t,
+			types.StatsJSON{},
+			newContainerStatsSample(100, time.Second, 10, 20, 30, 40),
+			newContainerStatsSample(300, 2*time.Second, 20, 40, 60, 80),
+			newContainerStatsSample(200, 3*time.Second, 30, 60, 90, 120),
+		),
+		newContainerStatsBody(
+			t,
+			newContainerStatsSample(150, time.Second, 1, 2, 3, 4),
+		),
+	}
+
+	client := docker.NewMockClient(t)
+	for _, body := range bodies {
+		client.On("ContainerStats", mock.Anything, "build", true).
+			Return(types.ContainerStats{Body: body}, nil).
+			Once()
+	}
+
+	collector := newResourceUsageCollector()
+	logger := logrus.New()
+
+	oldRetryInterval := resourceUsageRetryInterval
+	defer func() { resourceUsageRetryInterval = oldRetryInterval }()
+	resourceUsageRetryInterval = time.Hour
+
+	for _, body := range bodies {
+		stop := collector.watch(context.Background(), client, "build", logger)
+		<-body.closed
+		stop()
+	}
+
+	assert.Equal(t, &common.ResourceUsage{
+		PeakMemoryBytes: 300,
+		CPUSeconds:      4,
+		Disk:            &common.ResourceUsageIO{InBytes: 31, OutBytes: 62},
+		Network:         &common.ResourceUsageIO{InBytes: 93, OutBytes: 124},
+	}, collector.get())
+}
+
+func TestExecutorResourceUsage(t *testing.T) {
+	e := &executor{}
+	e.Build = &common.Build{Runner: &common.RunnerConfig{}}
+
+	e.setupResourceUsage()
+	usage, err := e.ResourceUsage()
+	assert.NoError(t, err)
+	assert.Nil(t, usage)
+
+	e.Build.Runner.FeatureFlags = map[string]bool{featureflags.ReportResourceUsage: true}
+
+	e.setupResourceUsage()
+	usage, err = e.ResourceUsage()
+	assert.NoError(t, err)
+	assert.Equal(t, &common.ResourceUsage{
+		Disk:    &common.ResourceUsageIO{},
+		Network: &common.ResourceUsageIO{},
+	}, usage)
+}
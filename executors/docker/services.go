@@ -30,6 +30,10 @@ func (e *executor) createServices() error {
 
 	linksMap := make(map[string]*types.Container)
 
+	if err := e.createBuildKitService(linksMap); err != nil {
+		return err
+	}
+
 	for index, serviceDefinition := range servicesDefinitions {
 		if err := e.createFromServiceDefinition(index, serviceDefinition, linksMap); err != nil {
 			return err
@@ -40,6 +44,10 @@ func (e *executor) createServices() error {
 
 	e.waitForServices()
 
+	if err := e.resetSharedServices(); err != nil {
+		return err
+	}
+
 	if e.networkMode.IsBridge() || e.networkMode.NetworkName() == "" {
 		e.Debugln("Building service links...")
 		e.links = e.buildServiceLinks(linksMap)
@@ -124,30 +132,60 @@ func (e *executor) createFromServiceDefinition(
 		// Create service if not yet created
 		if container == nil {
 			var err error
-			container, err = e.createService(
-				serviceIndex,
-				serviceMeta.Service,
-				serviceMeta.Version,
-				serviceMeta.ImageName,
-				serviceDefinition,
-				serviceMeta.Aliases,
-			)
+			container, err = e.createServiceContainer(serviceIndex, serviceDefinition, serviceMeta)
 			if err != nil {
 				return err
 			}
 
 			e.Debugln("Created service", serviceDefinition.Name, "as", container.ID)
+			if serviceDefinition.ReadinessProbe != nil {
+				if e.serviceReadinessProbes == nil {
+					e.serviceReadinessProbes = make(map[string]*common.ReadinessProbe)
+				}
+				e.serviceReadinessProbes[container.ID] = serviceDefinition.ReadinessProbe
+			}
 			e.services = append(e.services, container)
-			e.temporary = append(e.temporary, container.ID)
 		}
 		linksMap[linkName] = container
 	}
 	return nil
 }
 
+// createServiceContainer reuses a shared service when the service is shared,
+// otherwise it creates a service container removed with the job
+func (e *executor) createServiceContainer(
+	serviceIndex int,
+	serviceDefinition common.Image,
+	serviceMeta services.Service,
+) (*types.Container, error) {
+	container, err := e.createSharedService(serviceDefinition, serviceMeta)
+	if err != nil || container != nil {
+		return container, err
+	}
+
+	container, err = e.createService(
+		serviceIndex,
+		serviceMeta.Service,
+		serviceMeta.Version,
+		serviceMeta.ImageName,
+		serviceDefinition,
+		serviceMeta.Aliases,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	e.temporary = append(e.temporary, container.ID)
+
+	return container, nil
+}
+
 type serviceHealthCheckError struct {
 	Inner error
 	Logs  string
+	// LogsSource describes where the logs come from, the health check
+	// container when empty
+	LogsSource string
 }
 
 func (e *serviceHealthCheckError) Error() string {
@@ -158,7 +196,11 @@ func (e *serviceHealthCheckError) Error() string {
 	return e.Inner.Error()
 }
 
-func (e *executor) runServiceHealthCheckContainer(service *types.Container, timeout time.Duration) error {
+func (e *executor) runServiceHealthCheckContainer(
+	service *types.Container,
+	probe *common.ReadinessProbe,
+	timeout time.Duration,
+) error {
 	waitImage, err := e.getPrebuiltImage()
 	if err != nil {
 		return fmt.Errorf("getPrebuiltImage: %w", err)
@@ -166,7 +208,7 @@ func (e *executor) runServiceHealthCheckContainer(service *types.Container, time
 
 	containerName := service.Names[0] + "-wait-for-service"
 
-	environment, err := e.addServiceHealthCheckEnvironment(service)
+	environment, err := e.createServiceHealthCheckEnvironment(service, probe)
 	if err != nil {
 		return err
 	}
@@ -181,6 +223,7 @@ func (e *executor) runServiceHealthCheckContainer(service *types.Container, time
 	if err != nil {
 		return fmt.Errorf("create service container: %w", err)
 	}
+	e.recordContainer(resp.ID)
 	defer func() { _ = e.removeContainer(e.Context, resp.ID) }()
 
 	e.Debugln(fmt.Sprintf("Starting service healthcheck container %s (%s)...", containerName, resp.ID))
@@ -224,7 +267,7 @@ func (e *executor) createConfigForServiceHealthCheckContainer(
 }
 
 func (e *executor) waitForServiceContainer(service *types.Container, timeout time.Duration) error {
-	err := e.runServiceHealthCheckContainer(service, timeout)
+	err := e.runServiceReadinessProbe(service, timeout)
 	if err == nil {
 		return nil
 	}
@@ -240,8 +283,13 @@ func (e *executor) waitForServiceContainer(service *types.Container, timeout tim
 	buffer.WriteString("\n")
 
 	if healtCheckErr, ok := err.(*serviceHealthCheckError); ok {
+		logsSource := healtCheckErr.LogsSource
+		if logsSource == "" {
+			logsSource = "Health check container logs"
+		}
+
 		buffer.WriteString("\n")
-		buffer.WriteString("Health check container logs:\n")
+		buffer.WriteString(logsSource + ":\n")
 		buffer.WriteString(healtCheckErr.Logs)
 		buffer.WriteString("\n")
 	}
@@ -278,7 +326,9 @@ func (e *executor) captureContainersLogs(ctx context.Context, linksMap map[strin
 		}
 
 		sink := service_helpers.NewInlineServiceLogWriter(strings.Join(aliases, "-"), e.Trace)
-		if err := e.captureContainerLogs(ctx, service.ID, service.Names[0], sink); err != nil {
+		// the history of a shared service holds the logs of the other jobs
+		since := e.sharedServiceAttachTime(service.ID)
+		if err := e.captureContainerLogs(ctx, service.ID, service.Names[0], since, sink); err != nil {
 			e.Warningln(err.Error())
 		}
 	}
@@ -289,14 +339,25 @@ func (e *executor) captureContainersLogs(ctx context.Context, linksMap map[strin
 // sink, which can be any io.Writer (e.g. this process's stdout, a file, a log
 // aggregator). The logs are streamed as they are emitted, rather than batched
 // and written when we disconnect from the container (or it is stopped). The
-// specified sink is closed when the source is completely drained.
-func (e *executor) captureContainerLogs(ctx context.Context, cid, containerName string, sink io.WriteCloser) error {
-	source, err := e.client.ContainerLogs(ctx, cid, types.ContainerLogsOptions{
+// specified sink is closed when the source is completely drained. When since
+// isn't zero, only the logs emitted after it are read.
+func (e *executor) captureContainerLogs(
+	ctx context.Context,
+	cid, containerName string,
+	since time.Time,
+	sink io.WriteCloser,
+) error {
+	options := types.ContainerLogsOptions{
 		ShowStderr: true,
 		ShowStdout: true,
 		Timestamps: true,
 		Follow:     true,
-	})
+	}
+	if !since.IsZero() {
+		options.Since = since.Format(time.RFC3339Nano)
+	}
+
+	source, err := e.client.ContainerLogs(ctx, cid, options)
 	if err != nil {
 		return fmt.Errorf("failed to open log stream for container %s: %w", containerName, err)
 	}
@@ -840,7 +840,7 @@ func Test_Executor_captureContainerLogs(t *testing.T) {
 
 			ctx := context.Background()
 			c.On("ContainerLogs", ctx, cID, mock.Anything).Return(pr, tt.wantErr).Once()
-			err = e.captureContainerLogs(ctx, cID, cName, isw)
+			err = e.captureContainerLogs(ctx, cID, cName, time.Time{}, isw)
 
 			if tt.wantErr != nil {
 				require.Error(t, err)
@@ -0,0 +1,458 @@
+package docker
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/sirupsen/logrus"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/container/services"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/docker"
+)
+
+const labelSharedServiceType = "shared-service"
+
+// sharedServiceResetVariables are the job variables passed to the reset
+// command of the shared services, to create per-job state
+var sharedServiceResetVariables = []string{
+	"CI_JOB_ID",
+	"CI_PIPELINE_ID",
+	"CI_PROJECT_ID",
+	"CI_COMMIT_REF_SLUG",
+}
+
+var newSharedServicesDockerClient = func(config *common.DockerConfig) (docker.Client, error) {
+	return docker.New(config.Credentials)
+}
+
+// sharedServices is shared by all the jobs handled by this process
+var sharedServices = newSharedServiceRegistry()
+
+// sharedService is a service container started by a job, and reused by the
+// next jobs of the project that define the same service
+type sharedService struct {
+	key string
+
+	// lock is held while the container is checked and created, so that
+	// concurrent jobs don't start the same service twice
+	lock      sync.Mutex
+	container *types.Container
+
+	refs    int
+	removal *time.Timer
+}
+
+type sharedServiceRegistry struct {
+	lock     sync.Mutex
+	services map[string]*sharedService
+}
+
+func newSharedServiceRegistry() *sharedServiceRegistry {
+	return &sharedServiceRegistry{
+		services: make(map[string]*sharedService),
+	}
+}
+
+// acquire returns the shared service with the key, and cancels its pending
+// removal
+func (r *sharedServiceRegistry) acquire(key string) *sharedService {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	s, ok := r.services[key]
+	if !ok {
+		s = &sharedService{key: key}
+		r.services[key] = s
+	}
+
+	s.refs++
+	if s.removal != nil {
+		s.removal.Stop()
+		s.removal = nil
+	}
+
+	return s
+}
+
+// release schedules the removal of the service container after the TTL, when
+// it's no longer used by any job
+func (r *sharedServiceRegistry) release(s *sharedService, ttl time.Duration, remove func(id string)) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	s.refs--
+	if s.refs > 0 {
+		return
+	}
+
+	if s.container == nil {
+		delete(r.services, s.key)
+		return
+	}
+
+	id := s.container.ID
+	s.removal = time.AfterFunc(ttl, func() {
+		r.lock.Lock()
+		if s.refs > 0 || r.services[s.key] != s {
+			r.lock.Unlock()
+			return
+		}
+		delete(r.services, s.key)
+		r.lock.Unlock()
+
+		remove(id)
+	})
+}
+
+// sharedServiceUse is a shared service used by the job
+type sharedServiceUse struct {
+	service      *sharedService
+	resetCommand []string
+	variables    []string
+	// attachedAt is when the job started using the service, the service logs
+	// written before belong to other jobs
+	attachedAt time.Time
+}
+
+// getSharedServiceConfig returns the shared service configuration matching
+// the service image, or nil when the service isn't shared
+func (e *executor) getSharedServiceConfig(image string) *common.DockerSharedService {
+	// shared services outlive the job's network, so they can't be restricted
+	// by the job's egress policy
+	if e.Config.Docker.SharedServices == nil || e.isEgressPolicyEnabled() {
+		return nil
+	}
+
+	for i, service := range e.Config.Docker.SharedServices.Services {
+		ok, _ := doublestar.Match(service.Image, image)
+		if ok {
+			return &e.Config.Docker.SharedServices.Services[i]
+		}
+	}
+
+	return nil
+}
+
+// getSharedServiceVariables returns the variables of the shared service. The
+// predefined variables are left out, as they change with every job.
+func (e *executor) getSharedServiceVariables(serviceDefinition common.Image) []string {
+	var variables []string
+	for _, variable := range e.getServiceVariables(serviceDefinition) {
+		if strings.HasPrefix(variable, "CI_") || strings.HasPrefix(variable, "GITLAB_") {
+			continue
+		}
+
+		variables = append(variables, variable)
+	}
+
+	sort.Strings(variables)
+
+	return variables
+}
+
+// sharedServiceKey identifies the shared services that can be reused: the
+// ones started by the same runner, for the same project, with the same
+// service definition
+func (e *executor) sharedServiceKey(serviceDefinition common.Image, variables []string) string {
+	hash := sha256.New()
+	for _, part := range [][]string{
+		{e.Config.Docker.Host, e.Config.ShortDescription(), strconv.FormatInt(e.Build.JobInfo.ProjectID, 10)},
+		{serviceDefinition.Name},
+		serviceDefinition.Command,
+		serviceDefinition.Entrypoint,
+		variables,
+	} {
+		for _, value := range part {
+			_, _ = fmt.Fprintf(hash, "%q\n", value)
+		}
+		_, _ = hash.Write([]byte{0})
+	}
+
+	return fmt.Sprintf("%x", hash.Sum(nil))
+}
+
+// createSharedService returns the shared service container for the service
+// definition, starting it when it isn't running yet. It returns nil when the
+// service isn't shared.
+func (e *executor) createSharedService(
+	serviceDefinition common.Image,
+	serviceMeta services.Service,
+) (*types.Container, error) {
+	config := e.getSharedServiceConfig(serviceDefinition.Name)
+	if config == nil {
+		return nil, nil
+	}
+
+	variables := e.getSharedServiceVariables(serviceDefinition)
+	key := e.sharedServiceKey(serviceDefinition, variables)
+
+	for _, use := range e.sharedServices {
+		if use.service.key == key {
+			e.Warningln("Service", serviceDefinition.Name, "is already shared with this job. Starting a new one.")
+			return nil, nil
+		}
+	}
+
+	s := sharedServices.acquire(key)
+	e.sharedServices = append(e.sharedServices, sharedServiceUse{
+		service:      s,
+		resetCommand: config.ResetCommand,
+		variables:    variables,
+		attachedAt:   time.Now(),
+	})
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.container != nil && !e.isSharedServiceRunning(s.container.ID) {
+		e.Debugln("Shared service container", s.container.ID, "isn't running anymore")
+		_ = e.removeContainer(e.Context, s.container.ID)
+		s.container = nil
+	}
+
+	if s.container != nil {
+		e.Println("Using shared service", serviceMeta.Service+":"+serviceMeta.Version, "...")
+		err := e.connectSharedService(s.container.ID, serviceMeta.Aliases)
+		if err != nil {
+			return nil, err
+		}
+
+		return s.container, nil
+	}
+
+	c, err := e.createSharedServiceContainer(serviceDefinition, serviceMeta, variables, key)
+	if err != nil {
+		return nil, err
+	}
+
+	s.container = c
+
+	return c, nil
+}
+
+func (e *executor) isSharedServiceRunning(id string) bool {
+	inspect, err := e.client.ContainerInspect(e.Context, id)
+	if err != nil {
+		return false
+	}
+
+	return inspect.ContainerJSONBase != nil && inspect.State != nil && inspect.State.Running
+}
+
+// connectSharedService connects the shared service to the network created
+// for the job. With the default network, the service is linked to the build
+// container instead.
+func (e *executor) connectSharedService(id string, aliases []string) error {
+	if e.networkMode.UserDefined() == "" || e.Config.Docker.NetworkMode != "" {
+		return nil
+	}
+
+	err := e.client.NetworkConnect(e.Context, e.networkMode.UserDefined(), id, &network.EndpointSettings{Aliases: aliases})
+	if err != nil {
+		return fmt.Errorf("connecting shared service to the job network: %w", err)
+	}
+
+	return nil
+}
+
+func (e *executor) createSharedServiceContainer(
+	serviceDefinition common.Image,
+	serviceMeta services.Service,
+	variables []string,
+	key string,
+) (*types.Container, error) {
+	e.Println("Starting shared service", serviceMeta.Service+":"+serviceMeta.Version, "...")
+	serviceImage, err := e.pullManager.GetDockerImage(serviceMeta.ImageName, serviceDefinition.PullPolicies)
+	if err != nil {
+		return nil, err
+	}
+
+	containerName := fmt.Sprintf(
+		"runner-%s-project-%d-shared-%s",
+		e.Config.ShortDescription(),
+		e.Build.JobInfo.ProjectID,
+		key[:12],
+	)
+
+	// a container left by a previous runner process can't be reused, as its
+	// reset state is unknown
+	_ = e.removeContainer(e.Context, containerName)
+
+	config := &container.Config{
+		Image: serviceImage.ID,
+		Labels: e.labeler.Labels(map[string]string{
+			"type":            labelSharedServiceType,
+			"service":         serviceMeta.Service,
+			"service.version": serviceMeta.Version,
+		}),
+		Env: variables,
+	}
+
+	if len(serviceDefinition.Command) > 0 {
+		config.Cmd = serviceDefinition.Command
+	}
+	config.Entrypoint = e.overwriteEntrypoint(&serviceDefinition)
+
+	hostConfig, err := e.createHostConfigForService()
+	if err != nil {
+		return nil, err
+	}
+	hostConfig.Privileged = hostConfig.Privileged && e.isInPrivilegedServiceList(serviceDefinition)
+	// the job's volumes are removed with the job, they can't be mounted in
+	// a container that outlives it
+	hostConfig.Binds = nil
+
+	e.Debugln("Creating shared service container", containerName, "...")
+	resp, err := e.client.ContainerCreate(e.Context, config, hostConfig, e.networkConfig(serviceMeta.Aliases), containerName)
+	if err != nil {
+		return nil, err
+	}
+
+	e.Debugln(fmt.Sprintf("Starting shared service container %s (%s)...", containerName, resp.ID))
+	err = e.client.ContainerStart(e.Context, resp.ID, types.ContainerStartOptions{})
+	if err != nil {
+		_ = e.removeContainer(e.Context, resp.ID)
+		return nil, err
+	}
+
+	return fakeContainer(resp.ID, containerName), nil
+}
+
+// resetSharedServices runs the reset command of the shared services used by
+// the job, so that the job starts with a fresh state
+func (e *executor) resetSharedServices() error {
+	allVariables := e.Build.GetAllVariables()
+
+	for _, use := range e.sharedServices {
+		if len(use.resetCommand) == 0 {
+			continue
+		}
+
+		err := e.resetSharedService(use, allVariables)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// resetSharedService runs the reset command of the shared service for the job,
+// even when other jobs use the service. The command sets up the state of this
+// job only, the resets of concurrent jobs run one at a time.
+func (e *executor) resetSharedService(use sharedServiceUse, allVariables common.JobVariables) error {
+	use.service.lock.Lock()
+	defer use.service.lock.Unlock()
+
+	c := use.service.container
+	if c == nil {
+		return nil
+	}
+
+	env := append([]string{}, use.variables...)
+	for _, name := range sharedServiceResetVariables {
+		env = append(env, name+"="+allVariables.Value(name))
+	}
+
+	e.Debugln("Resetting shared service", c.Names[0], "...")
+	output, err := e.execServiceCommand(e.Context, c.ID, use.resetCommand, env)
+	if err != nil {
+		return &common.BuildError{
+			Inner: fmt.Errorf(
+				"resetting shared service %s: %w: %s",
+				c.Names[0],
+				err,
+				strings.TrimSpace(output),
+			),
+			FailureReason: common.RunnerSystemFailure,
+		}
+	}
+
+	return nil
+}
+
+// sharedServiceAttachTime returns when the job started using the shared
+// service container, or the zero time when the container isn't shared
+func (e *executor) sharedServiceAttachTime(id string) time.Time {
+	for _, use := range e.sharedServices {
+		use.service.lock.Lock()
+		c := use.service.container
+		use.service.lock.Unlock()
+
+		if c != nil && c.ID == id {
+			return use.attachedAt
+		}
+	}
+
+	return time.Time{}
+}
+
+// releaseSharedServices disconnects the shared services from the job network,
+// so that it can be removed, and schedules their removal once no job uses them
+func (e *executor) releaseSharedServices(ctx context.Context) {
+	if len(e.sharedServices) == 0 {
+		return
+	}
+
+	ttl, err := e.Config.Docker.SharedServices.GetTTL()
+	if err != nil {
+		e.Warningln("Using the default shared services TTL:", err)
+		ttl = common.DefaultDockerSharedServicesTTL
+	}
+
+	for _, use := range e.sharedServices {
+		use.service.lock.Lock()
+		c := use.service.container
+		use.service.lock.Unlock()
+
+		if c != nil && e.networkMode.UserDefined() != "" && e.Config.Docker.NetworkMode == "" {
+			err := e.client.NetworkDisconnect(ctx, e.networkMode.UserDefined(), c.ID, true)
+			if err != nil && !docker.IsErrNotFound(err) {
+				e.Warningln("Failed to disconnect shared service", c.Names[0], "from the job network:", err)
+			}
+		}
+
+		sharedServices.release(use.service, ttl, e.removeSharedServiceFunc())
+	}
+
+	e.sharedServices = nil
+}
+
+// removeSharedServiceFunc returns the function removing the shared service
+// containers after their TTL. It uses its own client, as the job's client is
+// closed by then.
+func (e *executor) removeSharedServiceFunc() func(id string) {
+	config := e.Config.Docker
+	logger := logrus.WithField("runner", e.Config.ShortDescription())
+
+	return func(id string) {
+		ctx, cancel := context.WithTimeout(context.Background(), dockerCleanupTimeout)
+		defer cancel()
+
+		client, err := newSharedServicesDockerClient(config)
+		if err != nil {
+			logger.WithError(err).Warningln("Failed to connect to Docker to remove shared service")
+			return
+		}
+		defer client.Close()
+
+		err = client.ContainerRemove(ctx, id, types.ContainerRemoveOptions{RemoveVolumes: true, Force: true})
+		if err != nil && !docker.IsErrNotFound(err) {
+			logger.WithError(err).WithField("container", id).Warningln("Failed to remove shared service")
+			return
+		}
+
+		logger.WithField("container", id).Debugln("Removed shared service")
+	}
+}
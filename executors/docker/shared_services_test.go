@@ -0,0 +1,225 @@
+//go:build !integration
+
+package docker
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/container/services"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/docker"
+)
+
+func TestSharedServiceRegistry(t *testing.T) {
+	r := newSharedServiceRegistry()
+	removed := make(chan string, 1)
+	remove := func(id string) { removed <- id }
+
+	s := r.acquire("key")
+	s.container = &types.Container{ID: "shared-id"}
+
+	assert.Same(t, s, r.acquire("key"), "the same service is returned while it's used")
+	r.release(s, time.Millisecond, remove)
+	assert.Empty(t, removed, "the service is kept while it's used by another job")
+
+	r.release(s, time.Hour, remove)
+	assert.Same(t, s, r.acquire("key"), "a pending removal is canceled when the service is reused")
+
+	r.release(s, time.Millisecond, remove)
+	select {
+	case id := <-removed:
+		assert.Equal(t, "shared-id", id)
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "shared service wasn't removed after its TTL")
+	}
+
+	assert.NotSame(t, s, r.acquire("key"), "a removed service isn't reused")
+}
+
+func TestSharedServiceRegistryReleaseWithoutContainer(t *testing.T) {
+	r := newSharedServiceRegistry()
+
+	s := r.acquire("key")
+	r.release(s, time.Hour, func(string) { require.Fail(t, "nothing to remove") })
+
+	assert.Empty(t, r.services)
+}
+
+func newSharedServicesTestExecutor(c docker.Client) *executor {
+	e := &executor{
+		AbstractExecutor: executors.AbstractExecutor{
+			Build: &common.Build{
+				JobResponse: common.JobResponse{
+					ID:      42,
+					JobInfo: common.JobInfo{ProjectID: 7},
+					Variables: common.JobVariables{
+						{Key: "CI_JOB_ID", Value: "42", Public: true},
+						{Key: "POSTGRES_DB", Value: "test", Public: true},
+					},
+				},
+				Runner: &common.RunnerConfig{},
+			},
+			Config: common.RunnerConfig{
+				RunnerSettings: common.RunnerSettings{
+					Docker: &common.DockerConfig{
+						SharedServices: &common.DockerSharedServicesConfig{
+							Services: []common.DockerSharedService{
+								{Image: "postgres:*", ResetCommand: []string{"reset-db"}},
+							},
+						},
+					},
+				},
+			},
+			Context: context.Background(),
+		},
+		client:      c,
+		networkMode: container.NetworkMode("runner-network"),
+	}
+
+	return e
+}
+
+func TestSharedServicesLifecycle(t *testing.T) {
+	defer func(r *sharedServiceRegistry) { sharedServices = r }(sharedServices)
+	sharedServices = newSharedServiceRegistry()
+
+	c := docker.NewMockClient(t)
+	e := newSharedServicesTestExecutor(c)
+
+	serviceDefinition := common.Image{Name: "postgres:15"}
+	serviceMeta := services.SplitNameAndVersion(serviceDefinition.Name)
+
+	// simulate the service started by a previous job of the project
+	key := e.sharedServiceKey(serviceDefinition, e.getSharedServiceVariables(serviceDefinition))
+	warm := sharedServices.acquire(key)
+	warm.container = &types.Container{ID: "shared-id", Names: []string{"shared-name"}}
+	sharedServices.release(warm, time.Hour, func(string) {})
+
+	c.On("ContainerInspect", e.Context, "shared-id").
+		Return(types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{State: &types.ContainerState{Running: true}},
+		}, nil).
+		Once()
+	c.On("NetworkConnect", e.Context, "runner-network", "shared-id", &network.EndpointSettings{Aliases: serviceMeta.Aliases}).
+		Return(nil).
+		Once()
+
+	shared, err := e.createSharedService(serviceDefinition, serviceMeta)
+	require.NoError(t, err)
+	assert.Equal(t, "shared-id", shared.ID)
+
+	c.On("ContainerExecCreate", e.Context, "shared-id", mock.MatchedBy(func(config types.ExecConfig) bool {
+		return assert.Equal(t, []string{"reset-db"}, config.Cmd) &&
+			assert.Contains(t, config.Env, "CI_JOB_ID=42") &&
+			assert.Contains(t, config.Env, "POSTGRES_DB=test")
+	})).
+		Return(types.IDResponse{ID: "exec-id"}, nil).
+		Once()
+	c.On("ContainerExecAttach", e.Context, "exec-id", types.ExecStartCheck{}).
+		Return(newProbeExecResponse(t, ""), nil).
+		Once()
+	c.On("ContainerExecInspect", e.Context, "exec-id").
+		Return(types.ContainerExecInspect{ExitCode: 0}, nil).
+		Once()
+
+	require.NoError(t, e.resetSharedServices())
+
+	c.On("NetworkDisconnect", mock.Anything, "runner-network", "shared-id", true).
+		Return(nil).
+		Once()
+
+	e.releaseSharedServices(context.Background())
+
+	assert.Empty(t, e.sharedServices)
+	assert.NotNil(t, sharedServices.services[key].removal, "the service is kept warm for its TTL")
+}
+
+func TestResetSharedServiceUsedByAnotherJob(t *testing.T) {
+	defer func(r *sharedServiceRegistry) { sharedServices = r }(sharedServices)
+	sharedServices = newSharedServiceRegistry()
+
+	c := docker.NewMockClient(t)
+	e := newSharedServicesTestExecutor(c)
+
+	s := sharedServices.acquire("key")
+	s.container = &types.Container{ID: "shared-id", Names: []string{"shared-name"}}
+	e.sharedServices = []sharedServiceUse{{service: s, resetCommand: []string{"reset-db"}}}
+
+	// the service is used by another job
+	other := sharedServices.acquire("key")
+	defer sharedServices.release(other, time.Hour, func(string) {})
+
+	// the job gets its own state even though the service is shared
+	c.On("ContainerExecCreate", e.Context, "shared-id", mock.MatchedBy(func(config types.ExecConfig) bool {
+		return assert.Equal(t, []string{"reset-db"}, config.Cmd) &&
+			assert.Contains(t, config.Env, "CI_JOB_ID=42")
+	})).
+		Return(types.IDResponse{ID: "exec-id"}, nil).
+		Once()
+	c.On("ContainerExecAttach", e.Context, "exec-id", types.ExecStartCheck{}).
+		Return(newProbeExecResponse(t, ""), nil).
+		Once()
+	c.On("ContainerExecInspect", e.Context, "exec-id").
+		Return(types.ContainerExecInspect{ExitCode: 0}, nil).
+		Once()
+
+	require.NoError(t, e.resetSharedServices())
+}
+
+func TestCaptureSharedServiceLogsSinceAttached(t *testing.T) {
+	c := docker.NewMockClient(t)
+	e := newSharedServicesTestExecutor(c)
+	e.Build.Variables = append(e.Build.Variables, common.JobVariable{Key: "CI_DEBUG_SERVICES", Value: "true"})
+	e.BuildLogger = common.NewBuildLogger(&common.Trace{Writer: io.Discard}, logrus.WithFields(logrus.Fields{}))
+
+	attachedAt := time.Date(2023, 6, 1, 12, 0, 0, 0, time.UTC)
+	shared := &types.Container{ID: "shared-id", Names: []string{"shared-name"}}
+	own := &types.Container{ID: "own-id", Names: []string{"own-name"}}
+
+	e.services = []*types.Container{shared, own}
+	e.sharedServices = []sharedServiceUse{{service: &sharedService{container: shared}, attachedAt: attachedAt}}
+
+	c.On("ContainerLogs", e.Context, "shared-id", mock.MatchedBy(func(options types.ContainerLogsOptions) bool {
+		return options.Since == "2023-06-01T12:00:00Z"
+	})).Return(nil, assert.AnError).Once()
+	c.On("ContainerLogs", e.Context, "own-id", mock.MatchedBy(func(options types.ContainerLogsOptions) bool {
+		return options.Since == ""
+	})).Return(nil, assert.AnError).Once()
+
+	e.captureContainersLogs(e.Context, map[string]*types.Container{"shared": shared, "own": own})
+}
+
+func TestCreateSharedServiceNotShared(t *testing.T) {
+	e := newSharedServicesTestExecutor(docker.NewMockClient(t))
+
+	serviceDefinition := common.Image{Name: "redis:7"}
+	shared, err := e.createSharedService(serviceDefinition, services.SplitNameAndVersion(serviceDefinition.Name))
+	require.NoError(t, err)
+	assert.Nil(t, shared)
+	assert.Empty(t, e.sharedServices)
+}
+
+func TestSharedServiceKey(t *testing.T) {
+	e := newSharedServicesTestExecutor(nil)
+	serviceDefinition := common.Image{Name: "postgres:15"}
+	key := e.sharedServiceKey(serviceDefinition, []string{"POSTGRES_DB=test"})
+
+	assert.Equal(t, key, e.sharedServiceKey(serviceDefinition, []string{"POSTGRES_DB=test"}))
+	assert.NotEqual(t, key, e.sharedServiceKey(serviceDefinition, []string{"POSTGRES_DB=other"}))
+	assert.NotEqual(t, key, e.sharedServiceKey(common.Image{Name: "postgres:16"}, []string{"POSTGRES_DB=test"}))
+
+	e.Build.JobInfo.ProjectID = 8
+	assert.NotEqual(t, key, e.sharedServiceKey(serviceDefinition, []string{"POSTGRES_DB=test"}))
+}
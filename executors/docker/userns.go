@@ -0,0 +1,34 @@
+package docker
+
+import (
+	"github.com/docker/docker/api/types"
+)
+
+const (
+	securityOptionRootless = "rootless"
+	securityOptionUserns   = "userns"
+)
+
+// isDaemonUserNamespaced returns true when the Docker daemon runs in rootless
+// mode or with user namespace remapping. In both cases the container's root
+// user is mapped to an unprivileged user on the host, so files created by the
+// helper container aren't writable by a non-root user of the build image.
+func isDaemonUserNamespaced(info types.Info) bool {
+	// User namespaces aren't supported by the docker-windows executor
+	if info.OSType == osTypeWindows {
+		return false
+	}
+
+	options, err := types.DecodeSecurityOptions(info.SecurityOptions)
+	if err != nil {
+		return false
+	}
+
+	for _, option := range options {
+		if option.Name == securityOptionRootless || option.Name == securityOptionUserns {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,177 @@
+//go:build !integration
+
+package docker
+
+import (
+	"context"
+	"io"
+	"os"
+	osexec "os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/docker/internal/exec"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/docker/internal/volumes"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/docker"
+)
+
+func TestIsDaemonUserNamespaced(t *testing.T) {
+	tests := map[string]struct {
+		info     types.Info
+		expected bool
+	}{
+		"default daemon": {
+			info: types.Info{
+				OSType:          osTypeLinux,
+				SecurityOptions: []string{"name=seccomp,profile=builtin", "name=cgroupns"},
+			},
+			expected: false,
+		},
+		"rootless daemon": {
+			info: types.Info{
+				OSType:          osTypeLinux,
+				SecurityOptions: []string{"name=seccomp,profile=builtin", "name=rootless", "name=cgroupns"},
+			},
+			expected: true,
+		},
+		"userns-remapped daemon": {
+			info: types.Info{
+				OSType:          osTypeLinux,
+				SecurityOptions: []string{"name=apparmor", "name=userns"},
+			},
+			expected: true,
+		},
+		"windows daemon": {
+			info: types.Info{
+				OSType:          osTypeWindows,
+				SecurityOptions: []string{"name=userns"},
+			},
+			expected: false,
+		},
+		"invalid security options": {
+			info: types.Info{
+				OSType:          osTypeLinux,
+				SecurityOptions: []string{"name=userns,invalid"},
+			},
+			expected: false,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			assert.Equal(t, tt.expected, isDaemonUserNamespaced(tt.info))
+		})
+	}
+}
+
+func TestExecuteChown(t *testing.T) {
+	const cacheChown = `[ "$(stat -c %u:%g "/cache")" = "1000:1000" ] || chown -RP -- 1000:1000 "/cache"`
+
+	tests := map[string]struct {
+		info             types.Info
+		expectedCommands []string
+	}{
+		"default daemon": {
+			info: types.Info{OSType: osTypeLinux},
+			expectedCommands: []string{
+				`chown -RP -- 1000:1000 "/builds/project"`,
+				`chown -RP -- 1000:1000 "/builds/project.tmp"`,
+			},
+		},
+		"userns-remapped daemon": {
+			info: types.Info{OSType: osTypeLinux, SecurityOptions: []string{"name=userns"}},
+			expectedCommands: []string{
+				`chown -RP -- 1000:1000 "/builds/project"`,
+				`chown -RP -- 1000:1000 "/builds/project.tmp"`,
+				cacheChown,
+			},
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			c := docker.NewMockClient(t)
+			dockerExec := exec.NewMockDocker(t)
+			volumesManager := volumes.NewMockManager(t)
+
+			e := &commandExecutor{
+				executor: executor{
+					AbstractExecutor: executors.AbstractExecutor{
+						Build: &common.Build{
+							Runner:   &common.RunnerConfig{},
+							BuildDir: "/builds/project",
+						},
+						BuildLogger: common.NewBuildLogger(&common.Trace{Writer: io.Discard}, logrus.WithFields(logrus.Fields{})),
+						Context:     context.Background(),
+					},
+					client:         c,
+					info:           tt.info,
+					volumesManager: volumesManager,
+				},
+				helperContainer: &types.ContainerJSON{ContainerJSONBase: &types.ContainerJSONBase{ID: "helper-id"}},
+			}
+
+			c.On("ContainerInspect", e.Context, "helper-id").Return(types.ContainerJSON{}, nil)
+			if isDaemonUserNamespaced(tt.info) {
+				volumesManager.On("CacheDestinations").Return([]string{"/cache"}).Once()
+			}
+
+			var commands []string
+			dockerExec.On("Exec", e.Context, "helper-id", mock.Anything).
+				Run(func(args mock.Arguments) {
+					command, err := io.ReadAll(args.Get(2).(exec.IOStreams).Stdin)
+					require.NoError(t, err)
+					commands = append(commands, string(command))
+				}).
+				Return(nil)
+
+			require.NoError(t, e.executeChown(dockerExec, 1000, 1000))
+			assert.Equal(t, tt.expectedCommands, commands)
+		})
+	}
+}
+
+func TestChangeFilesOwnershipNotNeeded(t *testing.T) {
+	// the umask is used and the daemon isn't user namespaced, so neither the
+	// client nor the volumes manager are used
+	e := &commandExecutor{
+		executor: executor{
+			AbstractExecutor: executors.AbstractExecutor{
+				Build: &common.Build{Runner: &common.RunnerConfig{}},
+			},
+			client:         docker.NewMockClient(t),
+			info:           types.Info{OSType: osTypeLinux},
+			volumesManager: volumes.NewMockManager(t),
+		},
+	}
+
+	assert.NoError(t, e.changeFilesOwnership())
+}
+
+func TestCacheChownCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the command runs in Linux helper containers")
+	}
+
+	dir := t.TempDir()
+	uid, gid := os.Getuid(), os.Getgid()
+
+	// the volume is already owned by the user, so chown isn't executed
+	out, err := osexec.Command("sh", "-c", cacheChownCommand(uid, gid, dir)).CombinedOutput()
+	assert.NoError(t, err, string(out))
+	assert.Empty(t, string(out))
+
+	// chown is executed, and fails, for a volume that isn't owned by the user
+	out, err = osexec.Command("sh", "-c", cacheChownCommand(uid+1, gid, filepath.Join(dir, "missing"))).CombinedOutput()
+	assert.Error(t, err)
+	assert.Contains(t, string(out), "chown")
+}
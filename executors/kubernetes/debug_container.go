@@ -0,0 +1,117 @@
+package kubernetes
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"golang.org/x/net/context"
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const debugContainerPrefix = "debug"
+
+func (s *executor) isDebugContainerEnabled() bool {
+	return s.Config.Kubernetes.DebugContainer != nil && s.Config.Kubernetes.DebugContainer.Image != ""
+}
+
+// startDebugContainer adds an ephemeral container to the build pod for an
+// interactive terminal session, like kubectl debug does. The container targets
+// the build container, so its processes and their filesystem under
+// /proc/<pid>/root are visible even when the build image has no shell. An
+// ephemeral container can't be restarted nor removed, each session gets its own
+// container, which terminates when the session's shell exits.
+func (s *executor) startDebugContainer(ctx context.Context) (string, error) {
+	if s.pod == nil {
+		return "", errors.New("the build pod isn't running")
+	}
+
+	config := s.Config.Kubernetes.DebugContainer
+	pods := s.kubeClient.CoreV1().Pods(s.pod.Namespace)
+
+	pod, err := pods.Get(ctx, s.pod.Name, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("getting pod: %w", err)
+	}
+
+	container := api.EphemeralContainer{
+		EphemeralContainerCommon: api.EphemeralContainerCommon{
+			Name:                     generateNameForK8sResources(debugContainerPrefix),
+			Image:                    s.ExpandValue(config.Image),
+			Command:                  config.GetCommand(),
+			Stdin:                    true,
+			TTY:                      true,
+			TerminationMessagePolicy: api.TerminationMessageReadFile,
+		},
+		TargetContainerName: buildContainerName,
+	}
+
+	// the debug container sees the files of the job through the volumes of the
+	// build container
+	for _, c := range pod.Spec.Containers {
+		if c.Name == buildContainerName {
+			container.VolumeMounts = debugContainerVolumeMounts(c.VolumeMounts)
+			container.WorkingDir = c.WorkingDir
+		}
+	}
+
+	pod.Spec.EphemeralContainers = append(pod.Spec.EphemeralContainers, container)
+	_, err = pods.UpdateEphemeralContainers(ctx, pod.Name, pod, metav1.UpdateOptions{})
+	if err != nil {
+		return "", fmt.Errorf("adding ephemeral container: %w", err)
+	}
+
+	s.Debugln(fmt.Sprintf("Started debug container %s with image %s for the terminal", container.Name, container.Image))
+
+	return container.Name, s.waitForDebugContainer(ctx, container.Name)
+}
+
+// debugContainerVolumeMounts returns the volume mounts of the build container
+// an ephemeral container accepts. The API server rejects the ephemeral
+// containers with subPath mounts, their files are still reachable through
+// /proc/<pid>/root of the build container's processes.
+func debugContainerVolumeMounts(mounts []api.VolumeMount) []api.VolumeMount {
+	var result []api.VolumeMount
+	for _, m := range mounts {
+		if m.SubPath != "" || m.SubPathExpr != "" {
+			continue
+		}
+
+		result = append(result, m)
+	}
+
+	return result
+}
+
+func (s *executor) waitForDebugContainer(ctx context.Context, name string) error {
+	pollInterval := time.Duration(s.Config.Kubernetes.GetPollInterval()) * time.Second
+
+	for {
+		pod, err := s.kubeClient.CoreV1().Pods(s.pod.Namespace).Get(ctx, s.pod.Name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("getting pod: %w", err)
+		}
+
+		for _, status := range pod.Status.EphemeralContainerStatuses {
+			if status.Name != name {
+				continue
+			}
+
+			switch {
+			case status.State.Running != nil:
+				return nil
+			case status.State.Terminated != nil:
+				return fmt.Errorf("debug container %s terminated: %s", name, status.State.Terminated.Reason)
+			case status.State.Waiting != nil && isImagePullReason(status.State.Waiting.Reason):
+				return fmt.Errorf("debug container %s: %s", name, status.State.Waiting.Message)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for debug container %s: %w", name, ctx.Err())
+		case <-time.After(pollInterval):
+		}
+	}
+}
@@ -0,0 +1,141 @@
+//go:build !integration
+
+package kubernetes
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/rest/fake"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+func TestStartDebugContainer(t *testing.T) {
+	tests := map[string]struct {
+		state         api.ContainerState
+		expectedError string
+	}{
+		"running": {
+			state: api.ContainerState{Running: &api.ContainerStateRunning{}},
+		},
+		"image pull failure": {
+			state: api.ContainerState{Waiting: &api.ContainerStateWaiting{
+				Reason:  "ErrImagePull",
+				Message: `pull access denied for "busybox:missing"`,
+			}},
+			expectedError: `pull access denied for "busybox:missing"`,
+		},
+		"terminated": {
+			state:         api.ContainerState{Terminated: &api.ContainerStateTerminated{Reason: "Error"}},
+			expectedError: "terminated: Error",
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			version, codec := testVersionAndCodec()
+
+			pod := &api.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "build-pod", Namespace: "ci"},
+				Spec: api.PodSpec{
+					Containers: []api.Container{
+						{
+							Name:       buildContainerName,
+							WorkingDir: "/builds/project",
+							VolumeMounts: []api.VolumeMount{
+								{Name: "repo", MountPath: "/builds"},
+								{Name: "snapshots", MountPath: "/builds/project", SubPath: "project"},
+								{Name: "user-volume", MountPath: "/data", SubPathExpr: "$(POD_NAME)"},
+							},
+						},
+						{Name: helperContainerName},
+					},
+				},
+			}
+
+			var added *api.EphemeralContainer
+			client := testKubernetesClient(version, fake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+				header := map[string][]string{"Content-Type": {"application/json"}}
+
+				switch p, m := req.URL.Path, req.Method; {
+				case p == "/api/v1/namespaces/ci/pods/build-pod" && m == http.MethodGet:
+					return &http.Response{StatusCode: http.StatusOK, Header: header, Body: objBody(codec, pod)}, nil
+				case p == "/api/v1/namespaces/ci/pods/build-pod/ephemeralcontainers" && m == http.MethodPut:
+					body, _ := io.ReadAll(req.Body)
+					updated := &api.Pod{}
+					require.NoError(t, json.Unmarshal(body, updated))
+					require.Len(t, updated.Spec.EphemeralContainers, 1)
+
+					added = &updated.Spec.EphemeralContainers[0]
+					pod = updated
+					pod.Status.EphemeralContainerStatuses = []api.ContainerStatus{{Name: added.Name, State: tt.state}}
+
+					return &http.Response{StatusCode: http.StatusOK, Header: header, Body: objBody(codec, pod)}, nil
+				}
+
+				t.Errorf("unexpected request: %s %s", req.Method, req.URL)
+				return nil, nil
+			}))
+
+			e := newExecutor()
+			e.kubeClient = client
+			e.pod = &api.Pod{ObjectMeta: metav1.ObjectMeta{Name: "build-pod", Namespace: "ci"}}
+			e.Build = &common.Build{Runner: &common.RunnerConfig{}}
+			e.Config.Kubernetes = &common.KubernetesConfig{
+				PollInterval: 1,
+				DebugContainer: &common.KubernetesDebugContainerConfig{
+					Image: "busybox:latest",
+				},
+			}
+			e.BuildLogger = common.NewBuildLogger(&common.Trace{Writer: io.Discard}, e.Build.Log())
+
+			require.True(t, e.isDebugContainerEnabled())
+
+			name, err := e.startDebugContainer(context.Background())
+			if tt.expectedError != "" {
+				assert.ErrorContains(t, err, tt.expectedError)
+			} else {
+				require.NoError(t, err)
+			}
+
+			require.NotNil(t, added)
+			assert.Equal(t, added.Name, name)
+			assert.True(t, strings.HasPrefix(name, debugContainerPrefix+"-"))
+			assert.Equal(t, "busybox:latest", added.Image)
+			assert.Equal(t, []string{"sh"}, added.Command)
+			assert.True(t, added.Stdin)
+			assert.True(t, added.TTY)
+			assert.Equal(t, buildContainerName, added.TargetContainerName)
+			assert.Equal(t, "/builds/project", added.WorkingDir)
+			assert.Equal(t, []api.VolumeMount{{Name: "repo", MountPath: "/builds"}}, added.VolumeMounts)
+		})
+	}
+}
+
+func TestGetTerminalWebSocketURL(t *testing.T) {
+	version, _ := testVersionAndCodec()
+
+	e := newExecutor()
+	e.kubeClient = testKubernetesClient(version, fake.CreateHTTPClient(nil))
+	e.pod = &api.Pod{ObjectMeta: metav1.ObjectMeta{Name: "build-pod", Namespace: "ci"}}
+
+	execURL := e.getTerminalWebSocketURL(buildContainerName)
+	assert.Equal(t, "/api/v1/namespaces/ci/pods/build-pod/exec", execURL.Path)
+	assert.Equal(t, []string{"sh", "-c", "bash || sh"}, execURL.Query()["command"])
+	assert.Equal(t, buildContainerName, execURL.Query().Get("container"))
+
+	attachURL := e.getTerminalWebSocketURL("debug-abcdefgh")
+	assert.Equal(t, "/api/v1/namespaces/ci/pods/build-pod/attach", attachURL.Path)
+	assert.Empty(t, attachURL.Query()["command"])
+	assert.Equal(t, "debug-abcdefgh", attachURL.Query().Get("container"))
+	assert.Equal(t, "true", attachURL.Query().Get("tty"))
+}
@@ -0,0 +1,433 @@
+package kubernetes
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	api "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/yaml"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/dns"
+)
+
+const (
+	// the labels identify the job namespaces of a runner, a namespace is only
+	// deleted when they match the runner and its job
+	jobNamespaceRunnerLabel = "job-namespace." + k8sAnnotationPrefix + "runner"
+	jobNamespaceJobLabel    = "job-namespace." + k8sAnnotationPrefix + "job"
+
+	// jobNamespaceExpiresAnnotation is the time after which a job namespace
+	// is a leftover, as its job has timed out
+	jobNamespaceExpiresAnnotation = "job-namespace." + k8sAnnotationPrefix + "expires-at"
+)
+
+var (
+	// jobNamespaceSweepInterval is how often the leftover job namespaces of a
+	// runner are deleted
+	jobNamespaceSweepInterval = 5 * time.Minute
+
+	jobNamespaceSweepsLock sync.Mutex
+	jobNamespaceSweeps     = map[string]time.Time{}
+)
+
+// jobNamespaceResources are created in each job namespace from the templates
+// of the configuration
+type jobNamespaceResources struct {
+	networkPolicy  *networkingv1.NetworkPolicy
+	resourceQuota  *api.ResourceQuota
+	serviceAccount *api.ServiceAccount
+	role           *rbacv1.Role
+	roleBinding    *rbacv1.RoleBinding
+}
+
+type jobNamespaceObject interface {
+	metav1.Object
+	runtime.Object
+}
+
+func parseJobNamespaceResources(config *common.KubernetesNamespacePerJobConfig) (*jobNamespaceResources, error) {
+	networkPolicy := &networkingv1.NetworkPolicy{}
+	resourceQuota := &api.ResourceQuota{}
+	serviceAccount := &api.ServiceAccount{}
+	role := &rbacv1.Role{}
+	roleBinding := &rbacv1.RoleBinding{}
+
+	templates := []struct {
+		kind     string
+		template string
+		obj      jobNamespaceObject
+	}{
+		{kind: "NetworkPolicy", template: config.NetworkPolicy, obj: networkPolicy},
+		{kind: "ResourceQuota", template: config.ResourceQuota, obj: resourceQuota},
+		{kind: "ServiceAccount", template: config.ServiceAccount, obj: serviceAccount},
+		{kind: "Role", template: config.Role, obj: role},
+		{kind: "RoleBinding", template: config.RoleBinding, obj: roleBinding},
+	}
+
+	for _, t := range templates {
+		if t.template == "" {
+			continue
+		}
+
+		if err := yaml.UnmarshalStrict([]byte(t.template), t.obj); err != nil {
+			return nil, fmt.Errorf("parsing the %s template: %w", t.kind, err)
+		}
+
+		if kind := t.obj.GetObjectKind().GroupVersionKind().Kind; kind != "" && kind != t.kind {
+			return nil, fmt.Errorf("the %s template defines a %s", t.kind, kind)
+		}
+
+		if t.obj.GetName() == "" {
+			return nil, fmt.Errorf("the %s template has no name", t.kind)
+		}
+	}
+
+	resources := &jobNamespaceResources{}
+	if config.NetworkPolicy != "" {
+		resources.networkPolicy = networkPolicy
+	}
+	if config.ResourceQuota != "" {
+		resources.resourceQuota = resourceQuota
+	}
+	if config.ServiceAccount != "" {
+		resources.serviceAccount = serviceAccount
+	}
+	if config.Role != "" {
+		resources.role = role
+	}
+	if config.RoleBinding != "" {
+		resources.roleBinding = roleBinding
+	}
+
+	return resources, nil
+}
+
+func (s *executor) isNamespacePerJobEnabled() bool {
+	return s.Config.Kubernetes != nil && s.Config.Kubernetes.NamespacePerJob != nil
+}
+
+func (s *executor) jobNamespaceRunner() string {
+	return sanitizeLabel(s.Build.Runner.ShortDescription())
+}
+
+// jobNamespaceName returns the name of the job namespace. The prefix is
+// truncated for the name to be a valid DNS label, the job ID is kept whole.
+func (s *executor) jobNamespaceName() string {
+	suffix := fmt.Sprintf("-%s-%d", dns.MakeRFC1123Compatible(s.Build.Runner.ShortDescription()), s.Build.ID)
+
+	prefix := dns.MakeRFC1123Compatible(s.Config.Kubernetes.NamespacePerJob.GetPrefix())
+	if len(prefix)+len(suffix) > dns.RFC1123NameMaximumLength {
+		prefix = prefix[:dns.RFC1123NameMaximumLength-len(suffix)]
+	}
+
+	return strings.TrimRight(prefix, "-") + suffix
+}
+
+// prepareJobNamespace sets the namespace of the job, and the service account
+// of the build pod when the job namespaces have one
+func (s *executor) prepareJobNamespace() error {
+	if !s.isNamespacePerJobEnabled() {
+		return nil
+	}
+
+	resources, err := parseJobNamespaceResources(s.Config.Kubernetes.NamespacePerJob)
+	if err != nil {
+		return fmt.Errorf("namespace per job: %w", err)
+	}
+
+	if s.Build.GetAllVariables().Get(NamespaceOverwriteVariableName) != "" {
+		s.Warningln(fmt.Sprintf("%s is ignored, the job runs in a namespace created for it", NamespaceOverwriteVariableName))
+	}
+
+	s.jobNamespaceResources = resources
+	s.configurationOverwrites.namespace = s.jobNamespaceName()
+	if resources.serviceAccount != nil {
+		s.configurationOverwrites.serviceAccount = resources.serviceAccount.Name
+	}
+
+	return nil
+}
+
+// setupJobNamespace creates the job namespace with the resources of the
+// templates, and copies the image pull secrets to it
+func (s *executor) setupJobNamespace(ctx context.Context) error {
+	if !s.isNamespacePerJobEnabled() || s.jobNamespace != nil {
+		return nil
+	}
+
+	s.sweepJobNamespaces(ctx)
+
+	config := s.Config.Kubernetes.NamespacePerJob
+	expiresAt := time.Now().Add(s.Build.GetBuildTimeout() + s.Config.Kubernetes.GetCleanupResourcesTimeout())
+
+	namespace := &api.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   s.configurationOverwrites.namespace,
+			Labels: map[string]string{},
+			Annotations: map[string]string{
+				jobNamespaceExpiresAnnotation: expiresAt.UTC().Format(time.RFC3339),
+			},
+		},
+	}
+	for k, v := range config.Labels {
+		namespace.Labels[k] = v
+	}
+	namespace.Labels[jobNamespaceRunnerLabel] = s.jobNamespaceRunner()
+	namespace.Labels[jobNamespaceJobLabel] = strconv.FormatInt(s.Build.ID, 10)
+
+	err := s.runKubeAPICall(func() error {
+		created, err := s.kubeClient.CoreV1().Namespaces().Create(ctx, namespace, metav1.CreateOptions{})
+		if kubeerrors.IsAlreadyExists(err) {
+			// the namespace of a previous attempt to prepare the job
+			created, err = s.kubeClient.CoreV1().Namespaces().Get(ctx, namespace.Name, metav1.GetOptions{})
+			if err == nil && !s.isJobNamespace(created) {
+				return fmt.Errorf("namespace %s already exists and isn't a namespace of the job", namespace.Name)
+			}
+		}
+		if err == nil {
+			s.jobNamespace = created
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("creating namespace %s: %w", namespace.Name, err)
+	}
+
+	s.Println("Created namespace", namespace.Name, "for the job")
+
+	return s.createJobNamespaceResources(ctx)
+}
+
+//nolint:gocognit
+func (s *executor) createJobNamespaceResources(ctx context.Context) error {
+	ns := s.jobNamespace.Name
+	resources := s.jobNamespaceResources
+
+	if sa := resources.serviceAccount; sa != nil {
+		sa.Namespace = ns
+		err := s.createJobNamespaceResource("ServiceAccount", sa.Name, func() error {
+			_, err := s.kubeClient.CoreV1().ServiceAccounts(ns).Create(ctx, sa, metav1.CreateOptions{})
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if role := resources.role; role != nil {
+		role.Namespace = ns
+		err := s.createJobNamespaceResource("Role", role.Name, func() error {
+			_, err := s.kubeClient.RbacV1().Roles(ns).Create(ctx, role, metav1.CreateOptions{})
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if binding := resources.roleBinding; binding != nil {
+		binding.Namespace = ns
+		for i, subject := range binding.Subjects {
+			if subject.Kind == rbacv1.ServiceAccountKind && subject.Namespace == "" {
+				binding.Subjects[i].Namespace = ns
+			}
+		}
+
+		err := s.createJobNamespaceResource("RoleBinding", binding.Name, func() error {
+			_, err := s.kubeClient.RbacV1().RoleBindings(ns).Create(ctx, binding, metav1.CreateOptions{})
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if quota := resources.resourceQuota; quota != nil {
+		quota.Namespace = ns
+		err := s.createJobNamespaceResource("ResourceQuota", quota.Name, func() error {
+			_, err := s.kubeClient.CoreV1().ResourceQuotas(ns).Create(ctx, quota, metav1.CreateOptions{})
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if policy := resources.networkPolicy; policy != nil {
+		policy.Namespace = ns
+		err := s.createJobNamespaceResource("NetworkPolicy", policy.Name, func() error {
+			_, err := s.kubeClient.NetworkingV1().NetworkPolicies(ns).Create(ctx, policy, metav1.CreateOptions{})
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return s.copyImagePullSecrets(ctx)
+}
+
+// copyImagePullSecrets copies the image pull secrets of the configured
+// namespace to the job namespace, for the pod to pull its images with them
+func (s *executor) copyImagePullSecrets(ctx context.Context) error {
+	source := s.Config.Kubernetes.Namespace
+	if source == "" {
+		source = DefaultResourceIdentifier
+	}
+
+	for _, name := range s.Config.Kubernetes.ImagePullSecrets {
+		var secret *api.Secret
+		err := s.runKubeAPICall(func() error {
+			var err error
+			secret, err = s.kubeClient.CoreV1().Secrets(source).Get(ctx, name, metav1.GetOptions{})
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("getting image pull secret %s of namespace %s: %w", name, source, err)
+		}
+
+		copied := &api.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: secret.Name, Namespace: s.jobNamespace.Name},
+			Type:       secret.Type,
+			Data:       secret.Data,
+		}
+
+		err = s.createJobNamespaceResource("Secret", name, func() error {
+			_, err := s.kubeClient.CoreV1().Secrets(copied.Namespace).Create(ctx, copied, metav1.CreateOptions{})
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *executor) createJobNamespaceResource(kind, name string, create func() error) error {
+	err := s.runKubeAPICall(func() error {
+		err := create()
+		if kubeerrors.IsAlreadyExists(err) {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("creating %s %s: %w", kind, name, err)
+	}
+
+	s.Debugln(fmt.Sprintf("Created %s %s in namespace %s", kind, name, s.jobNamespace.Name))
+
+	return nil
+}
+
+func (s *executor) isJobNamespace(namespace *api.Namespace) bool {
+	return namespace.Labels[jobNamespaceRunnerLabel] == s.jobNamespaceRunner() &&
+		namespace.Labels[jobNamespaceJobLabel] == strconv.FormatInt(s.Build.ID, 10)
+}
+
+// cleanupJobNamespace deletes the job namespace, along with all the resources
+// left in it. The namespace isn't deleted when its labels don't match the job.
+func (s *executor) cleanupJobNamespace(ctx context.Context) {
+	if s.jobNamespace == nil {
+		return
+	}
+
+	name := s.jobNamespace.Name
+	err := s.runKubeAPICall(func() error {
+		namespace, err := s.kubeClient.CoreV1().Namespaces().Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		if !s.isJobNamespace(namespace) {
+			return fmt.Errorf("namespace %s isn't a namespace of the job", name)
+		}
+
+		return s.deleteJobNamespace(ctx, namespace)
+	})
+	if err != nil && !kubeerrors.IsNotFound(err) {
+		s.Errorln(fmt.Sprintf("Error cleaning up namespace %s: %s", name, err.Error()))
+		return
+	}
+
+	s.jobNamespace = nil
+}
+
+// sweepJobNamespaces deletes the job namespaces of the runner which have
+// expired, as the runner couldn't clean them up at the end of their jobs. The
+// sweep runs once in a jobNamespaceSweepInterval for each runner.
+func (s *executor) sweepJobNamespaces(ctx context.Context) {
+	runner := s.jobNamespaceRunner()
+
+	jobNamespaceSweepsLock.Lock()
+	if time.Since(jobNamespaceSweeps[runner]) < jobNamespaceSweepInterval {
+		jobNamespaceSweepsLock.Unlock()
+		return
+	}
+	jobNamespaceSweeps[runner] = time.Now()
+	jobNamespaceSweepsLock.Unlock()
+
+	var namespaces *api.NamespaceList
+	err := s.runKubeAPICall(func() error {
+		var err error
+		namespaces, err = s.kubeClient.CoreV1().Namespaces().List(ctx, metav1.ListOptions{
+			LabelSelector: labels.SelectorFromSet(labels.Set{jobNamespaceRunnerLabel: runner}).String(),
+		})
+		return err
+	})
+	if err != nil {
+		s.Warningln(fmt.Sprintf("Failed to list the leftover job namespaces: %v", err))
+		return
+	}
+
+	for i := range namespaces.Items {
+		namespace := &namespaces.Items[i]
+		if namespace.DeletionTimestamp != nil {
+			continue
+		}
+
+		expiresAt, err := time.Parse(time.RFC3339, namespace.Annotations[jobNamespaceExpiresAnnotation])
+		if err != nil || time.Now().Before(expiresAt) {
+			continue
+		}
+
+		err = s.runKubeAPICall(func() error {
+			return s.deleteJobNamespace(ctx, namespace)
+		})
+		if err != nil && !kubeerrors.IsNotFound(err) {
+			s.Warningln(fmt.Sprintf("Failed to delete the leftover job namespace %s: %v", namespace.Name, err))
+			continue
+		}
+
+		s.Println("Deleted the leftover job namespace", namespace.Name)
+	}
+}
+
+// deleteJobNamespace deletes the namespace, unless it has been replaced since
+// it was read
+func (s *executor) deleteJobNamespace(ctx context.Context, namespace *api.Namespace) error {
+	uid := namespace.UID
+
+	err := s.kubeClient.CoreV1().Namespaces().Delete(ctx, namespace.Name, metav1.DeleteOptions{
+		Preconditions:     &metav1.Preconditions{UID: &uid},
+		PropagationPolicy: &PropagationPolicy,
+	})
+	if kubeerrors.IsConflict(err) {
+		return errors.New("the namespace has been replaced")
+	}
+
+	return err
+}
@@ -0,0 +1,351 @@
+//go:build !integration
+
+package kubernetes
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	api "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	restclient "k8s.io/client-go/rest"
+	"k8s.io/client-go/rest/fake"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+// fakeJobNamespaceAPI serves the objects of getObjects, and records the
+// objects created and deleted through the API
+type fakeJobNamespaceAPI struct {
+	mu         sync.Mutex
+	getObjects map[string]interface{}
+	created    map[string][]byte
+	deleted    map[string][]byte
+}
+
+func (f *fakeJobNamespaceAPI) handle(t *testing.T, req *http.Request) (*http.Response, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	respond := func(status int, obj interface{}) (*http.Response, error) {
+		body, err := json.Marshal(obj)
+		require.NoError(t, err)
+
+		return &http.Response{
+			StatusCode: status,
+			Header:     map[string][]string{"Content-Type": {"application/json"}},
+			Body:       io.NopCloser(bytes.NewReader(body)),
+		}, nil
+	}
+
+	var body []byte
+	if req.Body != nil {
+		body, _ = io.ReadAll(req.Body)
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		obj, ok := f.getObjects[req.URL.Path]
+		if !ok {
+			return respond(http.StatusNotFound, &metav1.Status{
+				Status: metav1.StatusFailure,
+				Reason: metav1.StatusReasonNotFound,
+				Code:   http.StatusNotFound,
+			})
+		}
+		return respond(http.StatusOK, obj)
+	case http.MethodPost:
+		var obj map[string]interface{}
+		require.NoError(t, json.Unmarshal(body, &obj))
+		name := obj["metadata"].(map[string]interface{})["name"].(string)
+		f.created[req.URL.Path+"/"+name] = body
+		return respond(http.StatusCreated, obj)
+	case http.MethodDelete:
+		f.deleted[req.URL.Path] = body
+		return respond(http.StatusOK, &metav1.Status{Status: metav1.StatusSuccess})
+	}
+
+	t.Errorf("unexpected request: %s %s", req.Method, req.URL)
+	return nil, nil
+}
+
+func newJobNamespaceTestExecutor(t *testing.T, config *common.KubernetesNamespacePerJobConfig) (*executor, *fakeJobNamespaceAPI) {
+	f := &fakeJobNamespaceAPI{
+		getObjects: map[string]interface{}{},
+		created:    map[string][]byte{},
+		deleted:    map[string][]byte{},
+	}
+
+	version, _ := testVersionAndCodec()
+	httpClient := fake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+		return f.handle(t, req)
+	})
+
+	client := testKubernetesClient(version, httpClient)
+	client.RbacV1().RESTClient().(*restclient.RESTClient).Client = httpClient
+	client.NetworkingV1().RESTClient().(*restclient.RESTClient).Client = httpClient
+
+	e := newExecutor()
+	e.kubeClient = client
+	e.Build = &common.Build{
+		JobResponse: common.JobResponse{ID: 1234},
+		Runner: &common.RunnerConfig{
+			RunnerCredentials: common.RunnerCredentials{Token: "abcdefgh1234"},
+		},
+	}
+	e.Config.Kubernetes = &common.KubernetesConfig{NamespacePerJob: config}
+	e.configurationOverwrites = &overwrites{}
+	e.BuildLogger = common.NewBuildLogger(&common.Trace{Writer: io.Discard}, e.Build.Log())
+
+	oldSweeps := jobNamespaceSweeps
+	t.Cleanup(func() { jobNamespaceSweeps = oldSweeps })
+	jobNamespaceSweeps = map[string]time.Time{e.jobNamespaceRunner(): time.Now()}
+
+	return e, f
+}
+
+func TestParseJobNamespaceResources(t *testing.T) {
+	tests := map[string]struct {
+		config        common.KubernetesNamespacePerJobConfig
+		assertResults func(t *testing.T, resources *jobNamespaceResources)
+		expectedErr   string
+	}{
+		"no templates": {
+			assertResults: func(t *testing.T, resources *jobNamespaceResources) {
+				assert.Equal(t, &jobNamespaceResources{}, resources)
+			},
+		},
+		"templates": {
+			config: common.KubernetesNamespacePerJobConfig{
+				NetworkPolicy: `
+apiVersion: networking.k8s.io/v1
+kind: NetworkPolicy
+metadata:
+  name: deny-ingress
+spec:
+  podSelector: {}
+  policyTypes: [Ingress]
+`,
+				ServiceAccount: `
+metadata:
+  name: ci-job
+`,
+				RoleBinding: `
+metadata:
+  name: ci-job
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: view
+subjects:
+- kind: ServiceAccount
+  name: ci-job
+`,
+			},
+			assertResults: func(t *testing.T, resources *jobNamespaceResources) {
+				require.NotNil(t, resources.networkPolicy)
+				assert.Equal(t, "deny-ingress", resources.networkPolicy.Name)
+				assert.Equal(t, []networkingv1.PolicyType{networkingv1.PolicyTypeIngress}, resources.networkPolicy.Spec.PolicyTypes)
+				require.NotNil(t, resources.serviceAccount)
+				assert.Equal(t, "ci-job", resources.serviceAccount.Name)
+				require.NotNil(t, resources.roleBinding)
+				assert.Equal(t, "view", resources.roleBinding.RoleRef.Name)
+				assert.Nil(t, resources.resourceQuota)
+				assert.Nil(t, resources.role)
+			},
+		},
+		"wrong kind": {
+			config: common.KubernetesNamespacePerJobConfig{
+				ResourceQuota: "kind: LimitRange\nmetadata:\n  name: limits\n",
+			},
+			expectedErr: "the ResourceQuota template defines a LimitRange",
+		},
+		"no name": {
+			config: common.KubernetesNamespacePerJobConfig{
+				Role: "rules: []\n",
+			},
+			expectedErr: "the Role template has no name",
+		},
+		"unknown field": {
+			config: common.KubernetesNamespacePerJobConfig{
+				Role: "metadata:\n  name: ci-job\nrule: []\n",
+			},
+			expectedErr: "parsing the Role template",
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			resources, err := parseJobNamespaceResources(&tt.config)
+			if tt.expectedErr != "" {
+				assert.ErrorContains(t, err, tt.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			tt.assertResults(t, resources)
+		})
+	}
+}
+
+func TestJobNamespaceName(t *testing.T) {
+	e, _ := newJobNamespaceTestExecutor(t, &common.KubernetesNamespacePerJobConfig{})
+	assert.Equal(t, "ci-job-abcdefgh-1234", e.jobNamespaceName())
+
+	e.Config.Kubernetes.NamespacePerJob.Prefix = strings.Repeat("Long_Prefix-", 10)
+	name := e.jobNamespaceName()
+	assert.Len(t, name, 63)
+	assert.True(t, strings.HasPrefix(name, "longprefix-longprefix-"))
+	assert.True(t, strings.HasSuffix(name, "-abcdefgh-1234"))
+}
+
+func TestSetupJobNamespace(t *testing.T) {
+	e, f := newJobNamespaceTestExecutor(t, &common.KubernetesNamespacePerJobConfig{
+		Labels:         map[string]string{"pod-security.kubernetes.io/enforce": "restricted"},
+		ServiceAccount: "metadata:\n  name: ci-job\n",
+		RoleBinding: `
+metadata:
+  name: ci-job
+roleRef:
+  apiGroup: rbac.authorization.k8s.io
+  kind: ClusterRole
+  name: view
+subjects:
+- kind: ServiceAccount
+  name: ci-job
+`,
+		NetworkPolicy: "metadata:\n  name: deny-all\nspec:\n  podSelector: {}\n",
+	})
+	e.Config.Kubernetes.ImagePullSecrets = []string{"registry"}
+	f.getObjects["/api/v1/namespaces/gitlab/secrets/registry"] = &api.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "registry", Namespace: "gitlab"},
+		Type:       api.SecretTypeDockerConfigJson,
+		Data:       map[string][]byte{".dockerconfigjson": []byte("{}")},
+	}
+	e.Config.Kubernetes.Namespace = "gitlab"
+
+	require.NoError(t, e.prepareJobNamespace())
+	assert.Equal(t, "ci-job-abcdefgh-1234", e.configurationOverwrites.namespace)
+	assert.Equal(t, "ci-job", e.configurationOverwrites.serviceAccount)
+
+	require.NoError(t, e.setupJobNamespace(context.Background()))
+
+	var namespace api.Namespace
+	require.NoError(t, json.Unmarshal(f.created["/api/v1/namespaces/ci-job-abcdefgh-1234"], &namespace))
+	assert.Equal(t, map[string]string{
+		"pod-security.kubernetes.io/enforce":     "restricted",
+		"job-namespace.runner.gitlab.com/runner": "abcdefgh",
+		"job-namespace.runner.gitlab.com/job":    "1234",
+	}, namespace.Labels)
+	expiresAt, err := time.Parse(time.RFC3339, namespace.Annotations[jobNamespaceExpiresAnnotation])
+	require.NoError(t, err)
+	assert.True(t, expiresAt.After(time.Now().Add(time.Hour)))
+
+	var binding rbacv1.RoleBinding
+	require.NoError(t, json.Unmarshal(
+		f.created["/apis/rbac.authorization.k8s.io/v1/namespaces/ci-job-abcdefgh-1234/rolebindings/ci-job"],
+		&binding,
+	))
+	assert.Equal(t, "ci-job-abcdefgh-1234", binding.Subjects[0].Namespace)
+
+	var secret api.Secret
+	require.NoError(t, json.Unmarshal(f.created["/api/v1/namespaces/ci-job-abcdefgh-1234/secrets/registry"], &secret))
+	assert.Equal(t, api.SecretTypeDockerConfigJson, secret.Type)
+	assert.Equal(t, []byte("{}"), secret.Data[".dockerconfigjson"])
+
+	assert.Contains(t, f.created, "/api/v1/namespaces/ci-job-abcdefgh-1234/serviceaccounts/ci-job")
+	assert.Contains(t, f.created, "/apis/networking.k8s.io/v1/namespaces/ci-job-abcdefgh-1234/networkpolicies/deny-all")
+	assert.Len(t, f.created, 5)
+}
+
+func TestCleanupJobNamespace(t *testing.T) {
+	tests := map[string]struct {
+		labels          map[string]string
+		expectedDeleted bool
+	}{
+		"namespace of the job": {
+			labels: map[string]string{
+				jobNamespaceRunnerLabel: "abcdefgh",
+				jobNamespaceJobLabel:    "1234",
+			},
+			expectedDeleted: true,
+		},
+		"namespace of another job": {
+			labels: map[string]string{
+				jobNamespaceRunnerLabel: "abcdefgh",
+				jobNamespaceJobLabel:    "5678",
+			},
+		},
+		"namespace without labels": {},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			e, f := newJobNamespaceTestExecutor(t, &common.KubernetesNamespacePerJobConfig{})
+			e.jobNamespace = &api.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "ci-job-abcdefgh-1234"}}
+			f.getObjects["/api/v1/namespaces/ci-job-abcdefgh-1234"] = &api.Namespace{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:   "ci-job-abcdefgh-1234",
+					UID:    types.UID("namespace-uid"),
+					Labels: tt.labels,
+				},
+			}
+
+			e.cleanupJobNamespace(context.Background())
+
+			body, deleted := f.deleted["/api/v1/namespaces/ci-job-abcdefgh-1234"]
+			assert.Equal(t, tt.expectedDeleted, deleted)
+			if deleted {
+				var options metav1.DeleteOptions
+				require.NoError(t, json.Unmarshal(body, &options))
+				require.NotNil(t, options.Preconditions)
+				assert.Equal(t, types.UID("namespace-uid"), *options.Preconditions.UID)
+				assert.Nil(t, e.jobNamespace)
+			}
+		})
+	}
+}
+
+func TestSweepJobNamespaces(t *testing.T) {
+	e, f := newJobNamespaceTestExecutor(t, &common.KubernetesNamespacePerJobConfig{})
+
+	newNamespace := func(name string, expiresAt time.Time) api.Namespace {
+		return api.Namespace{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        name,
+				Labels:      map[string]string{jobNamespaceRunnerLabel: "abcdefgh"},
+				Annotations: map[string]string{jobNamespaceExpiresAnnotation: expiresAt.Format(time.RFC3339)},
+			},
+		}
+	}
+
+	deleting := newNamespace("deleting", time.Now().Add(-time.Hour))
+	deleting.DeletionTimestamp = &metav1.Time{Time: time.Now()}
+
+	f.getObjects["/api/v1/namespaces"] = &api.NamespaceList{Items: []api.Namespace{
+		newNamespace("expired", time.Now().Add(-time.Hour)),
+		newNamespace("running", time.Now().Add(time.Hour)),
+		deleting,
+	}}
+
+	// the runner swept its namespaces recently
+	e.sweepJobNamespaces(context.Background())
+	assert.Empty(t, f.deleted)
+
+	jobNamespaceSweeps[e.jobNamespaceRunner()] = time.Now().Add(-jobNamespaceSweepInterval)
+	e.sweepJobNamespaces(context.Background())
+	assert.Len(t, f.deleted, 1)
+	assert.Contains(t, f.deleted, "/api/v1/namespaces/expired")
+}
@@ -170,6 +170,19 @@ func (r *retryableKubeAPICall) ShouldRetry(tries int, err error) bool {
 	return isNetworkError(err)
 }
 
+// runKubeAPICall runs fn with the retries of the Kubernetes API calls
+func (s *executor) runKubeAPICall(fn func() error) error {
+	r := retry.WithBuildLog(
+		&retryableKubeAPICall{
+			maxTries: defaultTries,
+			fn:       fn,
+		},
+		&s.BuildLogger,
+	)
+
+	return retry.NewWithBackoffDuration(r, defaultRetryMinBackoff, defaultRetryMaxBackoff).Run()
+}
+
 func isNetworkError(err error) bool {
 	if err == nil {
 		return false
@@ -263,6 +276,25 @@ type executor struct {
 
 	remoteStageStatusMutex sync.Mutex
 	remoteStageStatus      shells.StageCommandStatus
+
+	resourceUsage *resourceUsageCollector
+
+	// warmPod is set when the job's pod was acquired from the warm pool
+	warmPod *warmPod
+
+	// workspace is the volume of the builds directory when it's provisioned
+	// from the snapshots of the project
+	workspace *api.PersistentVolumeClaim
+	// buildSucceeded is set when the job succeeds, for its workspace to be
+	// snapshotted
+	buildSucceeded bool
+
+	// jobNamespace is the namespace created for the job, with the resources
+	// of jobNamespaceResources
+	jobNamespace          *api.Namespace
+	jobNamespaceResources *jobNamespaceResources
+
+	machineClass *common.KubernetesMachineClass
 }
 
 type serviceCreateResponse struct {
@@ -273,11 +305,20 @@ type serviceCreateResponse struct {
 // nolint:funlen
 func (s *executor) Prepare(options common.ExecutorPrepareOptions) (err error) {
 	s.AbstractExecutor.PrepareConfiguration(options)
+	orphanedResources.track(&s.Config, s.Build.ID)
+
+	if err = s.prepareMachineClass(options.Build.GetAllVariables()); err != nil {
+		return fmt.Errorf("couldn't prepare machine class: %w", err)
+	}
 
 	if err = s.prepareOverwrites(options.Build.GetAllVariables()); err != nil {
 		return fmt.Errorf("couldn't prepare overwrites: %w", err)
 	}
 
+	if err = s.prepareJobNamespace(); err != nil {
+		return err
+	}
+
 	s.pullManager, err = s.preparePullManager(options)
 	if err != nil {
 		return err
@@ -510,7 +551,12 @@ func (s *executor) runWithExecLegacy(cmd common.ExecutorCommand) error {
 	ctx := cmd.Context
 
 	if s.pod == nil {
-		err := s.setupCredentials(ctx)
+		err := s.setupJobNamespace(ctx)
+		if err != nil {
+			return err
+		}
+
+		err = s.setupCredentials(ctx)
 		if err != nil {
 			return err
 		}
@@ -604,27 +650,46 @@ func (s *executor) ensurePodsConfigured(ctx context.Context) error {
 		return nil
 	}
 
-	err := s.setupCredentials(ctx)
+	err := s.setupJobNamespace(ctx)
 	if err != nil {
-		return fmt.Errorf("setting up credentials: %w", err)
+		return fmt.Errorf("setting up job namespace: %w", err)
 	}
 
 	permissionsInitContainer, err := s.buildPermissionsInitContainer(s.helperImageInfo.OSType)
 	if err != nil {
 		return fmt.Errorf("building permissions init container: %w", err)
 	}
-	err = s.setupBuildPod(ctx, []api.Container{permissionsInitContainer})
-	if err != nil {
-		return fmt.Errorf("setting up build pod: %w", err)
-	}
+	initContainers := []api.Container{permissionsInitContainer}
 
-	status, err := waitForPodRunning(ctx, s.kubeClient, s.pod, s.Trace, s.Config.Kubernetes)
+	acquired, err := s.acquireWarmPod(ctx, initContainers)
 	if err != nil {
-		return fmt.Errorf("waiting for pod running: %w", err)
+		return fmt.Errorf("acquiring warm pod: %w", err)
 	}
 
-	if status != api.PodRunning {
-		return fmt.Errorf("pod failed to enter running state: %s", status)
+	if !acquired {
+		err = s.setupCredentials(ctx)
+		if err != nil {
+			return fmt.Errorf("setting up credentials: %w", err)
+		}
+
+		err = s.setupWorkspace(ctx)
+		if err != nil {
+			return fmt.Errorf("setting up workspace: %w", err)
+		}
+
+		err = s.setupBuildPod(ctx, initContainers)
+		if err != nil {
+			return fmt.Errorf("setting up build pod: %w", err)
+		}
+
+		status, err := waitForPodRunning(ctx, s.kubeClient, s.pod, s.Trace, s.Config.Kubernetes)
+		if err != nil {
+			return fmt.Errorf("waiting for pod running: %w", err)
+		}
+
+		if status != api.PodRunning {
+			return fmt.Errorf("pod failed to enter running state: %s", status)
+		}
 	}
 
 	err = s.setupTrappingScripts(ctx)
@@ -634,7 +699,7 @@ func (s *executor) ensurePodsConfigured(ctx context.Context) error {
 
 	go s.processLogs(ctx)
 
-	s.captureContainersLogs(ctx, s.pod.Spec.Containers)
+	s.captureContainersLogs(ctx, append(s.pod.Spec.Containers, s.pod.Spec.InitContainers...))
 
 	return nil
 }
@@ -912,12 +977,17 @@ func (s *executor) Finish(err error) {
 		s.pod = nil
 	}
 
+	s.buildSucceeded = err == nil
+
 	s.AbstractExecutor.Finish(err)
 }
 
 func (s *executor) Cleanup() {
 	s.cleanupResources()
 	closeKubeClient(s.kubeClient)
+	if s.Build != nil {
+		orphanedResources.untrack(&s.Config, s.Build.ID)
+	}
 	s.AbstractExecutor.Cleanup()
 }
 
@@ -933,7 +1003,9 @@ func (s *executor) cleanupResources() {
 	ctx, cancel := context.WithTimeout(context.Background(), s.Config.Kubernetes.GetCleanupResourcesTimeout())
 	defer cancel()
 
-	if s.pod != nil {
+	s.snapshotWorkspace(ctx)
+
+	if s.pod != nil && !s.releaseWarmPod(ctx) {
 		r := retry.WithBuildLog(
 			&retryableKubeAPICall{
 				maxTries: defaultTries,
@@ -975,6 +1047,9 @@ func (s *executor) cleanupResources() {
 			s.Errorln(fmt.Sprintf("Error cleaning up secrets: %s", err.Error()))
 		}
 	}
+
+	s.cleanupWorkspace(ctx)
+	s.cleanupJobNamespace(ctx)
 }
 
 //nolint:funlen
@@ -1084,10 +1159,18 @@ func (s *executor) logFile() string {
 }
 
 func (s *executor) logsDir() string {
+	if s.isWarmPoolEnabled() {
+		return warmPodLogsDir
+	}
+
 	return fmt.Sprintf("/logs-%d-%d", s.Build.JobInfo.ProjectID, s.Build.JobResponse.ID)
 }
 
 func (s *executor) scriptsDir() string {
+	if s.isWarmPoolEnabled() {
+		return warmPodScriptsDir
+	}
+
 	return fmt.Sprintf("/scripts-%d-%d", s.Build.JobInfo.ProjectID, s.Build.JobResponse.ID)
 }
 
@@ -1133,10 +1216,7 @@ func (s *executor) getVolumeMounts() []api.VolumeMount {
 	mounts = append(mounts, s.getVolumeMountsForConfig()...)
 
 	if s.isDefaultBuildsDirVolumeRequired() {
-		mounts = append(mounts, api.VolumeMount{
-			Name:      "repo",
-			MountPath: s.AbstractExecutor.RootDir(),
-		})
+		mounts = append(mounts, s.getBuildsDirVolumeMounts()...)
 	}
 
 	return mounts
@@ -1206,10 +1286,8 @@ func (s *executor) getVolumes() []api.Volume {
 
 	if s.isDefaultBuildsDirVolumeRequired() {
 		volumes = append(volumes, api.Volume{
-			Name: "repo",
-			VolumeSource: api.VolumeSource{
-				EmptyDir: &api.EmptyDirVolumeSource{},
-			},
+			Name:         "repo",
+			VolumeSource: s.getBuildsDirVolumeSource(),
 		})
 	}
 
@@ -1459,6 +1537,7 @@ func (s *executor) setupCredentials(ctx context.Context) error {
 	secret := api.Secret{}
 	secret.Name = generateNameForK8sResources(s.Build.ProjectUniqueName())
 	secret.Namespace = s.configurationOverwrites.namespace
+	secret.Labels = s.resourceLabels()
 	secret.Type = api.SecretTypeDockercfg
 	secret.Data = map[string][]byte{}
 	secret.Data[api.DockerConfigKey] = dockerCfgContent
@@ -1478,7 +1557,17 @@ func (s *executor) setupCredentials(ctx context.Context) error {
 	)
 	retryable := retry.NewWithBackoffDuration(r, defaultRetryMinBackoff, defaultRetryMaxBackoff)
 	err = retryable.Run()
-	return err
+	if err != nil {
+		return err
+	}
+
+	s.Build.RecordExecutorResource(common.ExecutorResource{
+		Type:      common.ExecutorResourceSecret,
+		ID:        s.credentials.Name,
+		Namespace: s.credentials.Namespace,
+	})
+
+	return nil
 }
 
 func (s *executor) requestSecretCreation(
@@ -1547,27 +1636,48 @@ func (s *executor) setupBuildPod(ctx context.Context, initContainers []api.Conta
 		}
 	}
 
+	if s.isNamespaceLimitsEnabled() {
+		s.applyLimitRanges(ctx, &podConfig)
+	}
+
 	s.Debugln("Creating build pod")
 
-	r := retry.WithBuildLog(
-		&retryableKubeAPICall{
-			maxTries: defaultTries,
-			fn: func() error {
-				pod, err := s.requestPodCreation(ctx, &podConfig, s.configurationOverwrites.namespace)
-				if err == nil {
-					s.pod = pod
-				}
-				return err
+	createPod := func() error {
+		r := retry.WithBuildLog(
+			&retryableKubeAPICall{
+				maxTries: defaultTries,
+				fn: func() error {
+					pod, err := s.requestPodCreation(ctx, &podConfig, s.configurationOverwrites.namespace)
+					if err == nil {
+						s.pod = pod
+					}
+					return err
+				},
 			},
-		},
-		&s.BuildLogger,
-	)
-	retryable := retry.NewWithBackoffDuration(r, defaultRetryMinBackoff, defaultRetryMaxBackoff)
-	err = retryable.Run()
+			&s.BuildLogger,
+		)
+		retryable := retry.NewWithBackoffDuration(r, defaultRetryMinBackoff, defaultRetryMaxBackoff)
+		return retryable.Run()
+	}
+
+	if s.isNamespaceLimitsEnabled() {
+		err = s.createPodWithinQuotas(ctx, &podConfig, createPod)
+	} else {
+		err = createPod()
+	}
 	if err != nil {
 		return err
 	}
 
+	// Services are owned by the pod, so they don't need to be recorded separately
+	s.Build.RecordExecutorResource(common.ExecutorResource{
+		Type:      common.ExecutorResourcePod,
+		ID:        s.pod.Name,
+		Namespace: s.pod.Namespace,
+	})
+
+	s.watchResourceUsage(ctx)
+
 	ownerReferences := s.buildPodReferences()
 	err = s.setOwnerReferencesForResources(ctx, ownerReferences)
 	if err != nil {
@@ -1579,8 +1689,14 @@ func (s *executor) setupBuildPod(ctx context.Context, initContainers []api.Conta
 }
 
 func (s *executor) requestPodCreation(ctx context.Context, pod *api.Pod, namespace string) (*api.Pod, error) {
-	p, err := s.kubeClient.CoreV1().
-		Pods(namespace).Create(ctx, pod, metav1.CreateOptions{})
+	var p *api.Pod
+	var err error
+	if s.useNativeSidecars() {
+		p, err = s.createPodWithNativeSidecars(ctx, pod, namespace)
+	} else {
+		p, err = s.kubeClient.CoreV1().
+			Pods(namespace).Create(ctx, pod, metav1.CreateOptions{})
+	}
 	if isConflict(err) {
 		s.Debugln(
 			fmt.Sprintf(
@@ -1642,6 +1758,12 @@ func (s *executor) createPodConfigPrepareOpts(initContainers []api.Container) (p
 	for key, val := range s.configurationOverwrites.podLabels {
 		labels[key] = sanitizeLabel(s.Build.Variables.ExpandValue(val))
 	}
+	for key, val := range s.resourceLabels() {
+		labels[key] = val
+	}
+	if s.machineClass != nil {
+		labels[machineClassLabel] = sanitizeLabel(s.machineClass.Name)
+	}
 
 	annotations := map[string]string{
 		"job." + k8sAnnotationPrefix + "id":         strconv.FormatInt(s.Build.ID, 10),
@@ -1720,6 +1842,13 @@ func (s *executor) preparePodServices() ([]api.Container, error) {
 		}
 	}
 
+	if s.useNativeSidecars() {
+		err = s.setServiceSidecarProbes(podServices)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return podServices, nil
 }
 
@@ -1729,6 +1858,16 @@ func (s *executor) preparePodConfig(opts podConfigPrepareOpts) (api.Pod, error)
 		return api.Pod{}, err
 	}
 
+	initContainers := opts.initContainers
+	containers := []api.Container{buildContainer, helperContainer}
+	if s.useNativeSidecars() {
+		// the services are started before the build and helper containers,
+		// and are stopped by the kubelet once they have exited
+		initContainers = append(append([]api.Container{}, initContainers...), opts.services...)
+	} else {
+		containers = append(containers, opts.services...)
+	}
+
 	pod := api.Pod{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:        generateNameForK8sResources(s.Build.ProjectUniqueName()),
@@ -1737,23 +1876,21 @@ func (s *executor) preparePodConfig(opts podConfigPrepareOpts) (api.Pod, error)
 			Annotations: opts.annotations,
 		},
 		Spec: api.PodSpec{
-			Volumes:            s.getVolumes(),
-			SchedulerName:      s.Config.Kubernetes.SchedulerName,
-			ServiceAccountName: s.configurationOverwrites.serviceAccount,
-			RestartPolicy:      api.RestartPolicyNever,
-			NodeSelector:       s.configurationOverwrites.nodeSelector,
-			Tolerations:        s.Config.Kubernetes.GetNodeTolerations(),
-			InitContainers:     opts.initContainers,
-			Containers: append([]api.Container{
-				buildContainer,
-				helperContainer,
-			}, opts.services...),
+			Volumes:                       s.getVolumes(),
+			SchedulerName:                 s.Config.Kubernetes.SchedulerName,
+			ServiceAccountName:            s.configurationOverwrites.serviceAccount,
+			RestartPolicy:                 api.RestartPolicyNever,
+			NodeSelector:                  s.configurationOverwrites.nodeSelector,
+			Tolerations:                   s.Config.Kubernetes.GetNodeTolerations(),
+			InitContainers:                initContainers,
+			Containers:                    containers,
 			TerminationGracePeriodSeconds: s.Config.Kubernetes.GetPodTerminationGracePeriodSeconds(),
 			ActiveDeadlineSeconds:         s.getPodActiveDeadlineSeconds(),
 			ImagePullSecrets:              opts.imagePullSecrets,
 			SecurityContext:               s.Config.Kubernetes.GetPodSecurityContext(),
 			HostAliases:                   opts.hostAliases,
 			Affinity:                      s.Config.Kubernetes.GetAffinity(),
+			TopologySpreadConstraints:     s.getTopologySpreadConstraints(),
 			DNSPolicy:                     s.getDNSPolicy(),
 			DNSConfig:                     s.Config.Kubernetes.GetDNSConfig(),
 			RuntimeClassName:              s.Config.Kubernetes.RuntimeClassName,
@@ -1883,7 +2020,7 @@ func doPodSpecMerge(original []byte, spec common.KubernetesPodSpec) ([]byte, err
 
 func (s *executor) setOwnerReferencesForResources(ctx context.Context, ownerReferences []metav1.OwnerReference) error {
 	if s.credentials == nil {
-		return nil
+		return s.setWorkspaceOwnerReferences(ctx, ownerReferences)
 	}
 
 	r := retry.WithBuildLog(
@@ -1905,7 +2042,12 @@ func (s *executor) setOwnerReferencesForResources(ctx context.Context, ownerRefe
 		&s.BuildLogger,
 	)
 	retryable := retry.NewWithBackoffDuration(r, defaultRetryMinBackoff, defaultRetryMaxBackoff)
-	return retryable.Run()
+	err := retryable.Run()
+	if err != nil {
+		return err
+	}
+
+	return s.setWorkspaceOwnerReferences(ctx, ownerReferences)
 }
 
 func (s *executor) buildPodReferences() []metav1.OwnerReference {
@@ -2069,6 +2211,7 @@ func (s *executor) prepareServiceConfig(
 		ObjectMeta: metav1.ObjectMeta{
 			Name:            generateNameForK8sResources(name),
 			Namespace:       s.configurationOverwrites.namespace,
+			Labels:          s.resourceLabels(),
 			OwnerReferences: ownerReferences,
 		},
 		Spec: api.ServiceSpec{
@@ -2569,11 +2712,13 @@ func featuresFn(features *common.FeaturesInfo) {
 
 func init() {
 	rand.Seed(time.Now().UnixNano())
-	common.RegisterExecutorProvider(common.ExecutorKubernetes, executors.DefaultExecutorProvider{
-		Creator: func() common.Executor {
-			return newExecutor()
+	common.RegisterExecutorProvider(common.ExecutorKubernetes, executorProvider{
+		DefaultExecutorProvider: executors.DefaultExecutorProvider{
+			Creator: func() common.Executor {
+				return newExecutor()
+			},
+			FeaturesUpdater:  featuresFn,
+			DefaultShellName: executorOptions.Shell.Shell,
 		},
-		FeaturesUpdater:  featuresFn,
-		DefaultShellName: executorOptions.Shell.Shell,
 	})
 }
@@ -3238,12 +3238,17 @@ func TestSetupBuildPod(t *testing.T) {
 				},
 			},
 			VerifyFn: func(t *testing.T, test setupBuildPodTestDef, pod *api.Pod) {
-				assert.Equal(t, map[string]string{
-					"test":    "label",
-					"another": "label",
-					"var":     "sometestvar",
-					"pod":     "runner--project-0-concurrent-0",
-				}, pod.ObjectMeta.Labels)
+				expectedLabels := map[string]string{
+					"test":     "label",
+					"another":  "label",
+					"var":      "sometestvar",
+					"pod":      "runner--project-0-concurrent-0",
+					jobIDLabel: "0",
+				}
+				for k, v := range runnerManagerLabels(&test.RunnerConfig) {
+					expectedLabels[k] = v
+				}
+				assert.Equal(t, expectedLabels, pod.ObjectMeta.Labels)
 			},
 			Variables: []common.JobVariable{
 				{Key: "test", Value: "sometestvar"},
@@ -3263,13 +3268,18 @@ func TestSetupBuildPod(t *testing.T) {
 				},
 			},
 			VerifyFn: func(t *testing.T, test setupBuildPodTestDef, pod *api.Pod) {
-				assert.Equal(t, map[string]string{
+				expectedLabels := map[string]string{
 					"test":     "label",
 					"another":  "newlabel",
 					"var":      "sometestvar",
 					"another2": "sometestvar",
 					"pod":      "runner--project-0-concurrent-0",
-				}, pod.ObjectMeta.Labels)
+					jobIDLabel: "0",
+				}
+				for k, v := range runnerManagerLabels(&test.RunnerConfig) {
+					expectedLabels[k] = v
+				}
+				assert.Equal(t, expectedLabels, pod.ObjectMeta.Labels)
 			},
 			Variables: []common.JobVariable{
 				{Key: "test", Value: "sometestvar"},
@@ -3277,6 +3287,64 @@ func TestSetupBuildPod(t *testing.T) {
 				{Key: "KUBERNETES_POD_LABELS_2", Value: "another2=$test"},
 			},
 		},
+		"applies the machine class selected by the job": {
+			RunnerConfig: common.RunnerConfig{
+				RunnerSettings: common.RunnerSettings{
+					Kubernetes: &common.KubernetesConfig{
+						NodeSelector:                 map[string]string{"kubernetes.io/os": "linux"},
+						CPULimit:                     "1",
+						MachineClassOverwriteAllowed: "arm64-.*",
+						MachineClasses: []common.KubernetesMachineClass{
+							{
+								Name:            "arm64-large",
+								NodeSelector:    map[string]string{"kubernetes.io/arch": "arm64"},
+								NodeTolerations: map[string]string{"arch=arm64": "NoSchedule"},
+								CPULimit:        "4",
+								TopologySpreadConstraints: []common.KubernetesTopologySpreadConstraint{
+									{MaxSkew: 1, TopologyKey: "topology.kubernetes.io/zone"},
+								},
+							},
+						},
+					},
+				},
+			},
+			Variables: []common.JobVariable{
+				{Key: MachineClassOverwriteVariableName, Value: "arm64-large"},
+			},
+			PrepareFn: func(t *testing.T, test setupBuildPodTestDef, e *executor) {
+				require.NoError(t, e.prepareMachineClass(test.Variables))
+			},
+			VerifyFn: func(t *testing.T, test setupBuildPodTestDef, pod *api.Pod) {
+				assert.Equal(t, map[string]string{
+					"kubernetes.io/os":   "linux",
+					"kubernetes.io/arch": "arm64",
+				}, pod.Spec.NodeSelector)
+				assert.Equal(t, []api.Toleration{
+					{Key: "arch", Value: "arm64", Operator: api.TolerationOpEqual, Effect: api.TaintEffectNoSchedule},
+				}, pod.Spec.Tolerations)
+				assert.Equal(t, "arm64-large", pod.Labels[machineClassLabel])
+				assert.Equal(t, []api.TopologySpreadConstraint{
+					{
+						MaxSkew:           1,
+						TopologyKey:       "topology.kubernetes.io/zone",
+						WhenUnsatisfiable: api.ScheduleAnyway,
+						LabelSelector: &metav1.LabelSelector{
+							MatchLabels: map[string]string{machineClassLabel: "arm64-large"},
+						},
+					},
+				}, pod.Spec.TopologySpreadConstraints)
+
+				for _, c := range pod.Spec.Containers {
+					if c.Name == buildContainerName {
+						assert.Equal(t, "4", c.Resources.Limits.Cpu().String())
+					}
+				}
+
+				// the configuration of the runner is left unchanged
+				assert.Equal(t, "1", test.RunnerConfig.Kubernetes.CPULimit)
+				assert.Len(t, test.RunnerConfig.Kubernetes.NodeSelector, 1)
+			},
+		},
 		"expands variables for pod annotations": {
 			RunnerConfig: common.RunnerConfig{
 				RunnerSettings: common.RunnerSettings{
@@ -3543,6 +3611,7 @@ func TestSetupBuildPod(t *testing.T) {
 						ObjectMeta: metav1.ObjectMeta{
 							Name:            "build",
 							Namespace:       "default",
+							Labels:          e.resourceLabels(),
 							OwnerReferences: ownerReferences,
 						},
 						Spec: api.ServiceSpec{
@@ -3561,6 +3630,7 @@ func TestSetupBuildPod(t *testing.T) {
 						ObjectMeta: metav1.ObjectMeta{
 							Name:            "proxy-svc-0",
 							Namespace:       "default",
+							Labels:          e.resourceLabels(),
 							OwnerReferences: ownerReferences,
 						},
 						Spec: api.ServiceSpec{
@@ -3584,6 +3654,7 @@ func TestSetupBuildPod(t *testing.T) {
 						ObjectMeta: metav1.ObjectMeta{
 							Name:            "proxy-svc-1",
 							Namespace:       "default",
+							Labels:          e.resourceLabels(),
 							OwnerReferences: ownerReferences,
 						},
 						Spec: api.ServiceSpec{
@@ -3671,6 +3742,44 @@ func TestSetupBuildPod(t *testing.T) {
 				}
 			},
 		},
+		"the services run as native sidecar containers": {
+			RunnerConfig: common.RunnerConfig{
+				RunnerSettings: common.RunnerSettings{
+					Kubernetes: &common.KubernetesConfig{
+						HelperImage:    "custom/helper-image",
+						NativeSidecars: true,
+					},
+				},
+			},
+			Options: &kubernetesOptions{
+				Image: common.Image{
+					Name: "test-image",
+				},
+				Services: common.Services{
+					{
+						Name: "test-service",
+						Ports: []common.Port{
+							{
+								Number: 82,
+							},
+						},
+					},
+				},
+			},
+			InitContainers: []api.Container{{Name: "init-permissions"}},
+			VerifyFn: func(t *testing.T, test setupBuildPodTestDef, pod *api.Pod) {
+				require.Len(t, pod.Spec.Containers, 2)
+				require.Len(t, pod.Spec.InitContainers, 2)
+				assert.Equal(t, "init-permissions", pod.Spec.InitContainers[0].Name)
+
+				service := pod.Spec.InitContainers[1]
+				assert.Equal(t, "svc-0", service.Name)
+				assert.Equal(t, "test-service", service.Image)
+				require.NotNil(t, service.StartupProbe)
+				assert.Equal(t, intstr.FromInt(82), service.StartupProbe.TCPSocket.Port)
+				require.NotNil(t, service.ReadinessProbe)
+			},
+		},
 		"the service is named as the alias if set": {
 			RunnerConfig: common.RunnerConfig{
 				RunnerSettings: common.RunnerSettings{
@@ -0,0 +1,127 @@
+package kubernetes
+
+import (
+	"fmt"
+
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+// machineClassLabel is set on the build pods to the name of their machine
+// class, the topology spread constraints count the pods of the class by default
+const machineClassLabel = "machine-class." + k8sAnnotationPrefix + "name"
+
+// prepareMachineClass selects the machine class of the job, from the
+// KUBERNETES_MACHINE_CLASS variable when it's allowed, and applies it to the
+// configuration of the executor. The configuration is copied, as it's shared
+// with the other jobs of the runner.
+func (s *executor) prepareMachineClass(variables common.JobVariables) error {
+	config := s.Config.Kubernetes
+
+	name, err := (&overwrites{}).evaluateOverwrite(
+		"MachineClass",
+		config.DefaultMachineClass,
+		config.MachineClassOverwriteAllowed,
+		variables.Expand().Get(MachineClassOverwriteVariableName),
+		s.BuildLogger,
+	)
+	if err != nil {
+		return err
+	}
+
+	if name == "" {
+		return nil
+	}
+
+	class := config.GetMachineClass(name)
+	if class == nil {
+		return fmt.Errorf("machine class %q isn't defined", name)
+	}
+
+	s.machineClass = class
+	s.Config.Kubernetes = applyMachineClass(config, class)
+
+	s.Println("Using machine class", name)
+
+	return nil
+}
+
+// applyMachineClass returns a copy of the configuration with the settings of
+// the machine class. The node selector and tolerations of the class are added
+// to the ones of the configuration, its other settings replace them.
+func applyMachineClass(config *common.KubernetesConfig, class *common.KubernetesMachineClass) *common.KubernetesConfig {
+	c := *config
+
+	c.NodeSelector = make(map[string]string, len(config.NodeSelector)+len(class.NodeSelector))
+	for k, v := range config.NodeSelector {
+		c.NodeSelector[k] = v
+	}
+	for k, v := range class.NodeSelector {
+		c.NodeSelector[k] = v
+	}
+
+	c.NodeTolerations = make(map[string]string, len(config.NodeTolerations)+len(class.NodeTolerations))
+	for k, v := range config.NodeTolerations {
+		c.NodeTolerations[k] = v
+	}
+	for k, v := range class.NodeTolerations {
+		c.NodeTolerations[k] = v
+	}
+
+	if class.Affinity != nil {
+		c.Affinity = *class.Affinity
+	}
+
+	if class.RuntimeClassName != "" {
+		runtimeClassName := class.RuntimeClassName
+		c.RuntimeClassName = &runtimeClassName
+	}
+
+	for _, r := range []struct {
+		value    string
+		resource *string
+	}{
+		{value: class.CPURequest, resource: &c.CPURequest},
+		{value: class.CPULimit, resource: &c.CPULimit},
+		{value: class.MemoryRequest, resource: &c.MemoryRequest},
+		{value: class.MemoryLimit, resource: &c.MemoryLimit},
+		{value: class.EphemeralStorageRequest, resource: &c.EphemeralStorageRequest},
+		{value: class.EphemeralStorageLimit, resource: &c.EphemeralStorageLimit},
+	} {
+		if r.value != "" {
+			*r.resource = r.value
+		}
+	}
+
+	return &c
+}
+
+func (s *executor) getTopologySpreadConstraints() []api.TopologySpreadConstraint {
+	if s.machineClass == nil {
+		return nil
+	}
+
+	var constraints []api.TopologySpreadConstraint
+	for _, c := range s.machineClass.TopologySpreadConstraints {
+		whenUnsatisfiable := api.ScheduleAnyway
+		if c.WhenUnsatisfiable != "" {
+			whenUnsatisfiable = api.UnsatisfiableConstraintAction(c.WhenUnsatisfiable)
+		}
+
+		matchLabels := c.MatchLabels
+		if len(matchLabels) == 0 {
+			matchLabels = map[string]string{machineClassLabel: sanitizeLabel(s.machineClass.Name)}
+		}
+
+		constraints = append(constraints, api.TopologySpreadConstraint{
+			MaxSkew:           c.MaxSkew,
+			TopologyKey:       c.TopologyKey,
+			WhenUnsatisfiable: whenUnsatisfiable,
+			LabelSelector:     &metav1.LabelSelector{MatchLabels: matchLabels},
+		})
+	}
+
+	return constraints
+}
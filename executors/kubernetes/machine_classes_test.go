@@ -0,0 +1,172 @@
+//go:build !integration
+
+package kubernetes
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	api "k8s.io/api/core/v1"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+func TestPrepareMachineClass(t *testing.T) {
+	classes := []common.KubernetesMachineClass{
+		{Name: "default", CPULimit: "1"},
+		{Name: "arm64-large", CPULimit: "4", NodeSelector: map[string]string{"kubernetes.io/arch": "arm64"}},
+		{Name: "gpu-less-highmem", MemoryLimit: "64Gi"},
+	}
+
+	tests := map[string]struct {
+		defaultClass      string
+		overwriteAllowed  string
+		variable          string
+		expectedClass     string
+		expectedCPULimit  string
+		expectedErr       string
+		expectedErrTarget error
+	}{
+		"no machine class": {
+			expectedCPULimit: "500m",
+		},
+		"default machine class": {
+			defaultClass:     "default",
+			expectedClass:    "default",
+			expectedCPULimit: "1",
+		},
+		"selected by the job": {
+			defaultClass:     "default",
+			overwriteAllowed: "arm64-.*|gpu-less-highmem",
+			variable:         "arm64-large",
+			expectedClass:    "arm64-large",
+			expectedCPULimit: "4",
+		},
+		"selection disabled": {
+			defaultClass:     "default",
+			variable:         "arm64-large",
+			expectedClass:    "default",
+			expectedCPULimit: "1",
+		},
+		"not allowed": {
+			overwriteAllowed:  "arm64-.*",
+			variable:          "gpu-less-highmem",
+			expectedErrTarget: new(malformedOverwriteError),
+		},
+		"not defined": {
+			overwriteAllowed: ".*",
+			variable:         "arm64-small",
+			expectedErr:      `machine class "arm64-small" isn't defined`,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			config := &common.KubernetesConfig{
+				CPULimit:                     "500m",
+				MachineClasses:               classes,
+				DefaultMachineClass:          tt.defaultClass,
+				MachineClassOverwriteAllowed: tt.overwriteAllowed,
+			}
+
+			e := newExecutor()
+			e.Config.Kubernetes = config
+			e.Build = &common.Build{Runner: &common.RunnerConfig{}}
+			e.BuildLogger = common.NewBuildLogger(&common.Trace{Writer: io.Discard}, e.Build.Log())
+
+			variables := common.JobVariables{{Key: MachineClassOverwriteVariableName, Value: tt.variable}}
+			err := e.prepareMachineClass(variables)
+
+			switch {
+			case tt.expectedErrTarget != nil:
+				assert.ErrorIs(t, err, tt.expectedErrTarget)
+				return
+			case tt.expectedErr != "":
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedCPULimit, e.Config.Kubernetes.CPULimit)
+			if tt.expectedClass == "" {
+				assert.Nil(t, e.machineClass)
+				assert.Same(t, config, e.Config.Kubernetes)
+				return
+			}
+
+			require.NotNil(t, e.machineClass)
+			assert.Equal(t, tt.expectedClass, e.machineClass.Name)
+			assert.Equal(t, "500m", config.CPULimit)
+		})
+	}
+}
+
+func TestApplyMachineClass(t *testing.T) {
+	runtimeClass := "runc"
+	config := &common.KubernetesConfig{
+		NodeSelector:     map[string]string{"kubernetes.io/os": "linux", "pool": "default"},
+		NodeTolerations:  map[string]string{"ci": "NoSchedule"},
+		RuntimeClassName: &runtimeClass,
+		MemoryRequest:    "1Gi",
+		MemoryLimit:      "2Gi",
+		Affinity: common.KubernetesAffinity{
+			NodeAffinity: &common.KubernetesNodeAffinity{},
+		},
+	}
+
+	class := &common.KubernetesMachineClass{
+		Name:             "gpu-less-highmem",
+		NodeSelector:     map[string]string{"pool": "highmem"},
+		NodeTolerations:  map[string]string{"highmem=true": "NoSchedule"},
+		RuntimeClassName: "gvisor",
+		MemoryLimit:      "64Gi",
+		Affinity: &common.KubernetesAffinity{
+			PodAntiAffinity: &common.KubernetesPodAntiAffinity{},
+		},
+	}
+
+	applied := applyMachineClass(config, class)
+
+	assert.Equal(t, map[string]string{"kubernetes.io/os": "linux", "pool": "highmem"}, applied.NodeSelector)
+	assert.Equal(t, map[string]string{"ci": "NoSchedule", "highmem=true": "NoSchedule"}, applied.NodeTolerations)
+	assert.Equal(t, "gvisor", *applied.RuntimeClassName)
+	assert.Equal(t, "1Gi", applied.MemoryRequest)
+	assert.Equal(t, "64Gi", applied.MemoryLimit)
+	assert.Nil(t, applied.Affinity.NodeAffinity)
+	assert.NotNil(t, applied.Affinity.PodAntiAffinity)
+
+	assert.Equal(t, map[string]string{"kubernetes.io/os": "linux", "pool": "default"}, config.NodeSelector)
+	assert.Equal(t, map[string]string{"ci": "NoSchedule"}, config.NodeTolerations)
+	assert.Equal(t, "runc", *config.RuntimeClassName)
+	assert.Equal(t, "2Gi", config.MemoryLimit)
+}
+
+func TestGetTopologySpreadConstraints(t *testing.T) {
+	e := newExecutor()
+	assert.Nil(t, e.getTopologySpreadConstraints())
+
+	e.machineClass = &common.KubernetesMachineClass{
+		Name: "arm64-large",
+		TopologySpreadConstraints: []common.KubernetesTopologySpreadConstraint{
+			{MaxSkew: 1, TopologyKey: "topology.kubernetes.io/zone"},
+			{
+				MaxSkew:           2,
+				TopologyKey:       "kubernetes.io/hostname",
+				WhenUnsatisfiable: "DoNotSchedule",
+				MatchLabels:       map[string]string{"team": "ci"},
+			},
+		},
+	}
+
+	constraints := e.getTopologySpreadConstraints()
+	require.Len(t, constraints, 2)
+
+	assert.Equal(t, api.ScheduleAnyway, constraints[0].WhenUnsatisfiable)
+	assert.Equal(t, map[string]string{machineClassLabel: "arm64-large"}, constraints[0].LabelSelector.MatchLabels)
+
+	assert.Equal(t, int32(2), constraints[1].MaxSkew)
+	assert.Equal(t, api.DoNotSchedule, constraints[1].WhenUnsatisfiable)
+	assert.Equal(t, map[string]string{"team": "ci"}, constraints[1].LabelSelector.MatchLabels)
+}
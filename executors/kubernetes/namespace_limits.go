@@ -0,0 +1,424 @@
+package kubernetes
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	api "k8s.io/api/core/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+// quotaExceededError is returned when the build pod doesn't fit in a resource
+// quota of the namespace. It's temporary when the pod would fit once the
+// resources used by other pods are released.
+type quotaExceededError struct {
+	quota     string
+	resource  api.ResourceName
+	requested resource.Quantity
+	used      resource.Quantity
+	hard      resource.Quantity
+	temporary bool
+}
+
+func (e *quotaExceededError) Error() string {
+	return fmt.Sprintf(
+		"exceeded quota %s: %s requested %s, used %s, limited %s",
+		e.quota,
+		e.resource,
+		e.requested.String(),
+		e.used.String(),
+		e.hard.String(),
+	)
+}
+
+func (s *executor) isNamespaceLimitsEnabled() bool {
+	return s.Config.Kubernetes.NamespaceLimits != nil
+}
+
+// isQuotaExceeded tells whether the pod creation was rejected by the quota
+// admission, which happens when the pod would exceed a quota
+func isQuotaExceeded(err error) bool {
+	return kubeerrors.IsForbidden(err) && strings.Contains(err.Error(), "exceeded quota")
+}
+
+// applyLimitRanges sets the resources of the pod's containers within the
+// container limit ranges of the namespace, for the pod not to be rejected. The
+// defaults of the limit ranges are set for the resources the containers don't
+// set, and the resources out of their bounds are clamped.
+func (s *executor) applyLimitRanges(ctx context.Context, pod *api.Pod) {
+	var limitRanges *api.LimitRangeList
+	err := s.runKubeAPICall(func() error {
+		var err error
+		limitRanges, err = s.kubeClient.CoreV1().LimitRanges(pod.Namespace).List(ctx, metav1.ListOptions{})
+		return err
+	})
+	if err != nil {
+		s.Warningln(fmt.Sprintf("Failed to list the limit ranges of namespace %s, they aren't applied: %v", pod.Namespace, err))
+		return
+	}
+
+	for _, limitRange := range limitRanges.Items {
+		for _, item := range limitRange.Spec.Limits {
+			if item.Type != api.LimitTypeContainer {
+				continue
+			}
+
+			for i := range pod.Spec.InitContainers {
+				s.applyLimitRange(&pod.Spec.InitContainers[i], limitRange.Name, item)
+			}
+			for i := range pod.Spec.Containers {
+				s.applyLimitRange(&pod.Spec.Containers[i], limitRange.Name, item)
+			}
+		}
+	}
+}
+
+//nolint:gocognit
+func (s *executor) applyLimitRange(container *api.Container, limitRange string, item api.LimitRangeItem) {
+	limits := container.Resources.Limits.DeepCopy()
+	if limits == nil {
+		limits = api.ResourceList{}
+	}
+	requests := container.Resources.Requests.DeepCopy()
+	if requests == nil {
+		requests = api.ResourceList{}
+	}
+
+	set := func(list api.ResourceList, kind string, name api.ResourceName, value resource.Quantity, bound string) {
+		if current, ok := list[name]; ok {
+			s.Warningln(fmt.Sprintf(
+				"Changing the %s %s of the %s container from %s to the %s %s of the limit range %s",
+				name, kind, container.Name, current.String(), bound, value.String(), limitRange,
+			))
+		} else {
+			s.Debugln(fmt.Sprintf(
+				"Setting the %s %s of the %s container to the %s %s of the limit range %s",
+				name, kind, container.Name, bound, value.String(), limitRange,
+			))
+		}
+
+		list[name] = value.DeepCopy()
+	}
+
+	for name, value := range item.Default {
+		if _, ok := limits[name]; !ok {
+			set(limits, "limit", name, value, "default")
+		}
+	}
+
+	for name, value := range item.DefaultRequest {
+		if _, ok := requests[name]; !ok {
+			set(requests, "request", name, value, "default")
+		}
+	}
+
+	for name, max := range item.Max {
+		if limit, ok := limits[name]; !ok || limit.Cmp(max) > 0 {
+			set(limits, "limit", name, max, "maximum")
+		}
+		if request, ok := requests[name]; ok && request.Cmp(max) > 0 {
+			set(requests, "request", name, max, "maximum")
+		}
+	}
+
+	for name, min := range item.Min {
+		if request, ok := requests[name]; !ok || request.Cmp(min) < 0 {
+			set(requests, "request", name, min, "minimum")
+		}
+		if limit, ok := limits[name]; ok && limit.Cmp(min) < 0 {
+			set(limits, "limit", name, min, "minimum")
+		}
+	}
+
+	for name, ratio := range item.MaxLimitRequestRatio {
+		limit, ok := limits[name]
+		if !ok || ratio.Sign() <= 0 {
+			continue
+		}
+
+		minRequest := *resource.NewMilliQuantity(
+			int64(math.Ceil(float64(limit.MilliValue())/ratio.AsApproximateFloat64())),
+			limit.Format,
+		)
+		if request, ok := requests[name]; !ok || request.Cmp(minRequest) < 0 {
+			set(requests, "request", name, minRequest, "minimum for the limit to request ratio")
+		}
+	}
+
+	// the requests can't exceed the limits, whichever bound they come from
+	for name, request := range requests {
+		if limit, ok := limits[name]; ok && request.Cmp(limit) > 0 {
+			s.Warningln(fmt.Sprintf(
+				"Lowering the %s request of the %s container from %s to its limit %s",
+				name, container.Name, request.String(), limit.String(),
+			))
+			requests[name] = limit.DeepCopy()
+		}
+	}
+
+	if len(limits) > 0 {
+		container.Resources.Limits = limits
+	}
+	if len(requests) > 0 {
+		container.Resources.Requests = requests
+	}
+}
+
+// podQuotaUsage returns the resources the pod counts against the resource
+// quotas. The init containers run one after the other, except the native
+// sidecar containers which keep running alongside the containers of the pod.
+func (s *executor) podQuotaUsage(pod *api.Pod) api.ResourceList {
+	usage := api.ResourceList{}
+	initUsage := api.ResourceList{}
+
+	for _, container := range pod.Spec.Containers {
+		addQuotaUsage(usage, container.Resources)
+	}
+
+	for _, container := range pod.Spec.InitContainers {
+		if s.useNativeSidecars() && strings.HasPrefix(container.Name, serviceContainerPrefix) {
+			addQuotaUsage(usage, container.Resources)
+			continue
+		}
+
+		containerUsage := api.ResourceList{}
+		addQuotaUsage(containerUsage, container.Resources)
+		for name, value := range containerUsage {
+			if current, ok := initUsage[name]; !ok || value.Cmp(current) > 0 {
+				initUsage[name] = value
+			}
+		}
+	}
+
+	for name, value := range initUsage {
+		if current, ok := usage[name]; !ok || value.Cmp(current) > 0 {
+			usage[name] = value
+		}
+	}
+
+	usage[api.ResourcePods] = *resource.NewQuantity(1, resource.DecimalSI)
+
+	return usage
+}
+
+func addQuotaUsage(usage api.ResourceList, resources api.ResourceRequirements) {
+	add := func(name api.ResourceName, value resource.Quantity) {
+		current := usage[name]
+		current.Add(value)
+		usage[name] = current
+	}
+
+	for name, value := range resources.Requests {
+		add(api.ResourceName(api.DefaultResourceRequestsPrefix+string(name)), value)
+	}
+	for name, value := range resources.Limits {
+		add(api.ResourceName("limits."+string(name)), value)
+	}
+}
+
+// quotaUsageName returns the name the pod usage is recorded with for a
+// resource of a quota. The quotas of the compute resources without prefix are
+// quotas of their requests.
+func quotaUsageName(name api.ResourceName) api.ResourceName {
+	switch name {
+	case api.ResourceCPU, api.ResourceMemory, api.ResourceEphemeralStorage:
+		return api.ResourceName(api.DefaultResourceRequestsPrefix + string(name))
+	default:
+		return name
+	}
+}
+
+// isQuotaComputeResource returns whether the quotas of the resource require the
+// containers to set its requests and limits
+func isQuotaComputeResource(name api.ResourceName) bool {
+	switch name {
+	case api.ResourceCPU, api.ResourceMemory, api.ResourceEphemeralStorage:
+		return true
+	default:
+		return false
+	}
+}
+
+// fillQuotaRequirements sets the requests and limits the resource quotas of
+// the namespace require the containers to set, from the limits and requests
+// they set. It returns an error when neither is set. Only the quotas of the
+// compute resources require every container to set them; the quotas of the
+// other resources, like the storage of the persistent volume claims or the
+// extended resources, are ignored.
+func (s *executor) fillQuotaRequirements(pod *api.Pod, quotas []api.ResourceQuota) error {
+	containers := make([]*api.Container, 0, len(pod.Spec.InitContainers)+len(pod.Spec.Containers))
+	for i := range pod.Spec.InitContainers {
+		containers = append(containers, &pod.Spec.InitContainers[i])
+	}
+	for i := range pod.Spec.Containers {
+		containers = append(containers, &pod.Spec.Containers[i])
+	}
+
+	for _, quota := range quotas {
+		for name := range quota.Spec.Hard {
+			usageName := string(quotaUsageName(name))
+
+			for _, container := range containers {
+				var kind, fromKind string
+				var required, from *api.ResourceList
+				switch {
+				case strings.HasPrefix(usageName, api.DefaultResourceRequestsPrefix):
+					kind, fromKind = "request", "limit"
+					required, from = &container.Resources.Requests, &container.Resources.Limits
+				case strings.HasPrefix(usageName, "limits."):
+					kind, fromKind = "limit", "request"
+					required, from = &container.Resources.Limits, &container.Resources.Requests
+				default:
+					continue
+				}
+
+				resourceName := api.ResourceName(usageName[strings.Index(usageName, ".")+1:])
+				if !isQuotaComputeResource(resourceName) {
+					continue
+				}
+
+				if _, ok := (*required)[resourceName]; ok {
+					continue
+				}
+
+				value, ok := (*from)[resourceName]
+				if !ok {
+					return fmt.Errorf(
+						"the %s container doesn't set the %s required by the resource quota %s",
+						container.Name, name, quota.Name,
+					)
+				}
+
+				s.Debugln(fmt.Sprintf(
+					"Setting the %s %s of the %s container to its %s %s, as required by the resource quota %s",
+					resourceName, kind, container.Name, fromKind, value.String(), quota.Name,
+				))
+
+				if *required == nil {
+					*required = api.ResourceList{}
+				}
+				(*required)[resourceName] = value.DeepCopy()
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkResourceQuotas returns a quotaExceededError when the pod doesn't fit in
+// the resource quotas of the namespace. The quotas limited to scopes are
+// ignored, as the scopes the pod belongs to aren't evaluated.
+func (s *executor) checkResourceQuotas(ctx context.Context, pod *api.Pod) error {
+	var quotas *api.ResourceQuotaList
+	err := s.runKubeAPICall(func() error {
+		var err error
+		quotas, err = s.kubeClient.CoreV1().ResourceQuotas(pod.Namespace).List(ctx, metav1.ListOptions{})
+		return err
+	})
+	if err != nil {
+		s.Warningln(fmt.Sprintf("Failed to list the resource quotas of namespace %s, they aren't checked: %v", pod.Namespace, err))
+		return nil
+	}
+
+	var unscoped []api.ResourceQuota
+	for _, quota := range quotas.Items {
+		if len(quota.Spec.Scopes) == 0 && quota.Spec.ScopeSelector == nil {
+			unscoped = append(unscoped, quota)
+		}
+	}
+
+	if err := s.fillQuotaRequirements(pod, unscoped); err != nil {
+		return err
+	}
+
+	usage := s.podQuotaUsage(pod)
+	for _, quota := range unscoped {
+		names := make([]string, 0, len(quota.Spec.Hard))
+		for name := range quota.Spec.Hard {
+			names = append(names, string(name))
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			hard := quota.Spec.Hard[api.ResourceName(name)]
+			requested, ok := usage[quotaUsageName(api.ResourceName(name))]
+			if !ok {
+				continue
+			}
+
+			used := quota.Status.Used[api.ResourceName(name)]
+			total := used.DeepCopy()
+			total.Add(requested)
+			if total.Cmp(hard) <= 0 {
+				continue
+			}
+
+			return &quotaExceededError{
+				quota:     quota.Name,
+				resource:  api.ResourceName(name),
+				requested: requested,
+				used:      used,
+				hard:      hard,
+				temporary: requested.Cmp(hard) <= 0,
+			}
+		}
+	}
+
+	return nil
+}
+
+// createPodWithinQuotas creates the pod once the resource quotas of the
+// namespace allow it. While the quotas are exhausted by other pods, the
+// creation is retried until the quota wait timeout.
+func (s *executor) createPodWithinQuotas(ctx context.Context, pod *api.Pod, create func() error) error {
+	timeout, err := s.Config.Kubernetes.NamespaceLimits.GetQuotaWaitTimeout()
+	if err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(timeout)
+	pollInterval := time.Duration(s.Config.Kubernetes.GetPollInterval()) * time.Second
+
+	var lastMessage string
+	for {
+		err := s.checkResourceQuotas(ctx, pod)
+		if err == nil {
+			err = create()
+		}
+
+		var quotaErr *quotaExceededError
+		switch {
+		case err == nil:
+			return nil
+		case errors.As(err, &quotaErr) && !quotaErr.temporary:
+			return &common.BuildError{Inner: err, FailureReason: common.ResourceQuotaFailure}
+		case !errors.As(err, &quotaErr) && !isQuotaExceeded(err):
+			return err
+		case !time.Now().Add(pollInterval).Before(deadline):
+			return &common.BuildError{
+				Inner:         fmt.Errorf("timed out waiting for the resource quotas: %w", err),
+				FailureReason: common.ResourceQuotaFailure,
+			}
+		}
+
+		if message := err.Error(); message != lastMessage {
+			s.Warningln(fmt.Sprintf("Waiting for the resource quotas of namespace %s to allow the pod: %s", pod.Namespace, message))
+			lastMessage = message
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(pollInterval):
+		}
+	}
+}
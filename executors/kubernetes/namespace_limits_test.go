@@ -0,0 +1,487 @@
+//go:build !integration
+
+package kubernetes
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	api "k8s.io/api/core/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/rest/fake"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+func newNamespaceLimitsTestExecutor(t *testing.T, fn func(req *http.Request) (*http.Response, error)) *executor {
+	version, _ := testVersionAndCodec()
+
+	e := newExecutor()
+	e.Build = &common.Build{Runner: &common.RunnerConfig{}}
+	e.Config.Kubernetes = &common.KubernetesConfig{
+		PollInterval:    1,
+		NamespaceLimits: &common.KubernetesNamespaceLimitsConfig{},
+	}
+	e.options = &kubernetesOptions{}
+	e.BuildLogger = common.NewBuildLogger(&common.Trace{Writer: io.Discard}, e.Build.Log())
+	e.kubeClient = testKubernetesClient(version, fake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+		resp, err := fn(req)
+		if resp == nil && err == nil {
+			t.Errorf("unexpected request: %s %s", req.Method, req.URL)
+			return nil, fmt.Errorf("unexpected request")
+		}
+		return resp, err
+	}))
+
+	return e
+}
+
+func resourceList(cpu, memory string) api.ResourceList {
+	list := api.ResourceList{}
+	if cpu != "" {
+		list[api.ResourceCPU] = resource.MustParse(cpu)
+	}
+	if memory != "" {
+		list[api.ResourceMemory] = resource.MustParse(memory)
+	}
+
+	return list
+}
+
+func TestApplyLimitRange(t *testing.T) {
+	tests := map[string]struct {
+		resources         api.ResourceRequirements
+		item              api.LimitRangeItem
+		expectedResources api.ResourceRequirements
+	}{
+		"defaults": {
+			resources: api.ResourceRequirements{Requests: resourceList("", "128Mi")},
+			item: api.LimitRangeItem{
+				Type:           api.LimitTypeContainer,
+				Default:        resourceList("1", "1Gi"),
+				DefaultRequest: resourceList("500m", "256Mi"),
+			},
+			expectedResources: api.ResourceRequirements{
+				Limits:   resourceList("1", "1Gi"),
+				Requests: resourceList("500m", "128Mi"),
+			},
+		},
+		"maximum": {
+			resources: api.ResourceRequirements{
+				Limits:   resourceList("4", ""),
+				Requests: resourceList("3", ""),
+			},
+			item: api.LimitRangeItem{
+				Type: api.LimitTypeContainer,
+				Max:  resourceList("2", "2Gi"),
+			},
+			expectedResources: api.ResourceRequirements{
+				Limits:   resourceList("2", "2Gi"),
+				Requests: resourceList("2", ""),
+			},
+		},
+		"minimum": {
+			resources: api.ResourceRequirements{
+				Limits:   resourceList("50m", ""),
+				Requests: resourceList("10m", ""),
+			},
+			item: api.LimitRangeItem{
+				Type: api.LimitTypeContainer,
+				Min:  resourceList("100m", ""),
+			},
+			expectedResources: api.ResourceRequirements{
+				Limits:   resourceList("100m", ""),
+				Requests: resourceList("100m", ""),
+			},
+		},
+		"limit to request ratio": {
+			resources: api.ResourceRequirements{
+				Limits:   resourceList("2", ""),
+				Requests: resourceList("100m", ""),
+			},
+			item: api.LimitRangeItem{
+				Type:                 api.LimitTypeContainer,
+				MaxLimitRequestRatio: resourceList("4", ""),
+			},
+			expectedResources: api.ResourceRequirements{
+				Limits:   resourceList("2", ""),
+				Requests: resourceList("500m", ""),
+			},
+		},
+		"default request above the limit": {
+			resources: api.ResourceRequirements{Limits: resourceList("200m", "")},
+			item: api.LimitRangeItem{
+				Type:           api.LimitTypeContainer,
+				DefaultRequest: resourceList("500m", ""),
+			},
+			expectedResources: api.ResourceRequirements{
+				Limits:   resourceList("200m", ""),
+				Requests: resourceList("200m", ""),
+			},
+		},
+		"no bounds": {
+			item: api.LimitRangeItem{Type: api.LimitTypeContainer},
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			e := newNamespaceLimitsTestExecutor(t, func(req *http.Request) (*http.Response, error) { return nil, nil })
+
+			container := &api.Container{Name: buildContainerName, Resources: tt.resources}
+			e.applyLimitRange(container, "limits", tt.item)
+
+			assertResourceListEqual(t, tt.expectedResources.Limits, container.Resources.Limits)
+			assertResourceListEqual(t, tt.expectedResources.Requests, container.Resources.Requests)
+		})
+	}
+}
+
+func assertResourceListEqual(t *testing.T, expected, actual api.ResourceList) {
+	require.Len(t, actual, len(expected))
+	for name, value := range expected {
+		actualValue, ok := actual[name]
+		require.True(t, ok, "missing %s", name)
+		assert.Zero(t, value.Cmp(actualValue), "%s: expected %s, got %s", name, value.String(), actualValue.String())
+	}
+}
+
+func TestApplyLimitRanges(t *testing.T) {
+	version, codec := testVersionAndCodec()
+
+	e := newNamespaceLimitsTestExecutor(t, func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path != "/api/"+version+"/namespaces/ci/limitranges" {
+			return nil, nil
+		}
+
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body: objBody(codec, &api.LimitRangeList{Items: []api.LimitRange{
+				{
+					ObjectMeta: metav1.ObjectMeta{Name: "limits"},
+					Spec: api.LimitRangeSpec{Limits: []api.LimitRangeItem{
+						{Type: api.LimitTypePod, Max: resourceList("1", "")},
+						{Type: api.LimitTypeContainer, Default: resourceList("", "512Mi")},
+					}},
+				},
+			}}),
+			Header: map[string][]string{"Content-Type": {"application/json"}},
+		}, nil
+	})
+
+	pod := &api.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ci"},
+		Spec: api.PodSpec{
+			InitContainers: []api.Container{{Name: "init-permissions"}},
+			Containers:     []api.Container{{Name: buildContainerName}, {Name: helperContainerName}},
+		},
+	}
+
+	e.applyLimitRanges(context.Background(), pod)
+
+	for _, container := range append(pod.Spec.InitContainers, pod.Spec.Containers...) {
+		assertResourceListEqual(t, resourceList("", "512Mi"), container.Resources.Limits)
+		assert.Nil(t, container.Resources.Requests)
+	}
+}
+
+func TestPodQuotaUsage(t *testing.T) {
+	pod := &api.Pod{
+		Spec: api.PodSpec{
+			InitContainers: []api.Container{
+				{Name: "init-permissions", Resources: api.ResourceRequirements{Requests: resourceList("3", "")}},
+				{Name: "svc-0", Resources: api.ResourceRequirements{Requests: resourceList("1", "")}},
+			},
+			Containers: []api.Container{
+				{
+					Name: buildContainerName,
+					Resources: api.ResourceRequirements{
+						Requests: resourceList("1", "1Gi"),
+						Limits:   resourceList("2", ""),
+					},
+				},
+				{Name: helperContainerName, Resources: api.ResourceRequirements{Requests: resourceList("500m", "")}},
+			},
+		},
+	}
+
+	e := newNamespaceLimitsTestExecutor(t, func(req *http.Request) (*http.Response, error) { return nil, nil })
+
+	assertResourceListEqual(t, api.ResourceList{
+		"requests.cpu":    resource.MustParse("3"),
+		"requests.memory": resource.MustParse("1Gi"),
+		"limits.cpu":      resource.MustParse("2"),
+		"pods":            resource.MustParse("1"),
+	}, e.podQuotaUsage(pod))
+
+	e.Config.Kubernetes.NativeSidecars = true
+	e.options.Services = common.Services{{Name: "postgres"}}
+
+	assertResourceListEqual(t, api.ResourceList{
+		"requests.cpu":    resource.MustParse("3"),
+		"requests.memory": resource.MustParse("1Gi"),
+		"limits.cpu":      resource.MustParse("2"),
+		"pods":            resource.MustParse("1"),
+	}, e.podQuotaUsage(pod))
+
+	pod.Spec.InitContainers[0].Resources.Requests = resourceList("1", "")
+
+	assertResourceListEqual(t, api.ResourceList{
+		"requests.cpu":    resource.MustParse("2500m"),
+		"requests.memory": resource.MustParse("1Gi"),
+		"limits.cpu":      resource.MustParse("2"),
+		"pods":            resource.MustParse("1"),
+	}, e.podQuotaUsage(pod))
+}
+
+func newTestResourceQuota(name string, hard, used api.ResourceList) api.ResourceQuota {
+	return api.ResourceQuota{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       api.ResourceQuotaSpec{Hard: hard},
+		Status:     api.ResourceQuotaStatus{Hard: hard, Used: used},
+	}
+}
+
+func TestCheckResourceQuotas(t *testing.T) {
+	tests := map[string]struct {
+		quotas             []api.ResourceQuota
+		limits             api.ResourceList
+		expectedErr        string
+		expectedTemporary  bool
+		expectedBuildLimit api.ResourceList
+	}{
+		"no quotas": {},
+		"fits": {
+			quotas: []api.ResourceQuota{
+				newTestResourceQuota("compute", resourceList("4", ""), resourceList("2", "")),
+			},
+		},
+		"temporarily exhausted": {
+			quotas: []api.ResourceQuota{
+				newTestResourceQuota("compute", resourceList("4", ""), resourceList("3500m", "")),
+			},
+			expectedErr:       "exceeded quota compute: cpu requested 1, used 3500m, limited 4",
+			expectedTemporary: true,
+		},
+		"too small": {
+			quotas: []api.ResourceQuota{
+				newTestResourceQuota("compute", resourceList("500m", ""), nil),
+			},
+			expectedErr: "exceeded quota compute: cpu requested 1, used 0, limited 500m",
+		},
+		"pods": {
+			quotas: []api.ResourceQuota{
+				newTestResourceQuota(
+					"pods",
+					api.ResourceList{api.ResourcePods: resource.MustParse("2")},
+					api.ResourceList{api.ResourcePods: resource.MustParse("2")},
+				),
+			},
+			expectedErr:       "exceeded quota pods: pods requested 1, used 2, limited 2",
+			expectedTemporary: true,
+		},
+		"scoped quota": {
+			quotas: func() []api.ResourceQuota {
+				quota := newTestResourceQuota("compute", resourceList("500m", ""), nil)
+				quota.Spec.Scopes = []api.ResourceQuotaScope{api.ResourceQuotaScopeBestEffort}
+				return []api.ResourceQuota{quota}
+			}(),
+		},
+		"required limits filled from the requests": {
+			quotas: []api.ResourceQuota{
+				newTestResourceQuota("limits", api.ResourceList{"limits.cpu": resource.MustParse("8")}, nil),
+			},
+			expectedBuildLimit: resourceList("1", ""),
+		},
+		"required limits not set": {
+			quotas: []api.ResourceQuota{
+				newTestResourceQuota(
+					"limits",
+					api.ResourceList{"limits.ephemeral-storage": resource.MustParse("8Gi")},
+					nil,
+				),
+			},
+			expectedErr: "the build container doesn't set the limits.ephemeral-storage required by the resource quota limits",
+		},
+		"storage quota": {
+			quotas: []api.ResourceQuota{
+				newTestResourceQuota(
+					"storage",
+					api.ResourceList{
+						"requests.storage":                                  resource.MustParse("100Gi"),
+						api.ResourcePersistentVolumeClaims:                  resource.MustParse("10"),
+						"gold.storageclass.storage.k8s.io/requests.storage": resource.MustParse("10Gi"),
+					},
+					nil,
+				),
+			},
+		},
+		"extended resource quota": {
+			quotas: []api.ResourceQuota{
+				newTestResourceQuota(
+					"gpu",
+					api.ResourceList{"requests.nvidia.com/gpu": resource.MustParse("4")},
+					nil,
+				),
+			},
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			version, codec := testVersionAndCodec()
+
+			e := newNamespaceLimitsTestExecutor(t, func(req *http.Request) (*http.Response, error) {
+				if req.URL.Path != "/api/"+version+"/namespaces/ci/resourcequotas" {
+					return nil, nil
+				}
+
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body:       objBody(codec, &api.ResourceQuotaList{Items: tt.quotas}),
+					Header:     map[string][]string{"Content-Type": {"application/json"}},
+				}, nil
+			})
+
+			pod := &api.Pod{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ci"},
+				Spec: api.PodSpec{
+					Containers: []api.Container{
+						{
+							Name:      buildContainerName,
+							Resources: api.ResourceRequirements{Requests: resourceList("1", "1Gi")},
+						},
+					},
+				},
+			}
+
+			err := e.checkResourceQuotas(context.Background(), pod)
+			if tt.expectedErr == "" {
+				require.NoError(t, err)
+				assertResourceListEqual(t, tt.expectedBuildLimit, pod.Spec.Containers[0].Resources.Limits)
+				return
+			}
+
+			assert.EqualError(t, err, tt.expectedErr)
+
+			var quotaErr *quotaExceededError
+			if errors.As(err, &quotaErr) {
+				assert.Equal(t, tt.expectedTemporary, quotaErr.temporary)
+			}
+		})
+	}
+}
+
+func TestCreatePodWithinQuotas(t *testing.T) {
+	version, codec := testVersionAndCodec()
+
+	tests := map[string]struct {
+		used              []api.ResourceList
+		creationErrs      []error
+		quotaWaitTimeout  string
+		expectedCreations int
+		expectedErr       string
+		expectedReason    common.JobFailureReason
+	}{
+		"fits": {
+			used:              []api.ResourceList{resourceList("1", "")},
+			expectedCreations: 1,
+		},
+		"waits for the quota": {
+			used:              []api.ResourceList{resourceList("4", ""), resourceList("2", "")},
+			expectedCreations: 1,
+		},
+		"retries the rejected creation": {
+			used: []api.ResourceList{resourceList("1", "")},
+			creationErrs: []error{
+				kubeerrors.NewForbidden(
+					schema.GroupResource{Resource: "pods"},
+					"runner",
+					errors.New("exceeded quota: compute, requested: requests.cpu=1"),
+				),
+			},
+			expectedCreations: 2,
+		},
+		"fails on other errors": {
+			used:              []api.ResourceList{resourceList("1", "")},
+			creationErrs:      []error{errors.New("creation failed")},
+			expectedCreations: 1,
+			expectedErr:       "creation failed",
+		},
+		"times out": {
+			used:             []api.ResourceList{resourceList("4", "")},
+			quotaWaitTimeout: "1s",
+			expectedErr: "timed out waiting for the resource quotas: " +
+				"exceeded quota compute: cpu requested 1, used 4, limited 4",
+			expectedReason: common.ResourceQuotaFailure,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			quotaRequests := 0
+			e := newNamespaceLimitsTestExecutor(t, func(req *http.Request) (*http.Response, error) {
+				if req.URL.Path != "/api/"+version+"/namespaces/ci/resourcequotas" {
+					return nil, nil
+				}
+
+				used := tt.used[len(tt.used)-1]
+				if quotaRequests < len(tt.used) {
+					used = tt.used[quotaRequests]
+				}
+				quotaRequests++
+
+				quotas := &api.ResourceQuotaList{Items: []api.ResourceQuota{
+					newTestResourceQuota("compute", resourceList("4", ""), used),
+				}}
+
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body:       objBody(codec, quotas),
+					Header:     map[string][]string{"Content-Type": {"application/json"}},
+				}, nil
+			})
+			e.Config.Kubernetes.NamespaceLimits.QuotaWaitTimeout = tt.quotaWaitTimeout
+
+			pod := &api.Pod{
+				ObjectMeta: metav1.ObjectMeta{Namespace: "ci"},
+				Spec: api.PodSpec{
+					Containers: []api.Container{
+						{Name: buildContainerName, Resources: api.ResourceRequirements{Requests: resourceList("1", "")}},
+					},
+				},
+			}
+
+			creations := 0
+			err := e.createPodWithinQuotas(context.Background(), pod, func() error {
+				creations++
+				if creations <= len(tt.creationErrs) {
+					return tt.creationErrs[creations-1]
+				}
+				return nil
+			})
+
+			assert.Equal(t, tt.expectedCreations, creations)
+			if tt.expectedErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.EqualError(t, err, tt.expectedErr)
+			if tt.expectedReason != "" {
+				var buildErr *common.BuildError
+				require.ErrorAs(t, err, &buildErr)
+				assert.Equal(t, tt.expectedReason, buildErr.FailureReason)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package kubernetes
+
+import (
+	"errors"
+	"fmt"
+
+	"golang.org/x/net/context"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors"
+)
+
+var newOrphanedJobsKubeClient = func(config *common.KubernetesConfig) (kubernetes.Interface, error) {
+	kubeConfig, err := getKubeClientConfig(config, &overwrites{})
+	if err != nil {
+		return nil, err
+	}
+
+	return kubernetes.NewForConfig(kubeConfig)
+}
+
+// executorProvider extends the default provider with the ability to remove the
+// pods and secrets of jobs orphaned by a runner restart.
+type executorProvider struct {
+	executors.DefaultExecutorProvider
+}
+
+func (p executorProvider) CleanupOrphanedJob(
+	ctx context.Context,
+	config *common.RunnerConfig,
+	job common.JobStateEntry,
+) error {
+	if config.Kubernetes == nil {
+		return errors.New("missing kubernetes configuration")
+	}
+
+	client, err := newOrphanedJobsKubeClient(config.Kubernetes)
+	if err != nil {
+		return fmt.Errorf("connecting to Kubernetes: %w", err)
+	}
+
+	return errors.Join(
+		removeOrphanedResources(ctx, client, config.Kubernetes, job.Resources),
+		removeOrphanedWarmPods(ctx, client, config),
+	)
+}
+
+func removeOrphanedResources(
+	ctx context.Context,
+	client kubernetes.Interface,
+	config *common.KubernetesConfig,
+	resources []common.ExecutorResource,
+) error {
+	var errs []error
+
+	for _, resource := range resources {
+		var err error
+
+		switch resource.Type {
+		case common.ExecutorResourcePod:
+			err = client.CoreV1().
+				Pods(resource.Namespace).
+				Delete(ctx, resource.ID, metav1.DeleteOptions{
+					GracePeriodSeconds: config.GetCleanupGracePeriodSeconds(),
+					PropagationPolicy:  &PropagationPolicy,
+				})
+		case common.ExecutorResourceSecret:
+			err = client.CoreV1().
+				Secrets(resource.Namespace).
+				Delete(ctx, resource.ID, metav1.DeleteOptions{
+					GracePeriodSeconds: config.GetCleanupGracePeriodSeconds(),
+				})
+		default:
+			continue
+		}
+
+		if err != nil && !kubeerrors.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("deleting %s %s/%s: %w", resource.Type, resource.Namespace, resource.ID, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// removeOrphanedWarmPods deletes the idle warm pods of the runner manager that
+// aren't in the warm pool of this process, left behind by the previous process
+func removeOrphanedWarmPods(ctx context.Context, client kubernetes.Interface, config *common.RunnerConfig) error {
+	namespace := config.Kubernetes.Namespace
+	if namespace == "" {
+		namespace = DefaultResourceIdentifier
+	}
+
+	selector := runnerManagerKey(config) + "," + warmPoolOwnerLabel + ",!" + jobIDLabel
+
+	pods, err := client.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return fmt.Errorf("listing warm pods: %w", err)
+	}
+
+	var errs []error
+	for _, pod := range pods.Items {
+		if pod.Labels[warmPoolOwnerLabel] == warmPods.owner {
+			continue
+		}
+
+		err := client.CoreV1().
+			Pods(pod.Namespace).
+			Delete(ctx, pod.Name, metav1.DeleteOptions{
+				GracePeriodSeconds: config.Kubernetes.GetCleanupGracePeriodSeconds(),
+				PropagationPolicy:  &PropagationPolicy,
+			})
+		if err != nil && !kubeerrors.IsNotFound(err) {
+			errs = append(errs, fmt.Errorf("deleting warm pod %s/%s: %w", pod.Namespace, pod.Name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
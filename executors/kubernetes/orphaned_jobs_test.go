@@ -0,0 +1,110 @@
+//go:build !integration
+
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	api "k8s.io/api/core/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+func TestExecutorProviderCleanupOrphanedJob(t *testing.T) {
+	client := fake.NewSimpleClientset(
+		&api.Pod{ObjectMeta: metav1.ObjectMeta{Name: "build-pod", Namespace: "ci"}},
+		&api.Pod{ObjectMeta: metav1.ObjectMeta{Name: "other-pod", Namespace: "ci"}},
+		&api.Secret{ObjectMeta: metav1.ObjectMeta{Name: "build-secret", Namespace: "ci"}},
+	)
+
+	oldNewClient := newOrphanedJobsKubeClient
+	defer func() { newOrphanedJobsKubeClient = oldNewClient }()
+	newOrphanedJobsKubeClient = func(_ *common.KubernetesConfig) (kubernetes.Interface, error) {
+		return client, nil
+	}
+
+	provider, ok := common.GetExecutorProvider(common.ExecutorKubernetes).(common.OrphanedJobCleaner)
+	require.True(t, ok)
+
+	err := provider.CleanupOrphanedJob(context.Background(), &common.RunnerConfig{}, common.JobStateEntry{})
+	assert.EqualError(t, err, "missing kubernetes configuration")
+
+	config := &common.RunnerConfig{
+		RunnerSettings: common.RunnerSettings{
+			Kubernetes: &common.KubernetesConfig{},
+		},
+	}
+	job := common.JobStateEntry{
+		ID: 1,
+		Resources: []common.ExecutorResource{
+			{Type: common.ExecutorResourcePod, ID: "build-pod", Namespace: "ci"},
+			{Type: common.ExecutorResourceSecret, ID: "build-secret", Namespace: "ci"},
+			{Type: common.ExecutorResourcePod, ID: "already-removed", Namespace: "ci"},
+			{Type: common.ExecutorResourceContainer, ID: "ignored"},
+		},
+	}
+
+	err = provider.CleanupOrphanedJob(context.Background(), config, job)
+	require.NoError(t, err)
+
+	_, err = client.CoreV1().Pods("ci").Get(context.Background(), "build-pod", metav1.GetOptions{})
+	assert.True(t, kubeerrors.IsNotFound(err))
+
+	_, err = client.CoreV1().Secrets("ci").Get(context.Background(), "build-secret", metav1.GetOptions{})
+	assert.True(t, kubeerrors.IsNotFound(err))
+
+	_, err = client.CoreV1().Pods("ci").Get(context.Background(), "other-pod", metav1.GetOptions{})
+	assert.NoError(t, err)
+}
+
+func TestRemoveOrphanedWarmPods(t *testing.T) {
+	config := &common.RunnerConfig{
+		RunnerCredentials: common.RunnerCredentials{Token: "runner-token"},
+		RunnerSettings: common.RunnerSettings{
+			Kubernetes: &common.KubernetesConfig{Namespace: "ci"},
+		},
+	}
+
+	warmPodLabels := func(owner string, extra map[string]string) map[string]string {
+		l := runnerManagerLabels(config)
+		l[warmPoolKeyLabel] = "key"
+		l[warmPoolOwnerLabel] = owner
+		for k, v := range extra {
+			l[k] = v
+		}
+		return l
+	}
+
+	client := fake.NewSimpleClientset(
+		&api.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name: "orphaned", Namespace: "ci", Labels: warmPodLabels("crashed-process", nil),
+		}},
+		&api.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name: "pooled", Namespace: "ci", Labels: warmPodLabels(warmPods.owner, nil),
+		}},
+		&api.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name: "assigned", Namespace: "ci", Labels: warmPodLabels("crashed-process", map[string]string{jobIDLabel: "1"}),
+		}},
+		&api.Pod{ObjectMeta: metav1.ObjectMeta{
+			Name: "other-runner", Namespace: "ci", Labels: map[string]string{warmPoolOwnerLabel: "crashed-process"},
+		}},
+	)
+
+	require.NoError(t, removeOrphanedWarmPods(context.Background(), client, config))
+
+	pods, err := client.CoreV1().Pods("ci").List(context.Background(), metav1.ListOptions{})
+	require.NoError(t, err)
+
+	var names []string
+	for _, pod := range pods.Items {
+		names = append(names, pod.Name)
+	}
+	assert.ElementsMatch(t, []string{"pooled", "assigned", "other-runner"}, names)
+}
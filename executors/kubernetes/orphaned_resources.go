@@ -0,0 +1,429 @@
+package kubernetes
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+const (
+	// the labels identify the runner manager and the job the resources are
+	// created for. The runner token is hashed as the labels are readable by
+	// anyone allowed to list the resources.
+	runnerTokenHashLabel = "manager." + k8sAnnotationPrefix + "token-hash"
+	runnerSystemIDLabel  = "manager." + k8sAnnotationPrefix + "system-id"
+	jobIDLabel           = "job." + k8sAnnotationPrefix + "id"
+)
+
+// orphanedResources is shared by all the jobs handled by this process, so that
+// the garbage collectors of the runners know which jobs are still running.
+var orphanedResources = newOrphanedResourcesGC()
+
+type orphanedResourceKind struct {
+	name   string
+	list   func(ctx context.Context, c kubernetes.Interface, namespace string, opts metav1.ListOptions) (runtime.Object, error)
+	delete func(ctx context.Context, c kubernetes.Interface, namespace, name string, opts metav1.DeleteOptions) error
+}
+
+var orphanedResourceKinds = []orphanedResourceKind{
+	{
+		name: "pod",
+		list: func(ctx context.Context, c kubernetes.Interface, namespace string, opts metav1.ListOptions) (runtime.Object, error) {
+			return c.CoreV1().Pods(namespace).List(ctx, opts)
+		},
+		delete: func(ctx context.Context, c kubernetes.Interface, namespace, name string, opts metav1.DeleteOptions) error {
+			return c.CoreV1().Pods(namespace).Delete(ctx, name, opts)
+		},
+	},
+	{
+		name: "secret",
+		list: func(ctx context.Context, c kubernetes.Interface, namespace string, opts metav1.ListOptions) (runtime.Object, error) {
+			return c.CoreV1().Secrets(namespace).List(ctx, opts)
+		},
+		delete: func(ctx context.Context, c kubernetes.Interface, namespace, name string, opts metav1.DeleteOptions) error {
+			return c.CoreV1().Secrets(namespace).Delete(ctx, name, opts)
+		},
+	},
+	{
+		name: "service",
+		list: func(ctx context.Context, c kubernetes.Interface, namespace string, opts metav1.ListOptions) (runtime.Object, error) {
+			return c.CoreV1().Services(namespace).List(ctx, opts)
+		},
+		delete: func(ctx context.Context, c kubernetes.Interface, namespace, name string, opts metav1.DeleteOptions) error {
+			return c.CoreV1().Services(namespace).Delete(ctx, name, opts)
+		},
+	},
+	{
+		name: "configmap",
+		list: func(ctx context.Context, c kubernetes.Interface, namespace string, opts metav1.ListOptions) (runtime.Object, error) {
+			return c.CoreV1().ConfigMaps(namespace).List(ctx, opts)
+		},
+		delete: func(ctx context.Context, c kubernetes.Interface, namespace, name string, opts metav1.DeleteOptions) error {
+			return c.CoreV1().ConfigMaps(namespace).Delete(ctx, name, opts)
+		},
+	},
+}
+
+type orphanedResourcesSweeper struct {
+	config common.RunnerConfig
+	cancel func()
+	done   chan struct{}
+}
+
+// orphanedResourcesGC runs a garbage collector for every runner that has it
+// configured. The collector deletes the resources labeled with the runner's
+// token hash and system ID whose job isn't running in this process anymore,
+// which are left behind when the runner crashes or when the cleanup of a job
+// times out.
+type orphanedResourcesGC struct {
+	lock     sync.Mutex
+	jobs     map[string]map[int64]int
+	sweepers map[string]*orphanedResourcesSweeper
+
+	now func() time.Time
+
+	resources *prometheus.CounterVec
+	sweeps    *prometheus.CounterVec
+}
+
+func newOrphanedResourcesGC() *orphanedResourcesGC {
+	return &orphanedResourcesGC{
+		jobs:     make(map[string]map[int64]int),
+		sweepers: make(map[string]*orphanedResourcesSweeper),
+		now:      time.Now,
+		resources: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "gitlab_runner_kubernetes_orphaned_resources_total",
+				Help: "Total number of orphaned resources found by the garbage collectors, by the outcome of their deletion",
+			},
+			[]string{"runner", "kind", "status"},
+		),
+		sweeps: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "gitlab_runner_kubernetes_orphaned_resources_sweeps_total",
+				Help: "Total number of sweeps of the orphaned resources garbage collectors",
+			},
+			[]string{"runner", "status"},
+		),
+	}
+}
+
+// runnerManagerLabels returns the labels of the resources created by the
+// runner manager
+func runnerManagerLabels(config *common.RunnerConfig) map[string]string {
+	sum := sha256.Sum256([]byte(config.Token))
+
+	return map[string]string{
+		runnerTokenHashLabel: fmt.Sprintf("%x", sum[:16]),
+		runnerSystemIDLabel:  sanitizeLabel(config.GetSystemID()),
+	}
+}
+
+func runnerManagerKey(config *common.RunnerConfig) string {
+	return labels.SelectorFromSet(runnerManagerLabels(config)).String()
+}
+
+// resourceLabels returns the labels of the resources created for the job
+func (s *executor) resourceLabels() map[string]string {
+	l := runnerManagerLabels(&s.Config)
+	l[jobIDLabel] = strconv.FormatInt(s.Build.ID, 10)
+
+	return l
+}
+
+// track records that the job is running, for its resources not to be deleted
+func (gc *orphanedResourcesGC) track(config *common.RunnerConfig, jobID int64) {
+	key := runnerManagerKey(config)
+
+	gc.lock.Lock()
+	defer gc.lock.Unlock()
+
+	if gc.jobs[key] == nil {
+		gc.jobs[key] = make(map[int64]int)
+	}
+	gc.jobs[key][jobID]++
+}
+
+// untrack records that the job has ended, the resources it has left behind
+// are deleted once they are older than the grace period
+func (gc *orphanedResourcesGC) untrack(config *common.RunnerConfig, jobID int64) {
+	key := runnerManagerKey(config)
+
+	gc.lock.Lock()
+	defer gc.lock.Unlock()
+
+	gc.jobs[key][jobID]--
+	if gc.jobs[key][jobID] <= 0 {
+		delete(gc.jobs[key], jobID)
+	}
+	if len(gc.jobs[key]) == 0 {
+		delete(gc.jobs, key)
+	}
+}
+
+func (gc *orphanedResourcesGC) runningJobs(key string) map[int64]bool {
+	gc.lock.Lock()
+	defer gc.lock.Unlock()
+
+	running := make(map[int64]bool, len(gc.jobs[key]))
+	for jobID := range gc.jobs[key] {
+		running[jobID] = true
+	}
+
+	return running
+}
+
+// configure starts the garbage collectors of the runners that have it
+// configured, restarts the ones whose configuration changed and stops the
+// others
+func (gc *orphanedResourcesGC) configure(runners []*common.RunnerConfig) {
+	gc.lock.Lock()
+	defer gc.lock.Unlock()
+
+	configured := make(map[string]bool)
+
+	for _, runner := range runners {
+		if runner.Executor != common.ExecutorKubernetes || runner.Kubernetes == nil ||
+			runner.Kubernetes.OrphanedResourcesGC == nil {
+			continue
+		}
+
+		name := runner.ShortDescription()
+		logger := logrus.WithField("runner", name)
+
+		interval, err := runner.Kubernetes.OrphanedResourcesGC.GetInterval()
+		if err == nil {
+			_, err = runner.Kubernetes.OrphanedResourcesGC.GetGracePeriod()
+		}
+		if err != nil {
+			logger.WithError(err).Errorln("Invalid orphaned resources GC configuration")
+			continue
+		}
+
+		configured[name] = true
+
+		sweeper, ok := gc.sweepers[name]
+		if ok && sweeper.config.Token == runner.Token &&
+			sweeper.config.GetSystemID() == runner.GetSystemID() &&
+			reflect.DeepEqual(sweeper.config.Kubernetes, runner.Kubernetes) {
+			continue
+		}
+
+		if ok {
+			sweeper.cancel()
+		}
+
+		logger.WithField("interval", interval).Debugln("Starting orphaned resources GC")
+		gc.sweepers[name] = gc.start(*runner, interval)
+	}
+
+	for name, sweeper := range gc.sweepers {
+		if !configured[name] {
+			sweeper.cancel()
+			delete(gc.sweepers, name)
+		}
+	}
+}
+
+func (gc *orphanedResourcesGC) start(config common.RunnerConfig, interval time.Duration) *orphanedResourcesSweeper {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	sweeper := &orphanedResourcesSweeper{
+		config: config,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		defer close(sweeper.done)
+
+		runner := config.ShortDescription()
+		logger := logrus.WithField("runner", runner)
+
+		for {
+			err := gc.sweep(ctx, &sweeper.config, logger)
+			if ctx.Err() != nil {
+				return
+			}
+
+			if err != nil {
+				gc.sweeps.WithLabelValues(runner, "failure").Inc()
+				logger.WithError(err).Warningln("Failed to delete the orphaned Kubernetes resources")
+			} else {
+				gc.sweeps.WithLabelValues(runner, "success").Inc()
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(interval):
+			}
+		}
+	}()
+
+	return sweeper
+}
+
+// stop stops all the garbage collectors and waits for their sweeps to finish
+func (gc *orphanedResourcesGC) stop(ctx context.Context) {
+	gc.lock.Lock()
+	sweepers := gc.sweepers
+	gc.sweepers = make(map[string]*orphanedResourcesSweeper)
+	gc.lock.Unlock()
+
+	for _, sweeper := range sweepers {
+		sweeper.cancel()
+	}
+
+	for _, sweeper := range sweepers {
+		select {
+		case <-sweeper.done:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// sweep deletes the orphaned resources of the runner, or only logs them in dry
+// run mode. The deletions are preconditioned on the UID of the resources, so a
+// resource recreated with the same name in the meantime is kept.
+func (gc *orphanedResourcesGC) sweep(ctx context.Context, config *common.RunnerConfig, logger logrus.FieldLogger) error {
+	gcConfig := config.Kubernetes.OrphanedResourcesGC
+
+	gracePeriod, err := gcConfig.GetGracePeriod()
+	if err != nil {
+		return err
+	}
+
+	client, err := newOrphanedJobsKubeClient(config.Kubernetes)
+	if err != nil {
+		return fmt.Errorf("connecting to Kubernetes: %w", err)
+	}
+
+	namespace := config.Kubernetes.Namespace
+	if gcConfig.AllNamespaces {
+		namespace = metav1.NamespaceAll
+	} else if namespace == "" {
+		namespace = DefaultResourceIdentifier
+	}
+
+	runner := config.ShortDescription()
+	selector := runnerManagerKey(config)
+	// the running jobs are read before the resources are listed, the resources
+	// of the jobs started in the meantime are protected by the grace period
+	running := gc.runningJobs(selector)
+
+	var errs []error
+	for _, kind := range orphanedResourceKinds {
+		list, err := kind.list(ctx, client, namespace, metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			errs = append(errs, fmt.Errorf("listing %ss: %w", kind.name, err))
+			continue
+		}
+
+		items, err := meta.ExtractList(list)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("reading %ss: %w", kind.name, err))
+			continue
+		}
+
+		for _, item := range items {
+			obj, err := meta.Accessor(item)
+			if err != nil || !gc.isOrphaned(obj, running, gracePeriod) {
+				continue
+			}
+
+			resourceLogger := logger.WithFields(logrus.Fields{
+				"kind":      kind.name,
+				"namespace": obj.GetNamespace(),
+				"name":      obj.GetName(),
+				"job":       obj.GetLabels()[jobIDLabel],
+			})
+
+			if gcConfig.DryRun {
+				gc.resources.WithLabelValues(runner, kind.name, "dry_run").Inc()
+				resourceLogger.Infoln("Found orphaned Kubernetes resource (dry run)")
+				continue
+			}
+
+			uid := obj.GetUID()
+			err = kind.delete(ctx, client, obj.GetNamespace(), obj.GetName(), metav1.DeleteOptions{
+				GracePeriodSeconds: config.Kubernetes.GetCleanupGracePeriodSeconds(),
+				PropagationPolicy:  &PropagationPolicy,
+				Preconditions:      &metav1.Preconditions{UID: &uid},
+			})
+			if err != nil && !kubeerrors.IsNotFound(err) && !kubeerrors.IsConflict(err) {
+				gc.resources.WithLabelValues(runner, kind.name, "failure").Inc()
+				resourceLogger.WithError(err).Warningln("Failed to delete orphaned Kubernetes resource")
+				continue
+			}
+
+			gc.resources.WithLabelValues(runner, kind.name, "deleted").Inc()
+			resourceLogger.Infoln("Deleted orphaned Kubernetes resource")
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// isOrphaned returns whether the resource has been created for a job that
+// isn't running anymore, or is an idle warm pod that isn't in the warm pool of
+// this process, and is older than the grace period
+func (gc *orphanedResourcesGC) isOrphaned(obj metav1.Object, running map[int64]bool, gracePeriod time.Duration) bool {
+	if obj.GetDeletionTimestamp() != nil {
+		return false
+	}
+
+	if gc.now().Sub(obj.GetCreationTimestamp().Time) < gracePeriod {
+		return false
+	}
+
+	if isIdleWarmPod(obj) {
+		return obj.GetLabels()[warmPoolOwnerLabel] != warmPods.owner
+	}
+
+	jobID, err := strconv.ParseInt(obj.GetLabels()[jobIDLabel], 10, 64)
+	if err != nil {
+		return false
+	}
+
+	return !running[jobID]
+}
+
+// Describe implements prometheus.Collector.
+func (gc *orphanedResourcesGC) Describe(ch chan<- *prometheus.Desc) {
+	gc.resources.Describe(ch)
+	gc.sweeps.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (gc *orphanedResourcesGC) Collect(ch chan<- prometheus.Metric) {
+	gc.resources.Collect(ch)
+	gc.sweeps.Collect(ch)
+}
+
+// Describe implements prometheus.Collector.
+func (p executorProvider) Describe(ch chan<- *prometheus.Desc) {
+	orphanedResources.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (p executorProvider) Collect(ch chan<- prometheus.Metric) {
+	orphanedResources.Collect(ch)
+}
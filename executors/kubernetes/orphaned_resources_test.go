@@ -0,0 +1,205 @@
+//go:build !integration
+
+package kubernetes
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+func TestOrphanedResourcesGCSweep(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	newConfig := func(token string, gcConfig common.KubernetesOrphanedGCConfig) *common.RunnerConfig {
+		return &common.RunnerConfig{
+			RunnerCredentials: common.RunnerCredentials{Token: token},
+			RunnerSettings: common.RunnerSettings{
+				Executor: common.ExecutorKubernetes,
+				Kubernetes: &common.KubernetesConfig{
+					Namespace:           "ci",
+					OrphanedResourcesGC: &gcConfig,
+				},
+			},
+		}
+	}
+
+	meta := func(namespace, name, jobID string, age time.Duration, runner *common.RunnerConfig) metav1.ObjectMeta {
+		l := runnerManagerLabels(runner)
+		if jobID != "" {
+			l[jobIDLabel] = jobID
+		}
+
+		return metav1.ObjectMeta{
+			Name:              name,
+			Namespace:         namespace,
+			Labels:            l,
+			CreationTimestamp: metav1.NewTime(now.Add(-age)),
+		}
+	}
+
+	newObjects := func(runner *common.RunnerConfig) []runtime.Object {
+		other := newConfig("other-token", common.KubernetesOrphanedGCConfig{})
+		deleting := meta("ci", "deleting", "1", 2*time.Hour, runner)
+		deleting.DeletionTimestamp = &metav1.Time{Time: now}
+		deleting.Finalizers = []string{"kubernetes"}
+
+		return []runtime.Object{
+			&api.Pod{ObjectMeta: meta("ci", "orphaned", "1", 2*time.Hour, runner)},
+			&api.Pod{ObjectMeta: meta("ci", "running", "2", 2*time.Hour, runner)},
+			&api.Pod{ObjectMeta: meta("ci", "recent", "3", 10*time.Minute, runner)},
+			&api.Pod{ObjectMeta: meta("ci", "other-runner", "1", 2*time.Hour, other)},
+			&api.Pod{ObjectMeta: meta("ci", "no-job", "", 2*time.Hour, runner)},
+			&api.Pod{ObjectMeta: meta("other", "other-namespace", "1", 2*time.Hour, runner)},
+			&api.Pod{ObjectMeta: deleting},
+			&api.Secret{ObjectMeta: meta("ci", "orphaned", "1", 2*time.Hour, runner)},
+			&api.Service{ObjectMeta: meta("ci", "orphaned", "1", 2*time.Hour, runner)},
+			&api.ConfigMap{ObjectMeta: meta("ci", "orphaned", "1", 2*time.Hour, runner)},
+		}
+	}
+
+	tests := map[string]struct {
+		gcConfig        common.KubernetesOrphanedGCConfig
+		expectedPods    []string
+		expectedDeleted float64
+		expectedDryRun  float64
+	}{
+		"deletes the orphaned resources": {
+			expectedPods:    []string{"ci/running", "ci/recent", "ci/other-runner", "ci/no-job", "other/other-namespace", "ci/deleting"},
+			expectedDeleted: 4,
+		},
+		"deletes the orphaned resources of all the namespaces": {
+			gcConfig:        common.KubernetesOrphanedGCConfig{AllNamespaces: true},
+			expectedPods:    []string{"ci/running", "ci/recent", "ci/other-runner", "ci/no-job", "ci/deleting"},
+			expectedDeleted: 5,
+		},
+		"applies the grace period": {
+			gcConfig:        common.KubernetesOrphanedGCConfig{GracePeriod: "5m"},
+			expectedPods:    []string{"ci/running", "ci/other-runner", "ci/no-job", "other/other-namespace", "ci/deleting"},
+			expectedDeleted: 5,
+		},
+		"dry run": {
+			gcConfig: common.KubernetesOrphanedGCConfig{DryRun: true},
+			expectedPods: []string{
+				"ci/orphaned", "ci/running", "ci/recent", "ci/other-runner", "ci/no-job", "other/other-namespace", "ci/deleting",
+			},
+			expectedDryRun: 4,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			config := newConfig("runner-token", tt.gcConfig)
+			client := fake.NewSimpleClientset(newObjects(config)...)
+
+			oldNewClient := newOrphanedJobsKubeClient
+			defer func() { newOrphanedJobsKubeClient = oldNewClient }()
+			newOrphanedJobsKubeClient = func(_ *common.KubernetesConfig) (kubernetes.Interface, error) {
+				return client, nil
+			}
+
+			gc := newOrphanedResourcesGC()
+			gc.now = func() time.Time { return now }
+			gc.track(config, 2)
+
+			err := gc.sweep(context.Background(), config, logrus.New())
+			require.NoError(t, err)
+
+			pods, err := client.CoreV1().Pods(metav1.NamespaceAll).List(context.Background(), metav1.ListOptions{})
+			require.NoError(t, err)
+
+			var names []string
+			for _, pod := range pods.Items {
+				names = append(names, pod.Namespace+"/"+pod.Name)
+			}
+			assert.ElementsMatch(t, tt.expectedPods, names)
+
+			var deleted, dryRun float64
+			for _, kind := range []string{"pod", "secret", "service", "configmap"} {
+				deleted += testutil.ToFloat64(gc.resources.WithLabelValues(config.ShortDescription(), kind, "deleted"))
+				dryRun += testutil.ToFloat64(gc.resources.WithLabelValues(config.ShortDescription(), kind, "dry_run"))
+			}
+			assert.Equal(t, tt.expectedDeleted, deleted)
+			assert.Equal(t, tt.expectedDryRun, dryRun)
+
+			_, err = client.CoreV1().Secrets("ci").Get(context.Background(), "orphaned", metav1.GetOptions{})
+			assert.Equal(t, tt.gcConfig.DryRun, err == nil)
+		})
+	}
+}
+
+func TestOrphanedResourcesGCTrack(t *testing.T) {
+	config := &common.RunnerConfig{RunnerCredentials: common.RunnerCredentials{Token: "runner-token"}}
+	key := runnerManagerKey(config)
+
+	gc := newOrphanedResourcesGC()
+	gc.track(config, 1)
+	gc.track(config, 1)
+	gc.track(config, 2)
+	assert.Equal(t, map[int64]bool{1: true, 2: true}, gc.runningJobs(key))
+
+	// a job prepared twice is running until both of its executors are cleaned up
+	gc.untrack(config, 1)
+	assert.Equal(t, map[int64]bool{1: true, 2: true}, gc.runningJobs(key))
+
+	gc.untrack(config, 1)
+	gc.untrack(config, 2)
+	assert.Empty(t, gc.runningJobs(key))
+	assert.Empty(t, gc.jobs)
+}
+
+func TestOrphanedResourcesGCConfigure(t *testing.T) {
+	oldNewClient := newOrphanedJobsKubeClient
+	defer func() { newOrphanedJobsKubeClient = oldNewClient }()
+	newOrphanedJobsKubeClient = func(_ *common.KubernetesConfig) (kubernetes.Interface, error) {
+		return fake.NewSimpleClientset(), nil
+	}
+
+	newRunner := func(token string, gcConfig *common.KubernetesOrphanedGCConfig) *common.RunnerConfig {
+		return &common.RunnerConfig{
+			RunnerCredentials: common.RunnerCredentials{Token: token},
+			RunnerSettings: common.RunnerSettings{
+				Executor:   common.ExecutorKubernetes,
+				Kubernetes: &common.KubernetesConfig{OrphanedResourcesGC: gcConfig},
+			},
+		}
+	}
+
+	gc := newOrphanedResourcesGC()
+	defer gc.stop(context.Background())
+
+	gc.configure([]*common.RunnerConfig{
+		newRunner("runner-1", &common.KubernetesOrphanedGCConfig{}),
+		newRunner("runner-2", nil),
+		newRunner("runner-3", &common.KubernetesOrphanedGCConfig{Interval: "invalid"}),
+	})
+	require.Len(t, gc.sweepers, 1)
+	first := gc.sweepers["runner-1"]
+	require.NotNil(t, first)
+
+	gc.configure([]*common.RunnerConfig{
+		newRunner("runner-1", &common.KubernetesOrphanedGCConfig{}),
+	})
+	assert.Same(t, first, gc.sweepers["runner-1"])
+
+	gc.configure([]*common.RunnerConfig{
+		newRunner("runner-1", &common.KubernetesOrphanedGCConfig{DryRun: true}),
+	})
+	assert.NotSame(t, first, gc.sweepers["runner-1"])
+	<-first.done
+
+	gc.configure(nil)
+	assert.Empty(t, gc.sweepers)
+}
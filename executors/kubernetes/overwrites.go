@@ -24,6 +24,8 @@ const (
 	// PodAnnotationsOverwriteVariablePrefix is the prefix for all the JobVariable keys containing
 	// user overwritten PodAnnotations
 	PodAnnotationsOverwriteVariablePrefix = "KUBERNETES_POD_ANNOTATIONS_"
+	// MachineClassOverwriteVariableName is the key for the JobVariable containing the machine class selected by the user
+	MachineClassOverwriteVariableName = "KUBERNETES_MACHINE_CLASS"
 	// NodeSelectorOverwriteVariablePrefix is the prefix for all the JobVariable keys containing
 	// user overwritten NodeSelectors
 	NodeSelectorOverwriteVariablePrefix = "KUBERNETES_NODE_SELECTOR_"
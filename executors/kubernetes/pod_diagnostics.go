@@ -0,0 +1,201 @@
+package kubernetes
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"golang.org/x/net/context"
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+// podDiagnosticKind is a cause of a pod not running. The kinds are ordered by
+// precedence: when a pod has several, the job fails with the failure reason of
+// the first one.
+type podDiagnosticKind int
+
+const (
+	podDiagnosticImagePull podDiagnosticKind = iota
+	podDiagnosticResourceQuota
+	podDiagnosticVolumeBinding
+	podDiagnosticInsufficientResources
+	podDiagnosticUnschedulable
+)
+
+var podDiagnosticKinds = []struct {
+	title  string
+	reason common.JobFailureReason
+}{
+	podDiagnosticImagePull:             {title: "Image pull failed", reason: common.ImagePullFailure},
+	podDiagnosticResourceQuota:         {title: "Resource quota exceeded", reason: common.ResourceQuotaFailure},
+	podDiagnosticVolumeBinding:         {title: "Volume not bound", reason: common.VolumeBindingFailure},
+	podDiagnosticInsufficientResources: {title: "Insufficient resources", reason: common.InsufficientResourcesFailure},
+	podDiagnosticUnschedulable:         {title: "Unschedulable", reason: common.PodSchedulingFailure},
+}
+
+// podDiagnostics holds the latest message found for each cause of a pod not
+// running
+type podDiagnostics map[podDiagnosticKind]string
+
+func (d podDiagnostics) kinds() []podDiagnosticKind {
+	kinds := make([]podDiagnosticKind, 0, len(d))
+	for kind := range d {
+		kinds = append(kinds, kind)
+	}
+	sort.Slice(kinds, func(i, j int) bool { return kinds[i] < kinds[j] })
+
+	return kinds
+}
+
+func (d podDiagnostics) String() string {
+	var sb strings.Builder
+	for _, kind := range d.kinds() {
+		_, _ = fmt.Fprintf(&sb, "\t%s: %s\n", podDiagnosticKinds[kind].title, d[kind])
+	}
+
+	return sb.String()
+}
+
+// summary describes the cause with the highest precedence
+func (d podDiagnostics) summary() string {
+	kinds := d.kinds()
+	if len(kinds) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("%s: %s", strings.ToLower(podDiagnosticKinds[kinds[0]].title), d[kinds[0]])
+}
+
+func (d podDiagnostics) failureReason() common.JobFailureReason {
+	kinds := d.kinds()
+	if len(kinds) == 0 {
+		return common.RunnerSystemFailure
+	}
+
+	return podDiagnosticKinds[kinds[0]].reason
+}
+
+func (d podDiagnostics) addSchedulingFailure(message string) {
+	switch {
+	case strings.Contains(message, "exceeded quota"):
+		d[podDiagnosticResourceQuota] = message
+	case strings.Contains(message, "Insufficient"):
+		d[podDiagnosticInsufficientResources] = message
+	case strings.Contains(strings.ToLower(message), "persistentvolumeclaim"),
+		strings.Contains(message, "volume node affinity conflict"):
+		d[podDiagnosticVolumeBinding] = message
+	default:
+		d[podDiagnosticUnschedulable] = message
+	}
+}
+
+func isImagePullReason(reason string) bool {
+	return reason == "ErrImagePull" || reason == "ImagePullBackOff"
+}
+
+// getPodDiagnostics explains why the pod isn't running from its conditions,
+// the waiting reasons of its containers and the warning events of the pod and
+// of its persistent volume claims. The events are left out when they can't be
+// listed, for example when the service account isn't allowed to.
+func getPodDiagnostics(ctx context.Context, c *kubernetes.Clientset, pod *api.Pod) podDiagnostics {
+	d := podDiagnostics{}
+
+	scheduled := false
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type != api.PodScheduled {
+			continue
+		}
+
+		scheduled = condition.Status == api.ConditionTrue
+		if !scheduled && condition.Reason == api.PodReasonUnschedulable {
+			d.addSchedulingFailure(condition.Message)
+		}
+	}
+
+	// the waiting message of a container backing off only names the image,
+	// the registry error is found in the events of the failed pulls
+	pulling := map[string]bool{}
+	for _, container := range append(pod.Status.InitContainerStatuses, pod.Status.ContainerStatuses...) {
+		waiting := container.State.Waiting
+		if waiting == nil || !isImagePullReason(waiting.Reason) {
+			continue
+		}
+
+		pulling[container.Image] = true
+		d[podDiagnosticImagePull] = waiting.Message
+	}
+
+	for _, event := range listWarningEvents(ctx, c, pod.Namespace, "Pod", pod.Name) {
+		switch {
+		case strings.Contains(event.Message, "exceeded quota"):
+			d[podDiagnosticResourceQuota] = event.Message
+		case event.Reason == "FailedScheduling":
+			if !scheduled {
+				d.addSchedulingFailure(event.Message)
+			}
+		case event.Reason == "FailedMount", event.Reason == "FailedAttachVolume":
+			d[podDiagnosticVolumeBinding] = event.Message
+		case event.Reason == "Failed":
+			for image := range pulling {
+				if strings.Contains(event.Message, fmt.Sprintf("Failed to pull image %q", image)) {
+					d[podDiagnosticImagePull] = event.Message
+				}
+			}
+		}
+	}
+
+	for _, volume := range pod.Spec.Volumes {
+		if volume.PersistentVolumeClaim == nil {
+			continue
+		}
+
+		events := listWarningEvents(ctx, c, pod.Namespace, "PersistentVolumeClaim", volume.PersistentVolumeClaim.ClaimName)
+		for _, event := range events {
+			switch {
+			case strings.Contains(event.Message, "exceeded quota"):
+				d[podDiagnosticResourceQuota] = event.Message
+			case event.Reason == "ProvisioningFailed", event.Reason == "FailedBinding":
+				d[podDiagnosticVolumeBinding] = event.Message
+			}
+		}
+	}
+
+	return d
+}
+
+// listWarningEvents returns the warning events of an object, oldest first
+func listWarningEvents(ctx context.Context, c *kubernetes.Clientset, namespace, kind, name string) []api.Event {
+	events, err := c.CoreV1().Events(namespace).List(ctx, metav1.ListOptions{
+		FieldSelector: fmt.Sprintf(
+			"involvedObject.kind=%s,involvedObject.name=%s,type=%s",
+			kind,
+			name,
+			k8sEventWarningType,
+		),
+	})
+	if err != nil {
+		return nil
+	}
+
+	sort.SliceStable(events.Items, func(i, j int) bool {
+		return eventTime(events.Items[i]).Before(eventTime(events.Items[j]))
+	})
+
+	return events.Items
+}
+
+func eventTime(event api.Event) time.Time {
+	switch {
+	case !event.LastTimestamp.IsZero():
+		return event.LastTimestamp.Time
+	case !event.EventTime.IsZero():
+		return event.EventTime.Time
+	default:
+		return event.CreationTimestamp.Time
+	}
+}
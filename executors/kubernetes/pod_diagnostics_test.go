@@ -0,0 +1,278 @@
+//go:build !integration
+
+package kubernetes
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest/fake"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+func newDiagnosticsTestClient(t *testing.T, pod *api.Pod, events map[string][]api.Event) *kubernetes.Clientset {
+	version, codec := testVersionAndCodec()
+
+	return testKubernetesClient(version, fake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+		switch p, m := req.URL.Path, req.Method; {
+		case p == "/api/"+version+"/namespaces/test-ns/pods/test-pod" && m == http.MethodGet:
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       objBody(codec, pod),
+				Header:     map[string][]string{"Content-Type": {"application/json"}},
+			}, nil
+		case p == "/api/"+version+"/namespaces/test-ns/events" && m == http.MethodGet:
+			list := &api.EventList{Items: events[req.URL.Query().Get("fieldSelector")]}
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       objBody(codec, list),
+				Header:     map[string][]string{"Content-Type": {"application/json"}},
+			}, nil
+		default:
+			t.Errorf("unexpected request: %s %s", req.Method, req.URL)
+			return nil, fmt.Errorf("unexpected request")
+		}
+	}))
+}
+
+func podEventsSelector(kind, name string) string {
+	return fmt.Sprintf("involvedObject.kind=%s,involvedObject.name=%s,type=Warning", kind, name)
+}
+
+func newWarningEvent(reason, message string, lastTimestamp time.Time) api.Event {
+	return api.Event{
+		Reason:        reason,
+		Message:       message,
+		Type:          api.EventTypeWarning,
+		LastTimestamp: metav1.NewTime(lastTimestamp),
+	}
+}
+
+func TestGetPodDiagnostics(t *testing.T) {
+	now := time.Now()
+	unschedulable := api.PodCondition{
+		Type:    api.PodScheduled,
+		Status:  api.ConditionFalse,
+		Reason:  api.PodReasonUnschedulable,
+		Message: "0/3 nodes are available: 3 node(s) didn't match Pod's node affinity/selector.",
+	}
+
+	tests := map[string]struct {
+		status              api.PodStatus
+		volumes             []api.Volume
+		events              map[string][]api.Event
+		expectedDiagnostics podDiagnostics
+	}{
+		"no diagnostics": {
+			status: api.PodStatus{Phase: api.PodPending},
+		},
+		"unschedulable": {
+			status: api.PodStatus{
+				Phase:      api.PodPending,
+				Conditions: []api.PodCondition{unschedulable},
+			},
+			expectedDiagnostics: podDiagnostics{
+				podDiagnosticUnschedulable: unschedulable.Message,
+			},
+		},
+		"insufficient resources from the latest event": {
+			status: api.PodStatus{
+				Phase:      api.PodPending,
+				Conditions: []api.PodCondition{unschedulable},
+			},
+			events: map[string][]api.Event{
+				podEventsSelector("Pod", "test-pod"): {
+					newWarningEvent("FailedScheduling", "0/3 nodes are available: 3 Insufficient memory.", now),
+					newWarningEvent("FailedScheduling", "0/3 nodes are available: 3 Insufficient cpu.", now.Add(-time.Minute)),
+				},
+			},
+			expectedDiagnostics: podDiagnostics{
+				podDiagnosticUnschedulable:         unschedulable.Message,
+				podDiagnosticInsufficientResources: "0/3 nodes are available: 3 Insufficient memory.",
+			},
+		},
+		"scheduling events of a scheduled pod": {
+			status: api.PodStatus{
+				Phase:      api.PodPending,
+				Conditions: []api.PodCondition{{Type: api.PodScheduled, Status: api.ConditionTrue}},
+			},
+			events: map[string][]api.Event{
+				podEventsSelector("Pod", "test-pod"): {
+					newWarningEvent("FailedScheduling", "0/3 nodes are available: 3 Insufficient cpu.", now),
+				},
+			},
+		},
+		"image pull with registry error": {
+			status: api.PodStatus{
+				Phase: api.PodPending,
+				ContainerStatuses: []api.ContainerStatus{
+					{
+						Name:  "build",
+						Image: "registry.example.com/image:latest",
+						State: api.ContainerState{
+							Waiting: &api.ContainerStateWaiting{
+								Reason:  "ImagePullBackOff",
+								Message: `Back-off pulling image "registry.example.com/image:latest"`,
+							},
+						},
+					},
+				},
+			},
+			events: map[string][]api.Event{
+				podEventsSelector("Pod", "test-pod"): {
+					newWarningEvent(
+						"Failed",
+						`Failed to pull image "registry.example.com/image:latest": 401 Unauthorized`,
+						now,
+					),
+					newWarningEvent("Failed", `Failed to pull image "other:latest": not found`, now),
+				},
+			},
+			expectedDiagnostics: podDiagnostics{
+				podDiagnosticImagePull: `Failed to pull image "registry.example.com/image:latest": 401 Unauthorized`,
+			},
+		},
+		"unbound persistent volume claim": {
+			status: api.PodStatus{
+				Phase: api.PodPending,
+				Conditions: []api.PodCondition{
+					{
+						Type:    api.PodScheduled,
+						Status:  api.ConditionFalse,
+						Reason:  api.PodReasonUnschedulable,
+						Message: "0/3 nodes are available: pod has unbound immediate PersistentVolumeClaims.",
+					},
+				},
+			},
+			volumes: []api.Volume{
+				{
+					Name: "workspace",
+					VolumeSource: api.VolumeSource{
+						PersistentVolumeClaim: &api.PersistentVolumeClaimVolumeSource{ClaimName: "workspace"},
+					},
+				},
+			},
+			events: map[string][]api.Event{
+				podEventsSelector("PersistentVolumeClaim", "workspace"): {
+					newWarningEvent("ProvisioningFailed", `storageclass.storage.k8s.io "fast" not found`, now),
+				},
+			},
+			expectedDiagnostics: podDiagnostics{
+				podDiagnosticVolumeBinding: `storageclass.storage.k8s.io "fast" not found`,
+			},
+		},
+		"exceeded quota of a persistent volume claim": {
+			status: api.PodStatus{Phase: api.PodPending},
+			volumes: []api.Volume{
+				{
+					Name: "workspace",
+					VolumeSource: api.VolumeSource{
+						PersistentVolumeClaim: &api.PersistentVolumeClaimVolumeSource{ClaimName: "workspace"},
+					},
+				},
+			},
+			events: map[string][]api.Event{
+				podEventsSelector("PersistentVolumeClaim", "workspace"): {
+					newWarningEvent(
+						"ProvisioningFailed",
+						"exceeded quota: storage, requested: requests.storage=10Gi, used: requests.storage=95Gi, limited: requests.storage=100Gi",
+						now,
+					),
+				},
+			},
+			expectedDiagnostics: podDiagnostics{
+				podDiagnosticResourceQuota: "exceeded quota: storage, requested: requests.storage=10Gi, " +
+					"used: requests.storage=95Gi, limited: requests.storage=100Gi",
+			},
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			pod := &api.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "test-pod", Namespace: "test-ns"},
+				Spec:       api.PodSpec{Volumes: tt.volumes},
+				Status:     tt.status,
+			}
+
+			c := newDiagnosticsTestClient(t, pod, tt.events)
+
+			diagnostics := getPodDiagnostics(context.Background(), c, pod)
+			if tt.expectedDiagnostics == nil {
+				assert.Empty(t, diagnostics)
+				return
+			}
+			assert.Equal(t, tt.expectedDiagnostics, diagnostics)
+		})
+	}
+}
+
+func TestPodDiagnostics(t *testing.T) {
+	var empty podDiagnostics
+	assert.Empty(t, empty.String())
+	assert.Empty(t, empty.summary())
+	assert.Equal(t, common.RunnerSystemFailure, empty.failureReason())
+
+	d := podDiagnostics{
+		podDiagnosticUnschedulable:         "node(s) had untolerated taint",
+		podDiagnosticInsufficientResources: "3 Insufficient cpu.",
+	}
+	assert.Equal(
+		t,
+		"\tInsufficient resources: 3 Insufficient cpu.\n\tUnschedulable: node(s) had untolerated taint\n",
+		d.String(),
+	)
+	assert.Equal(t, "insufficient resources: 3 Insufficient cpu.", d.summary())
+	assert.Equal(t, common.InsufficientResourcesFailure, d.failureReason())
+
+	d[podDiagnosticResourceQuota] = "exceeded quota: compute"
+	assert.Equal(t, common.ResourceQuotaFailure, d.failureReason())
+}
+
+func TestWaitForPodRunningDiagnostics(t *testing.T) {
+	pod := &api.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-pod", Namespace: "test-ns"},
+		Status:     api.PodStatus{Phase: api.PodPending},
+	}
+
+	c := newDiagnosticsTestClient(t, pod, map[string][]api.Event{
+		podEventsSelector("Pod", "test-pod"): {
+			newWarningEvent("FailedScheduling", "0/3 nodes are available: 3 Insufficient cpu.", time.Now()),
+		},
+	})
+
+	out := new(bytes.Buffer)
+	_, err := waitForPodRunning(context.Background(), c, pod, out, &common.KubernetesConfig{
+		PollInterval: 1,
+		PollTimeout:  1,
+	})
+
+	var buildErr *common.BuildError
+	require.ErrorAs(t, err, &buildErr)
+	assert.Equal(t, common.InsufficientResourcesFailure, buildErr.FailureReason)
+	assert.EqualError(
+		t,
+		err,
+		"timed out waiting for pod to start: insufficient resources: 0/3 nodes are available: 3 Insufficient cpu.",
+	)
+
+	// the diagnostics are printed once, as they didn't change while waiting
+	assert.Equal(
+		t,
+		"Waiting for pod test-ns/test-pod to be running, status is Pending\n"+
+			"Diagnostics for pod test-ns/test-pod:\n"+
+			"\tInsufficient resources: 0/3 nodes are available: 3 Insufficient cpu.\n"+
+			"Waiting for pod test-ns/test-pod to be running, status is Pending\n",
+		out.String(),
+	)
+}
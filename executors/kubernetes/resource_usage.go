@@ -0,0 +1,180 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/net/context"
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/featureflags"
+)
+
+const podMetricsPath = "/apis/metrics.k8s.io/v1beta1/namespaces/%s/pods/%s"
+
+var resourceUsagePollInterval = 10 * time.Second
+
+// podMetrics is the subset of the metrics.k8s.io PodMetrics resource
+// needed to account for the resources consumed by the build pod.
+type podMetrics struct {
+	Timestamp  metav1.Time     `json:"timestamp"`
+	Window     metav1.Duration `json:"window"`
+	Containers []struct {
+		Name  string           `json:"name"`
+		Usage api.ResourceList `json:"usage"`
+	} `json:"containers"`
+}
+
+type podMetricsFetcher func(ctx context.Context) (*podMetrics, error)
+
+// resourceUsageCollector polls the metrics API for the usage of the build
+// pod. The metrics API only exposes the current memory usage and CPU rate of
+// the containers, so the peak memory and CPU time are approximations based
+// on the samples, and disk and network usage are not available.
+type resourceUsageCollector struct {
+	lock          sync.Mutex
+	usage         common.ResourceUsage
+	sampled       bool
+	lastErr       error
+	lastTimestamp time.Time
+
+	cancel func()
+}
+
+func (c *resourceUsageCollector) watch(ctx context.Context, fetch podMetricsFetcher) {
+	c.stop()
+
+	ctx, cancel := context.WithCancel(ctx)
+	c.lock.Lock()
+	c.cancel = cancel
+	// the pod may have been recreated, so its CPU usage starts from scratch
+	c.lastTimestamp = time.Time{}
+	c.lock.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(resourceUsagePollInterval)
+		defer ticker.Stop()
+
+		for {
+			metrics, err := fetch(ctx)
+			if ctx.Err() != nil {
+				return
+			}
+			c.observe(metrics, err)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (c *resourceUsageCollector) stop() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.cancel != nil {
+		c.cancel()
+		c.cancel = nil
+	}
+}
+
+func (c *resourceUsageCollector) observe(metrics *podMetrics, err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if err != nil {
+		c.lastErr = err
+		return
+	}
+
+	// The usage is averaged over the window ending at the timestamp. The
+	// metrics may not have been refreshed since the last poll.
+	timestamp := metrics.Timestamp.Time
+	elapsed := metrics.Window.Duration
+	if !c.lastTimestamp.IsZero() {
+		if !timestamp.After(c.lastTimestamp) {
+			return
+		}
+		elapsed = timestamp.Sub(c.lastTimestamp)
+	}
+
+	var memory uint64
+	var cpu float64
+	for _, container := range metrics.Containers {
+		memory += uint64(container.Usage.Memory().Value())
+		cpu += float64(container.Usage.Cpu().MilliValue()) / 1000
+	}
+
+	if memory > c.usage.PeakMemoryBytes {
+		c.usage.PeakMemoryBytes = memory
+	}
+	c.usage.CPUSeconds += cpu * elapsed.Seconds()
+
+	c.lastTimestamp = timestamp
+	c.sampled = true
+}
+
+func (c *resourceUsageCollector) get() (*common.ResourceUsage, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if !c.sampled {
+		if c.lastErr != nil {
+			return nil, fmt.Errorf("retrieving pod metrics: %w", c.lastErr)
+		}
+
+		return nil, nil
+	}
+
+	usage := c.usage
+	return &usage, nil
+}
+
+func (s *executor) fetchPodMetrics(pod *api.Pod) podMetricsFetcher {
+	return func(ctx context.Context) (*podMetrics, error) {
+		raw, err := s.kubeClient.CoreV1().RESTClient().
+			Get().
+			AbsPath(fmt.Sprintf(podMetricsPath, pod.Namespace, pod.Name)).
+			DoRaw(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		var metrics podMetrics
+		if err := json.Unmarshal(raw, &metrics); err != nil {
+			return nil, fmt.Errorf("decoding pod metrics: %w", err)
+		}
+
+		return &metrics, nil
+	}
+}
+
+func (s *executor) watchResourceUsage(ctx context.Context) {
+	if !s.Build.IsFeatureFlagOn(featureflags.ReportResourceUsage) {
+		return
+	}
+
+	if s.resourceUsage == nil {
+		s.resourceUsage = &resourceUsageCollector{}
+	}
+
+	s.resourceUsage.watch(ctx, s.fetchPodMetrics(s.pod))
+}
+
+// ResourceUsage implements common.ResourceUsageReporter.
+func (s *executor) ResourceUsage() (*common.ResourceUsage, error) {
+	if s.resourceUsage == nil {
+		return nil, nil
+	}
+
+	s.resourceUsage.stop()
+
+	return s.resourceUsage.get()
+}
@@ -0,0 +1,101 @@
+//go:build !integration
+
+package kubernetes
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	api "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+func newPodMetrics(timestamp time.Time, usages ...api.ResourceList) *podMetrics {
+	metrics := &podMetrics{
+		Timestamp: metav1.NewTime(timestamp),
+		Window:    metav1.Duration{Duration: 15 * time.Second},
+	}
+
+	for _, usage := range usages {
+		metrics.Containers = append(metrics.Containers, struct {
+			Name  string           `json:"name"`
+			Usage api.ResourceList `json:"usage"`
+		}{Usage: usage})
+	}
+
+	return metrics
+}
+
+func newResourceList(cpu, memory string) api.ResourceList {
+	return api.ResourceList{
+		api.ResourceCPU:    resource.MustParse(cpu),
+		api.ResourceMemory: resource.MustParse(memory),
+	}
+}
+
+func TestResourceUsageCollector(t *testing.T) {
+	now := time.Now()
+
+	t.Run("samples accumulated", func(t *testing.T) {
+		c := &resourceUsageCollector{}
+
+		c.observe(newPodMetrics(now, newResourceList("500m", "100Mi"), newResourceList("500m", "28Mi")), nil)
+		c.observe(nil, errors.New("transient error"))
+		c.observe(newPodMetrics(now, newResourceList("2", "1Gi")), nil)
+		c.observe(newPodMetrics(now.Add(10*time.Second), newResourceList("2", "256Mi")), nil)
+
+		usage, err := c.get()
+		require.NoError(t, err)
+		assert.Equal(t, &common.ResourceUsage{
+			PeakMemoryBytes: 256 * 1024 * 1024,
+			CPUSeconds:      35,
+		}, usage)
+	})
+
+	t.Run("metrics API not available", func(t *testing.T) {
+		c := &resourceUsageCollector{}
+
+		usage, err := c.get()
+		assert.NoError(t, err)
+		assert.Nil(t, usage)
+
+		c.observe(nil, errors.New("the server could not find the requested resource"))
+
+		usage, err = c.get()
+		assert.EqualError(t, err, "retrieving pod metrics: the server could not find the requested resource")
+		assert.Nil(t, usage)
+	})
+
+	t.Run("polling stopped", func(t *testing.T) {
+		oldPollInterval := resourceUsagePollInterval
+		defer func() { resourceUsagePollInterval = oldPollInterval }()
+		resourceUsagePollInterval = time.Millisecond
+
+		fetched := make(chan struct{}, 1)
+		fetch := func(ctx context.Context) (*podMetrics, error) {
+			select {
+			case fetched <- struct{}{}:
+			default:
+			}
+
+			return newPodMetrics(now, newResourceList("1", "1Mi")), nil
+		}
+
+		c := &resourceUsageCollector{}
+		c.watch(context.Background(), fetch)
+		<-fetched
+		c.stop()
+
+		usage, err := c.get()
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1024*1024), usage.PeakMemoryBytes)
+		assert.Equal(t, float64(15), usage.CPUSeconds)
+	})
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gorilla/websocket"
 	"github.com/sirupsen/logrus"
@@ -78,6 +79,13 @@ func (s *executor) servicesRunning(ctx context.Context) bool {
 		}
 	}
 
+	// the services run as init containers when they are native sidecars
+	for _, container := range pod.Status.InitContainerStatuses {
+		if strings.HasPrefix(container.Name, serviceContainerPrefix) && !container.Ready {
+			return false
+		}
+	}
+
 	return true
 }
 
@@ -113,7 +121,7 @@ func proxyWSRequest(
 	// we should refactor the library "gitlab.com/gitlab-org/gitlab-terminal"
 	// and make it more generic, not so terminal focused, with a broader
 	// terminology. (https://gitlab.com/gitlab-org/gitlab-runner/issues/4059)
-	settings, err := s.getTerminalSettings()
+	settings, err := s.getTerminalSettings(buildContainerName)
 	if err != nil {
 		logger.WithError(err).Errorf("service proxy: error getting WS settings")
 		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
@@ -0,0 +1,201 @@
+package kubernetes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/context"
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+// sidecarRestartPolicy is the restart policy that makes an init container a
+// native sidecar container: it's started before the containers of the pod and
+// is stopped by the kubelet once they have exited.
+const sidecarRestartPolicy = "Always"
+
+var errNativeSidecarsUnsupported = errors.New(
+	"the cluster doesn't support native sidecar containers, " +
+		"Kubernetes 1.28 or later with the SidecarContainers feature gate enabled is required",
+)
+
+// sidecarContainer adds the restart policy of the init containers to
+// api.Container, as it isn't supported by the vendored Kubernetes API
+type sidecarContainer struct {
+	api.Container
+	RestartPolicy string `json:"restartPolicy,omitempty"`
+}
+
+type sidecarPodSpec struct {
+	api.PodSpec
+	InitContainers []sidecarContainer `json:"initContainers,omitempty"`
+}
+
+type sidecarPod struct {
+	metav1.TypeMeta
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+	Spec              sidecarPodSpec `json:"spec,omitempty"`
+}
+
+func (s *executor) useNativeSidecars() bool {
+	return s.Config.Kubernetes.NativeSidecars && len(s.options.Services) > 0
+}
+
+// createPodWithNativeSidecars creates the pod with its service init containers
+// defined as native sidecar containers. The request is encoded here, as the
+// restart policy of the init containers would be dropped by the typed client.
+func (s *executor) createPodWithNativeSidecars(ctx context.Context, pod *api.Pod, namespace string) (*api.Pod, error) {
+	sp := sidecarPod{
+		TypeMeta:   metav1.TypeMeta{Kind: "Pod", APIVersion: "v1"},
+		ObjectMeta: pod.ObjectMeta,
+		Spec:       sidecarPodSpec{PodSpec: pod.Spec},
+	}
+	for _, container := range pod.Spec.InitContainers {
+		sc := sidecarContainer{Container: container}
+		if strings.HasPrefix(container.Name, serviceContainerPrefix) {
+			sc.RestartPolicy = sidecarRestartPolicy
+		}
+		sp.Spec.InitContainers = append(sp.Spec.InitContainers, sc)
+	}
+
+	body, err := json.Marshal(sp)
+	if err != nil {
+		return nil, fmt.Errorf("encoding pod: %w", err)
+	}
+
+	raw, err := s.kubeClient.CoreV1().RESTClient().Post().
+		Namespace(namespace).
+		Resource("pods").
+		Body(body).
+		Do(ctx).
+		Raw()
+	if err != nil {
+		return nil, err
+	}
+
+	var created sidecarPod
+	var p api.Pod
+	if err := json.Unmarshal(raw, &created); err != nil {
+		return nil, fmt.Errorf("decoding pod: %w", err)
+	}
+	if err := json.Unmarshal(raw, &p); err != nil {
+		return nil, fmt.Errorf("decoding pod: %w", err)
+	}
+
+	// clusters without native sidecars drop the restart policy, and the pod
+	// would never start, as the services don't exit
+	for _, container := range created.Spec.InitContainers {
+		if strings.HasPrefix(container.Name, serviceContainerPrefix) && container.RestartPolicy != sidecarRestartPolicy {
+			_ = s.kubeClient.CoreV1().Pods(p.Namespace).Delete(ctx, p.Name, metav1.DeleteOptions{
+				GracePeriodSeconds: s.Config.Kubernetes.GetCleanupGracePeriodSeconds(),
+				PropagationPolicy:  &PropagationPolicy,
+			})
+
+			return nil, errNativeSidecarsUnsupported
+		}
+	}
+
+	return &p, nil
+}
+
+// serviceProbe derives the probe of the service's sidecar container from its
+// readiness probe, or from its ports otherwise. It returns nil when the
+// service has neither, in which case the service is only started before the
+// build.
+func (s *executor) serviceProbe(service common.Image) (*api.Probe, error) {
+	rp := service.ReadinessProbe
+	if rp == nil {
+		rp = &common.ReadinessProbe{}
+	}
+
+	port := rp.Port
+	if port == 0 {
+		var err error
+		port, err = serviceProbePort(service)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var handler api.ProbeHandler
+	switch {
+	case len(rp.Exec) > 0:
+		handler.Exec = &api.ExecAction{Command: rp.Exec}
+	case port == 0:
+		return nil, nil
+	case rp.HTTPPath != "":
+		handler.HTTPGet = &api.HTTPGetAction{Path: rp.HTTPPath, Port: intstr.FromInt(port)}
+	default:
+		handler.TCPSocket = &api.TCPSocketAction{Port: intstr.FromInt(port)}
+	}
+
+	period := int32(rp.GetPeriod().Seconds())
+	failureThreshold := int32(rp.Retries)
+	if failureThreshold <= 0 {
+		// the service is probed until the pod is expected to be running
+		failureThreshold = int32(s.Config.Kubernetes.GetPollAttempts()*s.Config.Kubernetes.GetPollInterval()) / period
+		if failureThreshold <= 0 {
+			failureThreshold = 1
+		}
+	}
+
+	return &api.Probe{
+		ProbeHandler:     handler,
+		TimeoutSeconds:   int32(rp.GetTimeout().Seconds()),
+		PeriodSeconds:    period,
+		FailureThreshold: failureThreshold,
+	}, nil
+}
+
+// serviceProbePort returns the port set with the HEALTHCHECK_TCP_PORT variable
+// of the service, or its first port
+func serviceProbePort(service common.Image) (int, error) {
+	for _, variable := range service.Variables {
+		if !strings.EqualFold(variable.Key, "HEALTHCHECK_TCP_PORT") {
+			continue
+		}
+
+		port, err := strconv.ParseInt(variable.Value, 10, 32)
+		if err != nil {
+			return 0, fmt.Errorf("invalid health check tcp port: %v", variable.Value)
+		}
+
+		return int(port), nil
+	}
+
+	if len(service.Ports) > 0 {
+		return service.Ports[0].Number, nil
+	}
+
+	return 0, nil
+}
+
+// setServiceSidecarProbes sets the probes of the service sidecar containers.
+// The startup probe holds back the next containers until the service is ready,
+// and the readiness probe reports it in the pod's status afterwards.
+func (s *executor) setServiceSidecarProbes(containers []api.Container) error {
+	for i, service := range s.options.Services {
+		probe, err := s.serviceProbe(service)
+		if err != nil {
+			return fmt.Errorf("service %s: %w", service.Name, err)
+		}
+
+		if probe == nil {
+			continue
+		}
+
+		readinessProbe := *probe
+		readinessProbe.FailureThreshold = 0
+
+		containers[i].StartupProbe = probe
+		containers[i].ReadinessProbe = &readinessProbe
+	}
+
+	return nil
+}
@@ -0,0 +1,228 @@
+//go:build !integration
+
+package kubernetes
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/rest/fake"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+func TestServiceProbe(t *testing.T) {
+	tests := map[string]struct {
+		service       common.Image
+		expectedProbe *api.Probe
+		expectedErr   string
+	}{
+		"no probe nor ports": {
+			service: common.Image{Name: "postgres"},
+		},
+		"first port": {
+			service: common.Image{
+				Name:  "postgres",
+				Ports: []common.Port{{Number: 5432}, {Number: 8080}},
+			},
+			expectedProbe: &api.Probe{
+				ProbeHandler:     api.ProbeHandler{TCPSocket: &api.TCPSocketAction{Port: intstr.FromInt(5432)}},
+				TimeoutSeconds:   1,
+				PeriodSeconds:    1,
+				FailureThreshold: 180,
+			},
+		},
+		"health check port": {
+			service: common.Image{
+				Name:      "postgres",
+				Ports:     []common.Port{{Number: 8080}},
+				Variables: common.JobVariables{{Key: "HEALTHCHECK_TCP_PORT", Value: "5432"}},
+			},
+			expectedProbe: &api.Probe{
+				ProbeHandler:     api.ProbeHandler{TCPSocket: &api.TCPSocketAction{Port: intstr.FromInt(5432)}},
+				TimeoutSeconds:   1,
+				PeriodSeconds:    1,
+				FailureThreshold: 180,
+			},
+		},
+		"invalid health check port": {
+			service: common.Image{
+				Name:      "postgres",
+				Variables: common.JobVariables{{Key: "HEALTHCHECK_TCP_PORT", Value: "postgres"}},
+			},
+			expectedErr: "invalid health check tcp port: postgres",
+		},
+		"exec probe": {
+			service: common.Image{
+				Name: "postgres",
+				ReadinessProbe: &common.ReadinessProbe{
+					Exec:          []string{"pg_isready"},
+					PeriodSeconds: 2,
+					Retries:       15,
+				},
+			},
+			expectedProbe: &api.Probe{
+				ProbeHandler:     api.ProbeHandler{Exec: &api.ExecAction{Command: []string{"pg_isready"}}},
+				TimeoutSeconds:   1,
+				PeriodSeconds:    2,
+				FailureThreshold: 15,
+			},
+		},
+		"http probe": {
+			service: common.Image{
+				Name: "api",
+				ReadinessProbe: &common.ReadinessProbe{
+					HTTPPath:       "/health",
+					Port:           8080,
+					TimeoutSeconds: 3,
+					PeriodSeconds:  4,
+				},
+			},
+			expectedProbe: &api.Probe{
+				ProbeHandler: api.ProbeHandler{
+					HTTPGet: &api.HTTPGetAction{Path: "/health", Port: intstr.FromInt(8080)},
+				},
+				TimeoutSeconds:   3,
+				PeriodSeconds:    4,
+				FailureThreshold: 45,
+			},
+		},
+		"http probe without port": {
+			service: common.Image{
+				Name:           "api",
+				ReadinessProbe: &common.ReadinessProbe{HTTPPath: "/health"},
+			},
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			e := newExecutor()
+			e.Config.Kubernetes = &common.KubernetesConfig{}
+
+			probe, err := e.serviceProbe(tt.service)
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedProbe, probe)
+		})
+	}
+}
+
+func TestSetServiceSidecarProbes(t *testing.T) {
+	e := newExecutor()
+	e.Config.Kubernetes = &common.KubernetesConfig{}
+	e.options = &kubernetesOptions{
+		Services: common.Services{
+			{Name: "postgres", Ports: []common.Port{{Number: 5432}}},
+			{Name: "redis"},
+		},
+	}
+
+	containers := []api.Container{{Name: "svc-0"}, {Name: "svc-1"}}
+	require.NoError(t, e.setServiceSidecarProbes(containers))
+
+	require.NotNil(t, containers[0].StartupProbe)
+	require.NotNil(t, containers[0].ReadinessProbe)
+	assert.Equal(t, int32(180), containers[0].StartupProbe.FailureThreshold)
+	assert.Zero(t, containers[0].ReadinessProbe.FailureThreshold)
+	assert.Equal(t, containers[0].StartupProbe.ProbeHandler, containers[0].ReadinessProbe.ProbeHandler)
+
+	assert.Nil(t, containers[1].StartupProbe)
+	assert.Nil(t, containers[1].ReadinessProbe)
+}
+
+func TestCreatePodWithNativeSidecars(t *testing.T) {
+	pod := &api.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "runner-pod", Namespace: "ci"},
+		Spec: api.PodSpec{
+			InitContainers: []api.Container{
+				{Name: "init-permissions"},
+				{Name: "svc-0", Image: "postgres"},
+			},
+			Containers: []api.Container{{Name: buildContainerName}, {Name: helperContainerName}},
+		},
+	}
+
+	tests := map[string]struct {
+		supported   bool
+		expectedErr error
+	}{
+		"supported": {
+			supported: true,
+		},
+		"unsupported": {
+			expectedErr: errNativeSidecarsUnsupported,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			version, _ := testVersionAndCodec()
+			deleted := false
+
+			client := fake.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+				switch req.Method {
+				case http.MethodPost:
+					body, err := io.ReadAll(req.Body)
+					require.NoError(t, err)
+
+					var sp sidecarPod
+					require.NoError(t, json.Unmarshal(body, &sp))
+					assert.Equal(t, "Pod", sp.Kind)
+					require.Len(t, sp.Spec.InitContainers, 2)
+					assert.Empty(t, sp.Spec.InitContainers[0].RestartPolicy)
+					assert.Equal(t, "Always", sp.Spec.InitContainers[1].RestartPolicy)
+					assert.Len(t, sp.Spec.Containers, 2)
+
+					if !tt.supported {
+						sp.Spec.InitContainers[1].RestartPolicy = ""
+						body, err = json.Marshal(sp)
+						require.NoError(t, err)
+					}
+
+					return &http.Response{
+						StatusCode: http.StatusCreated,
+						Header:     map[string][]string{"Content-Type": {"application/json"}},
+						Body:       io.NopCloser(bytes.NewReader(body)),
+					}, nil
+				case http.MethodDelete:
+					deleted = true
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Header:     map[string][]string{"Content-Type": {"application/json"}},
+						Body:       io.NopCloser(bytes.NewReader([]byte("{}"))),
+					}, nil
+				default:
+					t.Errorf("unexpected request: %s %s", req.Method, req.URL)
+					return nil, nil
+				}
+			})
+
+			e := newExecutor()
+			e.Config.Kubernetes = &common.KubernetesConfig{}
+			e.kubeClient = testKubernetesClient(version, client)
+
+			created, err := e.createPodWithNativeSidecars(context.Background(), pod, "ci")
+			assert.ErrorIs(t, err, tt.expectedErr)
+			assert.Equal(t, !tt.supported, deleted)
+			if tt.supported {
+				require.NotNil(t, created)
+				assert.Equal(t, "runner-pod", created.Name)
+				assert.Len(t, created.Spec.InitContainers, 2)
+			}
+		})
+	}
+}
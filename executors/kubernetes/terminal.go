@@ -1,19 +1,36 @@
 package kubernetes
 
 import (
+	"fmt"
 	"net/http"
 	"net/url"
 	"os"
+	"time"
 
 	"gitlab.com/gitlab-org/gitlab-runner/session/proxy"
 	terminalsession "gitlab.com/gitlab-org/gitlab-runner/session/terminal"
 	terminal "gitlab.com/gitlab-org/gitlab-terminal"
+	"golang.org/x/net/context"
 	api "k8s.io/api/core/v1"
 	"k8s.io/client-go/kubernetes/scheme"
 )
 
 func (s *executor) Connect() (terminalsession.Conn, error) {
-	settings, err := s.getTerminalSettings()
+	container := buildContainerName
+	if s.isDebugContainerEnabled() {
+		pollAttempts := s.Config.Kubernetes.GetPollAttempts()
+		timeout := time.Duration(pollAttempts*s.Config.Kubernetes.GetPollInterval()) * time.Second
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		var err error
+		container, err = s.startDebugContainer(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("starting debug container: %w", err)
+		}
+	}
+
+	settings, err := s.getTerminalSettings(container)
 	if err != nil {
 		return nil, err
 	}
@@ -42,13 +59,13 @@ func (t terminalConn) Close() error {
 	return nil
 }
 
-func (s *executor) getTerminalSettings() (*terminal.TerminalSettings, error) {
+func (s *executor) getTerminalSettings(container string) (*terminal.TerminalSettings, error) {
 	config, err := getKubeClientConfig(s.Config.Kubernetes, s.configurationOverwrites)
 	if err != nil {
 		return nil, err
 	}
 
-	wsURL := s.getTerminalWebSocketURL()
+	wsURL := s.getTerminalWebSocketURL(container)
 	if err != nil {
 		return nil, err
 	}
@@ -73,20 +90,36 @@ func (s *executor) getTerminalSettings() (*terminal.TerminalSettings, error) {
 	return term, nil
 }
 
-func (s *executor) getTerminalWebSocketURL() *url.URL {
-	wsURL := s.kubeClient.CoreV1().RESTClient().Post().
+// getTerminalWebSocketURL returns the URL to exec a shell in the build
+// container, or to attach to the shell of a debug container
+func (s *executor) getTerminalWebSocketURL(container string) *url.URL {
+	req := s.kubeClient.CoreV1().RESTClient().Post().
 		Namespace(s.pod.Namespace).
 		Resource("pods").
-		Name(s.pod.Name).
-		SubResource("exec").
-		VersionedParams(&api.PodExecOptions{
-			Stdin:     true,
-			Stdout:    true,
-			Stderr:    true,
-			TTY:       true,
-			Container: "build",
-			Command:   []string{"sh", "-c", "bash || sh"},
-		}, scheme.ParameterCodec).URL()
+		Name(s.pod.Name)
+
+	if container == buildContainerName {
+		req = req.SubResource("exec").
+			VersionedParams(&api.PodExecOptions{
+				Stdin:     true,
+				Stdout:    true,
+				Stderr:    true,
+				TTY:       true,
+				Container: container,
+				Command:   []string{"sh", "-c", "bash || sh"},
+			}, scheme.ParameterCodec)
+	} else {
+		req = req.SubResource("attach").
+			VersionedParams(&api.PodAttachOptions{
+				Stdin:     true,
+				Stdout:    true,
+				Stderr:    true,
+				TTY:       true,
+				Container: container,
+			}, scheme.ParameterCodec)
+	}
+
+	wsURL := req.URL()
 
 	wsURL.Scheme = proxy.WebsocketProtocolFor(wsURL.Scheme)
 	return wsURL
@@ -137,22 +137,25 @@ func isRunning(pod *api.Pod) (bool, error) {
 }
 
 type podPhaseResponse struct {
-	done  bool
-	phase api.PodPhase
-	err   error
+	done        bool
+	phase       api.PodPhase
+	err         error
+	diagnostics podDiagnostics
 }
 
 func getPodPhase(ctx context.Context, c *kubernetes.Clientset, pod *api.Pod, out io.Writer) podPhaseResponse {
 	pod, err := c.CoreV1().Pods(pod.Namespace).Get(ctx, pod.Name, metav1.GetOptions{})
 	if err != nil {
-		return podPhaseResponse{true, api.PodUnknown, err}
+		return podPhaseResponse{true, api.PodUnknown, err, nil}
 	}
 
 	ready, err := isRunning(pod)
 	if err != nil || ready {
-		return podPhaseResponse{true, pod.Status.Phase, err}
+		return podPhaseResponse{true, pod.Status.Phase, err, nil}
 	}
 
+	diagnostics := getPodDiagnostics(ctx, c, pod)
+
 	// check status of containers
 	for _, container := range append(pod.Status.ContainerStatuses, pod.Status.InitContainerStatuses...) {
 		if container.Ready {
@@ -166,7 +169,7 @@ func getPodPhase(ctx context.Context, c *kubernetes.Clientset, pod *api.Pod, out
 		switch waiting.Reason {
 		case "InvalidImageName":
 			err = &common.BuildError{Inner: fmt.Errorf("image pull failed: %s", waiting.Message)}
-			return podPhaseResponse{true, api.PodUnknown, err}
+			return podPhaseResponse{true, api.PodUnknown, err, diagnostics}
 		case "ErrImagePull", "ImagePullBackOff":
 			msg := fmt.Sprintf("image pull failed: %s", waiting.Message)
 			imagePullErr := &pull.ImagePullError{Message: msg, Image: container.Image}
@@ -174,6 +177,7 @@ func getPodPhase(ctx context.Context, c *kubernetes.Clientset, pod *api.Pod, out
 				true,
 				api.PodUnknown,
 				&common.BuildError{Inner: imagePullErr, FailureReason: common.ImagePullFailure},
+				diagnostics,
 			}
 		}
 	}
@@ -200,7 +204,7 @@ func getPodPhase(ctx context.Context, c *kubernetes.Clientset, pod *api.Pod, out
 		)
 	}
 
-	return podPhaseResponse{false, pod.Status.Phase, nil}
+	return podPhaseResponse{false, pod.Status.Phase, nil, diagnostics}
 }
 
 func triggerPodPhaseCheck(ctx context.Context, c *kubernetes.Clientset, pod *api.Pod, out io.Writer) <-chan podPhaseResponse {
@@ -216,8 +220,9 @@ func triggerPodPhaseCheck(ctx context.Context, c *kubernetes.Clientset, pod *api
 // state. It returns the final PodPhase once either PodRunning, PodSucceeded or
 // PodFailed has been reached. In the case of PodRunning, it will also wait until
 // all containers within the pod are also Ready.
+// While waiting, the diagnostics of the pod are printed whenever they change.
 // It returns error if the call to retrieve pod details fails or the timeout is
-// reached.
+// reached, in which case the failure reason is derived from the diagnostics.
 // The timeout and polling values are configurable through KubernetesConfig
 // parameters.
 func waitForPodRunning(
@@ -229,9 +234,16 @@ func waitForPodRunning(
 ) (api.PodPhase, error) {
 	pollInterval := config.GetPollInterval()
 	pollAttempts := config.GetPollAttempts()
+
+	var diagnostics podDiagnostics
 	for i := 0; i <= pollAttempts; i++ {
 		select {
 		case r := <-triggerPodPhaseCheck(ctx, c, pod, out):
+			if len(r.diagnostics) > 0 && r.diagnostics.String() != diagnostics.String() {
+				_, _ = fmt.Fprintf(out, "Diagnostics for pod %s/%s:\n%s", pod.Namespace, pod.Name, r.diagnostics)
+			}
+			diagnostics = r.diagnostics
+
 			if !r.done {
 				time.Sleep(time.Duration(pollInterval) * time.Second)
 				continue
@@ -241,7 +253,15 @@ func waitForPodRunning(
 			return api.PodUnknown, ctx.Err()
 		}
 	}
-	return api.PodUnknown, errors.New("timed out waiting for pod to start")
+
+	if len(diagnostics) == 0 {
+		return api.PodUnknown, errors.New("timed out waiting for pod to start")
+	}
+
+	return api.PodUnknown, &common.BuildError{
+		Inner:         fmt.Errorf("timed out waiting for pod to start: %s", diagnostics.summary()),
+		FailureReason: diagnostics.failureReason(),
+	}
 }
 
 // limits takes a string representing CPU, memory and ephemeralStorage limits,
@@ -227,6 +227,12 @@ func TestWaitForPodRunning(t *testing.T) {
 						Body:       objBody(codec, pod),
 						Header:     map[string][]string{"Content-Type": {"application/json"}},
 					}, nil
+				case p == "/api/"+version+"/namespaces/test-ns/events" && m == http.MethodGet:
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       objBody(codec, &api.EventList{}),
+						Header:     map[string][]string{"Content-Type": {"application/json"}},
+					}, nil
 				default:
 					// Ensures no GET is performed when deleting by name
 					t.Errorf("unexpected request: %s %#v\n%#v", req.Method, req.URL, req)
@@ -317,6 +323,12 @@ func TestWaitForPodRunning(t *testing.T) {
 						Body:       objBody(codec, pod),
 						Header:     map[string][]string{"Content-Type": {"application/json"}},
 					}, nil
+				case p == "/api/"+version+"/namespaces/test-ns/events" && m == http.MethodGet:
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       objBody(codec, &api.EventList{}),
+						Header:     map[string][]string{"Content-Type": {"application/json"}},
+					}, nil
 				default:
 					// Ensures no GET is performed when deleting by name
 					t.Errorf("unexpected request: %s %#v\n%#v", req.Method, req.URL, req)
@@ -494,6 +506,10 @@ func testVersionAndCodec() (version string, codec runtime.Codec) {
 		&api.Pod{},
 		&api.ServiceAccount{},
 		&api.Secret{},
+		&api.Event{},
+		&api.EventList{},
+		&api.LimitRangeList{},
+		&api.ResourceQuotaList{},
 		&metav1.Status{},
 	)
 
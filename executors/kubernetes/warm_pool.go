@@ -0,0 +1,702 @@
+package kubernetes
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	api "k8s.io/api/core/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8stypes "k8s.io/apimachinery/pkg/types"
+	utilrand "k8s.io/apimachinery/pkg/util/rand"
+	"k8s.io/client-go/kubernetes"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/docker/auth"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/featureflags"
+	"gitlab.com/gitlab-org/gitlab-runner/shells"
+)
+
+const (
+	// warmPoolKeyLabel identifies the pod configuration the warm pods are
+	// created from
+	warmPoolKeyLabel = "warm-pool." + k8sAnnotationPrefix + "key"
+
+	// warmPoolOwnerLabel identifies the process whose pool the warm pods belong
+	// to. The idle pods owned by another process, for example one that has
+	// crashed, are orphaned.
+	warmPoolOwnerLabel = "warm-pool." + k8sAnnotationPrefix + "owner"
+
+	// warmPodScriptsDir and warmPodLogsDir replace the job specific directories
+	// of the scripts and logs, for the warm pods to be usable by any job
+	warmPodScriptsDir = "/scripts"
+	warmPodLogsDir    = "/logs"
+
+	warmPoolOperationTimeout = 5 * time.Minute
+)
+
+var (
+	errWarmPodBuildsDirNotEmptyDir = errors.New("the builds directory isn't an emptyDir volume")
+	errWarmPodPendingTimeout       = errors.New("the pod is still pending after the poll timeout")
+)
+
+var newWarmPoolKubeClient = func(config *common.KubernetesConfig) (kubernetes.Interface, error) {
+	kubeConfig, err := getKubeClientConfig(config, &overwrites{})
+	if err != nil {
+		return nil, err
+	}
+
+	return kubernetes.NewForConfig(kubeConfig)
+}
+
+var warmPods = newWarmPodPool()
+
+// warmPodPool keeps idle build pods running for the pod configurations used by
+// the jobs, so that the jobs don't wait for their pod to be scheduled and for
+// its images to be pulled
+type warmPodPool struct {
+	mu        sync.Mutex
+	owner     string
+	templates map[string]*warmPodTemplate
+
+	now func() time.Time
+}
+
+// warmPodTemplate is a pod configuration used by the jobs of a runner, and the
+// idle pods created from it
+type warmPodTemplate struct {
+	key    string
+	runner string
+	config *common.KubernetesConfig
+	client kubernetes.Interface
+	pod    api.Pod
+
+	idle     []*warmPod
+	creating int
+	lastUsed time.Time
+}
+
+type warmPod struct {
+	key       string
+	name      string
+	namespace string
+	uses      int
+	created   time.Time
+
+	// jobLabels and jobAnnotations are the metadata keys the pod got when it
+	// was assigned to its current job
+	jobLabels      []string
+	jobAnnotations []string
+}
+
+func newWarmPodPool() *warmPodPool {
+	return &warmPodPool{
+		owner:     utilrand.String(16),
+		templates: make(map[string]*warmPodTemplate),
+		now:       time.Now,
+	}
+}
+
+// warmPodKey identifies the pod configuration of a runner. It's used as a
+// label value, so it's limited to 63 characters.
+func warmPodKey(runner string, pod api.Pod) (string, error) {
+	data, err := json.Marshal(pod)
+	if err != nil {
+		return "", fmt.Errorf("encoding pod: %w", err)
+	}
+
+	sum := sha256.Sum256(append([]byte(runner+"\n"), data...))
+
+	return fmt.Sprintf("%x", sum[:16]), nil
+}
+
+// acquire returns a running idle pod created from the pod configuration, and
+// starts replacing it in the background. The configuration is registered the
+// first time it's used, so no pod is returned until the pool is filled. The
+// pods still pending after the poll timeout are deleted, as they're unlikely
+// to be scheduled.
+func (p *warmPodPool) acquire(
+	ctx context.Context,
+	runner string,
+	config *common.KubernetesConfig,
+	pod api.Pod,
+) (*warmPod, error) {
+	key, err := warmPodKey(runner, pod)
+	if err != nil {
+		return nil, err
+	}
+
+	t, err := p.template(key, runner, config, pod)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { go p.fill(t) }()
+
+	var pending []*warmPod
+	defer func() {
+		p.mu.Lock()
+		t.idle = append(t.idle, pending...)
+		p.mu.Unlock()
+	}()
+
+	for {
+		wp := p.pop(t)
+		if wp == nil {
+			return nil, nil
+		}
+
+		running, err := t.isRunning(ctx, wp)
+		if running {
+			wp.uses++
+			return wp, nil
+		}
+
+		if err == nil && p.now().Sub(wp.created) > t.pendingTimeout() {
+			err = errWarmPodPendingTimeout
+		}
+
+		if err != nil {
+			logrus.WithError(err).WithField("pod", wp.name).Warningln("Removing warm pod")
+			go t.delete(wp)
+			continue
+		}
+
+		pending = append(pending, wp)
+	}
+}
+
+func (p *warmPodPool) template(
+	key string,
+	runner string,
+	config *common.KubernetesConfig,
+	pod api.Pod,
+) (*warmPodTemplate, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.expire()
+
+	t, ok := p.templates[key]
+	if !ok {
+		client, err := newWarmPoolKubeClient(config)
+		if err != nil {
+			return nil, fmt.Errorf("connecting to Kubernetes: %w", err)
+		}
+
+		// the labels of the runner manager set in the pod configuration are
+		// kept, for the orphaned pods to be found
+		labels := make(map[string]string, len(pod.Labels)+2)
+		for k, v := range pod.Labels {
+			labels[k] = v
+		}
+		labels[warmPoolKeyLabel] = key
+		labels[warmPoolOwnerLabel] = p.owner
+		pod.Labels = labels
+
+		t = &warmPodTemplate{
+			key:    key,
+			runner: runner,
+			config: config,
+			client: client,
+			pod:    pod,
+		}
+		p.templates[key] = t
+	}
+
+	t.lastUsed = p.now()
+
+	return t, nil
+}
+
+func (p *warmPodPool) pop(t *warmPodTemplate) *warmPod {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(t.idle) == 0 {
+		return nil
+	}
+
+	wp := t.idle[0]
+	t.idle = t.idle[1:]
+
+	return wp
+}
+
+// release returns the pod to the pool after it's used by a job, unless it has
+// reached the maximum number of jobs or the pool is already full. The pod is
+// cleaned up with recycle before it's used by another job. It returns whether
+// the pod was returned to the pool; otherwise the caller must delete it.
+func (p *warmPodPool) release(ctx context.Context, wp *warmPod, recycle func(context.Context) error) bool {
+	p.mu.Lock()
+	t := p.templates[wp.key]
+	p.mu.Unlock()
+
+	if t == nil || wp.uses >= t.config.WarmPool.GetMaxUseCount() {
+		return false
+	}
+
+	err := recycle(ctx)
+	if err != nil {
+		logrus.WithError(err).WithField("pod", wp.name).Warningln("Failed to recycle warm pod")
+		return false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.templates[wp.key] != t || len(t.idle)+t.creating >= t.config.WarmPool.Size {
+		return false
+	}
+
+	t.idle = append(t.idle, wp)
+
+	return true
+}
+
+// discard deletes a pod that was acquired but can't be used by the job
+func (p *warmPodPool) discard(wp *warmPod) {
+	p.mu.Lock()
+	t := p.templates[wp.key]
+	p.mu.Unlock()
+
+	if t != nil {
+		go t.delete(wp)
+	}
+}
+
+// fill creates pods until the configured number of idle pods is reached
+func (p *warmPodPool) fill(t *warmPodTemplate) {
+	for {
+		p.mu.Lock()
+		if p.templates[t.key] != t || len(t.idle)+t.creating >= t.config.WarmPool.Size {
+			p.mu.Unlock()
+			return
+		}
+		t.creating++
+		p.mu.Unlock()
+
+		wp, err := t.create()
+
+		p.mu.Lock()
+		t.creating--
+		removed := p.templates[t.key] != t
+		if err == nil && !removed {
+			wp.created = p.now()
+			t.idle = append(t.idle, wp)
+		}
+		p.mu.Unlock()
+
+		if err != nil {
+			logrus.WithError(err).WithField("runner", t.runner).Warningln("Failed to create warm pod")
+			return
+		}
+
+		if removed {
+			t.delete(wp)
+			return
+		}
+	}
+}
+
+// expire removes the pod configurations that weren't used by any job for
+// longer than the idle timeout. It must be called with the lock held.
+func (p *warmPodPool) expire() {
+	now := p.now()
+
+	for key, t := range p.templates {
+		timeout, err := t.config.WarmPool.GetIdleTimeout()
+		if err != nil {
+			timeout = common.DefaultKubernetesWarmPoolIdleTimeout
+		}
+
+		if now.Sub(t.lastUsed) > timeout {
+			p.remove(key, t)
+		}
+	}
+}
+
+// remove drops the pod configuration and deletes its idle pods in the
+// background. It must be called with the lock held.
+func (p *warmPodPool) remove(key string, t *warmPodTemplate) {
+	delete(p.templates, key)
+
+	idle := t.idle
+	t.idle = nil
+
+	go func() {
+		for _, wp := range idle {
+			t.delete(wp)
+		}
+	}()
+}
+
+// configure removes the pod configurations of the runners whose warm pool is
+// no longer configured
+func (p *warmPodPool) configure(runners []*common.RunnerConfig) {
+	enabled := make(map[string]bool)
+	for _, runner := range runners {
+		if runner.Kubernetes != nil && runner.Kubernetes.WarmPool != nil && runner.Kubernetes.WarmPool.Size > 0 {
+			enabled[runner.ShortDescription()] = true
+		}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key, t := range p.templates {
+		if !enabled[t.runner] {
+			p.remove(key, t)
+		}
+	}
+}
+
+// shutdown deletes all the idle pods
+func (p *warmPodPool) shutdown(ctx context.Context) {
+	p.mu.Lock()
+	templates := p.templates
+	p.templates = make(map[string]*warmPodTemplate)
+	p.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, t := range templates {
+		for _, wp := range t.idle {
+			wg.Add(1)
+			go func(t *warmPodTemplate, wp *warmPod) {
+				defer wg.Done()
+				t.delete(wp)
+			}(t, wp)
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+func (t *warmPodTemplate) create() (*warmPod, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), warmPoolOperationTimeout)
+	defer cancel()
+
+	pod := t.pod.DeepCopy()
+	pod.Name = generateNameForK8sResources(fmt.Sprintf("runner-%s-warm", t.runner))
+
+	created, err := t.client.CoreV1().Pods(pod.Namespace).Create(ctx, pod, metav1.CreateOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return &warmPod{key: t.key, name: created.Name, namespace: created.Namespace}, nil
+}
+
+// pendingTimeout is how long a warm pod can be pending, the same as a job waits
+// for its own pod to be running
+func (t *warmPodTemplate) pendingTimeout() time.Duration {
+	return time.Duration(t.config.GetPollAttempts()*t.config.GetPollInterval()) * time.Second
+}
+
+func (t *warmPodTemplate) isRunning(ctx context.Context, wp *warmPod) (bool, error) {
+	pod, err := t.client.CoreV1().Pods(wp.namespace).Get(ctx, wp.name, metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+
+	return isRunning(pod)
+}
+
+func (t *warmPodTemplate) delete(wp *warmPod) {
+	ctx, cancel := context.WithTimeout(context.Background(), warmPoolOperationTimeout)
+	defer cancel()
+
+	err := t.client.CoreV1().
+		Pods(wp.namespace).
+		Delete(ctx, wp.name, metav1.DeleteOptions{
+			GracePeriodSeconds: t.config.GetCleanupGracePeriodSeconds(),
+			PropagationPolicy:  &PropagationPolicy,
+		})
+	if err != nil && !kubeerrors.IsNotFound(err) {
+		logrus.WithError(err).WithField("pod", wp.name).Warningln("Failed to delete warm pod")
+	}
+}
+
+// isWarmPoolEnabled returns whether the job can use a warm pod. The pods of jobs
+// with services aren't pooled, as the services are configured for each job, nor
+// the pods of jobs with snapshotted workspaces, as their volume is created for
+// each job, nor the pods of jobs running in their own namespace, nor the pods
+// of jobs with their own credentials to pull the images, as the image pull
+// secret is created for each job.
+func (s *executor) isWarmPoolEnabled() bool {
+	if s.Config.Kubernetes == nil {
+		return false
+	}
+
+	pool := s.Config.Kubernetes.WarmPool
+	if pool == nil || pool.Size <= 0 {
+		return false
+	}
+
+	return !s.Build.IsFeatureFlagOn(featureflags.UseLegacyKubernetesExecutionStrategy) &&
+		len(s.options.Services) == 0 &&
+		s.configurationOverwrites.bearerToken == "" &&
+		!s.isWorkspaceSnapshotsEnabled() &&
+		!s.isNamespacePerJobEnabled() &&
+		!s.hasPullCredentials()
+}
+
+// hasPullCredentials returns whether the job has credentials to pull the images,
+// from DOCKER_AUTH_CONFIG or the registries of the job, which setupCredentials
+// stores in an image pull secret of the job
+func (s *executor) hasPullCredentials() bool {
+	authConfigs, err := auth.ResolveConfigs(s.Build.GetDockerAuthConfig(), s.Shell().User, s.Build.Credentials)
+
+	return err != nil || len(authConfigs) > 0
+}
+
+// acquireWarmPod assigns an idle pod from the warm pool to the job. It returns
+// false when no pod is available, for the job to create its own.
+func (s *executor) acquireWarmPod(ctx context.Context, initContainers []api.Container) (bool, error) {
+	if !s.isWarmPoolEnabled() {
+		return false, nil
+	}
+
+	template, opts, err := s.prepareWarmPodTemplate(initContainers)
+	if err != nil {
+		return false, err
+	}
+
+	wp, err := warmPods.acquire(ctx, s.Build.Runner.ShortDescription(), s.Config.Kubernetes, template)
+	if err != nil {
+		s.Warningln("Failed to acquire a warm pod:", err)
+		return false, nil
+	}
+
+	if wp == nil {
+		s.Debugln("No warm pod available")
+		return false, nil
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels":      opts.labels,
+			"annotations": opts.annotations,
+		},
+	})
+	if err != nil {
+		warmPods.discard(wp)
+		return false, fmt.Errorf("encoding warm pod metadata: %w", err)
+	}
+
+	pod, err := s.kubeClient.CoreV1().
+		Pods(wp.namespace).
+		Patch(ctx, wp.name, k8stypes.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		s.Warningln("Failed to assign the warm pod to the job:", err)
+		warmPods.discard(wp)
+		return false, nil
+	}
+
+	s.Println("Using warm pod", pod.Name, "...")
+	s.pod = pod
+	s.warmPod = wp
+	// the labels the idle pods have, like the runner manager's, are kept
+	// when the pod is unassigned from the job
+	wp.jobLabels = mapKeysExcept(opts.labels, template.Labels)
+	wp.jobAnnotations = mapKeysExcept(opts.annotations, nil)
+
+	s.Build.RecordExecutorResource(common.ExecutorResource{
+		Type:      common.ExecutorResourcePod,
+		ID:        s.pod.Name,
+		Namespace: s.pod.Namespace,
+	})
+
+	s.watchResourceUsage(ctx)
+
+	return true, nil
+}
+
+// prepareWarmPodTemplate returns the pod configuration of the job without the
+// parts specific to the job, with the labels and annotations the pod gets when
+// it's assigned to the job. The job's variables aren't set in the containers'
+// environment, as they're exported by the scripts of the job.
+func (s *executor) prepareWarmPodTemplate(initContainers []api.Container) (api.Pod, podConfigPrepareOpts, error) {
+	opts, err := s.createPodConfigPrepareOpts(initContainers)
+	if err != nil {
+		return api.Pod{}, opts, err
+	}
+
+	pod, err := s.preparePodConfig(opts)
+	if err != nil {
+		return api.Pod{}, opts, err
+	}
+
+	if s.Build.IsFeatureFlagOn(featureflags.UseAdvancedPodSpecConfiguration) {
+		pod.Spec, err = s.applyPodSpecMerge(&pod.Spec)
+		if err != nil {
+			return api.Pod{}, opts, err
+		}
+	}
+
+	pod.ObjectMeta = metav1.ObjectMeta{
+		Namespace: pod.Namespace,
+		Labels:    runnerManagerLabels(&s.Config),
+	}
+	pod.Spec.ActiveDeadlineSeconds = nil
+
+	for i := range pod.Spec.InitContainers {
+		pod.Spec.InitContainers[i].Env = nil
+	}
+
+	for i := range pod.Spec.Containers {
+		pod.Spec.Containers[i].Env = nil
+	}
+
+	return pod, opts, nil
+}
+
+// releaseWarmPod returns the job's pod to the warm pool. It returns false when
+// the pod must be deleted.
+func (s *executor) releaseWarmPod(ctx context.Context) bool {
+	if s.warmPod == nil {
+		return false
+	}
+
+	released := warmPods.release(ctx, s.warmPod, s.recycleWarmPod)
+	if released {
+		s.Debugln("Returned warm pod", s.pod.Name, "to the pool")
+	}
+
+	return released
+}
+
+// recycleWarmPod removes the files left by the job in the pod's volumes, for the
+// pod to be used by another job
+func (s *executor) recycleWarmPod(ctx context.Context) error {
+	if !s.isDefaultBuildsDirVolumeRequired() {
+		return errWarmPodBuildsDirNotEmptyDir
+	}
+
+	if _, ok := common.GetShell(s.Shell().Shell).(*shells.BashShell); !ok {
+		return fmt.Errorf("recycling pods isn't supported with the %s shell", s.Shell().Shell)
+	}
+
+	script := fmt.Sprintf(
+		"find %q %q %q -mindepth 1 -delete\n",
+		s.RootDir(),
+		s.scriptsDir(),
+		s.logsDir(),
+	)
+
+	exec := ExecOptions{
+		PodName:       s.pod.Name,
+		Namespace:     s.pod.Namespace,
+		ContainerName: helperContainerName,
+		Command:       s.BuildShell.DockerCommand,
+		In:            strings.NewReader(script),
+		Out:           io.Discard,
+		Err:           io.Discard,
+		Stdin:         true,
+		Config:        s.kubeConfig,
+		Client:        s.kubeClient,
+		Executor:      &DefaultRemoteExecutor{},
+
+		Context: ctx,
+	}
+
+	err := exec.Run()
+	if err != nil {
+		return err
+	}
+
+	return s.unassignWarmPod(ctx)
+}
+
+// unassignWarmPod removes the labels and annotations the pod got when it was
+// assigned to the job. The labels of the job would make the orphaned resources
+// garbage collector delete the idle pod once the job has ended.
+func (s *executor) unassignWarmPod(ctx context.Context) error {
+	labels := make(map[string]interface{}, len(s.warmPod.jobLabels))
+	for _, key := range s.warmPod.jobLabels {
+		if key != warmPoolKeyLabel && key != warmPoolOwnerLabel {
+			labels[key] = nil
+		}
+	}
+
+	annotations := make(map[string]interface{}, len(s.warmPod.jobAnnotations))
+	for _, key := range s.warmPod.jobAnnotations {
+		annotations[key] = nil
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels":      labels,
+			"annotations": annotations,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("encoding warm pod metadata: %w", err)
+	}
+
+	_, err = s.kubeClient.CoreV1().
+		Pods(s.warmPod.namespace).
+		Patch(ctx, s.warmPod.name, k8stypes.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		return fmt.Errorf("removing the job's metadata from the warm pod: %w", err)
+	}
+
+	s.warmPod.jobLabels = nil
+	s.warmPod.jobAnnotations = nil
+
+	return nil
+}
+
+// isIdleWarmPod returns whether the resource is a warm pod that isn't assigned
+// to a job
+func isIdleWarmPod(obj metav1.Object) bool {
+	labels := obj.GetLabels()
+
+	_, warm := labels[warmPoolOwnerLabel]
+	_, assigned := labels[jobIDLabel]
+
+	return warm && !assigned
+}
+
+func mapKeysExcept(m map[string]string, except map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		if _, ok := except[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+func (p executorProvider) Init() {}
+
+// Shutdown deletes the idle pods of the warm pool, and stops the orphaned
+// resources garbage collectors and the workspace snapshot pruners
+func (p executorProvider) Shutdown(ctx context.Context) {
+	orphanedResources.stop(ctx)
+	workspaceSnapshotPruners.stop(ctx)
+	warmPods.shutdown(ctx)
+}
+
+func (p executorProvider) Configure(runners []*common.RunnerConfig) {
+	warmPods.configure(runners)
+	orphanedResources.configure(runners)
+	workspaceSnapshotPruners.configure(runners)
+}
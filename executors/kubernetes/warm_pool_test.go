@@ -0,0 +1,387 @@
+//go:build !integration
+
+package kubernetes
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+	fakerest "k8s.io/client-go/rest/fake"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+func newTestWarmPodPool(t *testing.T) (*warmPodPool, *fake.Clientset) {
+	client := fake.NewSimpleClientset()
+
+	oldNewClient := newWarmPoolKubeClient
+	t.Cleanup(func() { newWarmPoolKubeClient = oldNewClient })
+	newWarmPoolKubeClient = func(_ *common.KubernetesConfig) (kubernetes.Interface, error) {
+		return client, nil
+	}
+
+	return newWarmPodPool(), client
+}
+
+func newTestWarmPodTemplate(image string) api.Pod {
+	return api.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "ci"},
+		Spec: api.PodSpec{
+			Containers: []api.Container{{Name: buildContainerName, Image: image}},
+		},
+	}
+}
+
+func listWarmPods(t *testing.T, client kubernetes.Interface) []api.Pod {
+	pods, err := client.CoreV1().Pods("ci").List(context.Background(), metav1.ListOptions{})
+	require.NoError(t, err)
+
+	return pods.Items
+}
+
+func setWarmPodsRunning(t *testing.T, client kubernetes.Interface) {
+	for _, pod := range listWarmPods(t, client) {
+		pod.Status.Phase = api.PodRunning
+		_, err := client.CoreV1().Pods("ci").UpdateStatus(context.Background(), &pod, metav1.UpdateOptions{})
+		require.NoError(t, err)
+	}
+}
+
+func TestWarmPodKey(t *testing.T) {
+	key, err := warmPodKey("runner", newTestWarmPodTemplate("alpine"))
+	require.NoError(t, err)
+	assert.Len(t, key, 32)
+
+	sameKey, err := warmPodKey("runner", newTestWarmPodTemplate("alpine"))
+	require.NoError(t, err)
+	assert.Equal(t, key, sameKey)
+
+	otherImageKey, err := warmPodKey("runner", newTestWarmPodTemplate("ubuntu"))
+	require.NoError(t, err)
+	assert.NotEqual(t, key, otherImageKey)
+
+	otherRunnerKey, err := warmPodKey("other-runner", newTestWarmPodTemplate("alpine"))
+	require.NoError(t, err)
+	assert.NotEqual(t, key, otherRunnerKey)
+}
+
+func TestWarmPodPoolAcquire(t *testing.T) {
+	pool, client := newTestWarmPodPool(t)
+	config := &common.KubernetesConfig{WarmPool: &common.KubernetesWarmPoolConfig{Size: 2}}
+
+	wp, err := pool.acquire(context.Background(), "runner", config, newTestWarmPodTemplate("alpine"))
+	require.NoError(t, err)
+	assert.Nil(t, wp, "the pool is filled after the pod configuration is first used")
+
+	require.Eventually(t, func() bool { return len(listWarmPods(t, client)) == 2 }, time.Second, 10*time.Millisecond)
+
+	for _, pod := range listWarmPods(t, client) {
+		assert.Equal(t, "alpine", pod.Spec.Containers[0].Image)
+		assert.Contains(t, pod.Name, "runner-runner-warm-")
+		assert.Contains(t, pod.Labels, warmPoolKeyLabel)
+		assert.Equal(t, pool.owner, pod.Labels[warmPoolOwnerLabel])
+	}
+
+	wp, err = pool.acquire(context.Background(), "runner", config, newTestWarmPodTemplate("alpine"))
+	require.NoError(t, err)
+	assert.Nil(t, wp, "pending pods aren't acquired")
+
+	setWarmPodsRunning(t, client)
+
+	wp, err = pool.acquire(context.Background(), "runner", config, newTestWarmPodTemplate("alpine"))
+	require.NoError(t, err)
+	require.NotNil(t, wp)
+	assert.Equal(t, "ci", wp.namespace)
+	assert.Equal(t, 1, wp.uses)
+
+	require.Eventually(t, func() bool { return len(listWarmPods(t, client)) == 3 }, time.Second, 10*time.Millisecond)
+
+	wp, err = pool.acquire(context.Background(), "runner", config, newTestWarmPodTemplate("ubuntu"))
+	require.NoError(t, err)
+	assert.Nil(t, wp, "pods of other pod configurations aren't acquired")
+}
+
+func TestWarmPodPoolAcquirePendingTimeout(t *testing.T) {
+	pool, client := newTestWarmPodPool(t)
+	config := &common.KubernetesConfig{
+		PollTimeout: 60,
+		WarmPool:    &common.KubernetesWarmPoolConfig{Size: 1},
+	}
+
+	now := time.Now()
+	pool.now = func() time.Time { return now }
+
+	_, err := pool.acquire(context.Background(), "runner", config, newTestWarmPodTemplate("alpine"))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return len(listWarmPods(t, client)) == 1 }, time.Second, 10*time.Millisecond)
+	pending := listWarmPods(t, client)[0].Name
+
+	now = now.Add(2 * time.Minute)
+
+	wp, err := pool.acquire(context.Background(), "runner", config, newTestWarmPodTemplate("alpine"))
+	require.NoError(t, err)
+	assert.Nil(t, wp)
+
+	// the pod still pending is replaced
+	require.Eventually(t, func() bool {
+		pods := listWarmPods(t, client)
+		return len(pods) == 1 && pods[0].Name != pending
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestWarmPodPoolRelease(t *testing.T) {
+	tests := map[string]struct {
+		maxUseCount      int
+		size             int
+		recycleErr       error
+		expectedReleased bool
+		expectedRecycle  bool
+	}{
+		"maximum use count reached": {
+			maxUseCount: 1,
+			size:        1,
+		},
+		"recycled": {
+			maxUseCount:      2,
+			size:             1,
+			expectedReleased: true,
+			expectedRecycle:  true,
+		},
+		"recycle failure": {
+			maxUseCount:     2,
+			size:            1,
+			recycleErr:      errors.New("recycle failure"),
+			expectedRecycle: true,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			pool, _ := newTestWarmPodPool(t)
+			config := &common.KubernetesConfig{
+				WarmPool: &common.KubernetesWarmPoolConfig{Size: tt.size, MaxUseCount: tt.maxUseCount},
+			}
+
+			key, err := warmPodKey("runner", newTestWarmPodTemplate("alpine"))
+			require.NoError(t, err)
+
+			template, err := pool.template(key, "runner", config, newTestWarmPodTemplate("alpine"))
+			require.NoError(t, err)
+
+			recycled := false
+			wp := &warmPod{key: key, name: "warm-pod", namespace: "ci", uses: 1}
+			released := pool.release(context.Background(), wp, func(context.Context) error {
+				recycled = true
+				return tt.recycleErr
+			})
+
+			assert.Equal(t, tt.expectedReleased, released)
+			assert.Equal(t, tt.expectedRecycle, recycled)
+			if tt.expectedReleased {
+				assert.Equal(t, []*warmPod{wp}, template.idle)
+			}
+		})
+	}
+}
+
+func TestUnassignWarmPod(t *testing.T) {
+	version, codec := testVersionAndCodec()
+
+	var patch map[string]interface{}
+	client := testKubernetesClient(version, fakerest.CreateHTTPClient(func(req *http.Request) (*http.Response, error) {
+		if req.URL.Path != "/api/v1/namespaces/ci/pods/warm-pod" || req.Method != http.MethodPatch {
+			t.Errorf("unexpected request: %s %s", req.Method, req.URL)
+			return nil, nil
+		}
+
+		body, _ := io.ReadAll(req.Body)
+		require.NoError(t, json.Unmarshal(body, &patch))
+
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     map[string][]string{"Content-Type": {"application/json"}},
+			Body:       objBody(codec, &api.Pod{}),
+		}, nil
+	}))
+
+	e := newExecutor()
+	e.kubeClient = client
+	e.warmPod = &warmPod{
+		key:            "key",
+		name:           "warm-pod",
+		namespace:      "ci",
+		jobLabels:      []string{jobIDLabel, warmPoolOwnerLabel, "pod"},
+		jobAnnotations: []string{"job.runner.gitlab.com/url"},
+	}
+
+	require.NoError(t, e.unassignWarmPod(context.Background()))
+
+	// the job's metadata is removed with null values, the other metadata of
+	// the pod, including the warm pool key and owner, is kept
+	assert.Equal(t, map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]interface{}{
+				jobIDLabel: nil,
+				"pod":      nil,
+			},
+			"annotations": map[string]interface{}{
+				"job.runner.gitlab.com/url": nil,
+			},
+		},
+	}, patch)
+	assert.Empty(t, e.warmPod.jobLabels)
+
+	// the idle pod isn't taken for a resource of the job that used it, unless
+	// it's owned by another process
+	idle := &api.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels:            map[string]string{warmPoolKeyLabel: "key", warmPoolOwnerLabel: warmPods.owner},
+			CreationTimestamp: metav1.NewTime(time.Now().Add(-24 * time.Hour)),
+		},
+	}
+	assert.False(t, newOrphanedResourcesGC().isOrphaned(idle, map[int64]bool{}, time.Hour))
+
+	idle.Labels[warmPoolOwnerLabel] = "crashed-process"
+	assert.True(t, newOrphanedResourcesGC().isOrphaned(idle, map[int64]bool{}, time.Hour))
+}
+
+func TestWarmPodPoolExpire(t *testing.T) {
+	pool, client := newTestWarmPodPool(t)
+	config := &common.KubernetesConfig{
+		WarmPool: &common.KubernetesWarmPoolConfig{Size: 1, IdleTimeout: "10m"},
+	}
+
+	now := time.Now()
+	pool.now = func() time.Time { return now }
+
+	_, err := pool.acquire(context.Background(), "runner", config, newTestWarmPodTemplate("alpine"))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return len(listWarmPods(t, client)) == 1 }, time.Second, 10*time.Millisecond)
+
+	now = now.Add(11 * time.Minute)
+
+	_, err = pool.acquire(context.Background(), "runner", config, newTestWarmPodTemplate("ubuntu"))
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		pods := listWarmPods(t, client)
+		return len(pods) == 1 && pods[0].Spec.Containers[0].Image == "ubuntu"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestWarmPodPoolConfigure(t *testing.T) {
+	pool, client := newTestWarmPodPool(t)
+	config := &common.KubernetesConfig{WarmPool: &common.KubernetesWarmPoolConfig{Size: 1}}
+	runner := &common.RunnerConfig{
+		Name:              "runner",
+		RunnerCredentials: common.RunnerCredentials{Token: "runner-token"},
+		RunnerSettings:    common.RunnerSettings{Kubernetes: config},
+	}
+
+	_, err := pool.acquire(context.Background(), runner.ShortDescription(), config, newTestWarmPodTemplate("alpine"))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool { return len(listWarmPods(t, client)) == 1 }, time.Second, 10*time.Millisecond)
+
+	pool.configure([]*common.RunnerConfig{runner})
+	assert.Len(t, pool.templates, 1)
+
+	runner.Kubernetes = &common.KubernetesConfig{}
+	pool.configure([]*common.RunnerConfig{runner})
+	assert.Empty(t, pool.templates)
+
+	require.Eventually(t, func() bool { return len(listWarmPods(t, client)) == 0 }, time.Second, 10*time.Millisecond)
+}
+
+func TestWarmPodPoolShutdown(t *testing.T) {
+	pool, client := newTestWarmPodPool(t)
+	config := &common.KubernetesConfig{WarmPool: &common.KubernetesWarmPoolConfig{Size: 2}}
+
+	_, err := pool.acquire(context.Background(), "runner", config, newTestWarmPodTemplate("alpine"))
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		pool.mu.Lock()
+		defer pool.mu.Unlock()
+
+		for _, template := range pool.templates {
+			return len(template.idle) == 2
+		}
+		return false
+	}, time.Second, 10*time.Millisecond)
+
+	pool.shutdown(context.Background())
+
+	assert.Empty(t, pool.templates)
+	assert.Empty(t, listWarmPods(t, client))
+}
+
+func TestIsWarmPoolEnabled(t *testing.T) {
+	tests := map[string]struct {
+		warmPool        *common.KubernetesWarmPoolConfig
+		services        common.Services
+		bearerToken     string
+		variables       common.JobVariables
+		expectedEnabled bool
+	}{
+		"not configured": {},
+		"empty pool": {
+			warmPool: &common.KubernetesWarmPoolConfig{},
+		},
+		"enabled": {
+			warmPool:        &common.KubernetesWarmPoolConfig{Size: 1},
+			expectedEnabled: true,
+		},
+		"job with services": {
+			warmPool: &common.KubernetesWarmPoolConfig{Size: 1},
+			services: common.Services{{Name: "postgres"}},
+		},
+		"bearer token overwritten": {
+			warmPool:    &common.KubernetesWarmPoolConfig{Size: 1},
+			bearerToken: "token",
+		},
+		"job with pull credentials": {
+			warmPool: &common.KubernetesWarmPoolConfig{Size: 1},
+			variables: common.JobVariables{
+				{Key: "DOCKER_AUTH_CONFIG", Value: `{"auths":{"registry.example.com":{"auth":"dXNlcjpwYXNz"}}}`},
+			},
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			e := newExecutor()
+			e.Build = &common.Build{
+				JobResponse: common.JobResponse{
+					ID:        456,
+					JobInfo:   common.JobInfo{ProjectID: 123},
+					Variables: tt.variables,
+				},
+				Runner: &common.RunnerConfig{},
+			}
+			e.Config.Kubernetes = &common.KubernetesConfig{WarmPool: tt.warmPool}
+			e.options = &kubernetesOptions{Services: tt.services}
+			e.configurationOverwrites = &overwrites{bearerToken: tt.bearerToken}
+
+			assert.Equal(t, tt.expectedEnabled, e.isWarmPoolEnabled())
+
+			if tt.expectedEnabled {
+				assert.Equal(t, "/scripts", e.scriptsDir())
+				assert.Equal(t, "/logs", e.logsDir())
+				return
+			}
+
+			assert.Equal(t, "/scripts-123-456", e.scriptsDir())
+			assert.Equal(t, "/logs-123-456", e.logsDir())
+		})
+	}
+}
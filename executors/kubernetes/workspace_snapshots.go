@@ -0,0 +1,637 @@
+package kubernetes
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/net/context"
+	api "k8s.io/api/core/v1"
+	kubeerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	restclient "k8s.io/client-go/rest"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/retry"
+)
+
+const (
+	workspaceProjectLabel = "workspace." + k8sAnnotationPrefix + "project"
+	workspaceRefLabel     = "workspace." + k8sAnnotationPrefix + "ref"
+	workspaceRunnerLabel  = "workspace." + k8sAnnotationPrefix + "runner"
+
+	// workspaceRefTypeLabel and workspaceRefProtectedLabel keep the snapshots
+	// of branches and tags, and of protected and unprotected refs, apart
+	workspaceRefTypeLabel      = "workspace." + k8sAnnotationPrefix + "ref-type"
+	workspaceRefProtectedLabel = "workspace." + k8sAnnotationPrefix + "ref-protected"
+
+	// workspaceRefAnnotation keeps the name of the ref, as the ref label is a
+	// hash of it
+	workspaceRefAnnotation = "workspace." + k8sAnnotationPrefix + "ref-name"
+
+	// workspaceBuildsSubPath and workspaceCacheSubPath are the directories of
+	// the workspace volume mounted as the builds and cache directories
+	workspaceBuildsSubPath = "builds"
+	workspaceCacheSubPath  = "cache"
+
+	volumeSnapshotAPIGroup = "snapshot.storage.k8s.io"
+	volumeSnapshotKind     = "VolumeSnapshot"
+)
+
+var (
+	volumeSnapshotsResource = schema.GroupVersionResource{
+		Group:    volumeSnapshotAPIGroup,
+		Version:  "v1",
+		Resource: "volumesnapshots",
+	}
+
+	workspaceSnapshotPollInterval = time.Second
+
+	// workspaceSnapshotPruneInterval is how often the snapshots of all the
+	// projects of a runner are pruned
+	workspaceSnapshotPruneInterval = 10 * time.Minute
+
+	newWorkspaceSnapshotClient = func(config *restclient.Config) (dynamic.Interface, error) {
+		return dynamic.NewForConfig(config)
+	}
+)
+
+// isWorkspaceSnapshotsEnabled returns whether the job's workspace is restored
+// from snapshots. The jobs running in their own namespace can't restore the
+// snapshots taken in the namespaces of the previous jobs.
+func (s *executor) isWorkspaceSnapshotsEnabled() bool {
+	return s.Config.Kubernetes != nil &&
+		s.Config.Kubernetes.WorkspaceSnapshots != nil &&
+		s.isDefaultBuildsDirVolumeRequired() &&
+		!s.isNamespacePerJobEnabled()
+}
+
+// workspaceRef is a ref of the project the workspace snapshots are taken for
+type workspaceRef struct {
+	name      string
+	refType   common.GitInfoRefType
+	protected bool
+}
+
+// jobWorkspaceRef returns the job's ref. The ref of a merge request pipeline
+// is never protected, as the pipeline runs the code of the merge request.
+func (s *executor) jobWorkspaceRef() *workspaceRef {
+	variables := s.Build.GetAllVariables()
+
+	return &workspaceRef{
+		name:    s.Build.GitInfo.Ref,
+		refType: s.Build.GitInfo.RefType,
+		protected: variables.Bool("CI_COMMIT_REF_PROTECTED") &&
+			variables.Value("CI_PIPELINE_SOURCE") != "merge_request_event",
+	}
+}
+
+// workspaceLabels identify the workspace snapshots of the project's ref taken
+// by the runner, or of all the project's refs when ref is nil. The ref is
+// hashed, as it can be longer than the labels.
+func (s *executor) workspaceLabels(ref *workspaceRef) map[string]string {
+	l := map[string]string{
+		workspaceProjectLabel: strconv.FormatInt(s.Build.JobInfo.ProjectID, 10),
+		workspaceRunnerLabel:  sanitizeLabel(s.Build.Runner.ShortDescription()),
+	}
+
+	if ref != nil {
+		sum := sha256.Sum256([]byte(ref.name))
+		l[workspaceRefLabel] = fmt.Sprintf("%x", sum[:16])
+		l[workspaceRefTypeLabel] = sanitizeLabel(string(ref.refType))
+		l[workspaceRefProtectedLabel] = strconv.FormatBool(ref.protected)
+	}
+
+	return l
+}
+
+func (s *executor) workspaceSnapshotClient() (dynamic.ResourceInterface, error) {
+	client, err := newWorkspaceSnapshotClient(s.kubeConfig)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to Kubernetes: %w", err)
+	}
+
+	return client.Resource(volumeSnapshotsResource).Namespace(s.configurationOverwrites.namespace), nil
+}
+
+// setupWorkspace creates the volume of the builds directory, restored from the
+// latest snapshot of the job's ref, or of the default branch otherwise
+func (s *executor) setupWorkspace(ctx context.Context) error {
+	if !s.isWorkspaceSnapshotsEnabled() {
+		return nil
+	}
+
+	config := s.Config.Kubernetes.WorkspaceSnapshots
+
+	size, err := resource.ParseQuantity(config.GetSize())
+	if err != nil {
+		return fmt.Errorf("parsing workspace size: %w", err)
+	}
+
+	pvc := api.PersistentVolumeClaim{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        generateNameForK8sResources(s.Build.ProjectUniqueName()),
+			Namespace:   s.configurationOverwrites.namespace,
+			Labels:      s.workspaceLabels(s.jobWorkspaceRef()),
+			Annotations: map[string]string{workspaceRefAnnotation: s.Build.GitInfo.Ref},
+		},
+		Spec: api.PersistentVolumeClaimSpec{
+			AccessModes: []api.PersistentVolumeAccessMode{api.ReadWriteOnce},
+			Resources: api.ResourceRequirements{
+				Requests: api.ResourceList{api.ResourceStorage: size},
+			},
+		},
+	}
+
+	if config.StorageClass != "" {
+		pvc.Spec.StorageClassName = &config.StorageClass
+	}
+
+	snapshot, err := s.findWorkspaceSnapshot(ctx)
+	switch {
+	case err != nil:
+		s.Warningln("Failed to look up the workspace snapshots, starting with an empty workspace:", err)
+	case snapshot == "":
+		s.Println("No workspace snapshot found, starting with an empty workspace")
+	default:
+		s.Println("Restoring the workspace from the snapshot", snapshot)
+
+		apiGroup := volumeSnapshotAPIGroup
+		pvc.Spec.DataSource = &api.TypedLocalObjectReference{
+			APIGroup: &apiGroup,
+			Kind:     volumeSnapshotKind,
+			Name:     snapshot,
+		}
+	}
+
+	r := retry.WithBuildLog(
+		&retryableKubeAPICall{
+			maxTries: defaultTries,
+			fn: func() error {
+				workspace, err := s.kubeClient.CoreV1().
+					PersistentVolumeClaims(pvc.Namespace).
+					Create(ctx, &pvc, metav1.CreateOptions{})
+				if isConflict(err) {
+					workspace, err = s.kubeClient.CoreV1().
+						PersistentVolumeClaims(pvc.Namespace).
+						Get(ctx, pvc.Name, metav1.GetOptions{})
+				}
+				if err == nil {
+					s.workspace = workspace
+				}
+				return err
+			},
+		},
+		&s.BuildLogger,
+	)
+	retryable := retry.NewWithBackoffDuration(r, defaultRetryMinBackoff, defaultRetryMaxBackoff)
+
+	return retryable.Run()
+}
+
+// findWorkspaceSnapshot returns the name of the latest snapshot ready to be
+// restored, of the job's ref or of the default branch. Only the snapshots of
+// the default branch taken at the same protection level as the job's ref are
+// restored, so that the jobs of unprotected refs and merge requests don't
+// restore the files of protected jobs.
+func (s *executor) findWorkspaceSnapshot(ctx context.Context) (string, error) {
+	client, err := s.workspaceSnapshotClient()
+	if err != nil {
+		return "", err
+	}
+
+	jobRef := s.jobWorkspaceRef()
+	refs := []*workspaceRef{jobRef}
+
+	defaultBranch := &workspaceRef{
+		name:      s.Build.GetAllVariables().Value("CI_DEFAULT_BRANCH"),
+		refType:   common.RefTypeBranch,
+		protected: jobRef.protected,
+	}
+	if defaultBranch.name != "" && *defaultBranch != *jobRef {
+		refs = append(refs, defaultBranch)
+	}
+
+	for _, ref := range refs {
+		list, err := client.List(ctx, metav1.ListOptions{
+			LabelSelector: labels.SelectorFromSet(s.workspaceLabels(ref)).String(),
+		})
+		if err != nil {
+			return "", err
+		}
+
+		var latest *unstructured.Unstructured
+		for i := range list.Items {
+			snapshot := &list.Items[i]
+
+			ready, _, _ := unstructured.NestedBool(snapshot.Object, "status", "readyToUse")
+			if !ready || snapshot.GetDeletionTimestamp() != nil {
+				continue
+			}
+
+			if latest == nil || latest.GetCreationTimestamp().Time.Before(snapshot.GetCreationTimestamp().Time) {
+				latest = snapshot
+			}
+		}
+
+		if latest != nil {
+			return latest.GetName(), nil
+		}
+	}
+
+	return "", nil
+}
+
+// snapshotWorkspace snapshots the volume of the builds directory of a
+// successful job, for the next jobs of its ref to be restored from it. The
+// snapshot must be taken before the pod is deleted, as the volume is deleted
+// with it.
+func (s *executor) snapshotWorkspace(ctx context.Context) {
+	if s.workspace == nil || !s.buildSucceeded {
+		return
+	}
+
+	client, err := s.workspaceSnapshotClient()
+	if err != nil {
+		s.Warningln("Failed to snapshot the workspace:", err)
+		return
+	}
+
+	snapshot := &unstructured.Unstructured{}
+	snapshot.SetAPIVersion(volumeSnapshotsResource.GroupVersion().String())
+	snapshot.SetKind(volumeSnapshotKind)
+	snapshot.SetName(s.workspace.Name)
+	snapshot.SetNamespace(s.workspace.Namespace)
+	snapshot.SetLabels(s.workspace.Labels)
+	snapshot.SetAnnotations(s.workspace.Annotations)
+	_ = unstructured.SetNestedField(snapshot.Object, s.workspace.Name, "spec", "source", "persistentVolumeClaimName")
+	if class := s.Config.Kubernetes.WorkspaceSnapshots.SnapshotClass; class != "" {
+		_ = unstructured.SetNestedField(snapshot.Object, class, "spec", "volumeSnapshotClassName")
+	}
+
+	_, err = client.Create(ctx, snapshot, metav1.CreateOptions{})
+	if err != nil {
+		s.Warningln("Failed to snapshot the workspace:", err)
+		return
+	}
+
+	err = s.waitForWorkspaceSnapshot(ctx, client, snapshot.GetName())
+	if err != nil {
+		s.Warningln("Failed to snapshot the workspace:", err)
+		return
+	}
+
+	s.Println("Created the workspace snapshot", snapshot.GetName())
+}
+
+// waitForWorkspaceSnapshot waits until the snapshot is taken. It can be
+// restored from later, once its content is uploaded by the storage provider.
+func (s *executor) waitForWorkspaceSnapshot(ctx context.Context, client dynamic.ResourceInterface, name string) error {
+	ticker := time.NewTicker(workspaceSnapshotPollInterval)
+	defer ticker.Stop()
+
+	for {
+		snapshot, err := client.Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+
+		message, _, _ := unstructured.NestedString(snapshot.Object, "status", "error", "message")
+		if message != "" {
+			return errors.New(message)
+		}
+
+		creationTime, _, _ := unstructured.NestedString(snapshot.Object, "status", "creationTime")
+		ready, _, _ := unstructured.NestedBool(snapshot.Object, "status", "readyToUse")
+		if creationTime != "" || ready {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// cleanupWorkspace deletes the volume of the builds directory when it isn't
+// owned by the pod, and the snapshots of the project that exceed the retention
+func (s *executor) cleanupWorkspace(ctx context.Context) {
+	if s.workspace == nil {
+		return
+	}
+
+	if len(s.workspace.OwnerReferences) == 0 {
+		err := s.kubeClient.CoreV1().
+			PersistentVolumeClaims(s.workspace.Namespace).
+			Delete(ctx, s.workspace.Name, metav1.DeleteOptions{})
+		if err != nil {
+			s.Errorln(fmt.Sprintf("Error cleaning up workspace volume: %s", err.Error()))
+		}
+	}
+
+	err := s.pruneWorkspaceSnapshots(ctx)
+	if err != nil {
+		s.Warningln("Failed to remove the expired workspace snapshots:", err)
+	}
+}
+
+// pruneWorkspaceSnapshots deletes the snapshots of the project that exceed the
+// retention
+func (s *executor) pruneWorkspaceSnapshots(ctx context.Context) error {
+	client, err := s.workspaceSnapshotClient()
+	if err != nil {
+		return err
+	}
+
+	return pruneSnapshots(ctx, client, s.workspaceLabels(nil), s.Config.Kubernetes.WorkspaceSnapshots, func(name string) {
+		s.Debugln("Removed the workspace snapshot", name)
+	})
+}
+
+// pruneSnapshots deletes the snapshots matching the labels older than the
+// maximum age, and the oldest snapshots of each project's ref beyond the
+// retention
+func pruneSnapshots(
+	ctx context.Context,
+	client dynamic.ResourceInterface,
+	selector map[string]string,
+	config *common.KubernetesWorkspaceSnapshotsConfig,
+	removed func(name string),
+) error {
+	maxAge, err := config.GetMaxAge()
+	if err != nil {
+		return err
+	}
+
+	list, err := client.List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(selector).String(),
+	})
+	if err != nil {
+		return err
+	}
+
+	snapshots := list.Items
+	sort.Slice(snapshots, func(i, j int) bool {
+		return snapshots[j].GetCreationTimestamp().Time.Before(snapshots[i].GetCreationTimestamp().Time)
+	})
+
+	kept := make(map[string]int)
+	for _, snapshot := range snapshots {
+		if snapshot.GetDeletionTimestamp() != nil {
+			continue
+		}
+
+		ref := strings.Join([]string{
+			snapshot.GetLabels()[workspaceProjectLabel],
+			snapshot.GetLabels()[workspaceRefLabel],
+			snapshot.GetLabels()[workspaceRefTypeLabel],
+			snapshot.GetLabels()[workspaceRefProtectedLabel],
+		}, "/")
+		expired := time.Since(snapshot.GetCreationTimestamp().Time) > maxAge
+		if !expired && kept[ref] < config.GetRetention() {
+			kept[ref]++
+			continue
+		}
+
+		err := client.Delete(ctx, snapshot.GetName(), metav1.DeleteOptions{})
+		if err != nil && !kubeerrors.IsNotFound(err) {
+			return err
+		}
+
+		removed(snapshot.GetName())
+	}
+
+	return nil
+}
+
+var workspaceSnapshotPruners = newWorkspaceSnapshotPrunerSet()
+
+type workspaceSnapshotPruner struct {
+	config common.RunnerConfig
+	cancel func()
+	done   chan struct{}
+}
+
+// workspaceSnapshotPrunerSet prunes the snapshots of all the projects of the
+// runners that have workspace snapshots configured. The jobs prune only the
+// snapshots of their own project, so the snapshots of the projects that don't
+// run jobs anymore would be kept forever otherwise.
+type workspaceSnapshotPrunerSet struct {
+	lock    sync.Mutex
+	pruners map[string]*workspaceSnapshotPruner
+}
+
+func newWorkspaceSnapshotPrunerSet() *workspaceSnapshotPrunerSet {
+	return &workspaceSnapshotPrunerSet{
+		pruners: make(map[string]*workspaceSnapshotPruner),
+	}
+}
+
+// configure starts the pruners of the runners that have workspace snapshots
+// configured, restarts the ones whose configuration changed and stops the
+// others
+func (ps *workspaceSnapshotPrunerSet) configure(runners []*common.RunnerConfig) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	configured := make(map[string]bool)
+
+	for _, runner := range runners {
+		if runner.Executor != common.ExecutorKubernetes || runner.Kubernetes == nil ||
+			runner.Kubernetes.WorkspaceSnapshots == nil {
+			continue
+		}
+
+		name := runner.ShortDescription()
+		configured[name] = true
+
+		pruner, ok := ps.pruners[name]
+		if ok && reflect.DeepEqual(pruner.config.Kubernetes, runner.Kubernetes) {
+			continue
+		}
+
+		if ok {
+			pruner.cancel()
+		}
+
+		ps.pruners[name] = ps.start(*runner)
+	}
+
+	for name, pruner := range ps.pruners {
+		if !configured[name] {
+			pruner.cancel()
+			delete(ps.pruners, name)
+		}
+	}
+}
+
+func (ps *workspaceSnapshotPrunerSet) start(config common.RunnerConfig) *workspaceSnapshotPruner {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	pruner := &workspaceSnapshotPruner{
+		config: config,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	go func() {
+		defer close(pruner.done)
+
+		logger := logrus.WithField("runner", config.ShortDescription())
+
+		for {
+			err := pruneRunnerWorkspaceSnapshots(ctx, &pruner.config, logger)
+			if ctx.Err() != nil {
+				return
+			}
+
+			if err != nil {
+				logger.WithError(err).Warningln("Failed to remove the expired workspace snapshots")
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(workspaceSnapshotPruneInterval):
+			}
+		}
+	}()
+
+	return pruner
+}
+
+// stop stops all the pruners and waits for them to finish
+func (ps *workspaceSnapshotPrunerSet) stop(ctx context.Context) {
+	ps.lock.Lock()
+	pruners := ps.pruners
+	ps.pruners = make(map[string]*workspaceSnapshotPruner)
+	ps.lock.Unlock()
+
+	for _, pruner := range pruners {
+		pruner.cancel()
+	}
+
+	for _, pruner := range pruners {
+		select {
+		case <-pruner.done:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// pruneRunnerWorkspaceSnapshots prunes the snapshots taken by the runner in its
+// namespace, for all the projects
+func pruneRunnerWorkspaceSnapshots(ctx context.Context, config *common.RunnerConfig, logger logrus.FieldLogger) error {
+	kubeConfig, err := getKubeClientConfig(config.Kubernetes, &overwrites{})
+	if err != nil {
+		return fmt.Errorf("connecting to Kubernetes: %w", err)
+	}
+
+	client, err := newWorkspaceSnapshotClient(kubeConfig)
+	if err != nil {
+		return fmt.Errorf("connecting to Kubernetes: %w", err)
+	}
+
+	namespace := config.Kubernetes.Namespace
+	if namespace == "" {
+		namespace = DefaultResourceIdentifier
+	}
+
+	selector := map[string]string{workspaceRunnerLabel: sanitizeLabel(config.ShortDescription())}
+
+	return pruneSnapshots(
+		ctx,
+		client.Resource(volumeSnapshotsResource).Namespace(namespace),
+		selector,
+		config.Kubernetes.WorkspaceSnapshots,
+		func(name string) {
+			logger.WithField("snapshot", name).Debugln("Removed the workspace snapshot")
+		},
+	)
+}
+
+// setWorkspaceOwnerReferences makes the pod own the volume of the builds
+// directory, for it to be deleted with the pod
+func (s *executor) setWorkspaceOwnerReferences(ctx context.Context, ownerReferences []metav1.OwnerReference) error {
+	if s.workspace == nil {
+		return nil
+	}
+
+	r := retry.WithBuildLog(
+		&retryableKubeAPICall{
+			maxTries: defaultTries,
+			fn: func() error {
+				pvc := s.workspace.DeepCopy()
+				pvc.SetOwnerReferences(ownerReferences)
+
+				workspace, err := s.kubeClient.CoreV1().
+					PersistentVolumeClaims(pvc.Namespace).
+					Update(ctx, pvc, metav1.UpdateOptions{})
+				if err == nil {
+					s.workspace = workspace
+				}
+				return err
+			},
+		},
+		&s.BuildLogger,
+	)
+	retryable := retry.NewWithBackoffDuration(r, defaultRetryMinBackoff, defaultRetryMaxBackoff)
+
+	return retryable.Run()
+}
+
+func (s *executor) getBuildsDirVolumeSource() api.VolumeSource {
+	if s.workspace == nil {
+		return api.VolumeSource{
+			EmptyDir: &api.EmptyDirVolumeSource{},
+		}
+	}
+
+	return api.VolumeSource{
+		PersistentVolumeClaim: &api.PersistentVolumeClaimVolumeSource{ClaimName: s.workspace.Name},
+	}
+}
+
+// getBuildsDirVolumeMounts mounts the builds directory, and the cache directory
+// when the workspace is snapshotted, for the local cache to be restored with it
+func (s *executor) getBuildsDirVolumeMounts() []api.VolumeMount {
+	if s.workspace == nil {
+		return []api.VolumeMount{{
+			Name:      "repo",
+			MountPath: s.AbstractExecutor.RootDir(),
+		}}
+	}
+
+	mounts := []api.VolumeMount{{
+		Name:      "repo",
+		MountPath: s.AbstractExecutor.RootDir(),
+		SubPath:   workspaceBuildsSubPath,
+	}}
+
+	for _, mount := range s.getVolumeMountsForConfig() {
+		if mount.MountPath == s.AbstractExecutor.CacheDir() {
+			return mounts
+		}
+	}
+
+	return append(mounts, api.VolumeMount{
+		Name:      "repo",
+		MountPath: s.AbstractExecutor.CacheDir(),
+		SubPath:   workspaceCacheSubPath,
+	})
+}
@@ -0,0 +1,452 @@
+//go:build !integration
+
+package kubernetes
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/net/context"
+	api "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	restclient "k8s.io/client-go/rest"
+	k8stesting "k8s.io/client-go/testing"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+func newWorkspaceTestExecutor(t *testing.T, snapshots ...runtime.Object) (*executor, *dynamicfake.FakeDynamicClient) {
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+		runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{volumeSnapshotsResource: "VolumeSnapshotList"},
+		snapshots...,
+	)
+
+	oldNewClient := newWorkspaceSnapshotClient
+	t.Cleanup(func() { newWorkspaceSnapshotClient = oldNewClient })
+	newWorkspaceSnapshotClient = func(_ *restclient.Config) (dynamic.Interface, error) {
+		return client, nil
+	}
+
+	e := newExecutor()
+	e.Build = &common.Build{
+		JobResponse: common.JobResponse{
+			JobInfo: common.JobInfo{ProjectID: 123},
+			GitInfo: common.GitInfo{Ref: "feature", RefType: common.RefTypeBranch},
+			Variables: common.JobVariables{
+				{Key: "CI_DEFAULT_BRANCH", Value: "main", Public: true},
+			},
+		},
+		Runner: &common.RunnerConfig{
+			RunnerCredentials: common.RunnerCredentials{Token: "runner-token"},
+		},
+	}
+	e.Config.Kubernetes = &common.KubernetesConfig{
+		WorkspaceSnapshots: &common.KubernetesWorkspaceSnapshotsConfig{},
+	}
+	e.configurationOverwrites = &overwrites{namespace: "ci"}
+	e.BuildLogger = common.NewBuildLogger(&common.Trace{Writer: io.Discard}, e.Build.Log())
+
+	return e, client
+}
+
+func newTestWorkspaceSnapshot(e *executor, name, ref string, created time.Time, ready bool) *unstructured.Unstructured {
+	snapshot := &unstructured.Unstructured{}
+	snapshot.SetAPIVersion("snapshot.storage.k8s.io/v1")
+	snapshot.SetKind("VolumeSnapshot")
+	snapshot.SetName(name)
+	snapshot.SetNamespace("ci")
+	snapshot.SetLabels(e.workspaceLabels(&workspaceRef{name: ref, refType: common.RefTypeBranch}))
+	snapshot.SetCreationTimestamp(metav1.NewTime(created))
+	_ = unstructured.SetNestedField(snapshot.Object, ready, "status", "readyToUse")
+
+	return snapshot
+}
+
+func protectedWorkspaceSnapshot(snapshot *unstructured.Unstructured) *unstructured.Unstructured {
+	l := snapshot.GetLabels()
+	l[workspaceRefProtectedLabel] = "true"
+	snapshot.SetLabels(l)
+
+	return snapshot
+}
+
+func listWorkspaceSnapshots(t *testing.T, client dynamic.Interface) []string {
+	list, err := client.Resource(volumeSnapshotsResource).Namespace("ci").List(context.Background(), metav1.ListOptions{})
+	require.NoError(t, err)
+
+	var names []string
+	for _, snapshot := range list.Items {
+		names = append(names, snapshot.GetName())
+	}
+
+	return names
+}
+
+func TestWorkspaceLabels(t *testing.T) {
+	e, _ := newWorkspaceTestExecutor(t)
+
+	main := &workspaceRef{name: "main", refType: common.RefTypeBranch, protected: true}
+
+	l := e.workspaceLabels(main)
+	assert.Equal(t, "123", l["workspace.runner.gitlab.com/project"])
+	assert.Equal(t, "runner-t", l["workspace.runner.gitlab.com/runner"])
+	assert.Len(t, l["workspace.runner.gitlab.com/ref"], 32)
+	assert.Equal(t, "branch", l["workspace.runner.gitlab.com/ref-type"])
+	assert.Equal(t, "true", l["workspace.runner.gitlab.com/ref-protected"])
+	assert.NotEqual(t, l, e.workspaceLabels(&workspaceRef{name: "feature", refType: common.RefTypeBranch, protected: true}))
+	assert.NotEqual(t, l, e.workspaceLabels(&workspaceRef{name: "main", refType: common.RefTypeTag, protected: true}))
+	assert.NotEqual(t, l, e.workspaceLabels(&workspaceRef{name: "main", refType: common.RefTypeBranch}))
+
+	assert.NotContains(t, e.workspaceLabels(nil), "workspace.runner.gitlab.com/ref")
+	assert.NotContains(t, e.workspaceLabels(nil), "workspace.runner.gitlab.com/ref-protected")
+}
+
+func TestJobWorkspaceRef(t *testing.T) {
+	tests := map[string]struct {
+		variables         common.JobVariables
+		expectedProtected bool
+	}{
+		"unprotected ref": {},
+		"protected ref": {
+			variables: common.JobVariables{
+				{Key: "CI_COMMIT_REF_PROTECTED", Value: "true", Public: true},
+			},
+			expectedProtected: true,
+		},
+		"merge request pipeline": {
+			variables: common.JobVariables{
+				{Key: "CI_COMMIT_REF_PROTECTED", Value: "true", Public: true},
+				{Key: "CI_PIPELINE_SOURCE", Value: "merge_request_event", Public: true},
+			},
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			e, _ := newWorkspaceTestExecutor(t)
+			e.Build.Variables = append(e.Build.Variables, tt.variables...)
+
+			assert.Equal(t, &workspaceRef{
+				name:      "feature",
+				refType:   common.RefTypeBranch,
+				protected: tt.expectedProtected,
+			}, e.jobWorkspaceRef())
+		})
+	}
+}
+
+func TestFindWorkspaceSnapshot(t *testing.T) {
+	now := time.Now()
+	e, _ := newWorkspaceTestExecutor(t)
+
+	tests := map[string]struct {
+		snapshots        []runtime.Object
+		variables        common.JobVariables
+		expectedSnapshot string
+	}{
+		"no snapshots": {},
+		"latest ready snapshot of the ref": {
+			snapshots: []runtime.Object{
+				newTestWorkspaceSnapshot(e, "old", "feature", now.Add(-2*time.Hour), true),
+				newTestWorkspaceSnapshot(e, "latest", "feature", now.Add(-time.Hour), true),
+				newTestWorkspaceSnapshot(e, "not-ready", "feature", now, false),
+				newTestWorkspaceSnapshot(e, "main", "main", now, true),
+			},
+			expectedSnapshot: "latest",
+		},
+		"default branch snapshot": {
+			snapshots: []runtime.Object{
+				newTestWorkspaceSnapshot(e, "not-ready", "feature", now, false),
+				newTestWorkspaceSnapshot(e, "main", "main", now, true),
+				newTestWorkspaceSnapshot(e, "other", "other", now, true),
+			},
+			expectedSnapshot: "main",
+		},
+		"protected default branch snapshot for an unprotected ref": {
+			snapshots: []runtime.Object{
+				protectedWorkspaceSnapshot(newTestWorkspaceSnapshot(e, "main", "main", now, true)),
+			},
+		},
+		"protected default branch snapshot for a protected ref": {
+			snapshots: []runtime.Object{
+				protectedWorkspaceSnapshot(newTestWorkspaceSnapshot(e, "main", "main", now, true)),
+				newTestWorkspaceSnapshot(e, "unprotected-main", "main", now.Add(time.Hour), true),
+			},
+			variables: common.JobVariables{
+				{Key: "CI_COMMIT_REF_PROTECTED", Value: "true", Public: true},
+			},
+			expectedSnapshot: "main",
+		},
+		"protected default branch snapshot for a merge request": {
+			snapshots: []runtime.Object{
+				protectedWorkspaceSnapshot(newTestWorkspaceSnapshot(e, "main", "main", now, true)),
+			},
+			variables: common.JobVariables{
+				{Key: "CI_COMMIT_REF_PROTECTED", Value: "true", Public: true},
+				{Key: "CI_PIPELINE_SOURCE", Value: "merge_request_event", Public: true},
+			},
+		},
+		"protected snapshot of the ref for an unprotected ref": {
+			snapshots: []runtime.Object{
+				protectedWorkspaceSnapshot(newTestWorkspaceSnapshot(e, "feature", "feature", now, true)),
+			},
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			e, _ := newWorkspaceTestExecutor(t, tt.snapshots...)
+			e.Build.Variables = append(e.Build.Variables, tt.variables...)
+
+			snapshot, err := e.findWorkspaceSnapshot(context.Background())
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedSnapshot, snapshot)
+		})
+	}
+}
+
+func TestSnapshotWorkspace(t *testing.T) {
+	tests := map[string]struct {
+		buildSucceeded    bool
+		snapshotClass     string
+		expectedSnapshots []string
+	}{
+		"failed job": {},
+		"successful job": {
+			buildSucceeded:    true,
+			expectedSnapshots: []string{"workspace"},
+		},
+		"snapshot class": {
+			buildSucceeded:    true,
+			snapshotClass:     "csi-snapclass",
+			expectedSnapshots: []string{"workspace"},
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			e, client := newWorkspaceTestExecutor(t)
+			e.Config.Kubernetes.WorkspaceSnapshots.SnapshotClass = tt.snapshotClass
+			e.buildSucceeded = tt.buildSucceeded
+			e.workspace = &api.PersistentVolumeClaim{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      "workspace",
+					Namespace: "ci",
+					Labels:    e.workspaceLabels(e.jobWorkspaceRef()),
+				},
+			}
+
+			client.PrependReactor("create", "volumesnapshots", func(action k8stesting.Action) (bool, runtime.Object, error) {
+				snapshot := action.(k8stesting.CreateAction).GetObject().(*unstructured.Unstructured)
+
+				source, _, _ := unstructured.NestedString(snapshot.Object, "spec", "source", "persistentVolumeClaimName")
+				assert.Equal(t, "workspace", source)
+				class, _, _ := unstructured.NestedString(snapshot.Object, "spec", "volumeSnapshotClassName")
+				assert.Equal(t, tt.snapshotClass, class)
+				assert.Equal(t, e.workspaceLabels(e.jobWorkspaceRef()), snapshot.GetLabels())
+
+				_ = unstructured.SetNestedField(snapshot.Object, "2023-06-01T12:00:00Z", "status", "creationTime")
+
+				return false, nil, nil
+			})
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+
+			e.snapshotWorkspace(ctx)
+
+			assert.Equal(t, tt.expectedSnapshots, listWorkspaceSnapshots(t, client))
+		})
+	}
+}
+
+func TestWaitForWorkspaceSnapshotError(t *testing.T) {
+	e, client := newWorkspaceTestExecutor(t)
+
+	snapshot := newTestWorkspaceSnapshot(e, "workspace", "feature", time.Now(), false)
+	_ = unstructured.SetNestedField(snapshot.Object, "snapshot failed", "status", "error", "message")
+
+	_, err := client.Resource(volumeSnapshotsResource).Namespace("ci").
+		Create(context.Background(), snapshot, metav1.CreateOptions{})
+	require.NoError(t, err)
+
+	resource := client.Resource(volumeSnapshotsResource).Namespace("ci")
+	assert.EqualError(t, e.waitForWorkspaceSnapshot(context.Background(), resource, "workspace"), "snapshot failed")
+}
+
+func TestPruneWorkspaceSnapshots(t *testing.T) {
+	now := time.Now()
+	e, _ := newWorkspaceTestExecutor(t)
+
+	other := newTestWorkspaceSnapshot(e, "other-project", "feature", now.Add(-30*24*time.Hour), true)
+	other.SetLabels(map[string]string{
+		workspaceProjectLabel: "456",
+		workspaceRunnerLabel:  "runner-t",
+	})
+
+	e, client := newWorkspaceTestExecutor(
+		t,
+		newTestWorkspaceSnapshot(e, "feature-1", "feature", now.Add(-3*time.Hour), true),
+		newTestWorkspaceSnapshot(e, "feature-2", "feature", now.Add(-2*time.Hour), true),
+		newTestWorkspaceSnapshot(e, "feature-3", "feature", now.Add(-time.Hour), true),
+		newTestWorkspaceSnapshot(e, "main-1", "main", now.Add(-time.Hour), true),
+		protectedWorkspaceSnapshot(newTestWorkspaceSnapshot(e, "protected-main-1", "main", now.Add(-3*time.Hour), true)),
+		protectedWorkspaceSnapshot(newTestWorkspaceSnapshot(e, "protected-main-2", "main", now.Add(-2*time.Hour), true)),
+		protectedWorkspaceSnapshot(newTestWorkspaceSnapshot(e, "protected-main-3", "main", now.Add(-time.Hour), true)),
+		newTestWorkspaceSnapshot(e, "expired", "old", now.Add(-30*24*time.Hour), true),
+		other,
+	)
+	e.Config.Kubernetes.WorkspaceSnapshots.Retention = 2
+
+	require.NoError(t, e.pruneWorkspaceSnapshots(context.Background()))
+	assert.ElementsMatch(
+		t,
+		[]string{"feature-2", "feature-3", "main-1", "protected-main-2", "protected-main-3", "other-project"},
+		listWorkspaceSnapshots(t, client),
+	)
+}
+
+func TestPruneRunnerWorkspaceSnapshots(t *testing.T) {
+	now := time.Now()
+	e, _ := newWorkspaceTestExecutor(t)
+
+	projectSnapshot := func(name, project string, created time.Time) *unstructured.Unstructured {
+		snapshot := newTestWorkspaceSnapshot(e, name, "main", created, true)
+		labels := snapshot.GetLabels()
+		labels[workspaceProjectLabel] = project
+		snapshot.SetLabels(labels)
+
+		return snapshot
+	}
+
+	otherRunner := newTestWorkspaceSnapshot(e, "other-runner", "main", now.Add(-30*24*time.Hour), true)
+	otherRunner.SetLabels(map[string]string{
+		workspaceProjectLabel: "123",
+		workspaceRunnerLabel:  "other-ru",
+	})
+
+	_, client := newWorkspaceTestExecutor(
+		t,
+		projectSnapshot("project-1-expired", "1", now.Add(-30*24*time.Hour)),
+		projectSnapshot("project-1", "1", now.Add(-time.Hour)),
+		projectSnapshot("project-2-old", "2", now.Add(-2*time.Hour)),
+		projectSnapshot("project-2", "2", now.Add(-time.Hour)),
+		projectSnapshot("project-3-expired", "3", now.Add(-30*24*time.Hour)),
+		otherRunner,
+	)
+
+	config := &common.RunnerConfig{
+		RunnerCredentials: common.RunnerCredentials{Token: "runner-token"},
+		RunnerSettings: common.RunnerSettings{
+			Kubernetes: &common.KubernetesConfig{
+				Host:               "https://kubernetes.example.com",
+				Namespace:          "ci",
+				WorkspaceSnapshots: &common.KubernetesWorkspaceSnapshotsConfig{},
+			},
+		},
+	}
+
+	require.NoError(t, pruneRunnerWorkspaceSnapshots(context.Background(), config, logrus.New()))
+	assert.ElementsMatch(
+		t,
+		[]string{"project-1", "project-2", "other-runner"},
+		listWorkspaceSnapshots(t, client),
+	)
+}
+
+func TestWorkspaceSnapshotPrunerSetConfigure(t *testing.T) {
+	newRunner := func(token string, config *common.KubernetesWorkspaceSnapshotsConfig) *common.RunnerConfig {
+		return &common.RunnerConfig{
+			RunnerCredentials: common.RunnerCredentials{Token: token},
+			RunnerSettings: common.RunnerSettings{
+				Executor: common.ExecutorKubernetes,
+				Kubernetes: &common.KubernetesConfig{
+					Host:               "https://kubernetes.example.com",
+					WorkspaceSnapshots: config,
+				},
+			},
+		}
+	}
+
+	// the pruners fail to connect, and wait for the next interval
+	oldNewClient := newWorkspaceSnapshotClient
+	defer func() { newWorkspaceSnapshotClient = oldNewClient }()
+	newWorkspaceSnapshotClient = func(_ *restclient.Config) (dynamic.Interface, error) {
+		return nil, assert.AnError
+	}
+
+	ps := newWorkspaceSnapshotPrunerSet()
+	defer ps.stop(context.Background())
+
+	ps.configure([]*common.RunnerConfig{
+		newRunner("runner-1", &common.KubernetesWorkspaceSnapshotsConfig{}),
+		newRunner("runner-2", nil),
+	})
+	require.Len(t, ps.pruners, 1)
+	first := ps.pruners["runner-1"]
+	require.NotNil(t, first)
+
+	ps.configure([]*common.RunnerConfig{
+		newRunner("runner-1", &common.KubernetesWorkspaceSnapshotsConfig{}),
+	})
+	assert.Same(t, first, ps.pruners["runner-1"])
+
+	ps.configure([]*common.RunnerConfig{
+		newRunner("runner-1", &common.KubernetesWorkspaceSnapshotsConfig{MaxAge: "24h"}),
+	})
+	assert.NotSame(t, first, ps.pruners["runner-1"])
+	<-first.done
+
+	ps.configure(nil)
+	assert.Empty(t, ps.pruners)
+}
+
+func TestGetBuildsDirVolumeMounts(t *testing.T) {
+	e, _ := newWorkspaceTestExecutor(t)
+	e.DefaultBuildsDir = "/builds"
+	e.DefaultCacheDir = "/cache"
+
+	assert.Equal(t, []api.VolumeMount{{Name: "repo", MountPath: "/builds"}}, e.getBuildsDirVolumeMounts())
+	assert.Equal(t, &api.EmptyDirVolumeSource{}, e.getBuildsDirVolumeSource().EmptyDir)
+
+	e.workspace = &api.PersistentVolumeClaim{ObjectMeta: metav1.ObjectMeta{Name: "workspace"}}
+
+	assert.Equal(t, []api.VolumeMount{
+		{Name: "repo", MountPath: "/builds", SubPath: "builds"},
+		{Name: "repo", MountPath: "/cache", SubPath: "cache"},
+	}, e.getBuildsDirVolumeMounts())
+	assert.Equal(
+		t,
+		&api.PersistentVolumeClaimVolumeSource{ClaimName: "workspace"},
+		e.getBuildsDirVolumeSource().PersistentVolumeClaim,
+	)
+
+	e.Config.Kubernetes.Volumes.EmptyDirs = []common.KubernetesEmptyDir{{Name: "cache", MountPath: "/cache"}}
+
+	assert.Equal(t, []api.VolumeMount{
+		{Name: "repo", MountPath: "/builds", SubPath: "builds"},
+	}, e.getBuildsDirVolumeMounts())
+}
+
+func TestIsWorkspaceSnapshotsEnabled(t *testing.T) {
+	e, _ := newWorkspaceTestExecutor(t)
+	e.DefaultBuildsDir = "/builds"
+	assert.True(t, e.isWorkspaceSnapshotsEnabled())
+
+	e.requireDefaultBuildsDirVolume = nil
+	e.Config.Kubernetes.Volumes.EmptyDirs = []common.KubernetesEmptyDir{{Name: "builds", MountPath: "/builds"}}
+	assert.False(t, e.isWorkspaceSnapshotsEnabled(), "the builds directory is a configured volume")
+
+	e.Config.Kubernetes.WorkspaceSnapshots = nil
+	assert.False(t, e.isWorkspaceSnapshotsEnabled())
+}
@@ -0,0 +1,76 @@
+package shell
+
+import (
+	"os"
+	"sync"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/featureflags"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/process"
+)
+
+// resourceUsageCollector accumulates the resource usage of the script
+// processes, as reported by the operating system once they've been waited
+// for. Only the usage of descendants that the shell itself waited for is
+// included.
+type resourceUsageCollector struct {
+	lock  sync.Mutex
+	usage common.ResourceUsage
+}
+
+func (c *resourceUsageCollector) add(state *os.ProcessState) {
+	if state == nil {
+		return
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.usage.CPUSeconds += (state.UserTime() + state.SystemTime()).Seconds()
+
+	peakMemory, disk := processStateUsage(state)
+	if peakMemory > c.usage.PeakMemoryBytes {
+		c.usage.PeakMemoryBytes = peakMemory
+	}
+
+	if disk != nil {
+		if c.usage.Disk == nil {
+			c.usage.Disk = &common.ResourceUsageIO{}
+		}
+		c.usage.Disk.Add(*disk)
+	}
+}
+
+func (c *resourceUsageCollector) get() *common.ResourceUsage {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	usage := c.usage
+	if c.usage.Disk != nil {
+		disk := *c.usage.Disk
+		usage.Disk = &disk
+	}
+
+	return &usage
+}
+
+func (s *executor) setupResourceUsage() {
+	if processStateUsageSupported && s.Build.IsFeatureFlagOn(featureflags.ReportResourceUsage) {
+		s.resourceUsage = &resourceUsageCollector{}
+	}
+}
+
+func (s *executor) recordResourceUsage(c process.Commander) {
+	if s.resourceUsage != nil {
+		s.resourceUsage.add(c.ProcessState())
+	}
+}
+
+// ResourceUsage implements common.ResourceUsageReporter.
+func (s *executor) ResourceUsage() (*common.ResourceUsage, error) {
+	if s.resourceUsage == nil {
+		return nil, nil
+	}
+
+	return s.resourceUsage.get(), nil
+}
@@ -0,0 +1,35 @@
+//go:build aix || android || darwin || dragonfly || freebsd || hurd || illumos || linux || netbsd || openbsd || solaris
+
+package shell
+
+import (
+	"os"
+	"runtime"
+	"syscall"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+// rusageBlockSize is the size of the blocks counted by ru_inblock and
+// ru_oublock.
+const rusageBlockSize = 512
+
+const processStateUsageSupported = true
+
+func processStateUsage(state *os.ProcessState) (uint64, *common.ResourceUsageIO) {
+	rusage, ok := state.SysUsage().(*syscall.Rusage)
+	if !ok || rusage == nil {
+		return 0, nil
+	}
+
+	// ru_maxrss is reported in bytes on macOS and in kilobytes elsewhere
+	peakMemory := uint64(rusage.Maxrss)
+	if runtime.GOOS != "darwin" {
+		peakMemory *= 1024
+	}
+
+	return peakMemory, &common.ResourceUsageIO{
+		InBytes:  uint64(rusage.Inblock) * rusageBlockSize,
+		OutBytes: uint64(rusage.Oublock) * rusageBlockSize,
+	}
+}
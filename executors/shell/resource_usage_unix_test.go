@@ -0,0 +1,47 @@
+//go:build !integration && (aix || android || darwin || dragonfly || freebsd || hurd || illumos || linux || netbsd || openbsd || solaris)
+
+package shell
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/featureflags"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/process"
+)
+
+func TestExecutorResourceUsage(t *testing.T) {
+	e := &executor{
+		AbstractExecutor: executors.AbstractExecutor{
+			Build: &common.Build{Runner: &common.RunnerConfig{}},
+		},
+	}
+
+	e.setupResourceUsage()
+	e.recordResourceUsage(process.NewMockCommander(t))
+
+	usage, err := e.ResourceUsage()
+	assert.NoError(t, err)
+	assert.Nil(t, usage)
+
+	e.Build.Runner.FeatureFlags = map[string]bool{featureflags.ReportResourceUsage: true}
+	e.setupResourceUsage()
+
+	for i := 0; i < 2; i++ {
+		cmd := process.NewOSCmd("sh", []string{"-c", "true"}, process.CommandOptions{})
+		require.NoError(t, cmd.Start())
+		require.NoError(t, cmd.Wait())
+		e.recordResourceUsage(cmd)
+	}
+
+	usage, err = e.ResourceUsage()
+	require.NoError(t, err)
+	require.NotNil(t, usage)
+	assert.NotZero(t, usage.PeakMemoryBytes)
+	assert.NotNil(t, usage.Disk)
+	assert.Nil(t, usage.Network)
+}
@@ -0,0 +1,14 @@
+package shell
+
+import (
+	"os"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+// The memory and disk usage of processes isn't reported on Windows
+const processStateUsageSupported = false
+
+func processStateUsage(_ *os.ProcessState) (uint64, *common.ResourceUsageIO) {
+	return 0, nil
+}
@@ -0,0 +1,218 @@
+package shell
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/process"
+)
+
+const (
+	sandboxTmpDir = "/tmp"
+	// sandboxJobsDir is the directory of the builds directory containing the
+	// directories of the jobs run in the sandbox
+	sandboxJobsDir = ".sandbox"
+)
+
+var geteuid = os.Geteuid
+
+// sandbox runs the scripts of the job in new Linux namespaces and, when a
+// cgroup parent is configured, in a cgroup with the resource limits of the job
+type sandbox struct {
+	config *common.ShellSandboxConfig
+
+	// tmpDir is the private /tmp of the job, shared by its stages
+	tmpDir string
+	// bindDir is the only directory of the builds directory that the job can
+	// access, on which jobDir is mounted. It's the parent of the project
+	// directory, as the clone strategy removes the project directory, which
+	// can't be a mount point. The parent is shared with the other projects of
+	// the group, or is the builds directory itself with a custom clone path,
+	// so the job gets its own directory of the builds directory instead.
+	bindDir string
+	jobDir  string
+	// hiddenDirs and cacheDir, the cache directory of the runner, are hidden
+	// from all the stages of the job. Only the stages restoring and archiving
+	// the cache can access projectCacheDir, the cache directory of the project.
+	// The other stages, like get_sources which runs the hooks of the job, can't
+	// access the cache.
+	hiddenDirs      []string
+	cacheDir        string
+	projectCacheDir string
+
+	cgroup *process.Cgroup
+}
+
+func (s *executor) prepareSandbox() error {
+	config := s.Config.ShellSandbox
+	if config == nil || !config.Enabled {
+		return nil
+	}
+
+	if runtime.GOOS != "linux" {
+		return process.ErrSandboxNotSupported
+	}
+
+	// the root user of the sandbox is mapped to the user of the runner, a job
+	// of a runner running as root would be root on the host
+	if geteuid() == 0 {
+		return errors.New("the sandbox can't run the jobs of a runner running as root")
+	}
+
+	if s.Shell().User != "" {
+		return errors.New("the sandbox can't run the jobs as another user")
+	}
+
+	if s.Shell().RunnerCommand == "" {
+		return errors.New("the sandbox requires the path of the runner executable")
+	}
+
+	limits, err := config.GetCgroupLimits()
+	if err != nil {
+		return fmt.Errorf("sandbox: %w", err)
+	}
+
+	sb := &sandbox{
+		config:     config,
+		bindDir:    filepath.Dir(s.Build.BuildDir),
+		jobDir:     sandboxJobDir(s.Build.RootDir, s.Build.BuildDir),
+		hiddenDirs: config.GetHiddenDirs(),
+		cacheDir:   s.CacheDir(),
+	}
+
+	if sb.cacheDir != "" {
+		sb.projectCacheDir = s.Build.CacheDir
+	}
+
+	// the directory is created outside of the sandbox, where the builds
+	// directory isn't hidden
+	err = os.MkdirAll(sb.jobDir, 0o755)
+	if err != nil {
+		return fmt.Errorf("creating the builds directory of the job: %w", err)
+	}
+
+	if sb.projectCacheDir != "" {
+		err = os.MkdirAll(sb.projectCacheDir, 0o755)
+		if err != nil {
+			return fmt.Errorf("creating the cache directory of the project: %w", err)
+		}
+	}
+
+	sb.tmpDir, err = os.MkdirTemp("", "gitlab-runner-sandbox")
+	if err != nil {
+		return fmt.Errorf("creating the tmp directory of the job: %w", err)
+	}
+
+	if config.CgroupParent != "" {
+		sb.cgroup, err = process.NewCgroup(config.CgroupParent, fmt.Sprintf("job-%d", s.Build.ID), limits)
+		if err != nil {
+			_ = os.RemoveAll(sb.tmpDir)
+			return fmt.Errorf("sandbox: %w", err)
+		}
+	}
+
+	s.sandbox = sb
+
+	return nil
+}
+
+// command wraps the shell command of the stage with the init process of the
+// sandbox
+func (sb *sandbox) command(
+	runnerCommand string,
+	buildsDir string,
+	stage common.BuildStage,
+	shell string,
+	args []string,
+) (string, []string) {
+	initArgs := []string{
+		// the runtime platform of the runner isn't printed in the job log
+		"--log-level", "warn",
+		"sandbox-init",
+		"--tmp-dir", sb.tmpDir,
+		"--builds-dir", buildsDir,
+		"--bind-dir", sb.bindDir,
+		"--job-dir", sb.jobDir,
+	}
+
+	for _, dir := range sb.hiddenDirs {
+		initArgs = append(initArgs, "--hide-dir", dir)
+	}
+
+	if sb.cacheDir != "" {
+		initArgs = append(initArgs, "--cache-dir", sb.cacheDir)
+		if isCacheStage(stage) {
+			initArgs = append(initArgs, "--project-cache-dir", sb.projectCacheDir)
+		}
+	}
+
+	initArgs = append(initArgs, "--", shell)
+
+	return runnerCommand, append(initArgs, args...)
+}
+
+// options returns the namespaces and the cgroup of the stage, only the user
+// scripts are isolated from the network, as the other stages download the
+// sources, the cache and the artifacts
+func (sb *sandbox) options(stage common.BuildStage) *process.SandboxOptions {
+	return &process.SandboxOptions{
+		IsolateNetwork: sb.config.IsolateNetwork && isUserScriptStage(stage),
+		Cgroup:         sb.cgroup,
+	}
+}
+
+// scriptPath returns the path, in the sandbox, of a script file of the job's
+// tmp directory
+func (sb *sandbox) scriptPath(path string) string {
+	rel, err := filepath.Rel(sb.tmpDir, path)
+	if err != nil {
+		return path
+	}
+
+	return filepath.Join(sandboxTmpDir, rel)
+}
+
+// sandboxJobDir returns the directory of the builds directory mounted on the
+// parent of the project directory of the job. It's stable, for the fetch
+// strategy to reuse the project directory, and unique to the project directory
+// of the job, which can't contain the one of another job.
+func sandboxJobDir(buildsDir string, buildDir string) string {
+	return filepath.Join(buildsDir, sandboxJobsDir, fmt.Sprintf("%x", sha256.Sum256([]byte(buildDir))))
+}
+
+func (s *executor) cleanupSandbox() {
+	if s.sandbox == nil {
+		return
+	}
+
+	if s.sandbox.cgroup != nil {
+		err := s.sandbox.cgroup.Remove()
+		if err != nil {
+			s.BuildLogger.Warningln("Failed to remove the cgroup of the job:", err)
+		}
+	}
+
+	err := os.RemoveAll(s.sandbox.tmpDir)
+	if err != nil {
+		s.BuildLogger.Warningln("Failed to remove the tmp directory of the job:", err)
+	}
+}
+
+func isCacheStage(stage common.BuildStage) bool {
+	switch stage {
+	case common.BuildStageRestoreCache, common.BuildStageArchiveOnSuccessCache, common.BuildStageArchiveOnFailureCache:
+		return true
+	default:
+		return false
+	}
+}
+
+func isUserScriptStage(stage common.BuildStage) bool {
+	return stage == common.BuildStageAfterScript || strings.HasPrefix(string(stage), "step_")
+}
@@ -0,0 +1,234 @@
+//go:build !integration
+
+package shell
+
+import (
+	"context"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/process"
+)
+
+func newSandboxExecutor(t *testing.T, config *common.ShellSandboxConfig) *executor {
+	buildsDir := t.TempDir()
+
+	return &executor{
+		AbstractExecutor: executors.AbstractExecutor{
+			Build: &common.Build{
+				JobResponse: common.JobResponse{ID: 1234},
+				Runner:      &common.RunnerConfig{},
+				RootDir:     buildsDir,
+				BuildDir:    filepath.Join(buildsDir, "token", "0", "group", "project"),
+			},
+			Config: common.RunnerConfig{
+				RunnerSettings: common.RunnerSettings{ShellSandbox: config},
+			},
+			ExecutorOptions: executors.ExecutorOptions{
+				Shell: common.ShellScriptInfo{RunnerCommand: "/usr/bin/gitlab-runner"},
+			},
+			BuildShell: &common.ShellConfiguration{Command: "bash", Arguments: []string{"--login"}},
+		},
+	}
+}
+
+func TestExecutor_PrepareSandbox(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("sandbox is supported on Linux only")
+	}
+
+	oldGeteuid := geteuid
+	defer func() { geteuid = oldGeteuid }()
+
+	geteuid = func() int { return 1000 }
+
+	t.Run("sandbox disabled", func(t *testing.T) {
+		e := newSandboxExecutor(t, &common.ShellSandboxConfig{})
+
+		require.NoError(t, e.prepareSandbox())
+		assert.Nil(t, e.sandbox)
+	})
+
+	t.Run("runner running as root", func(t *testing.T) {
+		geteuid = func() int { return 0 }
+		defer func() { geteuid = func() int { return 1000 } }()
+
+		e := newSandboxExecutor(t, &common.ShellSandboxConfig{Enabled: true})
+
+		assert.EqualError(t, e.prepareSandbox(), "the sandbox can't run the jobs of a runner running as root")
+	})
+
+	t.Run("jobs run as another user", func(t *testing.T) {
+		e := newSandboxExecutor(t, &common.ShellSandboxConfig{Enabled: true})
+		e.Shell().User = "gitlab-runner"
+
+		assert.EqualError(t, e.prepareSandbox(), "the sandbox can't run the jobs as another user")
+	})
+
+	t.Run("limits without cgroup parent", func(t *testing.T) {
+		e := newSandboxExecutor(t, &common.ShellSandboxConfig{Enabled: true, PidsLimit: 100})
+
+		assert.EqualError(t, e.prepareSandbox(), "sandbox: cgroup_parent is required to limit the resources of the jobs")
+	})
+
+	t.Run("sandbox enabled", func(t *testing.T) {
+		e := newSandboxExecutor(t, &common.ShellSandboxConfig{
+			Enabled:    true,
+			HiddenDirs: []string{"/etc/ssl/private"},
+			ConfigDir:  "/etc/gitlab-runner",
+		})
+		e.Config.CacheDir = filepath.Join(e.Build.RootDir, "cache")
+		e.Build.CacheDir = filepath.Join(e.Config.CacheDir, "group", "project")
+
+		require.NoError(t, e.prepareSandbox())
+		require.NotNil(t, e.sandbox)
+
+		assert.Equal(t, filepath.Join(e.Build.RootDir, "token", "0", "group"), e.sandbox.bindDir)
+		assert.Equal(t, filepath.Join(e.Build.RootDir, ".sandbox"), filepath.Dir(e.sandbox.jobDir))
+		assert.Equal(t, []string{"/etc/gitlab-runner", "/etc/ssl/private"}, e.sandbox.hiddenDirs)
+		assert.Equal(t, e.Config.CacheDir, e.sandbox.cacheDir)
+		assert.Equal(t, e.Build.CacheDir, e.sandbox.projectCacheDir)
+		assert.DirExists(t, e.sandbox.jobDir)
+		assert.NoDirExists(t, e.sandbox.bindDir)
+		assert.DirExists(t, e.sandbox.projectCacheDir)
+		assert.DirExists(t, e.sandbox.tmpDir)
+		assert.Nil(t, e.sandbox.cgroup)
+
+		e.cleanupSandbox()
+		assert.NoDirExists(t, e.sandbox.tmpDir)
+	})
+}
+
+func TestExecutor_RunInSandbox(t *testing.T) {
+	hiddenCacheArgs := []string{"--hide-dir", "/etc/gitlab-runner", "--cache-dir", "/var/cache/gitlab-runner"}
+	projectCacheArgs := []string{
+		"--hide-dir", "/etc/gitlab-runner",
+		"--cache-dir", "/var/cache/gitlab-runner",
+		"--project-cache-dir", "/var/cache/gitlab-runner/group/project",
+	}
+
+	tests := map[string]struct {
+		stage                  common.BuildStage
+		hooks                  common.Hooks
+		expectedIsolateNetwork bool
+		expectedHiddenDirArgs  []string
+	}{
+		"user script": {
+			stage:                  "step_script",
+			expectedIsolateNetwork: true,
+			expectedHiddenDirArgs:  hiddenCacheArgs,
+		},
+		"after script": {
+			stage:                  common.BuildStageAfterScript,
+			expectedIsolateNetwork: true,
+			expectedHiddenDirArgs:  hiddenCacheArgs,
+		},
+		"get sources": {
+			stage:                  common.BuildStageGetSources,
+			expectedIsolateNetwork: false,
+			expectedHiddenDirArgs:  hiddenCacheArgs,
+		},
+		"get sources with a pre_get_sources_script hook": {
+			stage: common.BuildStageGetSources,
+			hooks: common.Hooks{
+				{Name: common.HookPreGetSourcesScript, Script: common.StepScript{"cp evil.zip /var/cache/gitlab-runner"}},
+			},
+			expectedIsolateNetwork: false,
+			expectedHiddenDirArgs:  hiddenCacheArgs,
+		},
+		"restore cache": {
+			stage:                  common.BuildStageRestoreCache,
+			expectedIsolateNetwork: false,
+			expectedHiddenDirArgs:  projectCacheArgs,
+		},
+		"archive cache": {
+			stage:                  common.BuildStageArchiveOnSuccessCache,
+			expectedIsolateNetwork: false,
+			expectedHiddenDirArgs:  projectCacheArgs,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			e := newSandboxExecutor(t, &common.ShellSandboxConfig{Enabled: true, IsolateNetwork: true})
+			e.sandbox = &sandbox{
+				config:          e.Config.ShellSandbox,
+				tmpDir:          "/var/tmp/sandbox",
+				bindDir:         filepath.Join(e.Build.RootDir, "token", "0", "group"),
+				jobDir:          filepath.Join(e.Build.RootDir, ".sandbox", "job"),
+				hiddenDirs:      []string{"/etc/gitlab-runner"},
+				cacheDir:        "/var/cache/gitlab-runner",
+				projectCacheDir: "/var/cache/gitlab-runner/group/project",
+			}
+			e.Build.Hooks = tt.hooks
+
+			mCmd := process.NewMockCommander(t)
+			mCmd.On("Start").Return(nil).Once()
+			mCmd.On("Wait").Return(nil).Once()
+			mCmd.On("ProcessState").Return(nil).Maybe()
+
+			oldCmd := newCommander
+			defer func() { newCommander = oldCmd }()
+
+			newCommander = func(executable string, args []string, options process.CommandOptions) process.Commander {
+				assert.Equal(t, "/usr/bin/gitlab-runner", executable)
+				expectedArgs := []string{
+					"--log-level", "warn",
+					"sandbox-init",
+					"--tmp-dir", "/var/tmp/sandbox",
+					"--builds-dir", e.Build.RootDir,
+					"--bind-dir", e.sandbox.bindDir,
+					"--job-dir", e.sandbox.jobDir,
+				}
+				expectedArgs = append(expectedArgs, tt.expectedHiddenDirArgs...)
+				expectedArgs = append(expectedArgs, "--", "bash", "--login")
+
+				assert.Equal(t, expectedArgs, args)
+				assert.Contains(t, options.Env, "TMPDIR=/tmp")
+
+				require.NotNil(t, options.Sandbox)
+				assert.Equal(t, tt.expectedIsolateNetwork, options.Sandbox.IsolateNetwork)
+
+				return mCmd
+			}
+
+			err := e.Run(common.ExecutorCommand{
+				Script:  "echo hello",
+				Stage:   tt.stage,
+				Context: context.Background(),
+			})
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestSandboxJobDir(t *testing.T) {
+	project := sandboxJobDir("/builds", "/builds/token/0/group/project")
+	group := sandboxJobDir("/builds", "/builds/token/0/group")
+	other := sandboxJobDir("/builds", "/builds/token/0/group/other")
+
+	// the directories of the jobs are stable, and the directory of a job can't
+	// contain the one of another job, even with a custom clone path
+	assert.Equal(t, project, sandboxJobDir("/builds", "/builds/token/0/group/project"))
+	for _, dir := range []string{project, group, other} {
+		assert.Equal(t, "/builds/.sandbox", filepath.Dir(dir))
+	}
+	assert.NotEqual(t, project, group)
+	assert.NotEqual(t, project, other)
+}
+
+func TestSandboxScriptPath(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("sandbox is supported on Linux only")
+	}
+
+	sb := &sandbox{tmpDir: "/var/tmp/sandbox"}
+
+	assert.Equal(t, "/tmp/build_script123/script.ps1", sb.scriptPath("/var/tmp/sandbox/build_script123/script.ps1"))
+}
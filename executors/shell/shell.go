@@ -23,6 +23,10 @@ var newCommander = process.NewOSCmd
 
 type executor struct {
 	executors.AbstractExecutor
+
+	resourceUsage *resourceUsageCollector
+
+	sandbox *sandbox
 }
 
 func (s *executor) Prepare(options common.ExecutorPrepareOptions) error {
@@ -54,6 +58,18 @@ func (s *executor) Prepare(options common.ExecutorPrepareOptions) error {
 		return err
 	}
 
+	s.setupResourceUsage()
+
+	err = s.prepareSandbox()
+	if err != nil {
+		return err
+	}
+
+	if s.sandbox != nil {
+		s.Println("Using Shell (" + s.Shell().Shell + ") executor in a sandbox...")
+		return nil
+	}
+
 	s.Println("Using Shell (" + s.Shell().Shell + ") executor...")
 	return nil
 }
@@ -76,8 +92,15 @@ func (s *executor) Run(cmd common.ExecutorCommand) error {
 
 	cmdOpts.Stdin = stdin
 
+	executable := s.BuildShell.Command
+	if s.sandbox != nil {
+		executable, args = s.sandbox.command(s.Shell().RunnerCommand, s.Build.RootDir, cmd.Stage, executable, args)
+		cmdOpts.Env = append(cmdOpts.Env, "TMPDIR="+sandboxTmpDir)
+		cmdOpts.Sandbox = s.sandbox.options(cmd.Stage)
+	}
+
 	// Create execution command
-	c := newCommander(s.BuildShell.Command, args, cmdOpts)
+	c := newCommander(executable, args, cmdOpts)
 
 	// Start a process
 	err = c.Start()
@@ -89,6 +112,7 @@ func (s *executor) Run(cmd common.ExecutorCommand) error {
 	waitCh := make(chan error, 1)
 	go func() {
 		waitErr := c.Wait()
+		s.recordResourceUsage(c)
 		var exitErr *exec.ExitError
 		if errors.As(waitErr, &exitErr) {
 			waitErr = &common.BuildError{Inner: waitErr, ExitCode: exitErr.ExitCode()}
@@ -112,7 +136,12 @@ func (s *executor) shellScriptArgs(cmd common.ExecutorCommand, args []string) (i
 		return strings.NewReader(cmd.Script), args, func() {}, nil
 	}
 
-	scriptDir, err := os.MkdirTemp("", "build_script")
+	tmpDir := ""
+	if s.sandbox != nil {
+		tmpDir = s.sandbox.tmpDir
+	}
+
+	scriptDir, err := os.MkdirTemp(tmpDir, "build_script")
 	if err != nil {
 		return nil, nil, func() {}, fmt.Errorf("creating tmp build script dir: %w", err)
 	}
@@ -130,9 +159,18 @@ func (s *executor) shellScriptArgs(cmd common.ExecutorCommand, args []string) (i
 		return nil, nil, cleanup, fmt.Errorf("writing script file: %w", err)
 	}
 
+	if s.sandbox != nil {
+		scriptFile = s.sandbox.scriptPath(scriptFile)
+	}
+
 	return nil, append(args, scriptFile), cleanup, nil
 }
 
+func (s *executor) Cleanup() {
+	s.cleanupSandbox()
+	s.AbstractExecutor.Cleanup()
+}
+
 func init() {
 	// Look for self
 	runnerCommand, err := os.Executable()
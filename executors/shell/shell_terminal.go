@@ -40,6 +40,10 @@ func (s *executor) Connect() (terminalsession.Conn, error) {
 		return nil, errors.New("not yet supported")
 	}
 
+	if s.sandbox != nil {
+		return nil, errors.New("not supported in the sandbox")
+	}
+
 	cmd := exec.Command(s.BuildShell.Command, s.BuildShell.Arguments...)
 	if cmd == nil {
 		return nil, errors.New("failed to generate shell command")
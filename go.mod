@@ -38,6 +38,7 @@ require (
 	github.com/kardianos/service v1.2.2
 	github.com/klauspost/compress v1.16.5
 	github.com/klauspost/pgzip v1.2.5
+	github.com/magefile/mage v1.15.0
 	github.com/minio/minio-go/v7 v7.0.59
 	github.com/prometheus/client_golang v1.13.0
 	github.com/prometheus/client_model v0.2.0
@@ -140,7 +141,6 @@ require (
 	github.com/kelseyhightower/envconfig v1.4.0 // indirect
 	github.com/klauspost/cpuid/v2 v2.2.4 // indirect
 	github.com/kylelemons/godebug v1.1.0 // indirect
-	github.com/magefile/mage v1.15.0 // indirect
 	github.com/mailru/easyjson v0.7.7 // indirect
 	github.com/masterzen/simplexml v0.0.0-20190410153822-31eea3082786 // indirect
 	github.com/masterzen/winrm v0.0.0-20220917170901-b07f6cb0598d // indirect
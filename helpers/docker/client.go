@@ -47,8 +47,13 @@ type Client interface {
 		condition container.WaitCondition,
 	) (<-chan container.WaitResponse, <-chan error)
 	ContainerLogs(ctx context.Context, container string, options types.ContainerLogsOptions) (io.ReadCloser, error)
+	ContainerStats(ctx context.Context, containerID string, stream bool) (types.ContainerStats, error)
 	ContainerExecCreate(ctx context.Context, container string, config types.ExecConfig) (types.IDResponse, error)
 	ContainerExecAttach(ctx context.Context, execID string, config types.ExecStartCheck) (types.HijackedResponse, error)
+	ContainerExecInspect(ctx context.Context, execID string) (types.ContainerExecInspect, error)
+
+	CheckpointCreate(ctx context.Context, container string, options types.CheckpointCreateOptions) error
+	CheckpointDelete(ctx context.Context, container string, options types.CheckpointDeleteOptions) error
 
 	NetworkCreate(
 		ctx context.Context,
@@ -56,6 +61,7 @@ type Client interface {
 		options types.NetworkCreate,
 	) (types.NetworkCreateResponse, error)
 	NetworkRemove(ctx context.Context, networkID string) error
+	NetworkConnect(ctx context.Context, networkID, containerID string, config *network.EndpointSettings) error
 	NetworkDisconnect(ctx context.Context, networkID, containerID string, force bool) error
 	NetworkList(ctx context.Context, options types.NetworkListOptions) ([]types.NetworkResource, error)
 	NetworkInspect(ctx context.Context, networkID string) (types.NetworkResource, error)
@@ -64,6 +70,8 @@ type Client interface {
 	VolumeRemove(ctx context.Context, volumeID string, force bool) error
 	VolumeInspect(ctx context.Context, volumeID string) (volume.Volume, error)
 
+	DiskUsage(ctx context.Context, options types.DiskUsageOptions) (types.DiskUsage, error)
+
 	Info(ctx context.Context) (types.Info, error)
 
 	Close() error
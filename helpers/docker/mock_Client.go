@@ -23,6 +23,34 @@ type MockClient struct {
 	mock.Mock
 }
 
+// CheckpointCreate provides a mock function with given fields: ctx, _a1, options
+func (_m *MockClient) CheckpointCreate(ctx context.Context, _a1 string, options types.CheckpointCreateOptions) error {
+	ret := _m.Called(ctx, _a1, options)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, types.CheckpointCreateOptions) error); ok {
+		r0 = rf(ctx, _a1, options)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
+// CheckpointDelete provides a mock function with given fields: ctx, _a1, options
+func (_m *MockClient) CheckpointDelete(ctx context.Context, _a1 string, options types.CheckpointDeleteOptions) error {
+	ret := _m.Called(ctx, _a1, options)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, types.CheckpointDeleteOptions) error); ok {
+		r0 = rf(ctx, _a1, options)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // ClientVersion provides a mock function with given fields:
 func (_m *MockClient) ClientVersion() string {
 	ret := _m.Called()
@@ -147,6 +175,30 @@ func (_m *MockClient) ContainerExecCreate(ctx context.Context, _a1 string, confi
 	return r0, r1
 }
 
+// ContainerExecInspect provides a mock function with given fields: ctx, execID
+func (_m *MockClient) ContainerExecInspect(ctx context.Context, execID string) (types.ContainerExecInspect, error) {
+	ret := _m.Called(ctx, execID)
+
+	var r0 types.ContainerExecInspect
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string) (types.ContainerExecInspect, error)); ok {
+		return rf(ctx, execID)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string) types.ContainerExecInspect); ok {
+		r0 = rf(ctx, execID)
+	} else {
+		r0 = ret.Get(0).(types.ContainerExecInspect)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string) error); ok {
+		r1 = rf(ctx, execID)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // ContainerInspect provides a mock function with given fields: ctx, containerID
 func (_m *MockClient) ContainerInspect(ctx context.Context, containerID string) (types.ContainerJSON, error) {
 	ret := _m.Called(ctx, containerID)
@@ -265,6 +317,30 @@ func (_m *MockClient) ContainerStart(ctx context.Context, containerID string, op
 	return r0
 }
 
+// ContainerStats provides a mock function with given fields: ctx, containerID, stream
+func (_m *MockClient) ContainerStats(ctx context.Context, containerID string, stream bool) (types.ContainerStats, error) {
+	ret := _m.Called(ctx, containerID, stream)
+
+	var r0 types.ContainerStats
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, bool) (types.ContainerStats, error)); ok {
+		return rf(ctx, containerID, stream)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, string, bool) types.ContainerStats); ok {
+		r0 = rf(ctx, containerID, stream)
+	} else {
+		r0 = ret.Get(0).(types.ContainerStats)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, string, bool) error); ok {
+		r1 = rf(ctx, containerID, stream)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // ContainerStop provides a mock function with given fields: ctx, containerID, opions
 func (_m *MockClient) ContainerStop(ctx context.Context, containerID string, opions container.StopOptions) error {
 	ret := _m.Called(ctx, containerID, opions)
@@ -307,6 +383,30 @@ func (_m *MockClient) ContainerWait(ctx context.Context, containerID string, con
 	return r0, r1
 }
 
+// DiskUsage provides a mock function with given fields: ctx, options
+func (_m *MockClient) DiskUsage(ctx context.Context, options types.DiskUsageOptions) (types.DiskUsage, error) {
+	ret := _m.Called(ctx, options)
+
+	var r0 types.DiskUsage
+	var r1 error
+	if rf, ok := ret.Get(0).(func(context.Context, types.DiskUsageOptions) (types.DiskUsage, error)); ok {
+		return rf(ctx, options)
+	}
+	if rf, ok := ret.Get(0).(func(context.Context, types.DiskUsageOptions) types.DiskUsage); ok {
+		r0 = rf(ctx, options)
+	} else {
+		r0 = ret.Get(0).(types.DiskUsage)
+	}
+
+	if rf, ok := ret.Get(1).(func(context.Context, types.DiskUsageOptions) error); ok {
+		r1 = rf(ctx, options)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // ImageImportBlocking provides a mock function with given fields: ctx, source, ref, options
 func (_m *MockClient) ImageImportBlocking(ctx context.Context, source types.ImageImportSource, ref string, options types.ImageImportOptions) error {
 	ret := _m.Called(ctx, source, ref, options)
@@ -392,6 +492,20 @@ func (_m *MockClient) Info(ctx context.Context) (types.Info, error) {
 	return r0, r1
 }
 
+// NetworkConnect provides a mock function with given fields: ctx, networkID, containerID, config
+func (_m *MockClient) NetworkConnect(ctx context.Context, networkID string, containerID string, config *network.EndpointSettings) error {
+	ret := _m.Called(ctx, networkID, containerID, config)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, *network.EndpointSettings) error); ok {
+		r0 = rf(ctx, networkID, containerID, config)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // NetworkCreate provides a mock function with given fields: ctx, networkName, options
 func (_m *MockClient) NetworkCreate(ctx context.Context, networkName string, options types.NetworkCreate) (types.NetworkCreateResponse, error) {
 	ret := _m.Called(ctx, networkName, options)
@@ -185,6 +185,16 @@ func (c *officialDockerClient) ContainerLogs(
 	return rc, wrapError("ContainerLogs", err, started)
 }
 
+func (c *officialDockerClient) ContainerStats(
+	ctx context.Context,
+	containerID string,
+	stream bool,
+) (types.ContainerStats, error) {
+	started := time.Now()
+	stats, err := c.client.ContainerStats(ctx, containerID, stream)
+	return stats, wrapError("ContainerStats", err, started)
+}
+
 func (c *officialDockerClient) ContainerExecCreate(
 	ctx context.Context,
 	container string,
@@ -205,6 +215,32 @@ func (c *officialDockerClient) ContainerExecAttach(
 	return resp, wrapError("ContainerExecAttach", err, started)
 }
 
+func (c *officialDockerClient) ContainerExecInspect(ctx context.Context, execID string) (types.ContainerExecInspect, error) {
+	started := time.Now()
+	resp, err := c.client.ContainerExecInspect(ctx, execID)
+	return resp, wrapError("ContainerExecInspect", err, started)
+}
+
+func (c *officialDockerClient) CheckpointCreate(
+	ctx context.Context,
+	container string,
+	options types.CheckpointCreateOptions,
+) error {
+	started := time.Now()
+	err := c.client.CheckpointCreate(ctx, container, options)
+	return wrapError("CheckpointCreate", err, started)
+}
+
+func (c *officialDockerClient) CheckpointDelete(
+	ctx context.Context,
+	container string,
+	options types.CheckpointDeleteOptions,
+) error {
+	started := time.Now()
+	err := c.client.CheckpointDelete(ctx, container, options)
+	return wrapError("CheckpointDelete", err, started)
+}
+
 func (c *officialDockerClient) NetworkCreate(
 	ctx context.Context,
 	networkName string,
@@ -221,6 +257,16 @@ func (c *officialDockerClient) NetworkRemove(ctx context.Context, networkID stri
 	return wrapError("NetworkRemove", err, started)
 }
 
+func (c *officialDockerClient) NetworkConnect(
+	ctx context.Context,
+	networkID, containerID string,
+	config *network.EndpointSettings,
+) error {
+	started := time.Now()
+	err := c.client.NetworkConnect(ctx, networkID, containerID, config)
+	return wrapError("NetworkConnect", err, started)
+}
+
 func (c *officialDockerClient) NetworkDisconnect(ctx context.Context, networkID, containerID string, force bool) error {
 	started := time.Now()
 	err := c.client.NetworkDisconnect(ctx, networkID, containerID, force)
@@ -263,6 +309,12 @@ func (c *officialDockerClient) VolumeInspect(ctx context.Context, volumeID strin
 	return v, wrapError("VolumeInspect", err, started)
 }
 
+func (c *officialDockerClient) DiskUsage(ctx context.Context, options types.DiskUsageOptions) (types.DiskUsage, error) {
+	started := time.Now()
+	usage, err := c.client.DiskUsage(ctx, options)
+	return usage, wrapError("DiskUsage", err, started)
+}
+
 func (c *officialDockerClient) Info(ctx context.Context) (types.Info, error) {
 	started := time.Now()
 	info, err := c.client.Info(ctx)
@@ -0,0 +1,117 @@
+package egress
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path"
+	"strings"
+)
+
+// DeniedMessage prefixes the lines logged by the proxy for every connection
+// denied by the policy, so that they can be reported in the job's trace.
+const DeniedMessage = "egress denied:"
+
+var ErrDenied = errors.New("destination isn't allowed by the egress policy")
+
+type resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+type dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// Policy allows connections to the hosts matching one of the allowed host
+// patterns, and to the IP addresses within one of the allowed CIDRs.
+type Policy struct {
+	cidrs []*net.IPNet
+	hosts []string
+
+	resolver resolver
+	dialer   dialer
+}
+
+// NewPolicy creates a policy from the allowed CIDRs and host patterns. The
+// host patterns support the * wildcard, for example *.example.com.
+func NewPolicy(cidrs []string, hosts []string) (*Policy, error) {
+	p := &Policy{
+		resolver: net.DefaultResolver,
+		dialer:   &net.Dialer{},
+	}
+
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("parsing allowed CIDR %q: %w", cidr, err)
+		}
+		p.cidrs = append(p.cidrs, ipNet)
+	}
+
+	for _, host := range hosts {
+		host = strings.ToLower(host)
+		if _, err := path.Match(host, ""); err != nil {
+			return nil, fmt.Errorf("parsing allowed host %q: %w", host, err)
+		}
+		p.hosts = append(p.hosts, host)
+	}
+
+	return p, nil
+}
+
+func (p *Policy) isHostAllowed(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, pattern := range p.hosts {
+		if ok, _ := path.Match(pattern, host); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *Policy) isIPAllowed(ip net.IP) bool {
+	for _, cidr := range p.cidrs {
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Dial connects to the address when it's allowed by the policy. When the host
+// is only allowed by its IP address, the connection is made to the checked
+// address, so that the name can't be resolved again to another address.
+func (p *Policy) Dial(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	if p.isHostAllowed(host) {
+		return p.dialer.DialContext(ctx, network, address)
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		if p.isIPAllowed(ip) {
+			return p.dialer.DialContext(ctx, network, address)
+		}
+
+		return nil, ErrDenied
+	}
+
+	addrs, err := p.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, addr := range addrs {
+		if p.isIPAllowed(addr.IP) {
+			return p.dialer.DialContext(ctx, network, net.JoinHostPort(addr.IP.String(), port))
+		}
+	}
+
+	return nil, ErrDenied
+}
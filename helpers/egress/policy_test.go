@@ -0,0 +1,101 @@
+//go:build !integration
+
+package egress
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeResolver map[string][]net.IPAddr
+
+func (r fakeResolver) LookupIPAddr(_ context.Context, host string) ([]net.IPAddr, error) {
+	addrs, ok := r[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+
+	return addrs, nil
+}
+
+type recordingDialer struct {
+	dialed []string
+}
+
+func (d *recordingDialer) DialContext(_ context.Context, _, address string) (net.Conn, error) {
+	d.dialed = append(d.dialed, address)
+	client, server := net.Pipe()
+	_ = server.Close()
+
+	return client, nil
+}
+
+func TestNewPolicyErrors(t *testing.T) {
+	_, err := NewPolicy([]string{"10.0.0.0"}, nil)
+	assert.ErrorContains(t, err, `parsing allowed CIDR "10.0.0.0"`)
+
+	_, err = NewPolicy(nil, []string{"[example.com"})
+	assert.ErrorContains(t, err, `parsing allowed host "[example.com"`)
+}
+
+func TestPolicyDial(t *testing.T) {
+	tests := map[string]struct {
+		address        string
+		expectedDialed string
+		expectedErr    error
+	}{
+		"allowed host": {
+			address:        "gitlab.example.com:443",
+			expectedDialed: "gitlab.example.com:443",
+		},
+		"allowed host with wildcard": {
+			address:        "Registry.Example.ORG:443",
+			expectedDialed: "Registry.Example.ORG:443",
+		},
+		"host resolved to allowed CIDR": {
+			address:        "postgres:5432",
+			expectedDialed: "172.18.0.3:5432",
+		},
+		"host resolved to denied IP": {
+			address:     "exfiltrate.example.net:443",
+			expectedErr: ErrDenied,
+		},
+		"allowed IP": {
+			address:        "172.18.0.5:80",
+			expectedDialed: "172.18.0.5:80",
+		},
+		"denied IP": {
+			address:     "8.8.8.8:53",
+			expectedErr: ErrDenied,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			p, err := NewPolicy([]string{"172.18.0.0/16"}, []string{"gitlab.example.com", "*.example.org"})
+			require.NoError(t, err)
+
+			d := &recordingDialer{}
+			p.dialer = d
+			p.resolver = fakeResolver{
+				"postgres":               {{IP: net.ParseIP("172.18.0.3")}},
+				"exfiltrate.example.net": {{IP: net.ParseIP("203.0.113.10")}},
+			}
+
+			conn, err := p.Dial(context.Background(), "tcp", tt.address)
+			if tt.expectedErr != nil {
+				assert.ErrorIs(t, err, tt.expectedErr)
+				assert.Empty(t, d.dialed)
+				return
+			}
+
+			require.NoError(t, err)
+			_ = conn.Close()
+			assert.Equal(t, []string{tt.expectedDialed}, d.dialed)
+		})
+	}
+}
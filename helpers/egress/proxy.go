@@ -0,0 +1,134 @@
+package egress
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+)
+
+// hopHeaders are the headers meant for the proxy, they're not forwarded
+var hopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Proxy-Connection",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// Proxy is an HTTP proxy that forwards the requests and tunnels the CONNECT
+// requests only to the destinations allowed by the policy. The denied
+// destinations are logged with DeniedMessage.
+type Proxy struct {
+	policy    *Policy
+	transport *http.Transport
+
+	logLock sync.Mutex
+	log     io.Writer
+}
+
+func NewProxy(policy *Policy, log io.Writer) *Proxy {
+	return &Proxy{
+		policy: policy,
+		transport: &http.Transport{
+			DialContext:       policy.Dial,
+			DisableKeepAlives: true,
+		},
+		log: log,
+	}
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		p.tunnel(w, r)
+		return
+	}
+
+	if r.URL.Host == "" {
+		http.Error(w, "only proxy requests are supported", http.StatusBadRequest)
+		return
+	}
+
+	p.forward(w, r)
+}
+
+func (p *Proxy) tunnel(w http.ResponseWriter, r *http.Request) {
+	upstream, err := p.policy.Dial(r.Context(), "tcp", r.Host)
+	if err != nil {
+		p.fail(w, r.Host, err)
+		return
+	}
+	defer upstream.Close()
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "tunneling isn't supported", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	client, _, err := hijacker.Hijack()
+	if err != nil {
+		return
+	}
+	defer client.Close()
+
+	done := make(chan struct{}, 2)
+	pipe := func(dst, src net.Conn) {
+		_, _ = io.Copy(dst, src)
+		done <- struct{}{}
+	}
+
+	go pipe(upstream, client)
+	go pipe(client, upstream)
+
+	<-done
+}
+
+func (p *Proxy) forward(w http.ResponseWriter, r *http.Request) {
+	req := r.Clone(r.Context())
+	req.RequestURI = ""
+	for _, header := range hopHeaders {
+		req.Header.Del(header)
+	}
+
+	resp, err := p.transport.RoundTrip(req)
+	if err != nil {
+		p.fail(w, r.URL.Host, err)
+		return
+	}
+	defer resp.Body.Close()
+
+	for _, header := range hopHeaders {
+		resp.Header.Del(header)
+	}
+
+	for key, values := range resp.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.Copy(w, resp.Body)
+}
+
+func (p *Proxy) fail(w http.ResponseWriter, destination string, err error) {
+	if !errors.Is(err, ErrDenied) {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	p.logLock.Lock()
+	_, _ = fmt.Fprintln(p.log, DeniedMessage, destination)
+	p.logLock.Unlock()
+
+	http.Error(w, fmt.Sprintf("%s: %s", destination, err), http.StatusForbidden)
+}
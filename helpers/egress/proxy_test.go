@@ -0,0 +1,91 @@
+//go:build !integration
+
+package egress
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestProxyClient(t *testing.T, allowedCIDRs []string) (*http.Client, *bytes.Buffer) {
+	policy, err := NewPolicy(allowedCIDRs, nil)
+	require.NoError(t, err)
+
+	log := new(bytes.Buffer)
+	proxy := httptest.NewServer(NewProxy(policy, log))
+	t.Cleanup(proxy.Close)
+
+	proxyURL, err := url.Parse(proxy.URL)
+	require.NoError(t, err)
+
+	return &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}, log
+}
+
+func TestProxyForward(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Empty(t, r.Header.Get("Proxy-Connection"))
+		_, _ = io.WriteString(w, "hello")
+	}))
+	defer upstream.Close()
+
+	t.Run("allowed", func(t *testing.T) {
+		client, log := newTestProxyClient(t, []string{"127.0.0.0/8"})
+
+		resp, err := client.Get(upstream.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+		assert.Equal(t, "hello", string(body))
+		assert.Empty(t, log.String())
+	})
+
+	t.Run("denied", func(t *testing.T) {
+		client, log := newTestProxyClient(t, []string{"10.0.0.0/8"})
+
+		resp, err := client.Get(upstream.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		assert.Equal(t, http.StatusForbidden, resp.StatusCode)
+		assert.Equal(t, DeniedMessage+" "+upstream.Listener.Addr().String()+"\n", log.String())
+	})
+}
+
+func TestProxyTunnel(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "hello")
+	}))
+	defer upstream.Close()
+
+	t.Run("allowed", func(t *testing.T) {
+		client, log := newTestProxyClient(t, []string{"127.0.0.0/8"})
+		client.Transport.(*http.Transport).TLSClientConfig = upstream.Client().Transport.(*http.Transport).TLSClientConfig
+
+		resp, err := client.Get(upstream.URL)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		assert.Equal(t, "hello", string(body))
+		assert.Empty(t, log.String())
+	})
+
+	t.Run("denied", func(t *testing.T) {
+		client, log := newTestProxyClient(t, nil)
+
+		_, err := client.Get(upstream.URL)
+		assert.ErrorContains(t, err, "Forbidden")
+		assert.Equal(t, DeniedMessage+" "+upstream.Listener.Addr().String()+"\n", log.String())
+	})
+}
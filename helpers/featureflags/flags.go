@@ -32,6 +32,7 @@ const (
 	SetPermissionsBeforeCleanup          string = "FF_SET_PERMISSIONS_BEFORE_CLEANUP"
 	EnableSecretResolvingFailsIfMissing  string = "FF_SECRET_RESOLVING_FAILS_IF_MISSING"
 	RetrievePodWarningEvents             string = "FF_RETRIEVE_POD_WARNING_EVENTS"
+	ReportResourceUsage                  string = "FF_REPORT_RESOURCE_USAGE"
 )
 
 type FeatureFlag struct {
@@ -264,6 +265,14 @@ var flags = []FeatureFlag{
 		Deprecated:   false,
 		Description:  "When enabled, all warning events associated with the Pod are retrieved when the job fails.",
 	},
+	{
+		Name:         ReportResourceUsage,
+		DefaultValue: false,
+		Deprecated:   false,
+		Description: "When enabled, the Docker, Kubernetes and Shell executors measure the peak memory, CPU time, " +
+			"disk I/O and network usage of the job, print a summary at the end of the job log and " +
+			"report them as Prometheus metrics.",
+	},
 }
 
 func GetAll() []FeatureFlag {
@@ -0,0 +1,131 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// cgroupCPUPeriod is the period, in microseconds, of the CPU quota of the
+	// cgroup
+	cgroupCPUPeriod = 100000
+
+	cgroupRemoveTimeout  = 5 * time.Second
+	cgroupRemoveInterval = 100 * time.Millisecond
+)
+
+// NewCgroup creates the cgroup in the parent cgroup directory, which must be
+// delegated to the current user, and sets its limits
+func NewCgroup(parent string, name string, limits CgroupLimits) (*Cgroup, error) {
+	var controllers []string
+	files := make(map[string]string)
+
+	if limits.NanoCPUs > 0 {
+		quota := limits.NanoCPUs * cgroupCPUPeriod / 1e9
+		controllers = append(controllers, "+cpu")
+		files["cpu.max"] = fmt.Sprintf("%d %d", quota, cgroupCPUPeriod)
+	}
+
+	if limits.MemoryBytes > 0 {
+		controllers = append(controllers, "+memory")
+		files["memory.max"] = strconv.FormatInt(limits.MemoryBytes, 10)
+		files["memory.swap.max"] = "0"
+	}
+
+	if limits.PidsLimit > 0 {
+		controllers = append(controllers, "+pids")
+		files["pids.max"] = strconv.FormatInt(limits.PidsLimit, 10)
+	}
+
+	if len(controllers) > 0 {
+		err := writeCgroupFile(parent, "cgroup.subtree_control", strings.Join(controllers, " "))
+		if err != nil {
+			return nil, fmt.Errorf("enabling cgroup controllers: %w", err)
+		}
+	}
+
+	c := &Cgroup{dir: filepath.Join(parent, name)}
+
+	err := os.Mkdir(c.dir, 0o755)
+	if err != nil && !errors.Is(err, os.ErrExist) {
+		return nil, fmt.Errorf("creating cgroup: %w", err)
+	}
+
+	for file, value := range files {
+		err = writeCgroupFile(c.dir, file, value)
+		if err != nil && (file != "memory.swap.max" || !errors.Is(err, os.ErrNotExist)) {
+			_ = c.Remove()
+			return nil, fmt.Errorf("setting cgroup limit: %w", err)
+		}
+	}
+
+	return c, nil
+}
+
+// Kill kills all the processes of the cgroup, with cgroup.kill when the kernel
+// supports it
+func (c *Cgroup) Kill() error {
+	err := writeCgroupFile(c.dir, "cgroup.kill", "1")
+	if err == nil || !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	procs, err := os.ReadFile(filepath.Join(c.dir, "cgroup.procs"))
+	if err != nil {
+		return fmt.Errorf("reading cgroup processes: %w", err)
+	}
+
+	for _, field := range strings.Fields(string(procs)) {
+		pid, err := strconv.Atoi(field)
+		if err != nil {
+			continue
+		}
+
+		_ = syscall.Kill(pid, syscall.SIGKILL)
+	}
+
+	return nil
+}
+
+// Remove kills the processes of the cgroup and removes it, once the killed
+// processes exited
+func (c *Cgroup) Remove() error {
+	err := c.Kill()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("killing cgroup processes: %w", err)
+	}
+
+	deadline := time.Now().Add(cgroupRemoveTimeout)
+	for {
+		err = os.Remove(c.dir)
+		if err == nil || errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		if !errors.Is(err, syscall.EBUSY) || time.Now().After(deadline) {
+			return fmt.Errorf("removing cgroup: %w", err)
+		}
+
+		time.Sleep(cgroupRemoveInterval)
+	}
+}
+
+func writeCgroupFile(dir string, file string, value string) error {
+	f, err := os.OpenFile(filepath.Join(dir, file), os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+
+	_, err = f.WriteString(value)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
@@ -0,0 +1,86 @@
+//go:build !integration
+
+package process
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFakeCgroupParent creates a parent cgroup with the control files of a job
+// cgroup, as the kernel does when the cgroup is created
+func newFakeCgroupParent(t *testing.T, name string, files ...string) string {
+	parent := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(parent, "cgroup.subtree_control"), nil, 0o600))
+	require.NoError(t, os.Mkdir(filepath.Join(parent, name), 0o755))
+
+	for _, file := range files {
+		require.NoError(t, os.WriteFile(filepath.Join(parent, name, file), nil, 0o600))
+	}
+
+	return parent
+}
+
+func readCgroupFile(t *testing.T, dir string, file string) string {
+	data, err := os.ReadFile(filepath.Join(dir, file))
+	require.NoError(t, err)
+
+	return string(data)
+}
+
+func TestNewCgroup(t *testing.T) {
+	parent := newFakeCgroupParent(t, "job-1", "cpu.max", "memory.max", "pids.max")
+
+	c, err := NewCgroup(parent, "job-1", CgroupLimits{
+		NanoCPUs:    1500000000,
+		MemoryBytes: 512 * 1024 * 1024,
+		PidsLimit:   100,
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, filepath.Join(parent, "job-1"), c.Dir())
+	assert.Equal(t, "+cpu +memory +pids", readCgroupFile(t, parent, "cgroup.subtree_control"))
+	assert.Equal(t, "150000 100000", readCgroupFile(t, c.Dir(), "cpu.max"))
+	assert.Equal(t, "536870912", readCgroupFile(t, c.Dir(), "memory.max"))
+	assert.Equal(t, "100", readCgroupFile(t, c.Dir(), "pids.max"))
+}
+
+func TestNewCgroupWithoutLimits(t *testing.T) {
+	parent := t.TempDir()
+
+	c, err := NewCgroup(parent, "job-1", CgroupLimits{})
+	require.NoError(t, err)
+	assert.DirExists(t, c.Dir())
+	assert.NoFileExists(t, filepath.Join(parent, "cgroup.subtree_control"))
+}
+
+func TestNewCgroupMissingController(t *testing.T) {
+	parent := newFakeCgroupParent(t, "job-1")
+
+	_, err := NewCgroup(parent, "job-1", CgroupLimits{PidsLimit: 100})
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.ErrorContains(t, err, "setting cgroup limit")
+	assert.NoDirExists(t, filepath.Join(parent, "job-1"))
+}
+
+func TestCgroupKill(t *testing.T) {
+	parent := newFakeCgroupParent(t, "job-1", "cgroup.kill")
+	c := &Cgroup{dir: filepath.Join(parent, "job-1")}
+
+	require.NoError(t, c.Kill())
+	assert.Equal(t, "1", readCgroupFile(t, c.Dir(), "cgroup.kill"))
+}
+
+func TestCgroupRemove(t *testing.T) {
+	parent := newFakeCgroupParent(t, "job-1")
+	c := &Cgroup{dir: filepath.Join(parent, "job-1")}
+
+	require.NoError(t, c.Remove())
+	assert.NoDirExists(t, c.Dir())
+
+	require.NoError(t, c.Remove(), "removing a removed cgroup")
+}
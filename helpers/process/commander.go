@@ -12,6 +12,7 @@ type Commander interface {
 	Start() error
 	Wait() error
 	Process() *os.Process
+	ProcessState() *os.ProcessState
 }
 
 type CommandOptions struct {
@@ -28,6 +29,9 @@ type CommandOptions struct {
 	ForceKillTimeout    time.Duration
 
 	UseWindowsLegacyProcessStrategy bool
+
+	// Sandbox starts the process in new namespaces, supported on Linux only
+	Sandbox *SandboxOptions
 }
 
 type osCmd struct {
@@ -54,6 +58,16 @@ func NewOSCmd(executable string, args []string, options CommandOptions) Commande
 func (c *osCmd) Start() error {
 	setProcessGroup(c.internal, c.options.UseWindowsLegacyProcessStrategy)
 
+	if c.options.Sandbox == nil {
+		return c.internal.Start()
+	}
+
+	cleanup, err := setSandbox(c.internal, *c.options.Sandbox)
+	if err != nil {
+		return err
+	}
+	defer cleanup()
+
 	return c.internal.Start()
 }
 
@@ -64,3 +78,7 @@ func (c *osCmd) Wait() error {
 func (c *osCmd) Process() *os.Process {
 	return c.internal.Process
 }
+
+func (c *osCmd) ProcessState() *os.ProcessState {
+	return c.internal.ProcessState
+}
@@ -29,6 +29,22 @@ func (_m *MockCommander) Process() *os.Process {
 	return r0
 }
 
+// ProcessState provides a mock function with given fields:
+func (_m *MockCommander) ProcessState() *os.ProcessState {
+	ret := _m.Called()
+
+	var r0 *os.ProcessState
+	if rf, ok := ret.Get(0).(func() *os.ProcessState); ok {
+		r0 = rf()
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*os.ProcessState)
+		}
+	}
+
+	return r0
+}
+
 // Start provides a mock function with given fields:
 func (_m *MockCommander) Start() error {
 	ret := _m.Called()
@@ -0,0 +1,70 @@
+package process
+
+import (
+	"errors"
+)
+
+var ErrSandboxNotSupported = errors.New("sandbox is supported on Linux only")
+
+// SandboxOptions defines the namespaces and the cgroup in which a process is
+// started.
+//
+// The process is started in new user, mount and PID namespaces, as the root
+// user of the user namespace mapped to the current user. As the process is
+// the init process of the PID namespace, killing its process group kills all
+// the processes of the namespace, even the ones that left the group.
+type SandboxOptions struct {
+	// IsolateNetwork starts the process in a new network namespace, which has
+	// only a loopback interface
+	IsolateNetwork bool
+
+	// Cgroup is the cgroup the process is started in, if any
+	Cgroup *Cgroup
+}
+
+// CgroupLimits are the resource limits of a cgroup, a zero value means no
+// limit
+type CgroupLimits struct {
+	NanoCPUs    int64
+	MemoryBytes int64
+	PidsLimit   int64
+}
+
+func (l CgroupLimits) IsEmpty() bool {
+	return l == CgroupLimits{}
+}
+
+// Cgroup is a cgroup v2 in which all the processes of a job are started, so
+// that they share the resource limits and can be killed together
+type Cgroup struct {
+	dir string
+}
+
+// Dir returns the directory of the cgroup
+func (c *Cgroup) Dir() string {
+	return c.dir
+}
+
+// SandboxMounts are the mounts that the init process of the sandbox sets up in
+// its mount namespace, before it executes the job
+type SandboxMounts struct {
+	// TmpDir is mounted on /tmp
+	TmpDir string
+
+	// BuildsDir is hidden by an empty tmpfs, in which JobDir is mounted on
+	// BindDir, a directory of BuildsDir. BindDir is mounted back if JobDir is
+	// empty. Nothing is hidden if BuildsDir is empty.
+	BuildsDir string
+	BindDir   string
+	JobDir    string
+
+	// CacheDir, the cache directory of the runner, is hidden by an empty
+	// tmpfs, in which ProjectCacheDir, the cache directory of the project, is
+	// mounted back. The whole CacheDir is hidden if ProjectCacheDir is empty.
+	CacheDir        string
+	ProjectCacheDir string
+
+	// HiddenDirs are hidden by empty read-only tmpfs. They can't contain BindDir
+	// nor /tmp, the ones that don't exist are ignored.
+	HiddenDirs []string
+}
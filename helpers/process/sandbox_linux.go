@@ -0,0 +1,326 @@
+package process
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+const cgroupMountPoint = "/sys/fs/cgroup"
+
+func setSandbox(c *exec.Cmd, options SandboxOptions) (func(), error) {
+	if c.SysProcAttr == nil {
+		c.SysProcAttr = &syscall.SysProcAttr{}
+	}
+
+	attr := c.SysProcAttr
+	// the cgroup of the process is the root of the new cgroup namespace
+	attr.Cloneflags |= syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID | syscall.CLONE_NEWCGROUP
+	if options.IsolateNetwork {
+		attr.Cloneflags |= syscall.CLONE_NEWNET
+	}
+
+	attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}}
+	attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}}
+	attr.GidMappingsEnableSetgroups = false
+
+	if options.Cgroup == nil {
+		return func() {}, nil
+	}
+
+	fd, err := syscall.Open(options.Cgroup.Dir(), syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("opening cgroup %s: %w", options.Cgroup.Dir(), err)
+	}
+
+	attr.UseCgroupFD = true
+	attr.CgroupFD = fd
+
+	return func() { _ = syscall.Close(fd) }, nil
+}
+
+// SetupSandboxMounts sets up the mounts of the sandbox in the mount namespace
+// of the current process, which must be the init process of the sandbox
+func SetupSandboxMounts(mounts SandboxMounts) error {
+	hiddenDirs := mounts.HiddenDirs
+	if mounts.CacheDir != "" {
+		hiddenDirs = append([]string{mounts.CacheDir}, hiddenDirs...)
+	}
+
+	for _, dir := range hiddenDirs {
+		err := checkHiddenDir(dir, mounts.BindDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	// the mounts mustn't propagate to the mount namespace of the runner
+	err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, "")
+	if err != nil {
+		return fmt.Errorf("making the mounts private: %w", err)
+	}
+
+	if mounts.BuildsDir != "" {
+		jobDir := mounts.JobDir
+		if jobDir == "" {
+			jobDir = mounts.BindDir
+		}
+
+		err = hideDirExcept(mounts.BuildsDir, mounts.BindDir, jobDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	if mounts.CacheDir != "" {
+		err = hideCacheDir(mounts.CacheDir, mounts.ProjectCacheDir)
+		if err != nil {
+			return err
+		}
+	}
+
+	if mounts.TmpDir != "" {
+		err = syscall.Mount(mounts.TmpDir, "/tmp", "", syscall.MS_BIND|syscall.MS_REC, "")
+		if err != nil {
+			return fmt.Errorf("mounting %s on /tmp: %w", mounts.TmpDir, err)
+		}
+	}
+
+	for _, dir := range mounts.HiddenDirs {
+		err = hideDir(dir)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = remountCgroupsReadOnly()
+	if err != nil {
+		return err
+	}
+
+	// /proc shows only the processes of the new PID namespace
+	err = syscall.Mount("proc", "/proc", "proc", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, "")
+	if err != nil {
+		return fmt.Errorf("mounting /proc: %w", err)
+	}
+
+	return nil
+}
+
+func hideCacheDir(cacheDir string, projectCacheDir string) error {
+	if projectCacheDir == "" {
+		return hideDir(cacheDir)
+	}
+
+	return hideDirExcept(cacheDir, projectCacheDir, projectCacheDir)
+}
+
+// hideDirExcept hides dir by an empty tmpfs, in which srcDir is mounted on
+// keepDir, a directory of dir
+func hideDirExcept(dir string, keepDir string, srcDir string) error {
+	rel, err := filepath.Rel(dir, keepDir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%s isn't a directory of %s", keepDir, dir)
+	}
+
+	// the directory is opened before it's hidden by the tmpfs, so that it can
+	// be mounted from its file descriptor
+	fd, err := syscall.Open(srcDir, unix.O_PATH|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("opening %s: %w", srcDir, err)
+	}
+	defer func() { _ = syscall.Close(fd) }()
+
+	err = syscall.Mount("tmpfs", dir, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "mode=755")
+	if err != nil {
+		return fmt.Errorf("hiding %s: %w", dir, err)
+	}
+
+	err = os.MkdirAll(keepDir, 0o755)
+	if err != nil {
+		return fmt.Errorf("creating %s: %w", keepDir, err)
+	}
+
+	err = syscall.Mount(fmt.Sprintf("/proc/self/fd/%d", fd), keepDir, "", syscall.MS_BIND|syscall.MS_REC, "")
+	if err != nil {
+		return fmt.Errorf("mounting %s: %w", keepDir, err)
+	}
+
+	return nil
+}
+
+// remountCgroupsReadOnly remounts the cgroup file systems read-only, so that
+// the job can't change the limits of its cgroup nor move out of it. The cgroup
+// files are owned by the runner user, the root user of the sandbox.
+func remountCgroupsReadOnly() error {
+	mountPoints, err := mountPointsIn(cgroupMountPoint)
+	if err != nil {
+		return err
+	}
+
+	for _, mountPoint := range mountPoints {
+		var stat unix.Statfs_t
+		err = unix.Statfs(mountPoint, &stat)
+		if err != nil {
+			return fmt.Errorf("getting the mount flags of %s: %w", mountPoint, err)
+		}
+
+		// the flags of the mounts of the runner's namespace are locked, the
+		// remount must keep them
+		flags := uintptr(syscall.MS_REMOUNT | syscall.MS_BIND | syscall.MS_RDONLY)
+		for statFlag, mountFlag := range map[int64]uintptr{
+			unix.ST_NOSUID:     syscall.MS_NOSUID,
+			unix.ST_NODEV:      syscall.MS_NODEV,
+			unix.ST_NOEXEC:     syscall.MS_NOEXEC,
+			unix.ST_NOATIME:    syscall.MS_NOATIME,
+			unix.ST_NODIRATIME: syscall.MS_NODIRATIME,
+			unix.ST_RELATIME:   syscall.MS_RELATIME,
+		} {
+			if stat.Flags&statFlag != 0 {
+				flags |= mountFlag
+			}
+		}
+
+		err = syscall.Mount("", mountPoint, "", flags, "")
+		if err != nil {
+			return fmt.Errorf("remounting %s read-only: %w", mountPoint, err)
+		}
+	}
+
+	return nil
+}
+
+// mountPointsIn returns the mount points of the current mount namespace that
+// are the directory or are in it
+func mountPointsIn(dir string) ([]string, error) {
+	data, err := os.ReadFile("/proc/self/mountinfo")
+	if err != nil {
+		return nil, fmt.Errorf("reading the mounts: %w", err)
+	}
+
+	// spaces, tabs, new lines and backslashes are escaped in octal
+	unescape := strings.NewReplacer(`\040`, " ", `\011`, "\t", `\012`, "\n", `\134`, `\`)
+
+	var mountPoints []string
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 5 {
+			continue
+		}
+
+		mountPoint := unescape.Replace(fields[4])
+		if isInDir(dir, mountPoint) {
+			mountPoints = append(mountPoints, mountPoint)
+		}
+	}
+
+	return mountPoints, nil
+}
+
+// DropCapabilities drops the capabilities that the root user of the user
+// namespace gets when it executes a program, so that the job can't unmount the
+// mounts of the sandbox. Capabilities are per thread, the calling thread must
+// be locked and execute the program of the job.
+func DropCapabilities() error {
+	data, err := os.ReadFile("/proc/sys/kernel/cap_last_cap")
+	if err != nil {
+		return fmt.Errorf("reading the last capability: %w", err)
+	}
+
+	lastCap, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return fmt.Errorf("parsing the last capability: %w", err)
+	}
+
+	for c := 0; c <= lastCap; c++ {
+		err = unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(c), 0, 0, 0)
+		if err != nil {
+			return fmt.Errorf("dropping capability %d from the bounding set: %w", c, err)
+		}
+	}
+
+	err = unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0)
+	if err != nil {
+		return fmt.Errorf("clearing the ambient capabilities: %w", err)
+	}
+
+	header := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	caps := make([]unix.CapUserData, 2)
+	err = unix.Capget(&header, &caps[0])
+	if err != nil {
+		return fmt.Errorf("getting the capabilities: %w", err)
+	}
+
+	caps[0].Inheritable, caps[1].Inheritable = 0, 0
+	err = unix.Capset(&header, &caps[0])
+	if err != nil {
+		return fmt.Errorf("clearing the inheritable capabilities: %w", err)
+	}
+
+	// the job can't get capabilities back from set-user-ID or file
+	// capabilities programs
+	err = unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0)
+	if err != nil {
+		return fmt.Errorf("setting no new privileges: %w", err)
+	}
+
+	return nil
+}
+
+// checkHiddenDir checks that hiding the directory doesn't hide the directories
+// that the job uses
+func checkHiddenDir(dir string, bindDir string) error {
+	for _, path := range []string{bindDir, "/tmp"} {
+		if path != "" && isInDir(evalSymlinks(dir), evalSymlinks(path)) {
+			return fmt.Errorf("%s can't be hidden, it contains %s", dir, path)
+		}
+	}
+
+	return nil
+}
+
+func hideDir(dir string) error {
+	info, err := os.Stat(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("hiding %s: %w", dir, err)
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("hiding %s: not a directory", dir)
+	}
+
+	err = syscall.Mount("tmpfs", dir, "tmpfs", syscall.MS_RDONLY|syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, "mode=755")
+	if err != nil {
+		return fmt.Errorf("hiding %s: %w", dir, err)
+	}
+
+	return nil
+}
+
+// isInDir checks if the path is the directory or one of its descendants
+func isInDir(dir string, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// evalSymlinks returns the path with its symbolic links evaluated, or the path
+// itself if it doesn't exist
+func evalSymlinks(path string) string {
+	resolved, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+
+	return resolved
+}
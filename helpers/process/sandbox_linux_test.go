@@ -0,0 +1,288 @@
+//go:build !integration
+
+package process
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	sandboxTestMountsEnv = "SANDBOX_TEST_MOUNTS"
+	sandboxTestScriptEnv = "SANDBOX_TEST_SCRIPT"
+)
+
+// TestMain runs the test binary as the init process of a sandbox when it's
+// started by runInSandbox
+func TestMain(m *testing.M) {
+	if mounts := os.Getenv(sandboxTestMountsEnv); mounts != "" {
+		sandboxTestInit(mounts, os.Getenv(sandboxTestScriptEnv))
+	}
+
+	os.Exit(m.Run())
+}
+
+func sandboxTestInit(data string, script string) {
+	var mounts SandboxMounts
+	err := json.Unmarshal([]byte(data), &mounts)
+	if err == nil {
+		err = SetupSandboxMounts(mounts)
+	}
+
+	runtime.LockOSThread()
+
+	if err == nil {
+		err = DropCapabilities()
+	}
+
+	if err == nil {
+		err = syscall.Exec("/bin/sh", []string{"sh", "-c", script}, os.Environ())
+	}
+
+	fmt.Fprintln(os.Stderr, "sandbox init:", err)
+	os.Exit(2)
+}
+
+// runInSandbox runs the script in a sandbox set up by SetupSandboxMounts, and
+// returns its output
+func runInSandbox(t *testing.T, options SandboxOptions, mounts SandboxMounts, script string) string {
+	data, err := json.Marshal(mounts)
+	require.NoError(t, err)
+
+	out := new(bytes.Buffer)
+	cmd := NewOSCmd(os.Args[0], nil, CommandOptions{
+		Env:     append(os.Environ(), sandboxTestMountsEnv+"="+string(data), sandboxTestScriptEnv+"="+script),
+		Stdout:  out,
+		Stderr:  out,
+		Sandbox: &options,
+	})
+
+	err = cmd.Start()
+	if errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EINVAL) || errors.Is(err, syscall.ENOSPC) {
+		t.Skip("user namespaces aren't available:", err)
+	}
+	require.NoError(t, err)
+	require.NoError(t, cmd.Wait(), out.String())
+
+	return out.String()
+}
+
+func TestSetSandbox(t *testing.T) {
+	for _, isolateNetwork := range []bool{true, false} {
+		cmd := exec.Command("sleep", "1")
+		setProcessGroup(cmd, false)
+
+		cleanup, err := setSandbox(cmd, SandboxOptions{IsolateNetwork: isolateNetwork})
+		require.NoError(t, err)
+		cleanup()
+
+		attr := cmd.SysProcAttr
+		assert.True(t, attr.Setpgid)
+		assert.NotZero(t, attr.Cloneflags&syscall.CLONE_NEWUSER)
+		assert.NotZero(t, attr.Cloneflags&syscall.CLONE_NEWNS)
+		assert.NotZero(t, attr.Cloneflags&syscall.CLONE_NEWPID)
+		assert.NotZero(t, attr.Cloneflags&syscall.CLONE_NEWCGROUP)
+		assert.Equal(t, isolateNetwork, attr.Cloneflags&syscall.CLONE_NEWNET != 0)
+		assert.Equal(t, 0, attr.UidMappings[0].ContainerID)
+		assert.False(t, attr.UseCgroupFD)
+	}
+}
+
+func TestOSCmdSandbox(t *testing.T) {
+	out := new(bytes.Buffer)
+
+	cmd := NewOSCmd("sh", []string{"-c", `echo "$$ $(id -u) $(grep -c : /proc/net/dev)"`}, CommandOptions{
+		Stdout:  out,
+		Sandbox: &SandboxOptions{IsolateNetwork: true},
+	})
+
+	err := cmd.Start()
+	if errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EINVAL) || errors.Is(err, syscall.ENOSPC) {
+		t.Skip("user namespaces aren't available:", err)
+	}
+	require.NoError(t, err)
+	require.NoError(t, cmd.Wait())
+
+	// the shell is the init process of the PID namespace, run as root of the
+	// user namespace, and the network namespace has only a loopback interface
+	assert.Equal(t, "1 0 1", strings.TrimSpace(out.String()))
+}
+
+func TestCheckHiddenDir(t *testing.T) {
+	assert.NoError(t, checkHiddenDir("/etc/gitlab-runner", "/builds/token/0/group"))
+	assert.NoError(t, checkHiddenDir("/builds/token/0/group/project/.cache", "/builds/token/0/group"))
+	assert.NoError(t, checkHiddenDir("/etc/gitlab-runner", ""))
+
+	assert.EqualError(
+		t,
+		checkHiddenDir("/builds/token", "/builds/token/0/group"),
+		"/builds/token can't be hidden, it contains /builds/token/0/group",
+	)
+	assert.EqualError(
+		t,
+		checkHiddenDir("/builds/token/0/group/", "/builds/token/0/group"),
+		"/builds/token/0/group/ can't be hidden, it contains /builds/token/0/group",
+	)
+	assert.EqualError(t, checkHiddenDir("/", ""), "/ can't be hidden, it contains /tmp")
+}
+
+func TestSandboxMountsHiddenDirs(t *testing.T) {
+	dir := t.TempDir()
+
+	buildsDir := filepath.Join(dir, "builds")
+	bindDir := filepath.Join(buildsDir, "token", "0", "group")
+	configDir := filepath.Join(dir, "config")
+
+	require.NoError(t, os.MkdirAll(bindDir, 0o755))
+	require.NoError(t, os.MkdirAll(filepath.Join(buildsDir, "token", "1"), 0o755))
+	require.NoError(t, os.MkdirAll(configDir, 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(configDir, "config.toml"), []byte("token"), 0o600))
+
+	mounts := SandboxMounts{
+		BuildsDir:  buildsDir,
+		BindDir:    bindDir,
+		HiddenDirs: []string{configDir, filepath.Join(dir, "missing")},
+	}
+
+	// the job can't unmount the tmpfs hiding the directories, as it has no
+	// capabilities
+	out := runInSandbox(t, SandboxOptions{}, mounts, fmt.Sprintf(
+		`ls %[2]s/token; ls -A %[1]s; touch %[1]s/file 2>/dev/null || echo read-only; umount %[1]s 2>/dev/null || echo locked; ls -A %[1]s`,
+		configDir, buildsDir,
+	))
+
+	assert.Equal(t, "0\nread-only\nlocked\n", out)
+}
+
+func TestSandboxMountsJobDir(t *testing.T) {
+	dir := t.TempDir()
+
+	buildsDir := filepath.Join(dir, "builds")
+	bindDir := filepath.Join(buildsDir, "token", "0", "group")
+	jobDir := filepath.Join(buildsDir, ".sandbox", "job")
+
+	require.NoError(t, os.MkdirAll(filepath.Join(jobDir, "project"), 0o755))
+	require.NoError(t, os.MkdirAll(filepath.Join(bindDir, "other"), 0o755))
+
+	mounts := SandboxMounts{
+		BuildsDir: buildsDir,
+		BindDir:   bindDir,
+		JobDir:    jobDir,
+	}
+
+	// the other projects of the group are hidden, and the project directory
+	// can be removed by the clone strategy
+	out := runInSandbox(t, SandboxOptions{}, mounts, fmt.Sprintf(
+		`ls -A %[1]s; ls %[2]s; rm -r %[2]s/project && mkdir %[2]s/project && echo cloned`,
+		buildsDir, bindDir,
+	))
+
+	assert.Equal(t, "token\nproject\ncloned\n", out)
+	assert.DirExists(t, filepath.Join(jobDir, "project"))
+	assert.NoDirExists(t, filepath.Join(jobDir, "other"))
+}
+
+func TestSandboxMountsCacheDir(t *testing.T) {
+	dir := t.TempDir()
+
+	cacheDir := filepath.Join(dir, "cache")
+	projectCacheDir := filepath.Join(cacheDir, "group", "project")
+
+	require.NoError(t, os.MkdirAll(projectCacheDir, 0o755))
+	require.NoError(t, os.MkdirAll(filepath.Join(cacheDir, "group", "other"), 0o755))
+
+	t.Run("cache stage", func(t *testing.T) {
+		mounts := SandboxMounts{CacheDir: cacheDir, ProjectCacheDir: projectCacheDir}
+
+		out := runInSandbox(t, SandboxOptions{}, mounts, fmt.Sprintf(
+			`ls %[1]s/group; touch %[2]s/cache.zip && echo written`,
+			cacheDir, projectCacheDir,
+		))
+
+		assert.Equal(t, "project\nwritten\n", out)
+		assert.FileExists(t, filepath.Join(projectCacheDir, "cache.zip"))
+	})
+
+	t.Run("other stage", func(t *testing.T) {
+		mounts := SandboxMounts{CacheDir: cacheDir}
+
+		out := runInSandbox(t, SandboxOptions{}, mounts, fmt.Sprintf(
+			`ls -A %[1]s; touch %[1]s/cache.zip 2>/dev/null || echo read-only`,
+			cacheDir,
+		))
+
+		assert.Equal(t, "read-only\n", out)
+	})
+}
+
+// cgroup2Dir returns the directory of the cgroup v2 of the current process
+func cgroup2Dir(t *testing.T) string {
+	mountInfo, err := os.ReadFile("/proc/self/mountinfo")
+	require.NoError(t, err)
+
+	var mountPoint string
+	for _, line := range strings.Split(string(mountInfo), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) > 8 && fields[len(fields)-3] == "cgroup2" {
+			mountPoint = fields[4]
+			break
+		}
+	}
+
+	cgroups, err := os.ReadFile("/proc/self/cgroup")
+	require.NoError(t, err)
+
+	for _, line := range strings.Split(string(cgroups), "\n") {
+		if mountPoint != "" && strings.HasPrefix(line, "0::") {
+			return filepath.Join(mountPoint, strings.TrimPrefix(line, "0::"))
+		}
+	}
+
+	t.Skip("cgroup v2 isn't mounted")
+	return ""
+}
+
+func TestSandboxCgroupReadOnly(t *testing.T) {
+	parent := cgroup2Dir(t)
+
+	c, err := NewCgroup(parent, fmt.Sprintf("sandbox-test-%d", os.Getpid()), CgroupLimits{})
+	if err != nil {
+		t.Skip("cgroup v2 isn't writable:", err)
+	}
+	defer func() { assert.NoError(t, c.Remove()) }()
+
+	// the cgroup files are writable by the runner user outside of the sandbox
+	require.NoError(t, os.WriteFile(filepath.Join(c.Dir(), "cgroup.max.depth"), []byte("5"), 0o644))
+
+	// the job is in the root of its cgroup namespace, and can neither change
+	// its cgroup nor move out of it
+	out := runInSandbox(t, SandboxOptions{Cgroup: c}, SandboxMounts{}, fmt.Sprintf(
+		`grep ^0:: /proc/self/cgroup; (echo 1 > %[1]s/cgroup.max.depth) 2>/dev/null || echo read-only; (echo $$ > %[2]s/cgroup.procs) 2>/dev/null || echo read-only`,
+		c.Dir(), parent,
+	))
+
+	assert.Equal(t, "0::/\nread-only\nread-only\n", out)
+	assert.Equal(t, "5", strings.TrimSpace(readCgroupFile(t, c.Dir(), "cgroup.max.depth")))
+}
+
+func TestMountPointsIn(t *testing.T) {
+	mountPoints, err := mountPointsIn("/proc")
+	require.NoError(t, err)
+	assert.Contains(t, mountPoints, "/proc")
+
+	for _, mountPoint := range mountPoints {
+		assert.True(t, isInDir("/proc", mountPoint), mountPoint)
+	}
+}
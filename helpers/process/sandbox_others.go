@@ -0,0 +1,31 @@
+//go:build !linux
+
+package process
+
+import (
+	"os/exec"
+)
+
+func setSandbox(_ *exec.Cmd, _ SandboxOptions) (func(), error) {
+	return nil, ErrSandboxNotSupported
+}
+
+func NewCgroup(_ string, _ string, _ CgroupLimits) (*Cgroup, error) {
+	return nil, ErrSandboxNotSupported
+}
+
+func (c *Cgroup) Kill() error {
+	return ErrSandboxNotSupported
+}
+
+func (c *Cgroup) Remove() error {
+	return ErrSandboxNotSupported
+}
+
+func SetupSandboxMounts(_ SandboxMounts) error {
+	return ErrSandboxNotSupported
+}
+
+func DropCapabilities() error {
+	return ErrSandboxNotSupported
+}